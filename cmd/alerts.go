@@ -0,0 +1,200 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/ricomonster/black-flag/internal/alerts"
+	"github.com/ricomonster/black-flag/internal/config"
+	"github.com/ricomonster/black-flag/internal/notify"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/spf13/cobra"
+)
+
+// alertsCmd represents the alerts command
+var (
+	alertRule alerts.Rule
+	alertType string
+	alertsCmd = &cobra.Command{
+		Use:   "alerts",
+		Short: "Manages the alert rules evaluated after every new sample",
+	}
+	alertsListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists the alert rules from the config file and the store",
+		Run: func(_ *cobra.Command, _ []string) {
+			rules, err := loadAlertRules()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			t := table.NewWriter()
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"Id", "Type", "Threshold", "Window", "Cooldown", "Scope", "Notify", "Source"})
+
+			for _, rule := range rules {
+				scope := "all videos"
+				if rule.Video != "" {
+					scope = "video " + rule.Video
+				} else if rule.Channel != "" {
+					scope = "channel " + rule.Channel
+				}
+
+				notifiers := "all"
+				if len(rule.Notify) > 0 {
+					notifiers = strings.Join(rule.Notify, ", ")
+				}
+
+				t.AppendRow(table.Row{rule.Id, rule.Type, rule.Threshold, rule.Window, rule.CooldownOrDefault(), scope, notifiers, rule.Source})
+			}
+
+			t.Render()
+		},
+	}
+	alertsAddCmd = &cobra.Command{
+		Use:   "add",
+		Short: "Saves an alert rule to the store",
+		Run: func(_ *cobra.Command, _ []string) {
+			alertRule.Type = alerts.RuleType(alertType)
+
+			ruleStore, err := alerts.NewRuleStore()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			if err := ruleStore.SaveRule(alertRule); err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			fmt.Printf("Alert rule \"%s\" was saved.\n", alertRule.Id)
+		},
+	}
+	alertsRemoveCmd = &cobra.Command{
+		Use:   "remove",
+		Short: "Removes an alert rule from the store",
+		Run: func(_ *cobra.Command, _ []string) {
+			ruleStore, err := alerts.NewRuleStore()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			if err := ruleStore.DeleteRule(alertRule.Id); err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			fmt.Printf("Alert rule \"%s\" was removed.\n", alertRule.Id)
+		},
+	}
+)
+
+// Rules from the config file and the store combined
+func loadAlertRules() ([]alerts.Rule, error) {
+	rules, err := alerts.ConfigRules()
+	if err != nil {
+		return nil, err
+	}
+
+	ruleStore, err := alerts.NewRuleStore()
+	if err != nil {
+		return nil, err
+	}
+
+	storedRules, err := ruleStore.GetRules()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(rules, storedRules...), nil
+}
+
+// Notifiers declared under notifiers in the config file
+func loadNotifiers() (map[string]notify.Notifier, error) {
+	var notifierConfigs []notify.Config
+	if err := config.UnmarshalKey("notifiers", &notifierConfigs); err != nil {
+		return nil, err
+	}
+
+	return notify.NewNotifiers(notifierConfigs)
+}
+
+// Evaluates the alert rules after every new sample recorded by the video lib
+func setupAlerts(videoLib interface {
+	OnSample(func(videos.VideoDdbAttributes))
+}, logger *slog.Logger) error {
+	rules, err := alerts.ConfigRules()
+	if err != nil {
+		return err
+	}
+
+	ruleStore, err := alerts.NewRuleStore()
+	if err != nil {
+		return err
+	}
+
+	// The rules table is optional, not having one shouldn't stop us from refreshing the videos
+	storedRules, err := ruleStore.GetRules()
+	if err != nil {
+		logger.Warn("unable to read the alert rules from the store", "error", err)
+	}
+	rules = append(rules, storedRules...)
+
+	if len(rules) == 0 {
+		return nil
+	}
+
+	notifiers, err := loadNotifiers()
+	if err != nil {
+		return err
+	}
+
+	// Alerts shouldn't get lost silently
+	if len(notifiers) == 0 {
+		notifiers["log"] = notify.NewLog(notify.Config{Name: "log"})
+	}
+
+	stateStore, err := alerts.NewStateStore()
+	if err != nil {
+		return err
+	}
+
+	engine, err := alerts.NewEngine(rules, notifiers, stateStore, logger)
+	if err != nil {
+		return err
+	}
+
+	videoLib.OnSample(engine.Evaluate)
+
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(alertsCmd)
+	alertsCmd.AddCommand(alertsListCmd, alertsAddCmd, alertsRemoveCmd)
+
+	// alerts add --id=million --type=milestone --threshold=1000000
+	alertsAddCmd.Flags().StringVar(&alertRule.Id, "id", "", "Unique name of the rule.")
+	alertsAddCmd.Flags().StringVar(&alertType, "type", "", "One of milestone, delta, percent, stalled or anomaly.")
+	alertsAddCmd.Flags().Float64Var(&alertRule.Threshold, "threshold", 0, "Views for milestone and delta, percent for percent, max gain for stalled, score for anomaly.")
+	alertsAddCmd.Flags().DurationVar(&alertRule.Window, "window", 0, "Window for delta, percent and stalled rules, e.g. 1h.")
+	alertsAddCmd.Flags().DurationVar(&alertRule.Cooldown, "cooldown", 0, "Minimum time between two alerts for the same video.")
+	alertsAddCmd.Flags().StringVar(&alertRule.Video, "video", "", "Limits the rule to a video.")
+	alertsAddCmd.Flags().StringVar(&alertRule.Channel, "channel", "", "Limits the rule to a channel id.")
+	alertsAddCmd.Flags().StringSliceVar(&alertRule.Notify, "notify", []string{}, "Notifiers to send the alert to, all notifiers when empty.")
+	_ = alertsAddCmd.MarkFlagRequired("id")
+	_ = alertsAddCmd.MarkFlagRequired("type")
+
+	// alerts remove --id=million
+	alertsRemoveCmd.Flags().StringVar(&alertRule.Id, "id", "", "Id of the rule to remove.")
+	_ = alertsRemoveCmd.MarkFlagRequired("id")
+}
@@ -0,0 +1,146 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/ricomonster/black-flag/internal/anomaly"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/spf13/cobra"
+)
+
+// The shape of an anomaly when rendered as JSON
+type anomalyOutput struct {
+	Id       string    `json:"id"`
+	Title    string    `json:"title"`
+	Channel  string    `json:"channel"`
+	At       time.Time `json:"at"`
+	Kind     string    `json:"kind"`
+	Rate     float64   `json:"rate"`
+	Baseline float64   `json:"baseline"`
+	Score    float64   `json:"score"`
+	Seasonal bool      `json:"seasonal"`
+}
+
+// anomaliesCmd represents the anomalies command
+var (
+	anomaliesSince     time.Duration
+	anomaliesThreshold float64
+	anomaliesOutput    string
+	anomaliesCmd       = &cobra.Command{
+		Use:   "anomalies",
+		Short: "Lists the recent spikes and drops in views across all videos",
+		Run: func(_ *cobra.Command, _ []string) {
+			if err := validateOutput(anomaliesOutput); err != nil {
+				fmt.Println(err)
+				os.Exit(0)
+			}
+
+			// Instantiate the video lib
+			videoLib, err := videos.NewVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			allVideos, err := videoLib.GetVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			since := time.Now().Add(-anomaliesSince).Unix()
+
+			var found []anomaly.Anomaly
+			for _, item := range allVideos {
+				for _, a := range anomaly.Detect(item, anomaly.Options{Threshold: anomaliesThreshold}) {
+					if a.Timestamp >= since {
+						found = append(found, a)
+					}
+				}
+			}
+
+			// Strongest first
+			sort.Slice(found, func(i, j int) bool {
+				return math.Abs(found[i].Score) > math.Abs(found[j].Score)
+			})
+
+			if anomaliesOutput == "json" {
+				rows := []anomalyOutput{}
+				for _, a := range found {
+					rows = append(rows, newAnomalyOutput(a))
+				}
+
+				if err := renderJSON(os.Stdout, rows); err != nil {
+					fmt.Printf("Something went wrong %v", err)
+				}
+				return
+			}
+
+			if len(found) == 0 {
+				fmt.Printf("No anomalies in the last %s.\n", anomaliesSince)
+				return
+			}
+
+			t := table.NewWriter()
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"Title and Channel", "At", "Kind", "Views/h", "Usual/h", "Score"})
+
+			for _, a := range found {
+				t.AppendRow(table.Row{
+					fmt.Sprintf("%s\n%s", a.Video.Title, a.Video.Channel.Title),
+					time.Unix(a.Timestamp, 0).Local().Format(time.DateTime),
+					a.Kind,
+					fmt.Sprintf("%.0f", a.Rate),
+					fmt.Sprintf("%.0f", a.Baseline),
+					fmt.Sprintf("%.1f", a.Score),
+				})
+				t.AppendSeparator()
+			}
+
+			t.Render()
+		},
+	}
+)
+
+func newAnomalyOutput(a anomaly.Anomaly) anomalyOutput {
+	return anomalyOutput{
+		Id:       a.Video.Id,
+		Title:    a.Video.Title,
+		Channel:  a.Video.Channel.Title,
+		At:       time.Unix(a.Timestamp, 0).Local(),
+		Kind:     string(a.Kind),
+		Rate:     a.Rate,
+		Baseline: a.Baseline,
+		Score:    a.Score,
+		Seasonal: a.Seasonal,
+	}
+}
+
+// Human readable description of an anomaly
+func describeAnomaly(a anomaly.Anomaly) string {
+	return fmt.Sprintf(
+		"%s at %s, %.0f/h against the usual %.0f/h",
+		a.Kind, time.Unix(a.Timestamp, 0).Local().Format(time.DateTime), a.Rate, a.Baseline,
+	)
+}
+
+func init() {
+	rootCmd.AddCommand(anomaliesCmd)
+
+	// anomalies --since=24h
+	anomaliesCmd.Flags().DurationVar(&anomaliesSince, "since", 24*time.Hour, "Only lists anomalies within this period.")
+
+	// anomalies --threshold=3.5
+	anomaliesCmd.Flags().Float64Var(&anomaliesThreshold, "threshold", anomaly.DEFAULT_THRESHOLD, "How far from the usual views per hour a sample has to be.")
+
+	// anomalies --output=json
+	anomaliesCmd.Flags().StringVarP(&anomaliesOutput, "output", "o", "table", "Output format, either table or json.")
+}
@@ -0,0 +1,129 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/alerts"
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb"
+	"github.com/ricomonster/black-flag/internal/backup"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/spf13/cobra"
+)
+
+// backupCmd represents the backup command
+var (
+	backupOut        string
+	backupPassphrase string
+	backupCmd        = &cobra.Command{
+		Use:   "backup",
+		Short: "Writes a compressed and checksummed archive of every video, sample and alert",
+		Long: `Writes a compressed and checksummed archive of every video, sample and alert.
+
+Only the DynamoDB tables are backed up: ` + strings.Join(backup.TABLES, ", ") + `.
+The legacy storage JSON files are not, import them into the videos table first with import --format=legacy.`,
+		Run: func(_ *cobra.Command, _ []string) {
+			// Instantiate the video lib
+			videoLib, err := videos.NewVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			// A partial backup is worse than none, it would be restored as if it was everything
+			var dataset backup.Dataset
+			if dataset.Videos, err = videoLib.GetVideos(); err != nil {
+				fmt.Fprintf(os.Stderr, "Backup failed, unable to read the videos: %v\n", err)
+				os.Exit(1)
+			}
+
+			ruleStore, err := alerts.NewRuleStore()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			stateStore, err := alerts.NewStateStore()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			// The alert tables are optional, but when they exist they are backed up whole
+			if dataset.AlertRules, err = ruleStore.GetRules(); dynamodb.IsTableNotFound(err) {
+				fmt.Fprintf(os.Stderr, "Skipping the alert rules: %v\n", err)
+			} else if err != nil {
+				fmt.Fprintf(os.Stderr, "Backup failed, unable to read the alert rules: %v\n", err)
+				os.Exit(1)
+			}
+			if dataset.AlertState, err = stateStore.All(); dynamodb.IsTableNotFound(err) {
+				fmt.Fprintf(os.Stderr, "Skipping the alert state: %v\n", err)
+			} else if err != nil {
+				fmt.Fprintf(os.Stderr, "Backup failed, unable to read the alert state: %v\n", err)
+				os.Exit(1)
+			}
+
+			passphrase := backupPassphraseOf(backupPassphrase)
+
+			out := backupOut
+			if out == "" {
+				out = fmt.Sprintf("black-flag-%s.tar.gz", time.Now().Format("20060102-150405"))
+				if passphrase != "" {
+					out += ".enc"
+				}
+			}
+
+			file, err := os.Create(out)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Backup failed %v\n", err)
+				os.Exit(1)
+			}
+
+			// Keep the checksum of the whole archive so it can be checked after copying it around
+			hash := sha256.New()
+			manifest, err := backup.Write(io.MultiWriter(file, hash), dataset, passphrase)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				// Don't leave half an archive behind
+				os.Remove(out)
+				fmt.Fprintf(os.Stderr, "Backup failed %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Backed up %d videos with %d samples, %d alert rules and %d alert states to %s.\n",
+				len(dataset.Videos), dataset.Samples(), len(dataset.AlertRules), len(dataset.AlertState), out)
+			fmt.Printf("Version %d, tables: %s, encrypted: %v, sha256: %x\n",
+				manifest.Version, strings.Join(manifest.Tables, ", "), manifest.Encrypted, hash.Sum(nil))
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+
+	// backup --out=black-flag.tar.gz
+	backupCmd.Flags().StringVar(&backupOut, "out", "", "File to write the backup to, defaults to black-flag-<date>.tar.gz.")
+
+	// backup --passphrase=secret
+	backupCmd.Flags().StringVar(&backupPassphrase, "passphrase", "", "Encrypts the backup with this passphrase, defaults to "+BACKUP_PASSPHRASE_ENV+".")
+}
+
+// Lets the passphrase stay out of the shell history, read when the flag is empty so --help doesn't show it
+var BACKUP_PASSPHRASE_ENV = "BLACK_FLAG_BACKUP_PASSPHRASE"
+
+func backupPassphraseOf(flag string) string {
+	if flag != "" {
+		return flag
+	}
+
+	return os.Getenv(BACKUP_PASSPHRASE_ENV)
+}
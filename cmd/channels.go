@@ -0,0 +1,142 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/ricomonster/black-flag/internal/leaderboard"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/spf13/cobra"
+)
+
+// The shape of a channel when rendered as JSON
+type channelOutput struct {
+	Id         string             `json:"id"`
+	Title      string             `json:"title"`
+	Videos     int                `json:"videos"`
+	TotalViews int                `json:"total_views"`
+	Gain       int                `json:"gain"`
+	Partial    bool               `json:"partial"`
+	TopVideos  []channelTopOutput `json:"top_videos"`
+}
+
+type channelTopOutput struct {
+	Id    string `json:"id"`
+	Title string `json:"title"`
+	Views int    `json:"views"`
+}
+
+// channelsCmd represents the channels command
+var (
+	channelsWindow string
+	channelsTop    int
+	channelsOutput string
+	channelsCmd    = &cobra.Command{
+		Use:   "channels",
+		Short: "Lists the channels of the tracked videos with their views",
+		Run: func(_ *cobra.Command, _ []string) {
+			if err := validateOutput(channelsOutput); err != nil {
+				fmt.Println(err)
+				os.Exit(0)
+			}
+
+			window, err := leaderboard.ParseWindow(channelsWindow)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(0)
+			}
+
+			// Instantiate the video lib
+			videoLib, err := videos.NewVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			allVideos, err := videoLib.GetVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			// Gains of each channel in the window
+			gains := map[string]leaderboard.Entry{}
+			for _, entry := range leaderboard.Channels(allVideos, window, time.Now()) {
+				gains[entry.Channel.Id] = entry
+			}
+
+			var rows []channelOutput
+			for _, summary := range videos.SummarizeChannels(allVideos) {
+				row := channelOutput{
+					Id:         summary.Channel.Id,
+					Title:      summary.Channel.Title,
+					Videos:     summary.Videos,
+					TotalViews: summary.TotalViews,
+					Gain:       int(gains[summary.Channel.Id].Gain),
+					Partial:    gains[summary.Channel.Id].Partial,
+				}
+
+				for i, video := range summary.TopVideos {
+					if i == channelsTop {
+						break
+					}
+
+					row.TopVideos = append(row.TopVideos, channelTopOutput{Id: video.Id, Title: video.Title, Views: videos.LatestViews(video)})
+				}
+
+				rows = append(rows, row)
+			}
+
+			if channelsOutput == "json" {
+				if err := renderJSON(os.Stdout, rows); err != nil {
+					fmt.Printf("Something went wrong %v", err)
+				}
+				return
+			}
+
+			t := table.NewWriter()
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"Channel", "Videos", "Total Views", fmt.Sprintf("Gain (%s)", channelsWindow), "Top Videos"})
+
+			for _, row := range rows {
+				var top []string
+				for _, video := range row.TopVideos {
+					top = append(top, fmt.Sprintf("%s (%d)", video.Title, video.Views))
+				}
+
+				t.AppendRow(table.Row{row.Title, row.Videos, row.TotalViews, describeGain(row.Gain, row.Partial), strings.Join(top, "\n")})
+				t.AppendSeparator()
+			}
+
+			t.Render()
+		},
+	}
+)
+
+// Gains that don't cover the whole window are marked
+func describeGain(gain int, partial bool) string {
+	if partial {
+		return fmt.Sprintf("+%d*", gain)
+	}
+
+	return fmt.Sprintf("+%d", gain)
+}
+
+func init() {
+	rootCmd.AddCommand(channelsCmd)
+
+	// channels --window=week
+	channelsCmd.Flags().StringVarP(&channelsWindow, "window", "w", "day", "Window of the gain, either hour, day, week or a duration like 6h.")
+
+	// channels --top=5
+	channelsCmd.Flags().IntVar(&channelsTop, "top", 3, "Number of top videos to show for each channel.")
+
+	// channels --output=json
+	channelsCmd.Flags().StringVarP(&channelsOutput, "output", "o", "table", "Output format, either table or json.")
+}
@@ -0,0 +1,195 @@
+package cmd_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ricomonster/black-flag/cmd"
+	"github.com/ricomonster/black-flag/internal/alerts"
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb"
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb/ddbtest"
+	"github.com/ricomonster/black-flag/internal/lease"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/ricomonster/black-flag/internal/youtube/youtubetest"
+)
+
+// Runs the command like the binary would and returns what it printed
+func run(t *testing.T, args ...string) string {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, osArgs := os.Stdout, os.Args
+	os.Stdout, os.Args = writer, append([]string{"black-flag"}, args...)
+	defer func() { os.Stdout, os.Args = stdout, osArgs }()
+
+	output := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(reader)
+		output <- string(b)
+	}()
+
+	cmd.Execute()
+	writer.Close()
+
+	return <-output
+}
+
+func TestAddUpdateView(t *testing.T) {
+	// No config file and nothing sent to AWS or Youtube
+	t.Setenv("HOME", t.TempDir())
+
+	server := youtubetest.NewServer()
+	defer server.Close()
+	t.Setenv("BLACK_FLAG_YOUTUBE_ENDPOINT", server.Endpoint())
+	server.AddVideo("video1", "First video", "UC1", "Channel", "2023-10-01T00:00:00Z", 1000)
+
+	fake := ddbtest.New(videos.TABLE, alerts.RULES_TABLE, alerts.STATE_TABLE, lease.TABLE)
+	dynamodb.SetDefaultClient(fake)
+	defer dynamodb.SetDefaultClient(nil)
+
+	output := run(t, "add", "--video=https://www.youtube.com/watch?v=video1")
+	if !strings.Contains(output, `Video "First video" was added.`) {
+		t.Errorf("TestAddUpdateView: unexpected add output %q", output)
+	}
+
+	output = run(t, "add", "--video=video1")
+	if !strings.Contains(output, `Video "First video" was already added.`) {
+		t.Errorf("TestAddUpdateView: unexpected second add output %q", output)
+	}
+
+	server.SetViews("video1", 1500)
+	output = run(t, "update", "--force", "--output=json")
+
+	var updated []map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &updated); err != nil {
+		t.Fatalf("TestAddUpdateView: unable to decode the update output %q: %v", output, err)
+	}
+	if len(updated) != 1 || updated[0]["status"] != "refreshed" || updated[0]["views"] != float64(1500) || updated[0]["added"] != float64(500) {
+		t.Errorf("TestAddUpdateView: unexpected update output %v", updated)
+	}
+
+	// Just refreshed, it is still listed but not fetched
+	requests := server.Requests()
+	output = run(t, "update", "--force=false", "--output=json")
+
+	updated = nil
+	if err := json.Unmarshal([]byte(output), &updated); err != nil {
+		t.Fatalf("TestAddUpdateView: unable to decode the update output %q: %v", output, err)
+	}
+	if len(updated) != 1 || updated[0]["status"] != "throttled" || updated[0]["eligible_in"] == nil || server.Requests() != requests {
+		t.Errorf("TestAddUpdateView: expected the video to be throttled, got %v", updated)
+	}
+
+	// Another instance is refreshing the videos
+	leaseDir := t.TempDir()
+	store, err := lease.NewFileStore(leaseDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handle, err := lease.NewLocker(store, lease.Options{Holder: "other-host:1"}).Acquire(context.Background(), cmd.REFRESH_LEASE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output = run(t, "update", "--force", "--lease-dir="+leaseDir)
+	if !strings.Contains(output, "Skipping the update") || !strings.Contains(output, "other-host:1") {
+		t.Errorf("TestAddUpdateView: expected the update to be skipped, got %q", output)
+	}
+
+	// A shard of a sharded watch refreshes some of the same videos
+	handle.Release()
+	handle, err = lease.NewLocker(store, lease.Options{Holder: "other-host:2"}).Acquire(context.Background(), cmd.REFRESH_LEASE+"/1-of-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output = run(t, "update", "--force", "--lease-dir="+leaseDir)
+	if !strings.Contains(output, "Skipping the update") || !strings.Contains(output, "splitting the videos differently") {
+		t.Errorf("TestAddUpdateView: expected the update to be skipped while a shard is refreshed, got %q", output)
+	}
+
+	// Videos given by hand don't wait for the lease
+	output = run(t, "update", "--video=video1")
+	if strings.Contains(output, "Skipping the update") || !strings.Contains(output, "First video") {
+		t.Errorf("TestAddUpdateView: expected the video to be updated while the lease is held, got %q", output)
+	}
+	handle.Release()
+
+	// Just refreshed so view shows what is stored without calling Youtube
+	requests = server.Requests()
+	output = run(t, "view", "--video=video1", "--output=json")
+
+	var viewed map[string]interface{}
+	if err := json.Unmarshal([]byte(output), &viewed); err != nil {
+		t.Fatalf("TestAddUpdateView: unable to decode the view output %q: %v", output, err)
+	}
+	if viewed["title"] != "First video" || viewed["views"] != float64(1500) || viewed["status"] != "throttled" {
+		t.Errorf("TestAddUpdateView: unexpected view output %v", viewed)
+	}
+	if server.Requests() != requests {
+		t.Errorf("TestAddUpdateView: expected no request to Youtube for a throttled video")
+	}
+
+	output = run(t, "view", "--video=video1")
+	if !strings.Contains(output, "First video") || !strings.Contains(output, "1500") {
+		t.Errorf("TestAddUpdateView: unexpected view table %q", output)
+	}
+}
+
+func TestInitTable(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	fake := ddbtest.New()
+	dynamodb.SetDefaultClient(fake)
+	defer dynamodb.SetDefaultClient(nil)
+
+	output := run(t, "init-table")
+	if strings.Count(output, "created") != 4 || !strings.Contains(output, "ChannelIndex, PollIndex") {
+		t.Errorf("TestInitTable: unexpected output %q", output)
+	}
+
+	// Only the leases expire
+	if fake.Calls("UpdateTimeToLive") != 1 {
+		t.Errorf("TestInitTable: expected the TTL on the leases only, got %d", fake.Calls("UpdateTimeToLive"))
+	}
+
+	// Running it again changes nothing
+	output = run(t, "init-table")
+	if strings.Count(output, "already exists") != 4 || fake.Calls("CreateTable") != 4 || fake.Calls("UpdateTable") != 0 {
+		t.Errorf("TestInitTable: unexpected second output %q", output)
+	}
+}
+
+func TestViewWithoutSamples(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	server := youtubetest.NewServer()
+	defer server.Close()
+	t.Setenv("BLACK_FLAG_YOUTUBE_ENDPOINT", server.Endpoint())
+
+	fake := ddbtest.New(videos.TABLE, alerts.RULES_TABLE, alerts.STATE_TABLE)
+	dynamodb.SetDefaultClient(fake)
+	defer dynamodb.SetDefaultClient(nil)
+
+	// Imported without any sample and gone from Youtube, the stored video is shown
+	videoLib, err := videos.NewVideos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := videoLib.ImportViewLogs([]videos.ViewLogsImport{{Video: videos.VideoDdbAttributes{Id: "empty", Title: "Empty video"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	output := run(t, "view", "--video=empty", "--output=table")
+	if !strings.Contains(output, "Empty video") || !strings.Contains(output, "no samples yet") {
+		t.Errorf("TestViewWithoutSamples: unexpected output %q", output)
+	}
+}
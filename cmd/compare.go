@@ -0,0 +1,231 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/ricomonster/black-flag/internal/chart"
+	"github.com/ricomonster/black-flag/internal/compare"
+	"github.com/ricomonster/black-flag/internal/series"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/spf13/cobra"
+)
+
+// Markers of the videos in the overlay chart, in the order they were given
+var COMPARE_MARKERS = []rune{'●', '○', '■', '□', '▲', '△', '◆', '◇'}
+
+// The shape of a compared video when rendered as JSON
+type compareEntryOutput struct {
+	Id          string             `json:"id"`
+	Title       string             `json:"title"`
+	Channel     string             `json:"channel"`
+	Start       time.Time          `json:"start"`
+	Checkpoints []checkpointOutput `json:"checkpoints"`
+}
+
+type checkpointOutput struct {
+	After string `json:"after"`
+	Views *int   `json:"views"`
+	Gain  *int   `json:"gain"`
+}
+
+// compareCmd represents the compare command
+var (
+	compareVideos      []string
+	compareAlign       string
+	compareCheckpoints []string
+	compareOutput      string
+	compareCmd         = &cobra.Command{
+		Use:   "compare",
+		Short: "Compares the views of videos side by side",
+		Run: func(_ *cobra.Command, _ []string) {
+			if err := validateOutput(compareOutput); err != nil {
+				fmt.Println(err)
+				os.Exit(0)
+			}
+
+			align := compare.Alignment(compareAlign)
+			if align != compare.ALIGN_PUBLISH && align != compare.ALIGN_WALLCLOCK {
+				fmt.Printf("unknown alignment %q, expected one of %v\n", compareAlign, compare.ALIGNMENTS)
+				os.Exit(0)
+			}
+
+			checkpoints := make([]time.Duration, 0, len(compareCheckpoints))
+			for _, value := range compareCheckpoints {
+				checkpoint, err := compare.ParseDuration(value)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(0)
+				}
+				checkpoints = append(checkpoints, checkpoint)
+			}
+
+			// Instantiate the video lib
+			videoLib, err := videos.NewVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			var items []videos.VideoDdbAttributes
+			for _, value := range compareVideos {
+				video := videos.ParseVideoId(value)
+
+				videoItem, err := videoLib.FindVideo(video)
+				if err != nil {
+					fmt.Printf("Something went wrong %v", err)
+					os.Exit(0)
+				}
+
+				// Check if the video exists
+				if videoItem.Id == "" {
+					fmt.Printf("Video not yet included to our list. Run \"add --video=%s\"\n", video)
+					os.Exit(0)
+				}
+
+				items = append(items, videoItem)
+			}
+
+			entries := compare.Compare(items, align, checkpoints)
+
+			if compareOutput == "json" {
+				rows := make([]compareEntryOutput, 0, len(entries))
+				for _, entry := range entries {
+					rows = append(rows, newCompareOutput(entry))
+				}
+
+				if err := renderJSON(os.Stdout, rows); err != nil {
+					fmt.Printf("Something went wrong %v", err)
+				}
+				return
+			}
+
+			renderComparison(entries, align, checkpoints)
+		},
+	}
+)
+
+func newCompareOutput(entry compare.Entry) compareEntryOutput {
+	output := compareEntryOutput{
+		Id:      entry.Video.Id,
+		Title:   entry.Video.Title,
+		Channel: entry.Video.Channel.Title,
+		Start:   time.Unix(entry.Start, 0).Local(),
+	}
+
+	for _, checkpoint := range entry.Checkpoints {
+		row := checkpointOutput{After: compare.FormatDuration(checkpoint.After)}
+
+		if checkpoint.Known {
+			views := int(checkpoint.Views)
+			row.Views = &views
+		}
+
+		if checkpoint.HasGain {
+			gain := int(checkpoint.Gain)
+			row.Gain = &gain
+		}
+
+		output.Checkpoints = append(output.Checkpoints, row)
+	}
+
+	return output
+}
+
+func renderComparison(entries []compare.Entry, align compare.Alignment, checkpoints []time.Duration) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+
+	header := table.Row{"After"}
+	for i, entry := range entries {
+		header = append(header, fmt.Sprintf("%c %s\n%s", COMPARE_MARKERS[i%len(COMPARE_MARKERS)], entry.Video.Title, entry.Video.Channel.Title))
+	}
+	t.AppendHeader(header)
+
+	for i, after := range checkpoints {
+		row := table.Row{compare.FormatDuration(after)}
+
+		for _, entry := range entries {
+			checkpoint := entry.Checkpoints[i]
+
+			switch {
+			case !checkpoint.Known:
+				row = append(row, "-")
+			case checkpoint.HasGain:
+				row = append(row, fmt.Sprintf("%d\n+%d", int(checkpoint.Views), int(checkpoint.Gain)))
+			default:
+				row = append(row, int(checkpoint.Views))
+			}
+		}
+
+		t.AppendRow(row)
+		t.AppendSeparator()
+	}
+
+	t.Render()
+
+	// Only chart up to the last checkpoint so a long history doesn't squash the rest
+	var end int64
+	for _, after := range checkpoints {
+		end = max(end, int64(after.Seconds()))
+	}
+
+	var views, gains []chart.Line
+	for i, entry := range entries {
+		marker := COMPARE_MARKERS[i%len(COMPARE_MARKERS)]
+
+		var window series.Series
+		for _, point := range entry.Views {
+			if point.Timestamp >= 0 && (end == 0 || point.Timestamp <= end) {
+				window = append(window, point)
+			}
+		}
+
+		views = append(views, chart.Line{Name: entry.Video.Title, Marker: marker, Points: window})
+		gains = append(gains, chart.Line{Name: entry.Video.Title, Marker: marker, Points: window.Rates()})
+	}
+
+	// Time since publish or the actual date
+	label := func(offset int64) string {
+		return "+" + compare.FormatDuration((time.Duration(offset) * time.Second).Round(time.Hour))
+	}
+	if align == compare.ALIGN_WALLCLOCK && len(entries) > 0 {
+		label = func(offset int64) string {
+			return time.Unix(entries[0].Start+offset, 0).Local().Format(time.DateOnly)
+		}
+	}
+
+	for _, c := range []struct {
+		title string
+		lines []chart.Line
+	}{
+		{"Views", views},
+		{"Views gained per hour", gains},
+	} {
+		if err := chart.Render(os.Stdout, c.lines, chart.Options{Title: c.title, Label: label}); err != nil {
+			fmt.Printf("Something went wrong %v", err)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+
+	// compare --video=a --video=b
+	compareCmd.Flags().StringSliceVarP(&compareVideos, "video", "v", []string{}, "Video IDs or URLs of the youtube videos to compare.")
+	_ = compareCmd.MarkFlagRequired("video")
+
+	// compare --align=wallclock
+	compareCmd.Flags().StringVar(&compareAlign, "align", string(compare.ALIGN_PUBLISH), "Align the videos by the time since they were published (publish) or by date (wallclock).")
+
+	// compare --checkpoints=1h,24h,7d
+	compareCmd.Flags().StringSliceVar(&compareCheckpoints, "checkpoints", []string{"1h", "6h", "24h", "7d", "30d"}, "Times after the start to compare the views at.")
+
+	// compare --output=json
+	compareCmd.Flags().StringVarP(&compareOutput, "output", "o", "table", "Output format, either table or json.")
+}
@@ -0,0 +1,139 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb"
+	"github.com/ricomonster/black-flag/internal/migrate"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/spf13/cobra"
+)
+
+// dbCmd represents the db command
+var (
+	dbBatchSize  int32
+	dbCheckpoint string
+	dbDryRun     bool
+	dbExclusive  bool
+	dbCmd        = &cobra.Command{
+		Use:   "db",
+		Short: "Manages the shape of the items stored in the videos table",
+	}
+	dbMigrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrades every video that is behind to the latest schema version",
+		Run: func(_ *cobra.Command, _ []string) {
+			store, err := dynamodb.NewDynamoDB[videos.VideoDdbAttributes](videos.TABLE)
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			checkpoint, err := migrate.LoadCheckpoint(dbCheckpoint)
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			if checkpoint.Start() != nil && !dbDryRun {
+				fmt.Printf("Continuing from %s, %d videos were scanned so far.\n", dbCheckpoint, checkpoint.Result.Scanned)
+			}
+
+			options := migrate.Options{
+				BatchSize:  dbBatchSize,
+				DryRun:     dbDryRun,
+				Exclusive:  dbExclusive,
+				Checkpoint: checkpoint,
+				Progress: func(result migrate.Result) {
+					fmt.Fprintf(os.Stderr, "Scanned %d videos, migrated %d...\n", result.Scanned, result.Migrated)
+				},
+			}
+			if dbDryRun {
+				options.Checkpoint = nil
+			}
+
+			result, err := migrate.Run(store, videos.MIGRATIONS, options)
+			if err != nil {
+				fmt.Printf("Something went wrong %v\nRun it again to continue from the last batch.\n", err)
+				os.Exit(0)
+			}
+
+			verb := "Migrated"
+			if dbDryRun {
+				verb = "Dry run, would migrate"
+			}
+
+			fmt.Printf("%s %d of %d videos to version %d, %d were up to date.\n", verb, result.Migrated, result.Scanned, videos.MIGRATIONS.Latest(), result.UpToDate)
+			if result.Conflicts > 0 {
+				fmt.Printf("%d videos were changed while migrating them, run it again to migrate them.\n", result.Conflicts)
+			}
+		},
+	}
+	dbStatusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Shows how many videos are at every schema version",
+		Run: func(_ *cobra.Command, _ []string) {
+			store, err := dynamodb.NewDynamoDB[videos.VideoDdbAttributes](videos.TABLE)
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			counts, err := migrate.Status(store, dbBatchSize)
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			versions := make([]int, 0, len(counts))
+			for version := range counts {
+				versions = append(versions, version)
+			}
+			sort.Ints(versions)
+
+			descriptions := map[int]string{0: "before migrations"}
+			for _, migration := range videos.MIGRATIONS.Migrations() {
+				descriptions[migration.Version] = migration.Description
+			}
+
+			t := table.NewWriter()
+			t.SetOutputMirror(os.Stdout)
+			t.SetTitle(fmt.Sprintf("Latest version %d", videos.MIGRATIONS.Latest()))
+			t.AppendHeader(table.Row{"Version", "Videos", "Migration"})
+
+			behind := 0
+			for _, version := range versions {
+				t.AppendRow(table.Row{version, counts[version], descriptions[version]})
+				if version < videos.MIGRATIONS.Latest() {
+					behind += counts[version]
+				}
+			}
+
+			t.AppendFooter(table.Row{"Behind", behind})
+			t.Render()
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbMigrateCmd, dbStatusCmd)
+
+	// db migrate --batch-size=100
+	dbCmd.PersistentFlags().Int32Var(&dbBatchSize, "batch-size", migrate.DEFAULT_BATCH_SIZE, "Number of videos read per batch.")
+
+	// db migrate --checkpoint=.black-flag-migrate.json
+	dbMigrateCmd.Flags().StringVar(&dbCheckpoint, "checkpoint", ".black-flag-migrate.json", "File that remembers the last migrated batch so an interrupted run continues from there.")
+
+	// db migrate --dry-run
+	dbMigrateCmd.Flags().BoolVar(&dbDryRun, "dry-run", false, "Only counts the videos that would be migrated.")
+
+	// db migrate --exclusive
+	dbMigrateCmd.Flags().BoolVar(&dbExclusive, "exclusive", false, "Writes the videos in batches without checking for changes, only when nothing else is running.")
+}
@@ -0,0 +1,165 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/export"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/spf13/cobra"
+)
+
+// exportCmd represents the export command
+var (
+	exportFormat   string
+	exportVideos   []string
+	exportChannels []string
+	exportSince    string
+	exportUntil    string
+	exportCursor   string
+	exportOut      string
+	exportCmd      = &cobra.Command{
+		Use:   "export",
+		Short: "Exports every recorded sample as CSV, JSON Lines or Parquet",
+		Run: func(_ *cobra.Command, _ []string) {
+			format := export.Format(exportFormat)
+			if err := export.ValidateFormat(format); err != nil {
+				fmt.Println(err)
+				os.Exit(0)
+			}
+
+			filter := export.Filter{Channels: exportChannels}
+			for _, video := range exportVideos {
+				filter.Videos = append(filter.Videos, videos.ParseVideoId(video))
+			}
+
+			now := time.Now()
+			for _, bound := range []struct {
+				value  string
+				target *time.Time
+			}{
+				{exportSince, &filter.Since},
+				{exportUntil, &filter.Until},
+			} {
+				if bound.value == "" {
+					continue
+				}
+
+				parsed, err := parseExportTime(bound.value, now)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(0)
+				}
+				*bound.target = parsed
+			}
+
+			cursor, err := export.LoadCursor(exportCursor)
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			// Instantiate the video lib
+			videoLib, err := videos.NewVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			allVideos, err := videoLib.GetVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			// Messages go to stderr so they don't end up in the exported rows
+			var out io.Writer = os.Stdout
+			var file *os.File
+			if exportOut != "" {
+				file, err = os.Create(exportOut)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Something went wrong %v", err)
+					os.Exit(0)
+				}
+
+				out = file
+			}
+
+			writer, err := export.NewWriter(format, out)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			count, err := export.Export(allVideos, filter, cursor, writer)
+			if err == nil {
+				err = writer.Close()
+			}
+
+			// The rows are only written once the file is flushed and closed, e.g. on a full disk
+			if file != nil {
+				if err == nil {
+					err = file.Sync()
+				}
+				if closeErr := file.Close(); err == nil {
+					err = closeErr
+				}
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			// Only move the cursor once everything was written
+			if err := cursor.Save(); err != nil {
+				fmt.Fprintf(os.Stderr, "Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			fmt.Fprintf(os.Stderr, "Exported %d samples.\n", count)
+		},
+	}
+)
+
+// Accepts a date, a date and time or how long ago
+func parseExportTime(value string, now time.Time) (time.Time, error) {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(-duration), nil
+	}
+
+	for _, layout := range []string{time.DateOnly, time.DateTime, time.RFC3339} {
+		if parsed, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return parsed, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unable to parse %q, expected a date like 2024-01-31 or a duration like 24h", value)
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	// export --format=parquet
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", string(export.FORMAT_CSV), "Either csv, jsonl or parquet.")
+
+	// export --video=a --video=b
+	exportCmd.Flags().StringSliceVarP(&exportVideos, "video", "v", []string{}, "Only exports these videos.")
+
+	// export --channel=UC...
+	exportCmd.Flags().StringSliceVar(&exportChannels, "channel", []string{}, "Only exports the videos of these channels, by id or title.")
+
+	// export --since=2024-01-01 --until=24h
+	exportCmd.Flags().StringVar(&exportSince, "since", "", "Only exports samples after this date or duration ago.")
+	exportCmd.Flags().StringVar(&exportUntil, "until", "", "Only exports samples before this date or duration ago.")
+
+	// export --cursor=.black-flag-export.json
+	exportCmd.Flags().StringVar(&exportCursor, "cursor", "", "File that remembers the last export so only newer samples are exported, videos that got older samples since are exported again.")
+
+	// export --out=samples.parquet
+	exportCmd.Flags().StringVar(&exportOut, "out", "", "File to write to instead of the terminal.")
+}
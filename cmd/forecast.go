@@ -0,0 +1,264 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/ricomonster/black-flag/internal/chart"
+	"github.com/ricomonster/black-flag/internal/forecast"
+	"github.com/ricomonster/black-flag/internal/series"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/spf13/cobra"
+)
+
+// How far the chart looks ahead when there's no target or date
+var FORECAST_CHART_HORIZON = 7 * 24 * time.Hour
+
+// The shape of a forecast when rendered as JSON
+type forecastResultOutput struct {
+	Id        string             `json:"id"`
+	Title     string             `json:"title"`
+	Views     int                `json:"views"`
+	Model     string             `json:"model"`
+	Error     float64            `json:"error"`
+	Backtests map[string]float64 `json:"backtests"`
+	Target    *targetOutput      `json:"target,omitempty"`
+	At        *viewsAtOutput     `json:"at,omitempty"`
+}
+
+type targetOutput struct {
+	Views    int        `json:"views"`
+	Reached  bool       `json:"reached"`
+	At       *time.Time `json:"at,omitempty"`
+	Earliest *time.Time `json:"earliest,omitempty"`
+	Latest   *time.Time `json:"latest,omitempty"`
+}
+
+type viewsAtOutput struct {
+	At    time.Time `json:"at"`
+	Views int       `json:"views"`
+	Low   int       `json:"low"`
+	High  int       `json:"high"`
+}
+
+// forecastCmd represents the forecast command
+var (
+	forecastTarget int
+	forecastAt     string
+	forecastOutput string
+	forecastCmd    = &cobra.Command{
+		Use:   "forecast",
+		Short: "Predicts when a video will reach a number of views",
+		Run: func(cmd *cobra.Command, _ []string) {
+			if err := validateOutput(forecastOutput); err != nil {
+				fmt.Println(err)
+				os.Exit(0)
+			}
+
+			var at time.Time
+			if forecastAt != "" {
+				parsed, err := parseForecastAt(forecastAt, time.Now())
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(0)
+				}
+				at = parsed
+			}
+
+			video := videos.ParseVideoId(cmd.Flags().Lookup("video").Value.String())
+
+			// Instantiate the video lib
+			videoLib, err := videos.NewVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			videoItem, err := videoLib.FindVideo(video)
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			// Check if the video exists
+			if videoItem.Id == "" {
+				fmt.Printf("Video not yet included to our list. Run \"add --video=%s\"\n", video)
+				os.Exit(0)
+			}
+
+			fitted, err := forecast.Fit(videoItem)
+			if errors.Is(err, forecast.ErrNotEnoughSamples) {
+				fmt.Printf("Need at least %d samples to forecast, run \"update\" a few more times.\n", forecast.MIN_SAMPLES)
+				os.Exit(0)
+			}
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			output := newForecastOutput(videoItem, fitted, at)
+
+			if forecastOutput == "json" {
+				if err := renderJSON(os.Stdout, output); err != nil {
+					fmt.Printf("Something went wrong %v", err)
+				}
+				return
+			}
+
+			renderForecast(videoItem, fitted, output)
+		},
+	}
+)
+
+// Accepts a date, a date and time or how long from now
+func parseForecastAt(value string, now time.Time) (time.Time, error) {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(duration), nil
+	}
+
+	for _, layout := range []string{time.DateOnly, time.DateTime, time.RFC3339} {
+		if parsed, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return parsed, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unable to parse %q, expected a date like 2024-01-31 or a duration like 720h", value)
+}
+
+func newForecastOutput(video videos.VideoDdbAttributes, fitted forecast.Forecast, at time.Time) forecastResultOutput {
+	views, _, _ := latestViews(video)
+
+	output := forecastResultOutput{
+		Id:        video.Id,
+		Title:     video.Title,
+		Views:     views,
+		Model:     fitted.Model.Name(),
+		Error:     fitted.Error,
+		Backtests: fitted.Backtests,
+	}
+
+	if forecastTarget > 0 {
+		target := &targetOutput{Views: forecastTarget, Reached: views >= forecastTarget}
+
+		if !target.Reached {
+			projection, ok := fitted.ReachAt(float64(forecastTarget))
+			if ok {
+				target.At = &projection.At
+			}
+			if !projection.Earliest.IsZero() {
+				target.Earliest = &projection.Earliest
+			}
+			if !projection.Latest.IsZero() {
+				target.Latest = &projection.Latest
+			}
+		}
+
+		output.Target = target
+	}
+
+	if !at.IsZero() {
+		predicted, low, high := fitted.ViewsAt(at)
+		output.At = &viewsAtOutput{At: at, Views: int(predicted), Low: int(low), High: int(high)}
+	}
+
+	return output
+}
+
+func renderForecast(video videos.VideoDdbAttributes, fitted forecast.Forecast, output forecastResultOutput) {
+	t := table.NewWriter()
+	t.SetOutputMirror(os.Stdout)
+	t.SetTitle(video.Title)
+
+	t.AppendRow(table.Row{"Current:", output.Views})
+
+	// Best model first
+	names := make([]string, 0, len(output.Backtests))
+	for name := range output.Backtests {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return output.Backtests[names[i]] < output.Backtests[names[j]]
+	})
+
+	for _, name := range names {
+		label := ""
+		if name == output.Model {
+			label = "(chosen)"
+		}
+		t.AppendRow(table.Row{"Model:", name, fmt.Sprintf("backtest error ±%.0f", output.Backtests[name]), label})
+	}
+
+	if target := output.Target; target != nil {
+		switch {
+		case target.Reached:
+			t.AppendRow(table.Row{"Target:", target.Views, "already reached"})
+		case target.At == nil:
+			t.AppendRow(table.Row{"Target:", target.Views, fmt.Sprintf("not within %s", forecast.MAX_HORIZON)})
+		default:
+			t.AppendRow(table.Row{"Target:", target.Views, target.At.Local().Format(time.DateTime), describeInterval(target.Earliest, target.Latest)})
+		}
+	}
+
+	if at := output.At; at != nil {
+		t.AppendRow(table.Row{"Views at:", at.At.Local().Format(time.DateTime), at.Views, fmt.Sprintf("between %d and %d", at.Low, at.High)})
+	}
+
+	t.Render()
+
+	// The fitted curve next to the recorded views, up to the target or date we are asked about
+	views := series.Views(video.ViewLogs)
+	first, last := views[0].Timestamp, views[len(views)-1].Timestamp
+
+	end := time.Unix(last, 0).Add(FORECAST_CHART_HORIZON)
+	if output.Target != nil && output.Target.At != nil {
+		end = *output.Target.At
+	}
+	if output.At != nil && output.At.At.After(end) {
+		end = output.At.At
+	}
+
+	width := chart.DEFAULT_WIDTH
+	err := chart.Render(os.Stdout, []chart.Line{
+		{Name: fitted.Model.Name(), Marker: '·', Points: fitted.Curve(time.Unix(first, 0), end, width*2)},
+		{Name: "views", Marker: '●', Points: views},
+	}, chart.Options{Width: width})
+	if err != nil {
+		fmt.Printf("Something went wrong %v", err)
+	}
+}
+
+func describeInterval(earliest, latest *time.Time) string {
+	from, to := "?", "beyond the horizon"
+	if earliest != nil {
+		from = earliest.Local().Format(time.DateOnly)
+	}
+	if latest != nil {
+		to = latest.Local().Format(time.DateOnly)
+	}
+
+	return fmt.Sprintf("95%% between %s and %s", from, to)
+}
+
+func init() {
+	rootCmd.AddCommand(forecastCmd)
+
+	// forecast --video=url
+	forecastCmd.Flags().StringP("video", "v", "", "Video ID or URL of the youtube video to forecast.")
+	_ = forecastCmd.MarkFlagRequired("video")
+
+	// forecast --target=1000000
+	forecastCmd.Flags().IntVarP(&forecastTarget, "target", "t", 0, "Views to predict the date for.")
+
+	// forecast --at=2024-01-31
+	forecastCmd.Flags().StringVar(&forecastAt, "at", "", "Date or duration from now to predict the views at, e.g. 2024-01-31 or 720h.")
+
+	// forecast --output=json
+	forecastCmd.Flags().StringVarP(&forecastOutput, "output", "o", "table", "Output format, either table or json.")
+}
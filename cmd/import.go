@@ -0,0 +1,233 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb"
+	"github.com/ricomonster/black-flag/internal/importer"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/spf13/cobra"
+)
+
+// importCmd represents the import command
+var (
+	importFormat  string
+	importColumns map[string]string
+	importDryRun  bool
+	importCmd     = &cobra.Command{
+		Use:   "import [file or directory]",
+		Short: "Imports historical views from CSV, JSON or the legacy storage files",
+		Args:  cobra.ExactArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			mapping, err := importer.ParseMapping(importColumns)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(0)
+			}
+
+			samples, err := importer.ReadPath(args[0], importer.Format(importFormat), mapping)
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			if len(samples) == 0 {
+				fmt.Println("Nothing to import.")
+				return
+			}
+
+			// Instantiate the video lib
+			videoLib, err := videos.NewVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			merges, err := importer.Plan(samples, videoLib.FindVideos)
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			hasErrors := false
+			for _, merge := range merges {
+				renderMerge(merge, importDryRun)
+				hasErrors = hasErrors || merge.HasErrors()
+			}
+
+			if hasErrors {
+				fmt.Println("\nNothing was imported, fix the errors above and try again.")
+				os.Exit(0)
+			}
+
+			if importDryRun {
+				fmt.Println("\nDry run, nothing was imported.")
+				return
+			}
+
+			merges, err = addImportedVideos(videoLib, merges, samples)
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			var imports []videos.ViewLogsImport
+			added := map[string]int{}
+			for _, merge := range merges {
+				if len(merge.Added) == 0 {
+					continue
+				}
+
+				imports = append(imports, videos.ViewLogsImport{Video: merge.Existing, Samples: merge.Added})
+				added[merge.VideoId] = len(merge.Added)
+			}
+
+			// Written one video at a time, the videos that failed are reported and the rest are kept
+			err = videoLib.ImportViewLogs(imports)
+
+			var failed dynamodb.BatchErrors
+			if err != nil && !errors.As(err, &failed) {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			imported := 0
+			for _, importing := range imports {
+				id := importing.Video.Id
+				if err, ok := failed[id]; ok {
+					fmt.Printf("Unable to import %s: %v\n", id, err)
+					continue
+				}
+
+				imported += added[id]
+			}
+
+			fmt.Printf("\nImported %d samples.\n", imported)
+		},
+	}
+)
+
+// Videos we don't track yet take the title and channel from the import, or from Youtube when it has none.
+// The ones added through Youtube recorded a sample so they are planned again around it.
+func addImportedVideos(videoLib interface {
+	AddVideos(list []string) ([]videos.AddVideoResult, error)
+	FindVideos(ids []string) (map[string]videos.VideoDdbAttributes, error)
+}, merges []importer.Merge, samples []importer.Sample) ([]importer.Merge, error) {
+	var untitled []string
+	for i, merge := range merges {
+		if !merge.IsNew() || len(merge.Added) == 0 {
+			continue
+		}
+
+		if merge.Title != "" {
+			merges[i].Existing = videos.VideoDdbAttributes{Id: merge.VideoId, Title: merge.Title, Channel: merge.Channel}
+			continue
+		}
+
+		untitled = append(untitled, merge.VideoId)
+	}
+
+	if len(untitled) == 0 {
+		return merges, nil
+	}
+
+	results, err := videoLib.AddVideos(untitled)
+	if err != nil {
+		return nil, err
+	}
+
+	var replan []string
+	skipped := map[string]bool{}
+	for _, result := range results {
+		if result.Error != nil {
+			fmt.Printf("Unable to import %s: %v\n", result.Id, result.Error)
+			skipped[result.Id] = true
+			continue
+		}
+
+		replan = append(replan, result.Id)
+	}
+
+	var filtered []importer.Sample
+	for _, sample := range samples {
+		if slices.Contains(replan, sample.VideoId) {
+			filtered = append(filtered, sample)
+		}
+	}
+
+	replanned := map[string]importer.Merge{}
+	if len(filtered) > 0 {
+		planned, err := importer.Plan(filtered, videoLib.FindVideos)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, merge := range planned {
+			replanned[merge.VideoId] = merge
+		}
+	}
+
+	kept := merges[:0]
+	for _, merge := range merges {
+		if skipped[merge.VideoId] {
+			continue
+		}
+
+		if merge, ok := replanned[merge.VideoId]; ok {
+			kept = append(kept, merge)
+			continue
+		}
+
+		kept = append(kept, merge)
+	}
+
+	return kept, nil
+}
+
+// Diff of what the import does to a video
+func renderMerge(merge importer.Merge, verbose bool) {
+	title := merge.Existing.Title
+	switch {
+	case merge.IsNew() && merge.Title != "":
+		title = merge.Title + " (new video)"
+	case merge.IsNew():
+		title = "new video, the details will be fetched from Youtube"
+	}
+
+	fmt.Printf("%s %s: %d new, %d duplicates skipped, %d stored\n", merge.VideoId, title, len(merge.Added), merge.Duplicates, len(merge.Existing.ViewLogs))
+
+	if verbose {
+		for _, log := range merge.Added {
+			fmt.Printf("  + %s  %d views\n", time.Unix(log.Timestamp, 0).Local().Format(time.DateTime), log.Views)
+		}
+	}
+
+	for _, issue := range merge.Issues {
+		marker := "~"
+		if issue.Level == importer.ISSUE_ERROR {
+			marker = "!"
+		}
+
+		fmt.Printf("  %s %s %s: %s\n", marker, time.Unix(issue.Timestamp, 0).Local().Format(time.DateTime), issue.Source, issue.Message)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	// import --format=legacy
+	importCmd.Flags().StringVarP(&importFormat, "format", "f", string(importer.FORMAT_AUTO), "Either auto, csv, json or legacy, auto guesses from the file.")
+
+	// import --columns=video="Video ID",views="Total Views"
+	importCmd.Flags().StringToStringVar(&importColumns, "columns", map[string]string{}, "Columns or keys of the fields, e.g. video=Video ID,timestamp=Date,views=Views.")
+
+	// import --dry-run
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Shows what would be imported without saving anything.")
+}
@@ -0,0 +1,72 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/ricomonster/black-flag/internal/alerts"
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb"
+	"github.com/ricomonster/black-flag/internal/lease"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/spf13/cobra"
+)
+
+// initTableCmd represents the init-table command
+var (
+	initTableAlerts bool
+	initTableLeases bool
+	initTableCmd    = &cobra.Command{
+		Use:   "init-table",
+		Short: "Creates the DynamoDB tables, their indexes and TTL, tables that already exist are completed",
+		Run: func(_ *cobra.Command, _ []string) {
+			schemas := []dynamodb.TableSchema{videos.SCHEMA}
+			if initTableAlerts {
+				schemas = append(schemas, alerts.RULES_SCHEMA, alerts.STATE_SCHEMA)
+			}
+			if initTableLeases {
+				schemas = append(schemas, lease.SCHEMA)
+			}
+
+			t := table.NewWriter()
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"Table", "Status", "Added Indexes", "TTL"})
+
+			for _, schema := range schemas {
+				result, err := dynamodb.EnsureTable(schema)
+				if err != nil {
+					fmt.Printf("Something went wrong with %s %v", schema.Name, err)
+					os.Exit(0)
+				}
+
+				status := "already exists"
+				if result.Created {
+					status = "created"
+				}
+
+				ttl := schema.TTLAttribute
+				if result.EnabledTTL {
+					ttl += " (enabled)"
+				}
+
+				t.AppendRow(table.Row{schema.Name, status, strings.Join(result.AddedIndexes, ", "), ttl})
+			}
+
+			t.Render()
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(initTableCmd)
+
+	// init-table --alerts=false
+	initTableCmd.Flags().BoolVar(&initTableAlerts, "alerts", true, "Also creates the alert rules and state tables.")
+
+	// init-table --leases=false
+	initTableCmd.Flags().BoolVar(&initTableLeases, "leases", true, "Also creates the table of the leases that keeps update and watch from running twice.")
+}
@@ -0,0 +1,148 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/ricomonster/black-flag/internal/leaderboard"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/spf13/cobra"
+)
+
+// The shape of a leaderboard entry when rendered as JSON
+type leaderboardEntryOutput struct {
+	Rank    int    `json:"rank"`
+	Id      string `json:"id"`
+	Title   string `json:"title"`
+	Channel string `json:"channel,omitempty"`
+	Videos  int    `json:"videos"`
+	Views   int    `json:"views"`
+	Gain    int    `json:"gain"`
+	Partial bool   `json:"partial"`
+}
+
+// leaderboardCmd represents the leaderboard command
+var (
+	leaderboardBy     string
+	leaderboardWindow string
+	leaderboardLimit  int
+	leaderboardOutput string
+	leaderboardCmd    = &cobra.Command{
+		Use:   "leaderboard",
+		Short: "Ranks the videos or channels by the views gained recently",
+		Run: func(_ *cobra.Command, _ []string) {
+			if err := validateOutput(leaderboardOutput); err != nil {
+				fmt.Println(err)
+				os.Exit(0)
+			}
+
+			by := leaderboard.By(leaderboardBy)
+			if by != leaderboard.BY_VIDEOS && by != leaderboard.BY_CHANNELS {
+				fmt.Printf("unknown ranking %q, expected either videos or channels\n", leaderboardBy)
+				os.Exit(0)
+			}
+
+			window, err := leaderboard.ParseWindow(leaderboardWindow)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(0)
+			}
+
+			// Instantiate the video lib
+			videoLib, err := videos.NewVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			allVideos, err := videoLib.GetVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			entries := leaderboard.Videos(allVideos, window, time.Now())
+			if by == leaderboard.BY_CHANNELS {
+				entries = leaderboard.Channels(allVideos, window, time.Now())
+			}
+
+			if leaderboardLimit > 0 && len(entries) > leaderboardLimit {
+				entries = entries[:leaderboardLimit]
+			}
+
+			rows := make([]leaderboardEntryOutput, 0, len(entries))
+			for i, entry := range entries {
+				row := leaderboardEntryOutput{
+					Rank:    i + 1,
+					Id:      entry.Channel.Id,
+					Title:   entry.Channel.Title,
+					Videos:  entry.Videos,
+					Views:   entry.Views,
+					Gain:    int(entry.Gain),
+					Partial: entry.Partial,
+				}
+
+				if by == leaderboard.BY_VIDEOS {
+					row.Id, row.Title, row.Channel = entry.Video.Id, entry.Video.Title, entry.Channel.Title
+				}
+
+				rows = append(rows, row)
+			}
+
+			if leaderboardOutput == "json" {
+				if err := renderJSON(os.Stdout, rows); err != nil {
+					fmt.Printf("Something went wrong %v", err)
+				}
+				return
+			}
+
+			t := table.NewWriter()
+			t.SetOutputMirror(os.Stdout)
+
+			if by == leaderboard.BY_VIDEOS {
+				t.AppendHeader(table.Row{"#", "Title and Channel", "Views", fmt.Sprintf("Gain (%s)", leaderboardWindow)})
+			} else {
+				t.AppendHeader(table.Row{"#", "Channel", "Videos", "Views", fmt.Sprintf("Gain (%s)", leaderboardWindow)})
+			}
+
+			partial := false
+			for _, row := range rows {
+				partial = partial || row.Partial
+
+				if by == leaderboard.BY_VIDEOS {
+					t.AppendRow(table.Row{row.Rank, fmt.Sprintf("%s\n%s", row.Title, row.Channel), row.Views, describeGain(row.Gain, row.Partial)})
+				} else {
+					t.AppendRow(table.Row{row.Rank, row.Title, row.Videos, row.Views, describeGain(row.Gain, row.Partial)})
+				}
+				t.AppendSeparator()
+			}
+
+			if partial {
+				t.AppendFooter(table.Row{"", "* history doesn't cover the whole window"})
+			}
+
+			t.Render()
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(leaderboardCmd)
+
+	// leaderboard --by=channels
+	leaderboardCmd.Flags().StringVar(&leaderboardBy, "by", string(leaderboard.BY_VIDEOS), "Rank either videos or channels.")
+
+	// leaderboard --window=week
+	leaderboardCmd.Flags().StringVarP(&leaderboardWindow, "window", "w", "day", "Window of the gain, either hour, day, week or a duration like 6h.")
+
+	// leaderboard --limit=10
+	leaderboardCmd.Flags().IntVarP(&leaderboardLimit, "limit", "l", 10, "Number of entries to show, 0 shows everything.")
+
+	// leaderboard --output=json
+	leaderboardCmd.Flags().StringVarP(&leaderboardOutput, "output", "o", "table", "Output format, either table or json.")
+}
@@ -0,0 +1,223 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/lease"
+	"github.com/ricomonster/black-flag/internal/scheduler"
+	"github.com/ricomonster/black-flag/internal/shard"
+	"github.com/spf13/cobra"
+)
+
+// Leases of the instances refreshing the videos, refresh for all of them, refresh/2-of-4 for a shard and
+// refresh/worker/<holder> for the auto shard. Instances that split the videos differently wait for each other.
+var REFRESH_LEASE = "refresh"
+
+// Returned when instances splitting the videos differently are refreshing them, e.g. a sharded watch and an update
+var errOtherSplit = fmt.Errorf("%w by instances splitting the videos differently", lease.ErrHeld)
+
+// Flags of the commands refreshing the videos
+type leaseFlags struct {
+	store string
+	dir   string
+	mode  string
+	ttl   time.Duration
+	// The store was given rather than the default one
+	storeSet bool
+}
+
+func addLeaseFlags(cmd *cobra.Command, flags *leaseFlags, mode lease.Mode) {
+	// update --lease-store=file --lease-dir=/var/run/black-flag
+	cmd.Flags().StringVar(&flags.store, "lease-store", "file", "Where the lease is kept, either file for instances on the same machine, dynamodb once its table is created with init-table, or none.")
+	cmd.Flags().StringVar(&flags.dir, "lease-dir", filepath.Join(os.TempDir(), "black-flag"), "Directory of the leases when the lease store is file.")
+
+	// update --lease-mode=block
+	cmd.Flags().StringVar(&flags.mode, "lease-mode", string(mode), "What to do when another instance holds the lease, either block, skip or takeover to check every second until it is released or expires.")
+
+	// update --lease-ttl=2m
+	cmd.Flags().DurationVar(&flags.ttl, "lease-ttl", lease.DEFAULT_TTL, "How long the lease lasts without a heartbeat, i.e. how long a crashed instance blocks the others.")
+}
+
+// The store is nil when it is none
+func newLeaseStore(flags leaseFlags) (lease.Store, error) {
+	switch flags.store {
+	case "none":
+		return nil, nil
+	case "dynamodb":
+		return lease.NewStore()
+	case "file":
+		return lease.NewFileStore(flags.dir)
+	}
+
+	return nil, fmt.Errorf("invalid lease store %q, either dynamodb, file or none", flags.store)
+}
+
+// What the videos are refreshed under, ctx is cancelled once the lease is lost and lost tells why
+type refreshLease struct {
+	shard   scheduler.Shard
+	ctx     context.Context
+	release func() error
+	lost    func() error
+}
+
+// Waits for the lease of all the videos, or of the shard given as i/n or auto to split the videos between
+// the live workers. Nothing is held when the store is none.
+func acquireRefresh(ctx context.Context, flags leaseFlags, shardValue string, logger *slog.Logger) (refreshLease, error) {
+	refresh := refreshLease{
+		ctx:     ctx,
+		release: func() error { return nil },
+		lost:    func() error { return nil },
+	}
+
+	mode := lease.Mode(flags.mode)
+	if mode != lease.MODE_BLOCK && mode != lease.MODE_SKIP && mode != lease.MODE_TAKEOVER {
+		return refresh, fmt.Errorf("invalid lease mode %q, either block, skip or takeover", flags.mode)
+	}
+
+	var static *shard.Static
+	if shardValue != "" && shardValue != "auto" {
+		var err error
+		if static, err = shard.Parse(shardValue); err != nil {
+			return refresh, err
+		}
+		refresh.shard = static
+	}
+
+	// Shards usually run on several machines, the file store can't keep them apart
+	if shardValue != "" && !flags.storeSet {
+		return refresh, errors.New("sharding needs --lease-store, dynamodb across machines or file when every shard runs on this one")
+	}
+
+	store, err := newLeaseStore(flags)
+	if err == nil && store == nil && shardValue == "auto" {
+		err = errors.New("the auto shard needs a lease store to find the other workers")
+	}
+	if store == nil || err != nil {
+		return refresh, err
+	}
+
+	if flags.store == "file" {
+		logger.Warn("the leases are kept in files, only the instances on this machine wait for each other", "dir", flags.dir)
+	}
+
+	retry := lease.DEFAULT_RETRY_INTERVAL
+	if mode == lease.MODE_TAKEOVER {
+		retry = lease.TAKEOVER_RETRY_INTERVAL
+	}
+
+	for {
+		held, name, err := holdRefresh(ctx, store, mode, flags.ttl, static, shardValue == "auto", logger)
+		if err != nil {
+			return refresh, err
+		}
+		held.shard = refresh.shard
+
+		// Acquired first and checked after so two instances starting together can't both miss each other
+		others, err := otherSplits(store, name)
+		if err == nil && len(others) == 0 {
+			return held, nil
+		}
+
+		held.release()
+		if err != nil {
+			return refresh, err
+		}
+
+		err = fmt.Errorf("%w: %v", errOtherSplit, others[0])
+		if mode == lease.MODE_SKIP {
+			return refresh, err
+		}
+
+		logger.Info("waiting for the instances splitting the videos differently", "lease", name, "other", others[0].String())
+
+		timer := time.NewTimer(retry)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return refresh, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Acquires the lease of the videos we refresh and returns its name
+func holdRefresh(ctx context.Context, store lease.Store, mode lease.Mode, ttl time.Duration, static *shard.Static, auto bool, logger *slog.Logger) (refreshLease, string, error) {
+	held := refreshLease{}
+
+	if auto {
+		worker := lease.DefaultHolder()
+		prefix := REFRESH_LEASE + "/" + shard.WORKER_LEASE_PREFIX
+
+		dynamic, err := shard.Join(ctx, store, shard.DynamicOptions{Worker: worker, Prefix: prefix, TTL: ttl, Logger: logger})
+		if err != nil {
+			return held, "", fmt.Errorf("unable to join the workers: %w", err)
+		}
+
+		held.shard, held.ctx, held.release, held.lost = dynamic, dynamic.Context(), dynamic.Leave, dynamic.Err
+		return held, prefix + worker, nil
+	}
+
+	name := REFRESH_LEASE
+	if static != nil {
+		name = fmt.Sprintf("%s/%d-of-%d", REFRESH_LEASE, static.Index, static.Count)
+	}
+
+	locker := lease.NewLocker(store, lease.Options{TTL: ttl, Mode: mode, Logger: logger})
+	handle, err := locker.Acquire(ctx, name)
+	if err != nil {
+		return held, "", fmt.Errorf("unable to acquire the lease: %w", err)
+	}
+
+	held.ctx, held.release, held.lost = handle.Context(), handle.Release, handle.Err
+	return held, name, nil
+}
+
+// Live refresh leases whose videos overlap ours, only the shards of the same count and the auto workers
+// split the videos between them
+func otherSplits(store lease.Store, name string) ([]lease.Lease, error) {
+	leases, err := store.List(REFRESH_LEASE)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	split := splitOf(name)
+
+	var others []lease.Lease
+	for _, l := range leases {
+		if l.Name == name || l.Expired(now) || split != "" && splitOf(l.Name) == split {
+			continue
+		}
+		others = append(others, l)
+	}
+
+	return others, nil
+}
+
+// How the lease splits the videos, e.g. "of-4" or "worker", empty when it refreshes all of them
+func splitOf(name string) string {
+	rest, ok := strings.CutPrefix(name, REFRESH_LEASE+"/")
+	if !ok {
+		return ""
+	}
+
+	if strings.HasPrefix(rest, shard.WORKER_LEASE_PREFIX) {
+		return "worker"
+	}
+
+	if _, count, ok := strings.Cut(rest, "-of-"); ok {
+		return "of-" + count
+	}
+
+	return ""
+}
@@ -0,0 +1,87 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/spf13/cobra"
+)
+
+// listCmd represents the list command
+var (
+	listChannel string
+	listCmd     = &cobra.Command{
+		Use:   "list",
+		Short: "Lists the tracked videos and when they will be refreshed",
+		Run: func(_ *cobra.Command, _ []string) {
+			// Instantiate the video lib
+			videoLib, err := videos.NewVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			var allVideos []videos.VideoDdbAttributes
+			if listChannel != "" {
+				allVideos, err = videoLib.GetChannelVideos(listChannel)
+			} else {
+				allVideos, err = videoLib.GetVideos()
+			}
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			schedule := videoLib.Schedule()
+
+			// Videos that are due first
+			sort.Slice(allVideos, func(i, j int) bool {
+				return schedule.NextPollAt(allVideos[i]) < schedule.NextPollAt(allVideos[j])
+			})
+
+			t := table.NewWriter()
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"Title and Channel", "Views", "Last Run", "Interval", "Next Poll"})
+
+			now := time.Now()
+			for _, item := range allVideos {
+				views := 0
+				if len(item.ViewLogs) > 0 {
+					views = item.ViewLogs[len(item.ViewLogs)-1].Views
+				}
+
+				nextPollAt := time.Unix(schedule.NextPollAt(item), 0)
+
+				nextPoll := "due"
+				if nextPollAt.After(now) {
+					nextPoll = fmt.Sprintf("%s (in %s)", nextPollAt.Local().Format(time.DateTime), nextPollAt.Sub(now).Round(time.Minute))
+				}
+
+				t.AppendRow(table.Row{
+					fmt.Sprintf("%s\n%s", item.Title, item.Channel.Title),
+					views,
+					time.Unix(item.LastActivityAt, 0).Local(),
+					schedule.IntervalFor(item).Round(time.Minute),
+					nextPoll,
+				})
+				t.AppendSeparator()
+			}
+
+			t.Render()
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+
+	// list --channel=UC...
+	listCmd.Flags().StringVar(&listChannel, "channel", "", "Only lists the videos of the channel id.")
+}
@@ -0,0 +1,112 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/metrics"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/spf13/cobra"
+)
+
+// metricsCmd represents the metrics command
+var (
+	metricsAddr      string
+	metricsLogFormat string
+	metricsCmd       = &cobra.Command{
+		Use:   "metrics",
+		Short: "Starts a Prometheus exporter for the tracked videos",
+		Run: func(_ *cobra.Command, _ []string) {
+			logger := newLogger(metricsLogFormat)
+
+			// Instantiate the video lib
+			videoLib, err := videos.NewVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			// Stop gracefully once we receive a signal
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			if err := serveMetrics(ctx, metricsAddr, videoLib, logger); err != nil {
+				logger.Error("metrics server stopped", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+type videoLister interface {
+	GetVideos() ([]videos.VideoDdbAttributes, error)
+}
+
+// Reads the latest stats of every tracked video for the exporter
+func videoStatsSource(videoLib videoLister) func() ([]metrics.VideoStat, error) {
+	return func() ([]metrics.VideoStat, error) {
+		allVideos, err := videoLib.GetVideos()
+		if err != nil {
+			return nil, err
+		}
+
+		var stats []metrics.VideoStat
+		for _, item := range allVideos {
+			stat := metrics.VideoStat{Id: item.Id, Title: item.Title, Channel: item.Channel.Title}
+
+			if len(item.ViewLogs) > 0 {
+				lastItem := item.ViewLogs[len(item.ViewLogs)-1]
+				stat.Views, stat.Likes, stat.Comments = lastItem.Views, lastItem.Likes, lastItem.Comments
+			}
+
+			stats = append(stats, stat)
+		}
+
+		return stats, nil
+	}
+}
+
+// Serves /metrics on its own address until the context is cancelled
+func serveMetrics(ctx context.Context, addr string, videoLib videoLister, logger *slog.Logger) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(videoStatsSource(videoLib)))
+
+	httpServer := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		_ = httpServer.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("metrics server started", "addr", addr)
+
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(metricsCmd)
+
+	// metrics --addr=:9090
+	metricsCmd.Flags().StringVar(&metricsAddr, "addr", ":9090", "Address the metrics server listens to.")
+
+	// metrics --log-format=json
+	metricsCmd.Flags().StringVar(&metricsLogFormat, "log-format", "text", "Log format, either text or json.")
+}
@@ -0,0 +1,112 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+var OUTPUT_FORMATS = []string{"table", "json"}
+
+// The shape of a processed video when rendered as JSON
+type videoResultOutput struct {
+	Id      string `json:"id"`
+	Title   string `json:"title"`
+	Channel string `json:"channel"`
+	// Left out when the samples were not read, e.g. for the videos update only lists
+	Views      *int       `json:"views,omitempty"`
+	Added      *int       `json:"added,omitempty"`
+	LastRun    *time.Time `json:"last_run,omitempty"`
+	Status     string     `json:"status"`
+	EligibleAt *time.Time `json:"eligible_at,omitempty"`
+	EligibleIn string     `json:"eligible_in,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	// Only filled in by view
+	Anomalies []anomalyOutput `json:"anomalies,omitempty"`
+}
+
+func validateOutput(output string) error {
+	for _, format := range OUTPUT_FORMATS {
+		if output == format {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown output format %q, expected one of %v", output, OUTPUT_FORMATS)
+}
+
+// Returns the latest recorded views, how much were added since the previous run and when that previous run happened
+func latestViews(video videos.VideoDdbAttributes) (int, int, time.Time) {
+	if len(video.ViewLogs) == 0 {
+		return 0, 0, time.Time{}
+	}
+
+	// Get the last item in ViewLogs
+	lastIndex := len(video.ViewLogs) - 1
+	lastItem := video.ViewLogs[lastIndex]
+
+	// First time
+	if lastIndex == 0 || video.ViewLogs[lastIndex-1].Views == 0 {
+		return lastItem.Views, 0, time.Unix(lastItem.Timestamp, 0).Local()
+	}
+
+	beforeLastItem := video.ViewLogs[lastIndex-1]
+
+	return lastItem.Views, lastItem.Views - beforeLastItem.Views, time.Unix(beforeLastItem.Timestamp, 0).Local()
+}
+
+// Human readable status of a processed video
+func describeStatus(result videos.ProcessVideoStatResult, now time.Time) string {
+	switch result.Status {
+	case videos.STATUS_THROTTLED:
+		return fmt.Sprintf("throttled (eligible in %s)", result.EligibleIn(now).Round(time.Second))
+	case videos.STATUS_FAILED:
+		return fmt.Sprintf("failed: %v", result.Error)
+	default:
+		return string(result.Status)
+	}
+}
+
+func newVideoResultOutput(result videos.ProcessVideoStatResult, now time.Time) videoResultOutput {
+	views, added, lastRun := latestViews(result.Video)
+
+	output := videoResultOutput{
+		Id:      result.Video.Id,
+		Title:   result.Video.Title,
+		Channel: result.Video.Channel.Title,
+		Status:  string(result.Status),
+	}
+
+	if len(result.Video.ViewLogs) > 0 {
+		output.Views, output.Added = &views, &added
+	}
+
+	if !lastRun.IsZero() {
+		output.LastRun = &lastRun
+	}
+
+	if result.Status == videos.STATUS_THROTTLED {
+		eligibleAt := time.Unix(result.EligibleAt, 0).Local()
+		output.EligibleAt = &eligibleAt
+		output.EligibleIn = result.EligibleIn(now).Round(time.Second).String()
+	}
+
+	if result.Error != nil {
+		output.Error = result.Error.Error()
+	}
+
+	return output
+}
+
+func renderJSON(w io.Writer, data any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(data)
+}
@@ -0,0 +1,136 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/notify"
+	"github.com/ricomonster/black-flag/internal/report"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/spf13/cobra"
+)
+
+// How long the notifiers are given to deliver the report
+var REPORT_NOTIFY_TIMEOUT = 30 * time.Second
+
+// reportCmd represents the report command
+var (
+	reportPeriod   string
+	reportFormat   string
+	reportTemplate string
+	reportTop      int
+	reportOut      string
+	reportNotify   []string
+	reportCmd      = &cobra.Command{
+		Use:   "report",
+		Short: "Builds a digest of the top gainers, milestones, anomalies and channels",
+		Run: func(_ *cobra.Command, _ []string) {
+			period, err := report.ParsePeriod(reportPeriod)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(0)
+			}
+
+			format := report.Format(reportFormat)
+			if err := report.ValidateFormat(format); err != nil {
+				fmt.Println(err)
+				os.Exit(0)
+			}
+
+			// Check the notifiers before doing any work
+			var notifiers map[string]notify.Notifier
+			if len(reportNotify) > 0 {
+				notifiers, err = loadNotifiers()
+				if err != nil {
+					fmt.Printf("Something went wrong %v", err)
+					os.Exit(0)
+				}
+
+				for _, name := range reportNotify {
+					if _, ok := notifiers[name]; !ok {
+						fmt.Printf("Unknown notifier %q, add it under notifiers in the config file.\n", name)
+						os.Exit(0)
+					}
+				}
+			}
+
+			// Instantiate the video lib
+			videoLib, err := videos.NewVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			allVideos, err := videoLib.GetVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			digest := report.Build(allVideos, reportPeriod, period, time.Now(), report.Options{Top: reportTop})
+
+			var rendered bytes.Buffer
+			if err := report.Render(&rendered, digest, format, reportTemplate); err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			// Deliver it, otherwise we write it out
+			if len(reportNotify) > 0 {
+				ctx, cancel := context.WithTimeout(context.Background(), REPORT_NOTIFY_TIMEOUT)
+				defer cancel()
+
+				message := notify.Message{Title: digest.Title, Text: rendered.String(), Data: digest}
+				for _, name := range reportNotify {
+					if err := notifiers[name].Notify(ctx, message); err != nil {
+						fmt.Printf("Unable to send the report to %s: %v\n", name, err)
+						continue
+					}
+
+					fmt.Printf("Report was sent to %s.\n", name)
+				}
+				return
+			}
+
+			if reportOut != "" {
+				if err := os.WriteFile(reportOut, rendered.Bytes(), 0644); err != nil {
+					fmt.Printf("Something went wrong %v", err)
+					os.Exit(0)
+				}
+
+				fmt.Printf("Report was saved to %s.\n", reportOut)
+				return
+			}
+
+			_, _ = os.Stdout.Write(rendered.Bytes())
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(reportCmd)
+
+	// report --period=week
+	reportCmd.Flags().StringVarP(&reportPeriod, "period", "p", "week", "Period the report covers, either day, week or month.")
+
+	// report --format=html
+	reportCmd.Flags().StringVarP(&reportFormat, "format", "f", string(report.FORMAT_MARKDOWN), "Either markdown, html or text.")
+
+	// report --template=./weekly.md.tmpl
+	reportCmd.Flags().StringVarP(&reportTemplate, "template", "t", "", "Go template to render the report with instead of the built in one.")
+
+	// report --top=5
+	reportCmd.Flags().IntVar(&reportTop, "top", report.DEFAULT_TOP, "Number of top gainers to include.")
+
+	// report --out=report.html
+	reportCmd.Flags().StringVar(&reportOut, "out", "", "File to write the report to instead of the terminal.")
+
+	// report --notify=slack
+	reportCmd.Flags().StringSliceVar(&reportNotify, "notify", []string{}, "Notifiers to send the report to instead of writing it out.")
+}
@@ -0,0 +1,125 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/alerts"
+	"github.com/ricomonster/black-flag/internal/backup"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/spf13/cobra"
+)
+
+// restoreCmd represents the restore command
+var (
+	restoreAsOf       string
+	restorePassphrase string
+	restoreDryRun     bool
+	restoreCmd        = &cobra.Command{
+		Use:   "restore [backup]",
+		Short: "Restores the videos, samples and alerts from a backup",
+		Args:  cobra.ExactArgs(1),
+		Run: func(_ *cobra.Command, args []string) {
+			file, err := os.Open(args[0])
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+			defer file.Close()
+
+			dataset, manifest, err := backup.Read(file, backupPassphraseOf(restorePassphrase))
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			fmt.Printf("Backup made on %s, version %d.\n", manifest.CreatedAt.Local().Format(time.DateTime), manifest.Version)
+			if len(manifest.Tables) > 0 {
+				fmt.Printf("Covers %s.\n", strings.Join(manifest.Tables, ", "))
+			}
+
+			if restoreAsOf != "" {
+				asOf, err := parseExportTime(restoreAsOf, time.Now())
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(0)
+				}
+
+				dataset = dataset.AsOf(asOf)
+				fmt.Printf("Restoring as of %s.\n", asOf.Local().Format(time.DateTime))
+			}
+
+			summary := fmt.Sprintf("%d videos with %d samples, %d alert rules and %d alert states",
+				len(dataset.Videos), dataset.Samples(), len(dataset.AlertRules), len(dataset.AlertState))
+
+			if restoreDryRun {
+				fmt.Printf("Dry run, would restore %s.\n", summary)
+				return
+			}
+
+			// Instantiate the video lib
+			videoLib, err := videos.NewVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			// Written one video at a time above its stored version, a partial failure still stops the restore
+			// so it can be run again
+			if err := videoLib.PutVideos(dataset.Videos); err != nil {
+				fmt.Printf("Something went wrong restoring the videos: %v", err)
+				os.Exit(0)
+			}
+
+			if len(dataset.AlertRules) > 0 {
+				ruleStore, err := alerts.NewRuleStore()
+				if err != nil {
+					fmt.Printf("Something went wrong %v", err)
+					os.Exit(0)
+				}
+
+				for _, rule := range dataset.AlertRules {
+					if err := ruleStore.SaveRule(rule); err != nil {
+						fmt.Printf("Something went wrong restoring the rule %s: %v", rule.Id, err)
+						os.Exit(0)
+					}
+				}
+			}
+
+			if len(dataset.AlertState) > 0 {
+				stateStore, err := alerts.NewStateStore()
+				if err != nil {
+					fmt.Printf("Something went wrong %v", err)
+					os.Exit(0)
+				}
+
+				for _, state := range dataset.AlertState {
+					if err := stateStore.Replace(state); err != nil {
+						fmt.Printf("Something went wrong restoring the alert state %s: %v", state.Id, err)
+						os.Exit(0)
+					}
+				}
+			}
+
+			fmt.Printf("Restored %s.\n", summary)
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+
+	// restore --as-of=2024-01-31
+	restoreCmd.Flags().StringVar(&restoreAsOf, "as-of", "", "Drops the samples after this date or duration ago, e.g. 2024-01-31 or 24h.")
+
+	// restore --passphrase=secret
+	restoreCmd.Flags().StringVar(&restorePassphrase, "passphrase", "", "Passphrase of an encrypted backup, defaults to "+BACKUP_PASSPHRASE_ENV+".")
+
+	// restore --dry-run
+	restoreCmd.Flags().BoolVar(&restoreDryRun, "dry-run", false, "Verifies the backup and shows what would be restored without saving anything.")
+}
@@ -0,0 +1,162 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/lease"
+	"github.com/ricomonster/black-flag/internal/metrics"
+	"github.com/ricomonster/black-flag/internal/scheduler"
+	"github.com/ricomonster/black-flag/internal/server"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/spf13/cobra"
+)
+
+// serveCmd represents the serve command
+var (
+	serveAddr      string
+	serveApiKey    string
+	serveNoAuth    bool
+	serveLogFormat string
+	serveWatch     bool
+	serveTick      time.Duration
+	serveWorkers   int
+	serveLease     leaseFlags
+	serveShard     string
+	serveCmd       = &cobra.Command{
+		Use:   "serve",
+		Short: "Starts an HTTP server exposing the tracked videos through a JSON API and a dashboard",
+		Run: func(cmd *cobra.Command, _ []string) {
+			logger := newLogger(serveLogFormat)
+
+			if serveApiKey == "" {
+				serveApiKey = os.Getenv("BLACK_FLAG_API_KEY")
+			}
+
+			if serveApiKey == "" && !serveNoAuth {
+				fmt.Println("An API key is required, set BLACK_FLAG_API_KEY or --api-key (or pass --no-auth).")
+				os.Exit(0)
+			}
+
+			// Instantiate the video lib
+			videoLib, err := videos.NewVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			// Evaluate the alert rules on every new sample
+			if err := setupAlerts(videoLib, logger); err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			handler := server.NewServer(videoLib, server.Options{ApiKey: serveApiKey, Logger: logger})
+
+			// Push the new samples to the dashboards
+			videoLib.OnSample(handler.NotifySample)
+
+			// Prometheus usually scrapes without credentials so this one is public
+			handler.Handle("/metrics", metrics.Handler(videoStatsSource(videoLib)))
+
+			httpServer := &http.Server{
+				Addr:              serveAddr,
+				Handler:           handler,
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+
+			// Stop gracefully once we receive a signal
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			go func() {
+				<-ctx.Done()
+
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+
+				_ = httpServer.Shutdown(shutdownCtx)
+			}()
+
+			// Refresh the videos in the same process so the dashboards gets live updates
+			// Like watch only one instance refreshes the videos, or each shard. The server keeps serving while
+			// it waits for the lease and waits for it again when it is lost.
+			if serveWatch {
+				serveLease.storeSet = cmd.Flags().Changed("lease-store")
+				go func() {
+					for ctx.Err() == nil {
+						refresh, err := acquireRefresh(ctx, serveLease, serveShard, logger)
+						if err != nil {
+							if ctx.Err() == nil {
+								logger.Error("the videos are not refreshed", "error", err)
+							}
+							return
+						}
+
+						svc := scheduler.NewScheduler(videoLib, scheduler.Options{
+							Tick:    serveTick,
+							Workers: serveWorkers,
+							Shard:   refresh.shard,
+							Logger:  logger,
+						})
+
+						err = svc.Run(refresh.ctx)
+						if err == nil {
+							err = refresh.lost()
+						}
+						refresh.release()
+
+						if err != nil {
+							logger.Error("refreshes stopped, waiting for the lease again", "error", err)
+						}
+					}
+				}()
+			}
+
+			logger.Info("server started", "addr", serveAddr)
+
+			if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("server stopped", "error", err)
+				os.Exit(1)
+			}
+
+			logger.Info("server stopped")
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	// serve --addr=:8080
+	serveCmd.Flags().StringVar(&serveAddr, "addr", ":8080", "Address the HTTP server listens to.")
+
+	// serve --api-key=secret
+	serveCmd.Flags().StringVar(&serveApiKey, "api-key", "", "API key required from the clients, defaults to BLACK_FLAG_API_KEY.")
+
+	// serve --no-auth
+	serveCmd.Flags().BoolVar(&serveNoAuth, "no-auth", false, "Allows starting the server without an API key.")
+
+	// serve --watch --tick=1m --workers=4
+	serveCmd.Flags().BoolVar(&serveWatch, "watch", false, "Also refreshes the videos based on their schedule, like the watch command.")
+	serveCmd.Flags().DurationVar(&serveTick, "tick", time.Minute, "Longest time to wait before checking for videos that are due.")
+	serveCmd.Flags().IntVar(&serveWorkers, "workers", 4, "Number of videos to refresh at the same time.")
+
+	// serve --watch --lease-mode=block
+	addLeaseFlags(serveCmd, &serveLease, lease.MODE_BLOCK)
+
+	// serve --watch --shard=2/4 or --shard=auto
+	serveCmd.Flags().StringVar(&serveShard, "shard", "", "Only refreshes the videos of this shard, e.g. 2/4, or auto to split them between the live workers. Needs --lease-store.")
+
+	// serve --log-format=json
+	serveCmd.Flags().StringVar(&serveLogFormat, "log-format", "text", "Log format, either text or json.")
+}
@@ -4,106 +4,225 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"sync"
 	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/ricomonster/black-flag/internal/lease"
 	"github.com/ricomonster/black-flag/internal/videos"
 	"github.com/spf13/cobra"
 )
 
 // updateCmd represents the update command
-var updateCmd = &cobra.Command{
-	Use:   "update",
-	Short: "Updates and fetches video stats from Youtube API",
-	Run: func(_ *cobra.Command, _ []string) {
-		// Get the items from dynamodb
-		// Instantiate the video lib
-		videoLib, err := videos.NewVideos()
-		if err != nil {
-			fmt.Printf("Something went wrong %v", err)
-			os.Exit(0)
-		}
-
-		allVideos, err := videoLib.GetVideos()
-		if err != nil {
-			fmt.Printf("Something went wrong %v", err)
-			os.Exit(0)
-		}
-
-		// Create a channel to receive the results of the concurrent processing.
-		results := make(chan videos.VideoDdbAttributes)
+var (
+	updateForce  bool
+	updateOutput string
+	updateVideos []string
+	updateLease  leaseFlags
+	updateCmd    = &cobra.Command{
+		Use:   "update",
+		Short: "Updates and fetches video stats from Youtube API",
+		Run: func(_ *cobra.Command, _ []string) {
+			if err := validateOutput(updateOutput); err != nil {
+				fmt.Println(err)
+				os.Exit(0)
+			}
 
-		// Setup goroutine
-		var wg sync.WaitGroup
-		wg.Add(len(allVideos))
+			// Get the items from dynamodb
+			// Instantiate the video lib
+			videoLib, err := videos.NewVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
 
-		// Loop the videos
-		for _, item := range allVideos {
-			go func(item videos.VideoDdbAttributes) {
-				defer wg.Done()
-				// fmt.Printf("Processing %s\n", item.Title)
+			// Evaluate the alert rules on every new sample
+			if err := setupAlerts(videoLib, slog.Default()); err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
 
-				// Process
-				result, err := videoLib.ProcessVideoStat(item.Id)
-				if err != nil {
-					fmt.Printf("Error: %v", err)
+			// Another instance refreshing at the same time would spend the quota twice. Videos given by hand
+			// cost little and their writes are versioned so they don't wait for watch to let go of the lease.
+			// Sharded watches refresh the same videos so they keep update out too.
+			ctx := context.Background()
+			if len(updateVideos) == 0 {
+				refresh, err := acquireRefresh(ctx, updateLease, "", slog.Default())
+				if errors.Is(err, lease.ErrHeld) {
+					fmt.Printf("Skipping the update, %v\n", err)
 					return
 				}
+				if err != nil {
+					fmt.Printf("Something went wrong %v", err)
+					os.Exit(0)
+				}
 
-				// Send the result to the channel.
-				results <- result
-			}(item)
-		}
+				// Stop refreshing once someone else took the lease
+				ctx = refresh.ctx
+				defer func() {
+					if err := refresh.lost(); err != nil {
+						fmt.Fprintf(os.Stderr, "The lease was lost during the update: %v\n", err)
+					}
+					refresh.release()
+				}()
+			}
 
-		// Close the channel when all of the goroutines have finished processing their items.
-		go func() {
-			wg.Wait()
-			close(results)
-		}()
+			// Unless we are forced to, only the videos that are due are read in full. The others are
+			// still listed as throttled from their headers.
+			now := time.Now()
+			var allVideos, waiting []videos.VideoDdbAttributes
+			switch {
+			case len(updateVideos) > 0:
+				allVideos, err = findUpdateVideos(videoLib, updateVideos)
+			case updateForce:
+				allVideos, err = videoLib.GetVideos()
+			default:
+				allVideos, err = videoLib.GetDueVideos(now)
+				if err == nil {
+					waiting, err = videoLib.GetWaitingVideos(now)
+				}
+			}
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
 
-		t := table.NewWriter()
-		t.SetOutputMirror(os.Stdout)
-		t.AppendHeader(table.Row{"Title and Channel", "Views", "Added", "Last Run"})
+			// Create a channel to receive the results of the concurrent processing.
+			results := make(chan videos.ProcessVideoStatResult)
+
+			// Setup goroutine
+			var wg sync.WaitGroup
+			wg.Add(len(allVideos))
+
+			// Only videos that are due will be fetched from Youtube unless we are forced to
+			schedule := videoLib.Schedule()
+
+			// Loop the videos
+			for _, item := range allVideos {
+				go func(item videos.VideoDdbAttributes) {
+					defer wg.Done()
+
+					// The lease was lost, whoever took it refreshes the rest
+					if ctx.Err() != nil {
+						results <- videos.ProcessVideoStatResult{Video: item, Status: videos.STATUS_FAILED, Error: errors.New("not refreshed, the lease was lost")}
+						return
+					}
+
+					if !updateForce && !schedule.IsDue(item, now) {
+						results <- videoLib.Throttled(item)
+						return
+					}
+
+					// Process, failures are still sent so they are included in the output
+					result, _ := videoLib.ProcessVideoStat(item.Id, videos.ProcessVideoStatOptions{Force: updateForce, Stored: item})
+					if result.Video.Title == "" {
+						result.Video = item
+					}
+
+					// Send the result to the channel.
+					results <- result
+				}(item)
+			}
 
-		// Iterate over the channel to receive the results of the concurrent processing.
-		for result := range results {
-			// Get the last item in ViewLogs
-			lastIndex := len(result.ViewLogs) - 1
-			lastItem := result.ViewLogs[lastIndex]
+			// Eligible when the stored schedule says, the view logs were not read
+			wg.Add(len(waiting))
+			for _, item := range waiting {
+				go func(item videos.VideoDdbAttributes) {
+					defer wg.Done()
+					results <- videos.ProcessVideoStatResult{Video: item, Status: videos.STATUS_THROTTLED, EligibleAt: item.NextPollAt}
+				}(item)
+			}
+
+			// Close the channel when all of the goroutines have finished processing their items.
+			go func() {
+				wg.Wait()
+				close(results)
+			}()
 
-			var beforeLastItem videos.VideoViewAttributes
+			if updateOutput == "json" {
+				var rows []videoResultOutput
+				for result := range results {
+					rows = append(rows, newVideoResultOutput(result, now))
+				}
 
-			// Check if there's previous item after the last item
-			beforeLastIndex := lastIndex - 1
-			if beforeLastIndex > -1 && beforeLastIndex < len(result.ViewLogs) {
-				beforeLastItem = result.ViewLogs[beforeLastIndex]
+				if err := renderJSON(os.Stdout, rows); err != nil {
+					fmt.Printf("Something went wrong %v", err)
+				}
+				return
 			}
 
-			// First time
-			added := 0
-			lastRun := time.Unix(lastItem.Timestamp, 0).Local()
+			t := table.NewWriter()
+			t.SetOutputMirror(os.Stdout)
+			t.AppendHeader(table.Row{"Title and Channel", "Views", "Added", "Last Run", "Status"})
 
-			if beforeLastItem.Views != 0 {
-				added = lastItem.Views - beforeLastItem.Views
-				lastRun = time.Unix(beforeLastItem.Timestamp, 0).Local()
+			// Iterate over the channel to receive the results of the concurrent processing.
+			for result := range results {
+				views, added, lastRun := latestViews(result.Video)
+
+				// Listed from the headers, no samples to show
+				row := table.Row{fmt.Sprintf("%s\n%s", result.Video.Title, result.Video.Channel.Title), views, added, lastRun}
+				if len(result.Video.ViewLogs) == 0 {
+					row = table.Row{row[0], "-", "-", "-"}
+				}
+
+				t.AppendRow(append(row, describeStatus(result, now)))
+				t.AppendSeparator()
 			}
 
-			t.AppendRow(table.Row{
-				fmt.Sprintf("%s\n%s", result.Title, result.Channel.Title),
-				lastItem.Views,
-				added,
-				lastRun,
-			})
-			t.AppendSeparator()
+			t.Render()
+		},
+	}
+)
+
+// Reads the given videos at once, the ones we don't track are skipped
+func findUpdateVideos(videoLib interface {
+	FindVideos(ids []string) (map[string]videos.VideoDdbAttributes, error)
+}, list []string) ([]videos.VideoDdbAttributes, error) {
+	var ids []string
+	seen := map[string]bool{}
+	for _, video := range list {
+		id := videos.ParseVideoId(video)
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	found, err := videoLib.FindVideos(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []videos.VideoDdbAttributes
+	for _, id := range ids {
+		if item, ok := found[id]; ok {
+			items = append(items, item)
+			continue
 		}
 
-		t.Render()
-	},
+		fmt.Fprintf(os.Stderr, "Skipping %s, it is not tracked yet.\n", id)
+	}
+
+	return items, nil
 }
 
 func init() {
 	rootCmd.AddCommand(updateCmd)
+
+	// update --force
+	updateCmd.Flags().BoolVarP(&updateForce, "force", "f", false, "Fetches the stats of every video even if it was refreshed recently.")
+
+	// update --output=json
+	updateCmd.Flags().StringVarP(&updateOutput, "output", "o", "table", "Output format, either table or json.")
+
+	// update --video=abc --video=def
+	updateCmd.Flags().StringSliceVarP(&updateVideos, "video", "v", []string{}, "Only updates these videos, can be repeated.")
+
+	// update --lease-mode=skip, videos given with --video don't need the lease
+	addLeaseFlags(updateCmd, &updateLease, lease.MODE_SKIP)
 }
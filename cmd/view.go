@@ -5,29 +5,34 @@ package cmd
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/ricomonster/black-flag/internal/anomaly"
 	"github.com/ricomonster/black-flag/internal/videos"
 	"github.com/spf13/cobra"
 )
 
+// How many of the latest anomalies are shown
+var VIEW_ANOMALIES = 5
+
 // viewCmd represents the view command
 var (
-	showViews bool
-	viewCmd   = &cobra.Command{
+	showViews  bool
+	viewForce  bool
+	viewOutput string
+	viewCmd    = &cobra.Command{
 		Use: "view",
 		Run: func(cmd *cobra.Command, _ []string) {
-			video := cmd.Flags().Lookup("video").Value.String()
-
-			if strings.Contains(video, "?") {
-				// Split
-				splitString := strings.Split(video, "v=")
-				video = splitString[1]
+			if err := validateOutput(viewOutput); err != nil {
+				fmt.Println(err)
+				os.Exit(0)
 			}
 
+			video := videos.ParseVideoId(cmd.Flags().Lookup("video").Value.String())
+
 			// Instantiate the video lib
 			videoLib, err := videos.NewVideos()
 			if err != nil {
@@ -35,6 +40,12 @@ var (
 				os.Exit(0)
 			}
 
+			// Evaluate the alert rules on every new sample
+			if err := setupAlerts(videoLib, slog.Default()); err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
 			videoItem, err := videoLib.FindVideo(video)
 			if err != nil {
 				fmt.Printf("Something went wrong %v", err)
@@ -47,14 +58,25 @@ var (
 				os.Exit(0)
 			}
 
-			// Process the video
-			videoItem, err = videoLib.ProcessVideoStat(video)
-			if err != nil {
-				fmt.Printf("Something went wrong %v", err)
-				os.Exit(0)
+			// Process the video, if it fails we still show what we have stored
+			result, _ := videoLib.ProcessVideoStat(video, videos.ProcessVideoStatOptions{Force: viewForce})
+			if result.Status == videos.STATUS_FAILED {
+				result.Video = videoItem
 			}
 
-			renderVideoDetails(videoItem)
+			if viewOutput == "json" {
+				output := newVideoResultOutput(result, time.Now())
+				for _, a := range recentAnomalies(result.Video) {
+					output.Anomalies = append(output.Anomalies, newAnomalyOutput(a))
+				}
+
+				if err := renderJSON(os.Stdout, output); err != nil {
+					fmt.Printf("Something went wrong %v", err)
+				}
+				return
+			}
+
+			renderVideoDetails(result)
 		},
 	}
 )
@@ -62,8 +84,31 @@ var (
 func renderVideoHistory(video videos.VideoDdbAttributes) {
 }
 
+// The last few spikes and drops of the video
+func recentAnomalies(video videos.VideoDdbAttributes) []anomaly.Anomaly {
+	found := anomaly.Detect(video, anomaly.Options{})
+	if len(found) > VIEW_ANOMALIES {
+		found = found[len(found)-VIEW_ANOMALIES:]
+	}
+
+	return found
+}
+
 // Will render/show the basic video details and some comparison of the recorded view stat.
-func renderVideoDetails(video videos.VideoDdbAttributes) {
+func renderVideoDetails(result videos.ProcessVideoStatResult) {
+	video := result.Video
+
+	// Imported or restored without any sample
+	if len(video.ViewLogs) == 0 {
+		t := table.NewWriter()
+		t.SetOutputMirror(os.Stdout)
+		t.SetTitle(video.Title)
+		t.AppendRow(table.Row{"Current:", "no samples yet"})
+		t.AppendFooter(table.Row{"Status:", describeStatus(result, time.Now())})
+		t.Render()
+		return
+	}
+
 	// Get the last item in ViewLogs
 	lastIndex := len(video.ViewLogs) - 1
 	lastItem := video.ViewLogs[lastIndex]
@@ -90,6 +135,12 @@ func renderVideoDetails(video videos.VideoDdbAttributes) {
 		})
 	}
 
+	for _, a := range recentAnomalies(video) {
+		t.AppendRow(table.Row{"Anomaly:", describeAnomaly(a)})
+	}
+
+	t.AppendFooter(table.Row{"Status:", describeStatus(result, time.Now())})
+
 	t.Render()
 }
 
@@ -100,6 +151,12 @@ func init() {
 	viewCmd.Flags().StringP("video", "v", "", "Video ID or URL of the youtube video to view.")
 	_ = viewCmd.MarkFlagRequired("video")
 
+	// view --force
+	viewCmd.Flags().BoolVarP(&viewForce, "force", "f", false, "Fetches the stats even if the video was refreshed recently.")
+
+	// view --output=json
+	viewCmd.Flags().StringVarP(&viewOutput, "output", "o", "table", "Output format, either table or json.")
+
 	// view --show-history
 	viewCmd.Flags().BoolVarP(&showViews, "show-views", "s", true, "Shows the stored view logs for the video.")
 }
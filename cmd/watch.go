@@ -0,0 +1,177 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/lease"
+	"github.com/ricomonster/black-flag/internal/scheduler"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/spf13/cobra"
+)
+
+// watchCmd represents the watch command
+var (
+	watchInterval         time.Duration
+	watchAdaptive         bool
+	watchMinInterval      time.Duration
+	watchMaxInterval      time.Duration
+	watchChannelIntervals map[string]string
+	watchVideoIntervals   map[string]string
+	watchTick             time.Duration
+	watchWorkers          int
+	watchLogFormat        string
+	watchMetricsAddr      string
+	watchLease            leaseFlags
+	watchShard            string
+	watchCmd              = &cobra.Command{
+		Use:   "watch",
+		Short: "Keeps on running and refreshes each video stats based on its schedule",
+		Run: func(cmd *cobra.Command, _ []string) {
+			logger := newLogger(watchLogFormat)
+
+			// Instantiate the video lib
+			videoLib, err := videos.NewVideos()
+			if err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			// Evaluate the alert rules on every new sample
+			if err := setupAlerts(videoLib, logger); err != nil {
+				fmt.Printf("Something went wrong %v", err)
+				os.Exit(0)
+			}
+
+			// Flags wins over the env config
+			schedule := videoLib.Schedule()
+			if cmd.Flags().Changed("interval") {
+				schedule.Interval = watchInterval
+			}
+			if cmd.Flags().Changed("adaptive") {
+				schedule.Adaptive = watchAdaptive
+			}
+			if cmd.Flags().Changed("min-interval") {
+				schedule.MinInterval = watchMinInterval
+			}
+			if cmd.Flags().Changed("max-interval") {
+				schedule.MaxInterval = watchMaxInterval
+			}
+
+			for id, value := range watchChannelIntervals {
+				interval, err := time.ParseDuration(value)
+				if err != nil {
+					fmt.Printf("Invalid interval for channel %s: %v\n", id, err)
+					os.Exit(0)
+				}
+				schedule.Channels[id] = interval
+			}
+
+			for id, value := range watchVideoIntervals {
+				interval, err := time.ParseDuration(value)
+				if err != nil {
+					fmt.Printf("Invalid interval for video %s: %v\n", id, err)
+					os.Exit(0)
+				}
+				schedule.Videos[id] = interval
+			}
+
+			videoLib.SetSchedule(schedule)
+
+			// Stop gracefully once we receive a signal
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			// Expose the metrics next to the scheduler
+			if watchMetricsAddr != "" {
+				go func() {
+					if err := serveMetrics(ctx, watchMetricsAddr, videoLib, logger); err != nil {
+						logger.Error("metrics server stopped", "error", err)
+					}
+				}()
+			}
+
+			// Only one instance refreshes the videos, or each shard, the others wait for the lease
+			watchLease.storeSet = cmd.Flags().Changed("lease-store")
+			refresh, err := acquireRefresh(ctx, watchLease, watchShard, logger)
+			if err != nil {
+				logger.Error("unable to start", "error", err)
+				os.Exit(1)
+			}
+			defer refresh.release()
+
+			svc := scheduler.NewScheduler(videoLib, scheduler.Options{
+				Tick:    watchTick,
+				Workers: watchWorkers,
+				Shard:   refresh.shard,
+				Logger:  logger,
+			})
+
+			if err := svc.Run(refresh.ctx); err != nil {
+				logger.Error("watch stopped", "error", err)
+				os.Exit(1)
+			}
+
+			// Someone else refreshes the videos now
+			if err := refresh.lost(); err != nil {
+				logger.Error("watch stopped", "error", err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+// Creates the structured logger used by the long running commands
+func newLogger(format string) *slog.Logger {
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	}
+
+	return slog.New(slog.NewTextHandler(os.Stderr, nil))
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	// watch --interval=1h
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", videos.DEFAULT_POLL_INTERVAL, "Time between each refresh of a video when adaptive polling is off or has no data.")
+
+	// watch --adaptive=false
+	watchCmd.Flags().BoolVar(&watchAdaptive, "adaptive", true, "Computes the interval of each video from its age and recent growth.")
+
+	// watch --min-interval=5m --max-interval=24h
+	watchCmd.Flags().DurationVar(&watchMinInterval, "min-interval", videos.DEFAULT_MIN_POLL_INTERVAL, "Shortest interval the adaptive polling can use.")
+	watchCmd.Flags().DurationVar(&watchMaxInterval, "max-interval", videos.DEFAULT_MAX_POLL_INTERVAL, "Longest interval the adaptive polling can use.")
+
+	// watch --channel-interval=UCxxxx=30m
+	watchCmd.Flags().StringToStringVar(&watchChannelIntervals, "channel-interval", map[string]string{}, "Refresh interval override for a channel, e.g. UCxxxx=30m.")
+
+	// watch --video-interval=_Hu4GYtye5U=10m
+	watchCmd.Flags().StringToStringVar(&watchVideoIntervals, "video-interval", map[string]string{}, "Refresh interval override for a video, e.g. _Hu4GYtye5U=10m.")
+
+	// watch --tick=1m
+	watchCmd.Flags().DurationVar(&watchTick, "tick", time.Minute, "Longest time to wait before checking for videos that are due.")
+
+	// watch --workers=4
+	watchCmd.Flags().IntVar(&watchWorkers, "workers", 4, "Number of videos to refresh at the same time.")
+
+	// watch --metrics-addr=:9090
+	watchCmd.Flags().StringVar(&watchMetricsAddr, "metrics-addr", "", "Serves Prometheus metrics on this address when set.")
+
+	// watch --log-format=json
+	watchCmd.Flags().StringVar(&watchLogFormat, "log-format", "text", "Log format, either text or json.")
+
+	// watch --lease-mode=block
+	addLeaseFlags(watchCmd, &watchLease, lease.MODE_BLOCK)
+
+	// watch --shard=2/4 or --shard=auto
+	watchCmd.Flags().StringVar(&watchShard, "shard", "", "Only refreshes the videos of this shard, e.g. 2/4, or auto to split them between the live workers. Needs --lease-store.")
+}
@@ -0,0 +1,205 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb"
+	"github.com/ricomonster/black-flag/internal/notify"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+// How long the notifiers are given to deliver an alert
+var NOTIFY_TIMEOUT = 15 * time.Second
+
+type Alert struct {
+	Rule    Rule
+	Video   videos.VideoDdbAttributes
+	Value   float64
+	Reason  string
+	FiredAt time.Time
+}
+
+// Payload sent to the notifiers that accepts structured data
+type alertData struct {
+	Rule    string    `json:"rule"`
+	Type    RuleType  `json:"type"`
+	VideoId string    `json:"video_id"`
+	Title   string    `json:"title"`
+	Channel string    `json:"channel"`
+	Value   float64   `json:"value"`
+	Reason  string    `json:"reason"`
+	FiredAt time.Time `json:"fired_at"`
+}
+
+func (a Alert) Message() notify.Message {
+	return notify.Message{
+		Title: fmt.Sprintf("%s %s", a.Video.Title, a.Reason),
+		Text: fmt.Sprintf(
+			"Rule: %s (%s)\nVideo: %s\nChannel: %s\nhttps://www.youtube.com/watch?v=%s",
+			a.Rule.Id, a.Rule.Type, a.Video.Title, a.Video.Channel.Title, a.Video.Id,
+		),
+		Data: alertData{
+			Rule:    a.Rule.Id,
+			Type:    a.Rule.Type,
+			VideoId: a.Video.Id,
+			Title:   a.Video.Title,
+			Channel: a.Video.Channel.Title,
+			Value:   a.Value,
+			Reason:  a.Reason,
+			FiredAt: a.FiredAt,
+		},
+	}
+}
+
+type Engine struct {
+	rules     []Rule
+	notifiers map[string]notify.Notifier
+	state     StateStore
+	logger    *slog.Logger
+
+	// Samples of the same video can be evaluated concurrently
+	mu sync.Mutex
+}
+
+func NewEngine(rules []Rule, notifiers map[string]notify.Notifier, state StateStore, logger *slog.Logger) (*Engine, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+
+		for _, name := range rule.Notify {
+			if _, ok := notifiers[name]; !ok {
+				return nil, fmt.Errorf("rule %s uses an unknown notifier %q", rule.Id, name)
+			}
+		}
+	}
+
+	return &Engine{rules: rules, notifiers: notifiers, state: state, logger: logger}, nil
+}
+
+func (e *Engine) Rules() []Rule {
+	return e.rules
+}
+
+// Checks every rule against the latest sample of the video and sends the alerts.
+// This is meant to be registered through OnSample.
+func (e *Engine) Evaluate(video videos.VideoDdbAttributes) {
+	// Only the dedupe needs the lock, a slow notifier shouldn't hold up the other videos
+	for _, alert := range e.fired(video) {
+		if err := e.send(alert.Rule.Notify, alert.Message()); err != nil {
+			e.logger.Error("failed to send alert", "rule", alert.Rule.Id, "video", video.Id, "error", err)
+		}
+	}
+}
+
+// The alerts to send, they are marked as sent already
+func (e *Engine) fired(video videos.VideoDdbAttributes) []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+
+	var fired []Alert
+	for _, rule := range e.rules {
+		if !rule.Matches(video) {
+			continue
+		}
+
+		value, reason, ok := rule.Check(video)
+		if !ok {
+			continue
+		}
+
+		alert := Alert{Rule: rule, Video: video, Value: value, Reason: reason, FiredAt: now}
+		firing, err := e.fire(alert)
+		if err != nil {
+			e.logger.Error("failed to send alert", "rule", rule.Id, "video", video.Id, "error", err)
+			continue
+		}
+
+		if firing {
+			fired = append(fired, alert)
+		}
+	}
+
+	return fired
+}
+
+// Tells if the alert has to be sent, false when it was sent already or is in its cooldown
+func (e *Engine) fire(alert Alert) (bool, error) {
+	stateId := alert.Rule.Id + "#" + alert.Video.Id
+
+	state, err := e.state.Find(stateId)
+	if err != nil {
+		return false, err
+	}
+
+	// Dedupe, milestones are only sent once and the rest waits for the cooldown
+	if state.FiredAt != 0 {
+		if alert.Rule.Type == RULE_MILESTONE {
+			return false, nil
+		}
+
+		if alert.FiredAt.Sub(time.Unix(state.FiredAt, 0)) < alert.Rule.CooldownOrDefault() {
+			e.logger.Debug("alert in cooldown", "rule", alert.Rule.Id, "video", alert.Video.Id)
+			return false, nil
+		}
+	}
+
+	// Mark it first so a slow or failing notifier doesn't make us send it again.
+	// Only the instance whose save lands on the state it read sends it, the others lost the race.
+	err = e.state.Save(AlertState{
+		Id:      stateId,
+		Rule:    alert.Rule.Id,
+		Video:   alert.Video.Id,
+		Value:   alert.Value,
+		FiredAt: alert.FiredAt.Unix(),
+		Version: state.Version,
+	})
+	if errors.Is(err, dynamodb.ErrConflict) {
+		e.logger.Debug("alert sent by another instance", "rule", alert.Rule.Id, "video", alert.Video.Id)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	e.logger.Info("alert fired", "rule", alert.Rule.Id, "video", alert.Video.Id, "reason", alert.Reason)
+
+	return true, nil
+}
+
+func (e *Engine) send(names []string, message notify.Message) error {
+	targets := names
+	if len(targets) == 0 {
+		for name := range e.notifiers {
+			targets = append(targets, name)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), NOTIFY_TIMEOUT)
+	defer cancel()
+
+	var failed []string
+	for _, name := range targets {
+		if err := e.notifiers[name].Notify(ctx, message); err != nil {
+			e.logger.Error("notifier failed", "notifier", name, "error", err)
+			failed = append(failed, name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("notifiers failed: %v", failed)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package alerts_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/alerts"
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb"
+	"github.com/ricomonster/black-flag/internal/notify"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+type memoryStates struct {
+	mu     sync.Mutex
+	states map[string]alerts.AlertState
+	// When set every Find waits for the others, so the engines all read the same state
+	reads *sync.WaitGroup
+}
+
+func (m *memoryStates) Find(id string) (alerts.AlertState, error) {
+	m.mu.Lock()
+	state := m.states[id]
+	m.mu.Unlock()
+
+	if m.reads != nil {
+		m.reads.Done()
+		m.reads.Wait()
+	}
+
+	return state, nil
+}
+
+func (m *memoryStates) Save(state alerts.AlertState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.states[state.Id].Version != state.Version {
+		return dynamodb.ErrConflict
+	}
+
+	state.Version++
+	m.states[state.Id] = state
+	return nil
+}
+
+func (m *memoryStates) Replace(state alerts.AlertState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state.Version = m.states[state.Id].Version + 1
+	m.states[state.Id] = state
+	return nil
+}
+
+func (m *memoryStates) All() ([]alerts.AlertState, error) {
+	return nil, nil
+}
+
+type countingNotifier struct {
+	mu   sync.Mutex
+	sent int
+}
+
+func (n *countingNotifier) Name() string {
+	return "counting"
+}
+
+func (n *countingNotifier) Notify(ctx context.Context, message notify.Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.sent++
+	return nil
+}
+
+// Holds the alerts of the slow video until it is released
+type slowNotifier struct {
+	slow    string
+	release chan struct{}
+	sent    chan string
+}
+
+func (n *slowNotifier) Name() string {
+	return "slow"
+}
+
+func (n *slowNotifier) Notify(ctx context.Context, message notify.Message) error {
+	if strings.HasPrefix(message.Title, n.slow) {
+		select {
+		case <-n.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	n.sent <- message.Title
+	return nil
+}
+
+func TestEvaluateSlowNotifier(t *testing.T) {
+	notifier := &slowNotifier{slow: "Slow video", release: make(chan struct{}), sent: make(chan string, 2)}
+	rules := []alerts.Rule{{Id: "million", Type: alerts.RULE_MILESTONE, Threshold: 1000000}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	engine, err := alerts.NewEngine(rules, map[string]notify.Notifier{"slow": notifier}, &memoryStates{states: map[string]alerts.AlertState{}}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Unix()
+	video := func(id, title string) videos.VideoDdbAttributes {
+		return videos.VideoDdbAttributes{Id: id, Title: title, ViewLogs: []videos.VideoViewAttributes{
+			{Views: 990000, Timestamp: now - 60},
+			{Views: 1005000, Timestamp: now},
+		}}
+	}
+
+	go engine.Evaluate(video("slow", "Slow video"))
+	time.Sleep(50 * time.Millisecond)
+
+	// The other video is not held up by the alert being sent
+	done := make(chan struct{})
+	go func() {
+		engine.Evaluate(video("fast", "Fast video"))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("TestEvaluateSlowNotifier: the fast video waited for the slow notifier")
+	}
+	if title := <-notifier.sent; !strings.HasPrefix(title, "Fast video") {
+		t.Errorf("TestEvaluateSlowNotifier: expected the fast video first, got %s", title)
+	}
+
+	close(notifier.release)
+	if title := <-notifier.sent; !strings.HasPrefix(title, "Slow video") {
+		t.Errorf("TestEvaluateSlowNotifier: expected the slow video, got %s", title)
+	}
+}
+
+func TestEvaluateTwoInstances(t *testing.T) {
+	notifier := &countingNotifier{}
+	rules := []alerts.Rule{{Id: "million", Type: alerts.RULE_MILESTONE, Threshold: 1000000}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	reads := &sync.WaitGroup{}
+	reads.Add(2)
+	states := &memoryStates{states: map[string]alerts.AlertState{}, reads: reads}
+
+	now := time.Now().Unix()
+	video := videos.VideoDdbAttributes{Id: "video", Title: "Video", ViewLogs: []videos.VideoViewAttributes{
+		{Views: 990000, Timestamp: now - 60},
+		{Views: 1005000, Timestamp: now},
+	}}
+
+	// Two watch instances see the same sample and both find the alert not sent yet
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		engine, err := alerts.NewEngine(rules, map[string]notify.Notifier{"counting": notifier}, states, logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			engine.Evaluate(video)
+		}()
+	}
+	wg.Wait()
+
+	if notifier.sent != 1 {
+		t.Errorf("TestEvaluateTwoInstances: expected the alert to be sent once, got %d", notifier.sent)
+	}
+	if state := states.states["million#video"]; state.Version != 1 {
+		t.Errorf("TestEvaluateTwoInstances: expected the state to be saved once, got %+v", state)
+	}
+}
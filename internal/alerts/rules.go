@@ -0,0 +1,180 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/anomaly"
+	"github.com/ricomonster/black-flag/internal/series"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+type RuleType string
+
+var (
+	// Views reached the threshold, e.g. 1M views
+	RULE_MILESTONE RuleType = "milestone"
+	// Gained more than the threshold within the window
+	RULE_DELTA RuleType = "delta"
+	// Grew by more than the threshold percent within the window
+	RULE_PERCENT RuleType = "percent"
+	// Gained at most the threshold within the window
+	RULE_STALLED RuleType = "stalled"
+	// The latest per hour gain deviates from the video's own baseline, the threshold is the score
+	RULE_ANOMALY RuleType = "anomaly"
+)
+
+var RULE_TYPES = []RuleType{RULE_MILESTONE, RULE_DELTA, RULE_PERCENT, RULE_STALLED, RULE_ANOMALY}
+
+type Rule struct {
+	Id        string        `dynamodbav:"Id" dynamodbkey:"partition" mapstructure:"id"`
+	Type      RuleType      `dynamodbav:"Type" mapstructure:"type"`
+	Threshold float64       `dynamodbav:"Threshold" mapstructure:"threshold"`
+	Window    time.Duration `dynamodbav:"Window" mapstructure:"window"`
+	// Minimum time between two alerts of the same rule and video, milestones only fire once
+	Cooldown time.Duration `dynamodbav:"Cooldown" mapstructure:"cooldown"`
+	// Limits the rule to a video or channel, the rule applies to every video when both are empty
+	Video   string `dynamodbav:"Video" mapstructure:"video"`
+	Channel string `dynamodbav:"Channel" mapstructure:"channel"`
+	// Names of the notifiers to send the alert to, all notifiers when empty
+	Notify []string `dynamodbav:"Notify" mapstructure:"notify"`
+	// Where the rule came from, either config or store
+	Source string `dynamodbav:"-" mapstructure:"-"`
+}
+
+func (r Rule) Validate() error {
+	if r.Id == "" {
+		return errors.New("rule id is required")
+	}
+
+	known := false
+	for _, ruleType := range RULE_TYPES {
+		if r.Type == ruleType {
+			known = true
+		}
+	}
+	if !known {
+		return fmt.Errorf("rule %s has an unknown type %q", r.Id, r.Type)
+	}
+
+	// Anomalies fall back to the default score
+	if r.Type != RULE_STALLED && r.Type != RULE_ANOMALY && r.Threshold <= 0 {
+		return fmt.Errorf("rule %s requires a positive threshold", r.Id)
+	}
+
+	if r.Type != RULE_MILESTONE && r.Type != RULE_ANOMALY && r.Window <= 0 {
+		return fmt.Errorf("rule %s requires a window", r.Id)
+	}
+
+	return nil
+}
+
+// Checks if the rule applies to the video
+func (r Rule) Matches(video videos.VideoDdbAttributes) bool {
+	if r.Video != "" && r.Video != video.Id {
+		return false
+	}
+
+	if r.Channel != "" && r.Channel != video.Channel.Id {
+		return false
+	}
+
+	return true
+}
+
+// Time to wait before firing again for the same video
+func (r Rule) CooldownOrDefault() time.Duration {
+	if r.Cooldown > 0 {
+		return r.Cooldown
+	}
+
+	if r.Window > time.Hour {
+		return r.Window
+	}
+
+	return time.Hour
+}
+
+// Evaluates the rule against the latest sample of the video.
+// Returns the value that triggered the rule and a human readable reason.
+func (r Rule) Check(video videos.VideoDdbAttributes) (float64, string, bool) {
+	views := series.Views(video.ViewLogs)
+
+	last, ok := views.Last()
+	if !ok {
+		return 0, "", false
+	}
+
+	switch r.Type {
+	case RULE_MILESTONE:
+		// Only alert when we saw it cross the milestone, videos added above it are not news
+		if len(views) < 2 || last.Value < r.Threshold || views[len(views)-2].Value >= r.Threshold {
+			return 0, "", false
+		}
+
+		return last.Value, fmt.Sprintf("crossed %s views", formatNumber(r.Threshold)), true
+
+	case RULE_DELTA:
+		gain, _, ok := views.GainOver(r.Window, last.Timestamp)
+		if !ok || gain <= r.Threshold {
+			return 0, "", false
+		}
+
+		return gain, fmt.Sprintf("gained %s views in the last %s", formatNumber(gain), r.Window), true
+
+	case RULE_PERCENT:
+		gain, start, ok := views.GainOver(r.Window, last.Timestamp)
+		if !ok || start <= 0 {
+			return 0, "", false
+		}
+
+		percent := gain / start * 100
+		if percent <= r.Threshold {
+			return 0, "", false
+		}
+
+		return percent, fmt.Sprintf("grew by %.2f%% in the last %s", percent, r.Window), true
+
+	case RULE_STALLED:
+		gain, _, ok := views.GainOver(r.Window, last.Timestamp)
+		if !ok || gain > r.Threshold {
+			return 0, "", false
+		}
+
+		return gain, fmt.Sprintf("only gained %s views in the last %s", formatNumber(gain), r.Window), true
+
+	case RULE_ANOMALY:
+		found, ok := anomaly.Latest(video, anomaly.Options{Threshold: r.Threshold})
+		if !ok {
+			return 0, "", false
+		}
+
+		return found.Score, fmt.Sprintf(
+			"%s in views, %s/h against the usual %s/h", found.Kind, formatNumber(found.Rate), formatNumber(found.Baseline),
+		), true
+	}
+
+	return 0, "", false
+}
+
+func formatNumber(value float64) string {
+	switch {
+	case value >= 1e9:
+		return trim(value/1e9) + "B"
+	case value >= 1e6:
+		return trim(value/1e6) + "M"
+	case value >= 1e3:
+		return trim(value/1e3) + "K"
+	default:
+		return trim(value)
+	}
+}
+
+func trim(value float64) string {
+	if value == float64(int64(value)) {
+		return fmt.Sprintf("%d", int64(value))
+	}
+
+	return fmt.Sprintf("%.1f", value)
+}
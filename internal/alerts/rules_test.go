@@ -0,0 +1,78 @@
+package alerts_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/alerts"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+func TestRuleCheck(t *testing.T) {
+	now := time.Now().Unix()
+	hour := int64(time.Hour.Seconds())
+
+	video := videos.VideoDdbAttributes{
+		Id: "video",
+		ViewLogs: []videos.VideoViewAttributes{
+			{Views: 990000, Timestamp: now - 2*hour},
+			{Views: 995000, Timestamp: now - hour},
+			{Views: 1005000, Timestamp: now},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		rule  alerts.Rule
+		want  float64
+		fired bool
+	}{
+		{
+			name:  "milestone crossed",
+			rule:  alerts.Rule{Type: alerts.RULE_MILESTONE, Threshold: 1000000},
+			want:  1005000,
+			fired: true,
+		},
+		{
+			name: "milestone passed before",
+			rule: alerts.Rule{Type: alerts.RULE_MILESTONE, Threshold: 900000},
+		},
+		{
+			name:  "delta above threshold",
+			rule:  alerts.Rule{Type: alerts.RULE_DELTA, Threshold: 5000, Window: time.Hour},
+			want:  10000,
+			fired: true,
+		},
+		{
+			name: "delta below threshold",
+			rule: alerts.Rule{Type: alerts.RULE_DELTA, Threshold: 20000, Window: time.Hour},
+		},
+		{
+			name:  "percent above threshold",
+			rule:  alerts.Rule{Type: alerts.RULE_PERCENT, Threshold: 1, Window: 2 * time.Hour},
+			want:  1.5151515151515151,
+			fired: true,
+		},
+		{
+			name: "not stalled",
+			rule: alerts.Rule{Type: alerts.RULE_STALLED, Threshold: 100, Window: time.Hour},
+		},
+		{
+			name:  "window longer than the history",
+			rule:  alerts.Rule{Type: alerts.RULE_DELTA, Threshold: 1, Window: 24 * time.Hour},
+			fired: false,
+		},
+	}
+
+	for _, test := range tests {
+		value, _, fired := test.rule.Check(video)
+		if fired != test.fired {
+			t.Errorf("TestRuleCheck: %s expected fired to be %v, got %v", test.name, test.fired, fired)
+			continue
+		}
+
+		if fired && value != test.want {
+			t.Errorf("TestRuleCheck: %s expected %v, got %v", test.name, test.want, value)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package alerts
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb"
+	"github.com/ricomonster/black-flag/internal/config"
+)
+
+var (
+	RULES_TABLE = "BlackFlag_AlertRules"
+	STATE_TABLE = "BlackFlag_AlertState"
+
+	RULES_SCHEMA = dynamodb.TableSchema{
+		Name:    RULES_TABLE,
+		HashKey: dynamodb.KeyAttribute{Name: "Id", Type: types.ScalarAttributeTypeS},
+	}
+	STATE_SCHEMA = dynamodb.TableSchema{
+		Name:    STATE_TABLE,
+		HashKey: dynamodb.KeyAttribute{Name: "Id", Type: types.ScalarAttributeTypeS},
+	}
+)
+
+// Keeps track of when an alert was last sent for a rule and video so it only fires once
+type AlertState struct {
+	Id      string  `dynamodbav:"Id" dynamodbkey:"partition"`
+	Rule    string  `dynamodbav:"Rule"`
+	Video   string  `dynamodbav:"Video"`
+	Value   float64 `dynamodbav:"Value"`
+	FiredAt int64   `dynamodbav:"FiredAt"`
+	// Bumped on every save so two instances can't both mark the alert as theirs
+	Version int64 `dynamodbav:"Version" dynamodbversion:"true"`
+}
+
+type StateStore interface {
+	Find(id string) (AlertState, error)
+	// Only saves when the stored state is still at the version of state, dynamodb.ErrConflict otherwise
+	Save(state AlertState) error
+	// Saves whatever version is stored, e.g. when restoring a backup
+	Replace(state AlertState) error
+	All() ([]AlertState, error)
+}
+
+type ddbStateStore struct {
+	dynamodb *dynamodb.DynamoDB[AlertState]
+}
+
+func NewStateStore() (StateStore, error) {
+	ddb, err := dynamodb.NewDynamoDB[AlertState](STATE_TABLE)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ddbStateStore{dynamodb: ddb}, nil
+}
+
+func (s *ddbStateStore) Find(id string) (AlertState, error) {
+	return s.dynamodb.FindByKey(dynamodb.Key{Partition: id})
+}
+
+func (s *ddbStateStore) Save(state AlertState) error {
+	return s.dynamodb.PutItem(state)
+}
+
+func (s *ddbStateStore) Replace(state AlertState) error {
+	_, err := s.dynamodb.Replace(state)
+	return err
+}
+
+func (s *ddbStateStore) All() ([]AlertState, error) {
+	return s.dynamodb.GetAll()
+}
+
+// Manages the rules saved in the store, rules can also be declared in the config file
+type RuleStore struct {
+	dynamodb *dynamodb.DynamoDB[Rule]
+}
+
+func NewRuleStore() (*RuleStore, error) {
+	ddb, err := dynamodb.NewDynamoDB[Rule](RULES_TABLE)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RuleStore{dynamodb: ddb}, nil
+}
+
+func (s *RuleStore) GetRules() ([]Rule, error) {
+	rules, err := s.dynamodb.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range rules {
+		rules[i].Source = "store"
+	}
+
+	return rules, nil
+}
+
+func (s *RuleStore) FindRule(id string) (Rule, error) {
+	return s.dynamodb.FindByKey(dynamodb.Key{Partition: id})
+}
+
+func (s *RuleStore) SaveRule(rule Rule) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+
+	return s.dynamodb.PutItem(rule)
+}
+
+func (s *RuleStore) DeleteRule(id string) error {
+	return s.dynamodb.DeleteItem(dynamodb.Key{Partition: id})
+}
+
+// Reads the rules declared under alerts.rules in the config file
+func ConfigRules() ([]Rule, error) {
+	var rules []Rule
+	if err := config.UnmarshalKey("alerts.rules", &rules); err != nil {
+		return nil, err
+	}
+
+	for i := range rules {
+		rules[i].Source = "config"
+	}
+
+	return rules, nil
+}
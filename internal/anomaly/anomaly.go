@@ -0,0 +1,216 @@
+package anomaly
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/series"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+type Kind string
+
+var (
+	KIND_SPIKE Kind = "spike"
+	KIND_DROP  Kind = "drop"
+)
+
+var (
+	// How far from the baseline a sample has to be, in robust standard deviations
+	DEFAULT_THRESHOLD = 3.5
+	// Number of previous samples the rolling baseline is built from
+	DEFAULT_WINDOW = 24
+	// Samples needed before we trust the baseline at all
+	DEFAULT_MIN_SAMPLES = 8
+	// History needed before the baseline only uses samples from the same hour of the day
+	DEFAULT_SEASONAL_AFTER = 7 * 24 * time.Hour
+	// Samples from the same hour of the day needed for the seasonal baseline
+	DEFAULT_SEASONAL_SAMPLES = 5
+)
+
+// Scales the median absolute deviation so it is comparable to a standard deviation
+const madScale = 1.4826
+
+type Options struct {
+	Threshold       float64
+	Window          int
+	MinSamples      int
+	SeasonalAfter   time.Duration
+	SeasonalSamples int
+}
+
+type Anomaly struct {
+	Video     videos.VideoDdbAttributes
+	Timestamp int64
+	// Views gained per hour for the sample and what we expected
+	Rate     float64
+	Baseline float64
+	// Deviation from the baseline, negative for drops
+	Score    float64
+	Kind     Kind
+	Seasonal bool
+}
+
+func (o Options) withDefaults() Options {
+	if o.Threshold <= 0 {
+		o.Threshold = DEFAULT_THRESHOLD
+	}
+
+	if o.Window <= 0 {
+		o.Window = DEFAULT_WINDOW
+	}
+
+	if o.MinSamples <= 0 {
+		o.MinSamples = DEFAULT_MIN_SAMPLES
+	}
+
+	if o.SeasonalAfter <= 0 {
+		o.SeasonalAfter = DEFAULT_SEASONAL_AFTER
+	}
+
+	if o.SeasonalSamples <= 0 {
+		o.SeasonalSamples = DEFAULT_SEASONAL_SAMPLES
+	}
+
+	return o
+}
+
+// Flags every sample whose per hour gain deviates strongly from the video's own history
+func Detect(video videos.VideoDdbAttributes, options Options) []Anomaly {
+	options = options.withDefaults()
+	rates := series.Views(video.ViewLogs).Rates()
+
+	var anomalies []Anomaly
+	for i := range rates {
+		if anomaly, ok := check(video, rates, i, options); ok {
+			anomalies = append(anomalies, anomaly)
+		}
+	}
+
+	return anomalies
+}
+
+// Checks only the latest sample, used when a new sample is recorded
+func Latest(video videos.VideoDdbAttributes, options Options) (Anomaly, bool) {
+	options = options.withDefaults()
+	rates := series.Views(video.ViewLogs).Rates()
+	if len(rates) == 0 {
+		return Anomaly{}, false
+	}
+
+	return check(video, rates, len(rates)-1, options)
+}
+
+func check(video videos.VideoDdbAttributes, rates series.Series, i int, options Options) (Anomaly, bool) {
+	baseline, seasonal := baselineFor(rates, i, options)
+	if len(baseline) < options.MinSamples {
+		return Anomaly{}, false
+	}
+
+	center, spread := robustStats(baseline)
+	if spread == 0 {
+		// A flat history, only the mean and stddev can tell how unusual this is
+		center, spread = meanStddev(baseline)
+		if spread == 0 {
+			return Anomaly{}, false
+		}
+	}
+
+	rate := rates[i].Value
+	score := (rate - center) / spread
+	if math.Abs(score) < options.Threshold {
+		return Anomaly{}, false
+	}
+
+	kind := KIND_SPIKE
+	if score < 0 {
+		kind = KIND_DROP
+	}
+
+	return Anomaly{
+		Video:     video,
+		Timestamp: rates[i].Timestamp,
+		Rate:      rate,
+		Baseline:  center,
+		Score:     score,
+		Kind:      kind,
+		Seasonal:  seasonal,
+	}, true
+}
+
+// Picks the samples the i-th rate is compared against. Once there's enough history we only
+// compare with the same hour of the day so the usual daily peaks are not flagged.
+func baselineFor(rates series.Series, i int, options Options) ([]float64, bool) {
+	history := rates[:i]
+	if len(history) == 0 {
+		return nil, false
+	}
+
+	span := time.Duration(rates[i].Timestamp-history[0].Timestamp) * time.Second
+	if span >= options.SeasonalAfter {
+		hour := time.Unix(rates[i].Timestamp, 0).UTC().Hour()
+
+		var sameHour []float64
+		for j := len(history) - 1; j >= 0 && len(sameHour) < options.Window; j-- {
+			if time.Unix(history[j].Timestamp, 0).UTC().Hour() == hour {
+				sameHour = append(sameHour, history[j].Value)
+			}
+		}
+
+		if len(sameHour) >= options.SeasonalSamples {
+			return sameHour, true
+		}
+	}
+
+	start := len(history) - options.Window
+	if start < 0 {
+		start = 0
+	}
+
+	values := make([]float64, 0, len(history)-start)
+	for _, point := range history[start:] {
+		values = append(values, point.Value)
+	}
+
+	return values, false
+}
+
+// Median and the scaled median absolute deviation, a few spikes in the history don't move them
+func robustStats(values []float64) (float64, float64) {
+	center := median(values)
+
+	deviations := make([]float64, len(values))
+	for i, value := range values {
+		deviations[i] = math.Abs(value - center)
+	}
+
+	return center, median(deviations) * madScale
+}
+
+func meanStddev(values []float64) (float64, float64) {
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	mean := sum / float64(len(values))
+
+	var squares float64
+	for _, value := range values {
+		squares += (value - mean) * (value - mean)
+	}
+
+	return mean, math.Sqrt(squares / float64(len(values)))
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+
+	return sorted[middle]
+}
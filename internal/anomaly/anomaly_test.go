@@ -0,0 +1,94 @@
+package anomaly_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/anomaly"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+// Builds hourly samples from the views gained every hour
+func hourly(start int64, gains []int) []videos.VideoViewAttributes {
+	logs := []videos.VideoViewAttributes{{Views: 1000, Timestamp: start}}
+	for i, gain := range gains {
+		last := logs[len(logs)-1]
+		logs = append(logs, videos.VideoViewAttributes{Views: last.Views + gain, Timestamp: start + int64(i+1)*3600})
+	}
+
+	return logs
+}
+
+func TestDetect(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+
+	tests := []struct {
+		name  string
+		gains []int
+		want  []anomaly.Kind
+	}{
+		{
+			name:  "steady",
+			gains: []int{100, 110, 90, 105, 95, 100, 102, 98, 101, 99, 100},
+		},
+		{
+			name:  "spike",
+			gains: []int{100, 110, 90, 105, 95, 100, 102, 98, 101, 99, 1000},
+			want:  []anomaly.Kind{anomaly.KIND_SPIKE},
+		},
+		{
+			name:  "drop",
+			gains: []int{100, 110, 90, 105, 95, 100, 102, 98, 101, 99, 0},
+			want:  []anomaly.Kind{anomaly.KIND_DROP},
+		},
+		{
+			name:  "not enough history",
+			gains: []int{100, 110, 1000},
+		},
+	}
+
+	for _, test := range tests {
+		video := videos.VideoDdbAttributes{Id: "video", ViewLogs: hourly(start, test.gains)}
+
+		got := anomaly.Detect(video, anomaly.Options{})
+		if len(got) != len(test.want) {
+			t.Errorf("TestDetect: %s expected %d anomalies, got %d", test.name, len(test.want), len(got))
+			continue
+		}
+
+		for i, kind := range test.want {
+			if got[i].Kind != kind {
+				t.Errorf("TestDetect: %s expected a %s, got a %s", test.name, kind, got[i].Kind)
+			}
+		}
+	}
+}
+
+func TestDetectSeasonal(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+
+	// Every evening the video gets ten times the views, that is expected after a week
+	var gains []int
+	for day := 0; day < 10; day++ {
+		for hour := 0; hour < 24; hour++ {
+			gain := 100 + (day+hour)%5
+			if hour == 19 {
+				gain = 1000 + day
+			}
+			gains = append(gains, gain)
+		}
+	}
+
+	video := videos.VideoDdbAttributes{Id: "video", ViewLogs: hourly(start, gains)}
+
+	for _, got := range anomaly.Detect(video, anomaly.Options{}) {
+		if got.Seasonal && got.Kind == anomaly.KIND_SPIKE {
+			t.Errorf("TestDetectSeasonal: expected the daily peak at %s not to be flagged", time.Unix(got.Timestamp, 0).UTC())
+		}
+	}
+
+	latest, ok := anomaly.Latest(video, anomaly.Options{})
+	if ok {
+		t.Errorf("TestDetectSeasonal: expected the latest sample to be normal, got %s with score %.2f", latest.Kind, latest.Score)
+	}
+}
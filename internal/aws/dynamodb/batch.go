@@ -0,0 +1,252 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Limits of BatchGetItem and BatchWriteItem
+var (
+	BATCH_GET_SIZE   = 100
+	BATCH_WRITE_SIZE = 25
+)
+
+// How often and how long we wait before sending the items DynamoDB didn't process again
+var (
+	BATCH_RETRIES     = 5
+	BATCH_BACKOFF     = 50 * time.Millisecond
+	BATCH_MAX_BACKOFF = 2 * time.Second
+)
+
+// Returned when DynamoDB still didn't process an item after all the retries
+var ErrUnprocessed = errors.New("the item was not processed")
+
+// Errors of the items of a batch that failed, by the value of their key as given by Key.String.
+// The other items went through.
+type BatchErrors map[string]error
+
+func (e BatchErrors) Error() string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	messages := make([]string, 0, len(keys))
+	for _, key := range keys {
+		messages = append(messages, fmt.Sprintf("%s: %v", key, e[key]))
+	}
+
+	return fmt.Sprintf("%d items failed: %s", len(e), strings.Join(messages, "; "))
+}
+
+// Nil when nothing failed so it can be returned as an error
+func (e BatchErrors) orNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+// Reads the items with the given keys by the value of their key as given by Key.String,
+// items that don't exist are not in the result
+func (ddb *DynamoDB[T]) BatchGet(keys []Key) (map[string]T, error) {
+	results := map[string]T{}
+	failed := BatchErrors{}
+
+	marshalled, err := ddb.marshalKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	for start := 0; start < len(marshalled); start += BATCH_GET_SIZE {
+		chunk := marshalled[start:min(start+BATCH_GET_SIZE, len(marshalled))]
+
+		pending := map[string]types.KeysAndAttributes{ddb.table: {Keys: chunk}}
+		err := retryBatch(func() (bool, error) {
+			response, err := ddb.client.BatchGetItem(context.TODO(), &dynamodb.BatchGetItemInput{RequestItems: pending})
+			if err != nil {
+				trackError("BatchGetItem")
+				return false, err
+			}
+
+			for _, item := range response.Responses[ddb.table] {
+				var result T
+				if err := ddb.decode(item, &result); err != nil {
+					failed[ddb.keys.stringOf(item)] = err
+					continue
+				}
+
+				results[ddb.keys.stringOf(item)] = result
+			}
+
+			pending = response.UnprocessedKeys
+			return len(pending[ddb.table].Keys) > 0, nil
+		})
+
+		// Whatever is still pending failed
+		if err != nil {
+			for _, pendingKey := range pending[ddb.table].Keys {
+				failed[ddb.keys.stringOf(pendingKey)] = err
+			}
+		}
+	}
+
+	return results, failed.orNil()
+}
+
+// Writes the items, items with the same key value are only written once with the last one winning.
+// Batches can't be conditioned, the version of versioned items is incremented but never checked, so this
+// can move the version of a stored item backwards. Use Replace for items others may be writing.
+func (ddb *DynamoDB[T]) BatchPut(items []T) error {
+	marshalled := make([]map[string]types.AttributeValue, 0, len(items))
+	for _, item := range items {
+		// Whoever read the item before has to read it again
+		if ddb.version != nil {
+			ddb.version.set(&item, ddb.version.get(&item)+1)
+		}
+
+		raw, err := attributevalue.MarshalMap(item)
+		if err != nil {
+			return err
+		}
+
+		marshalled = append(marshalled, raw)
+	}
+
+	return ddb.BatchPutRaw(marshalled)
+}
+
+// Writes the items as they are, without going through T. Used by the migrations.
+func (ddb *DynamoDB[T]) BatchPutRaw(items []map[string]types.AttributeValue) error {
+	failed := BatchErrors{}
+
+	var requests []types.WriteRequest
+	positions := map[string]int{}
+	for _, item := range items {
+		if _, ok := item[ddb.keys.Partition.Name]; !ok {
+			return fmt.Errorf("an item has no %s", ddb.keys.Partition.Name)
+		}
+		value := ddb.keys.stringOf(item)
+
+		request := types.WriteRequest{PutRequest: &types.PutRequest{Item: item}}
+
+		// DynamoDB rejects a batch with the same key twice
+		if position, ok := positions[value]; ok {
+			requests[position] = request
+			continue
+		}
+
+		positions[value] = len(requests)
+		requests = append(requests, request)
+	}
+
+	ddb.batchWrite(requests, failed)
+
+	return failed.orNil()
+}
+
+// Deletes the items with the given keys
+func (ddb *DynamoDB[T]) BatchDelete(keys []Key) error {
+	failed := BatchErrors{}
+
+	marshalled, err := ddb.marshalKeys(keys)
+	if err != nil {
+		return err
+	}
+
+	var requests []types.WriteRequest
+	for _, key := range marshalled {
+		requests = append(requests, types.WriteRequest{DeleteRequest: &types.DeleteRequest{Key: key}})
+	}
+
+	ddb.batchWrite(requests, failed)
+
+	return failed.orNil()
+}
+
+func (ddb *DynamoDB[T]) batchWrite(requests []types.WriteRequest, failed BatchErrors) {
+	for start := 0; start < len(requests); start += BATCH_WRITE_SIZE {
+		pending := map[string][]types.WriteRequest{ddb.table: requests[start:min(start+BATCH_WRITE_SIZE, len(requests))]}
+
+		err := retryBatch(func() (bool, error) {
+			response, err := ddb.client.BatchWriteItem(context.TODO(), &dynamodb.BatchWriteItemInput{RequestItems: pending})
+			if err != nil {
+				trackError("BatchWriteItem")
+				return false, err
+			}
+
+			pending = response.UnprocessedItems
+			return len(pending[ddb.table]) > 0, nil
+		})
+
+		// Whatever is still pending failed
+		if err != nil {
+			for _, request := range pending[ddb.table] {
+				failed[ddb.requestKey(request)] = err
+			}
+		}
+	}
+}
+
+// Calls the batch until nothing is left to process, waiting longer and longer in between
+func retryBatch(call func() (bool, error)) error {
+	backoff := BATCH_BACKOFF
+
+	for attempt := 0; ; attempt++ {
+		left, err := call()
+		if err != nil {
+			return err
+		}
+
+		if !left {
+			return nil
+		}
+
+		if attempt == BATCH_RETRIES {
+			return ErrUnprocessed
+		}
+
+		time.Sleep(backoff)
+		backoff = min(backoff*2, BATCH_MAX_BACKOFF)
+	}
+}
+
+func (ddb *DynamoDB[T]) requestKey(request types.WriteRequest) string {
+	if request.PutRequest != nil {
+		return ddb.keys.stringOf(request.PutRequest.Item)
+	}
+
+	return ddb.keys.stringOf(request.DeleteRequest.Key)
+}
+
+// The keys as sent to DynamoDB without the duplicates, which it rejects
+func (ddb *DynamoDB[T]) marshalKeys(keys []Key) ([]map[string]types.AttributeValue, error) {
+	seen := map[string]bool{}
+
+	var marshalled []map[string]types.AttributeValue
+	for _, key := range keys {
+		value, err := ddb.keys.marshal(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[ddb.keys.stringOf(value)] {
+			continue
+		}
+		seen[ddb.keys.stringOf(value)] = true
+
+		marshalled = append(marshalled, value)
+	}
+
+	return marshalled, nil
+}
@@ -0,0 +1,891 @@
+// Package ddbtest is an in-memory stand-in for DynamoDB so tests never touch AWS.
+package ddbtest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// Hash key used by every table of the app
+var DEFAULT_KEY = "Id"
+
+type table struct {
+	// The hash key then the range key when the table has one
+	keys        []string
+	items       map[string]item
+	description types.TableDescription
+	ttl         types.TimeToLiveDescription
+}
+
+// Fake implements dynamodb.Client with the tables kept in memory
+type Fake struct {
+	mu          sync.Mutex
+	tables      map[string]*table
+	failures    map[string][]error
+	unprocessed map[string][]int
+	calls       map[string]int
+	pageSize    int32
+}
+
+// Stops every scan and query after size items like DynamoDB does after 1 MB, 0 reads everything at once
+func (f *Fake) SetPageSize(size int32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.pageSize = size
+}
+
+// The number of items a scan or query reads, 0 when there is no limit
+func (f *Fake) limit(limit *int32) int32 {
+	if limit != nil && *limit > 0 && (f.pageSize == 0 || *limit < f.pageSize) {
+		return *limit
+	}
+
+	return f.pageSize
+}
+
+// Creates a fake with the given tables, each keyed by Id
+func New(tables ...string) *Fake {
+	f := &Fake{tables: map[string]*table{}, failures: map[string][]error{}, unprocessed: map[string][]int{}, calls: map[string]int{}}
+	for _, name := range tables {
+		f.AddTable(name, DEFAULT_KEY)
+	}
+
+	return f
+}
+
+// Adds an empty table keyed by a string attribute, calls to unknown tables fail like they do on AWS
+func (f *Fake) AddTable(name string, key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.tables[name] = newTable(name, []types.KeySchemaElement{{AttributeName: aws.String(key), KeyType: types.KeyTypeHash}}, []types.AttributeDefinition{
+		{AttributeName: aws.String(key), AttributeType: types.ScalarAttributeTypeS},
+	})
+}
+
+func newTable(name string, schema []types.KeySchemaElement, definitions []types.AttributeDefinition) *table {
+	var keys []string
+	for _, keyType := range []types.KeyType{types.KeyTypeHash, types.KeyTypeRange} {
+		for _, element := range schema {
+			if element.KeyType == keyType {
+				keys = append(keys, aws.ToString(element.AttributeName))
+			}
+		}
+	}
+
+	return &table{
+		keys:  keys,
+		items: map[string]item{},
+		description: types.TableDescription{
+			TableName:            aws.String(name),
+			TableStatus:          types.TableStatusActive,
+			KeySchema:            schema,
+			AttributeDefinitions: definitions,
+			BillingModeSummary:   &types.BillingModeSummary{BillingMode: types.BillingModePayPerRequest},
+		},
+		ttl: types.TimeToLiveDescription{TimeToLiveStatus: types.TimeToLiveStatusDisabled},
+	}
+}
+
+// Makes the next call of the operation, e.g. "PutItem", return the error
+func (f *Fake) FailNext(operation string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failures[operation] = append(f.failures[operation], err)
+}
+
+// Makes the next call of the batch operation, "BatchGetItem" or "BatchWriteItem", leave the last count
+// requests unprocessed like DynamoDB does when it is throttling
+func (f *Fake) UnprocessNext(operation string, count int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.unprocessed[operation] = append(f.unprocessed[operation], count)
+}
+
+// Requests to leave unprocessed by this call of the batch operation, must be called with the lock held
+func (f *Fake) skipped(operation string) int {
+	counts := f.unprocessed[operation]
+	if len(counts) == 0 {
+		return 0
+	}
+
+	f.unprocessed[operation] = counts[1:]
+	return counts[0]
+}
+
+// Number of times the operation was called
+func (f *Fake) Calls(operation string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.calls[operation]
+}
+
+// Items of the table sorted by key
+func (f *Fake) Items(name string) []map[string]types.AttributeValue {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t, ok := f.tables[name]
+	if !ok {
+		return nil
+	}
+
+	var items []map[string]types.AttributeValue
+	for _, key := range t.sortedKeys() {
+		items = append(items, copyItem(t.items[key]))
+	}
+
+	return items
+}
+
+// Counts the call and returns the injected failure if any, must be called with the lock held
+func (f *Fake) begin(operation string) error {
+	f.calls[operation]++
+
+	if failures := f.failures[operation]; len(failures) > 0 {
+		f.failures[operation] = failures[1:]
+		return failures[0]
+	}
+
+	return nil
+}
+
+func (f *Fake) table(name *string) (*table, error) {
+	t, ok := f.tables[aws.ToString(name)]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("Requested resource not found: Table: " + aws.ToString(name) + " not found")}
+	}
+
+	return t, nil
+}
+
+// Map key of an item made of its hash and range key
+func (t *table) keyOf(key map[string]types.AttributeValue) (string, error) {
+	var mapKey strings.Builder
+	for _, name := range t.keys {
+		switch value := key[name].(type) {
+		case *types.AttributeValueMemberS:
+			if value.Value == "" {
+				return "", validationError(fmt.Sprintf("The provided key element %s is an empty string", name))
+			}
+			mapKey.WriteString("S" + value.Value)
+		case *types.AttributeValueMemberN:
+			mapKey.WriteString("N" + value.Value)
+		case *types.AttributeValueMemberB:
+			if len(value.Value) == 0 {
+				return "", validationError(fmt.Sprintf("The provided key element %s is an empty binary", name))
+			}
+			mapKey.WriteString("B" + string(value.Value))
+		default:
+			return "", validationError(fmt.Sprintf("The provided key element does not match the schema, expected %s", strings.Join(t.keys, ", ")))
+		}
+
+		mapKey.WriteByte(0)
+	}
+
+	return mapKey.String(), nil
+}
+
+// The key attributes of an item, e.g. for LastEvaluatedKey
+func (t *table) keyAttributes(current item) map[string]types.AttributeValue {
+	key := map[string]types.AttributeValue{}
+	for _, name := range t.keys {
+		key[name] = current[name]
+	}
+
+	return key
+}
+
+func (t *table) sortedKeys() []string {
+	keys := make([]string, 0, len(t.items))
+	for key := range t.items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Validation errors have no dedicated type in the SDK
+func validationError(message string) error {
+	return &smithy.GenericAPIError{Code: "ValidationException", Message: message, Fault: smithy.FaultClient}
+}
+
+func conditionFailed() error {
+	return &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed")}
+}
+
+// Checks the condition expression against the current item, a missing item is an empty one.
+// The current item is part of the error when it is asked for with ReturnValuesOnConditionCheckFailure.
+func checkCondition(expr *string, names map[string]string, values map[string]types.AttributeValue, current item, returnValues types.ReturnValuesOnConditionCheckFailure) error {
+	if aws.ToString(expr) == "" {
+		return nil
+	}
+
+	cond, err := parseCondition(aws.ToString(expr), placeholders{names: names, values: values})
+	if err != nil {
+		return validationError("Invalid ConditionExpression: " + err.Error())
+	}
+
+	if current == nil {
+		if !cond(item{}) {
+			return conditionFailed()
+		}
+		return nil
+	}
+
+	if !cond(current) {
+		if returnValues == types.ReturnValuesOnConditionCheckFailureAllOld {
+			return &types.ConditionalCheckFailedException{Message: aws.String("The conditional request failed"), Item: copyItem(current)}
+		}
+		return conditionFailed()
+	}
+
+	return nil
+}
+
+func (f *Fake) ListTables(_ context.Context, params *dynamodb.ListTablesInput, _ ...func(*dynamodb.Options)) (*dynamodb.ListTablesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin("ListTables"); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range f.tables {
+		if params.ExclusiveStartTableName == nil || name > *params.ExclusiveStartTableName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return &dynamodb.ListTablesOutput{TableNames: names}, nil
+}
+
+// Tables and indexes are active right away
+func (f *Fake) DescribeTable(_ context.Context, params *dynamodb.DescribeTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin("DescribeTable"); err != nil {
+		return nil, err
+	}
+
+	t, err := f.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	description := t.description
+	description.ItemCount = aws.Int64(int64(len(t.items)))
+
+	return &dynamodb.DescribeTableOutput{Table: &description}, nil
+}
+
+func (f *Fake) CreateTable(_ context.Context, params *dynamodb.CreateTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin("CreateTable"); err != nil {
+		return nil, err
+	}
+
+	name := aws.ToString(params.TableName)
+	if _, exists := f.tables[name]; exists {
+		return nil, &types.ResourceInUseException{Message: aws.String("Table already exists: " + name)}
+	}
+
+	hashKeys := 0
+	for _, element := range params.KeySchema {
+		if element.KeyType == types.KeyTypeHash {
+			hashKeys++
+		}
+	}
+	if hashKeys != 1 {
+		return nil, validationError("A single hash key is required")
+	}
+
+	t := newTable(name, params.KeySchema, params.AttributeDefinitions)
+	t.description.BillingModeSummary = &types.BillingModeSummary{BillingMode: params.BillingMode}
+	for _, index := range params.GlobalSecondaryIndexes {
+		t.description.GlobalSecondaryIndexes = append(t.description.GlobalSecondaryIndexes, types.GlobalSecondaryIndexDescription{
+			IndexName:   index.IndexName,
+			KeySchema:   index.KeySchema,
+			Projection:  index.Projection,
+			IndexStatus: types.IndexStatusActive,
+		})
+	}
+	f.tables[name] = t
+
+	description := t.description
+	return &dynamodb.CreateTableOutput{TableDescription: &description}, nil
+}
+
+// Only adding global secondary indexes is supported
+func (f *Fake) UpdateTable(_ context.Context, params *dynamodb.UpdateTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin("UpdateTable"); err != nil {
+		return nil, err
+	}
+
+	t, err := f.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, update := range params.GlobalSecondaryIndexUpdates {
+		if update.Create == nil {
+			continue
+		}
+
+		for _, index := range t.description.GlobalSecondaryIndexes {
+			if aws.ToString(index.IndexName) == aws.ToString(update.Create.IndexName) {
+				return nil, validationError("Attempting to create an index which already exists")
+			}
+		}
+
+		t.description.GlobalSecondaryIndexes = append(t.description.GlobalSecondaryIndexes, types.GlobalSecondaryIndexDescription{
+			IndexName:   update.Create.IndexName,
+			KeySchema:   update.Create.KeySchema,
+			Projection:  update.Create.Projection,
+			IndexStatus: types.IndexStatusActive,
+		})
+	}
+
+	for _, definition := range params.AttributeDefinitions {
+		if !hasDefinition(t.description.AttributeDefinitions, aws.ToString(definition.AttributeName)) {
+			t.description.AttributeDefinitions = append(t.description.AttributeDefinitions, definition)
+		}
+	}
+
+	description := t.description
+	return &dynamodb.UpdateTableOutput{TableDescription: &description}, nil
+}
+
+func hasDefinition(definitions []types.AttributeDefinition, name string) bool {
+	for _, definition := range definitions {
+		if aws.ToString(definition.AttributeName) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *Fake) DescribeTimeToLive(_ context.Context, params *dynamodb.DescribeTimeToLiveInput, _ ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin("DescribeTimeToLive"); err != nil {
+		return nil, err
+	}
+
+	t, err := f.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := t.ttl
+	return &dynamodb.DescribeTimeToLiveOutput{TimeToLiveDescription: &ttl}, nil
+}
+
+// Items are never expired by the fake, the setting is only recorded
+func (f *Fake) UpdateTimeToLive(_ context.Context, params *dynamodb.UpdateTimeToLiveInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin("UpdateTimeToLive"); err != nil {
+		return nil, err
+	}
+
+	t, err := f.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	specification := params.TimeToLiveSpecification
+	if specification == nil {
+		return nil, validationError("A time to live specification is required")
+	}
+
+	t.ttl = types.TimeToLiveDescription{AttributeName: specification.AttributeName, TimeToLiveStatus: types.TimeToLiveStatusDisabled}
+	if aws.ToBool(specification.Enabled) {
+		t.ttl.TimeToLiveStatus = types.TimeToLiveStatusEnabled
+	}
+
+	return &dynamodb.UpdateTimeToLiveOutput{TimeToLiveSpecification: specification}, nil
+}
+
+func (f *Fake) Scan(_ context.Context, params *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin("Scan"); err != nil {
+		return nil, err
+	}
+
+	t, err := f.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	var filter condition
+	if expr := aws.ToString(params.FilterExpression); expr != "" {
+		filter, err = parseCondition(expr, placeholders{names: params.ExpressionAttributeNames, values: params.ExpressionAttributeValues})
+		if err != nil {
+			return nil, validationError("Invalid FilterExpression: " + err.Error())
+		}
+	}
+
+	start := ""
+	if params.ExclusiveStartKey != nil {
+		if start, err = t.keyOf(params.ExclusiveStartKey); err != nil {
+			return nil, err
+		}
+	}
+
+	limit := f.limit(params.Limit)
+
+	output := &dynamodb.ScanOutput{}
+	for _, key := range t.sortedKeys() {
+		if start != "" && key <= start {
+			continue
+		}
+
+		// Limit counts the items read, not the ones that passed the filter
+		if limit > 0 && output.ScannedCount == limit {
+			output.LastEvaluatedKey = t.keyAttributes(t.items[start])
+			break
+		}
+
+		output.ScannedCount++
+		start = key
+
+		if filter != nil && !filter(t.items[key]) {
+			continue
+		}
+
+		output.Items = append(output.Items, copyItem(t.items[key]))
+		output.Count++
+	}
+
+	return output, nil
+}
+
+// Items are sorted by the range key of the table or the index, then by the table key
+func (f *Fake) Query(_ context.Context, params *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin("Query"); err != nil {
+		return nil, err
+	}
+
+	t, err := f.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := t.description.KeySchema
+	if index := aws.ToString(params.IndexName); index != "" {
+		found := false
+		for _, gsi := range t.description.GlobalSecondaryIndexes {
+			if aws.ToString(gsi.IndexName) == index {
+				schema, found = gsi.KeySchema, true
+			}
+		}
+
+		if !found {
+			return nil, validationError("The table does not have the specified index: " + index)
+		}
+	}
+
+	var keyNames []string
+	var rangeKey string
+	for _, element := range schema {
+		keyNames = append(keyNames, aws.ToString(element.AttributeName))
+		if element.KeyType == types.KeyTypeRange {
+			rangeKey = aws.ToString(element.AttributeName)
+		}
+	}
+
+	queryParams := placeholders{names: params.ExpressionAttributeNames, values: params.ExpressionAttributeValues}
+	keyCondition, err := parseCondition(aws.ToString(params.KeyConditionExpression), queryParams)
+	if err != nil {
+		return nil, validationError("Invalid KeyConditionExpression: " + err.Error())
+	}
+
+	var filter condition
+	if expr := aws.ToString(params.FilterExpression); expr != "" {
+		if filter, err = parseCondition(expr, queryParams); err != nil {
+			return nil, validationError("Invalid FilterExpression: " + err.Error())
+		}
+	}
+
+	// Indexes are sparse, items without the key attributes are not in them
+	var keys []string
+	for _, key := range t.sortedKeys() {
+		complete := true
+		for _, name := range keyNames {
+			if _, ok := t.items[key][name]; !ok {
+				complete = false
+			}
+		}
+
+		if complete && keyCondition(t.items[key]) {
+			keys = append(keys, key)
+		}
+	}
+
+	if rangeKey != "" {
+		sort.SliceStable(keys, func(i, j int) bool {
+			cmp, _ := compare(t.items[keys[i]][rangeKey], t.items[keys[j]][rangeKey])
+			return cmp < 0
+		})
+	}
+
+	if params.ScanIndexForward != nil && !*params.ScanIndexForward {
+		for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
+
+	if params.ExclusiveStartKey != nil {
+		start, err := t.keyOf(params.ExclusiveStartKey)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, key := range keys {
+			if key == start {
+				keys = keys[i+1:]
+				break
+			}
+		}
+	}
+
+	limit := f.limit(params.Limit)
+
+	output := &dynamodb.QueryOutput{}
+	for i, key := range keys {
+		if limit > 0 && output.ScannedCount == limit {
+			last := t.items[keys[i-1]]
+
+			output.LastEvaluatedKey = t.keyAttributes(last)
+			for _, name := range keyNames {
+				output.LastEvaluatedKey[name] = last[name]
+			}
+			break
+		}
+
+		output.ScannedCount++
+
+		if filter != nil && !filter(t.items[key]) {
+			continue
+		}
+
+		output.Items = append(output.Items, copyItem(t.items[key]))
+		output.Count++
+	}
+
+	return output, nil
+}
+
+func (f *Fake) BatchGetItem(_ context.Context, params *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin("BatchGetItem"); err != nil {
+		return nil, err
+	}
+
+	type request struct {
+		table string
+		key   map[string]types.AttributeValue
+	}
+
+	var requests []request
+	for name, keys := range params.RequestItems {
+		for _, key := range keys.Keys {
+			requests = append(requests, request{table: name, key: key})
+		}
+	}
+
+	if len(requests) > 100 {
+		return nil, validationError("Too many items requested for the BatchGetItem call")
+	}
+
+	skip := f.skipped("BatchGetItem")
+	if skip > len(requests) {
+		skip = len(requests)
+	}
+
+	output := &dynamodb.BatchGetItemOutput{
+		Responses:       map[string][]map[string]types.AttributeValue{},
+		UnprocessedKeys: map[string]types.KeysAndAttributes{},
+	}
+
+	seen := map[string]bool{}
+	for i, request := range requests {
+		t, err := f.table(aws.String(request.table))
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := t.keyOf(request.key)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[request.table+key] {
+			return nil, validationError("Provided list of item keys contains duplicates")
+		}
+		seen[request.table+key] = true
+
+		if i >= len(requests)-skip {
+			unprocessed := output.UnprocessedKeys[request.table]
+			unprocessed.Keys = append(unprocessed.Keys, request.key)
+			output.UnprocessedKeys[request.table] = unprocessed
+			continue
+		}
+
+		if current, ok := t.items[key]; ok {
+			output.Responses[request.table] = append(output.Responses[request.table], copyItem(current))
+		}
+	}
+
+	return output, nil
+}
+
+// Puts and deletes are unconditional, like on DynamoDB
+func (f *Fake) BatchWriteItem(_ context.Context, params *dynamodb.BatchWriteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin("BatchWriteItem"); err != nil {
+		return nil, err
+	}
+
+	type request struct {
+		table string
+		write types.WriteRequest
+	}
+
+	var requests []request
+	for name, writes := range params.RequestItems {
+		for _, write := range writes {
+			requests = append(requests, request{table: name, write: write})
+		}
+	}
+
+	if len(requests) > 25 {
+		return nil, validationError("Too many items requested for the BatchWriteItem call")
+	}
+
+	skip := f.skipped("BatchWriteItem")
+	if skip > len(requests) {
+		skip = len(requests)
+	}
+
+	// The whole batch is validated before anything is written
+	keys := make([]string, len(requests))
+	seen := map[string]bool{}
+	for i, request := range requests {
+		t, err := f.table(aws.String(request.table))
+		if err != nil {
+			return nil, err
+		}
+
+		keyItem := map[string]types.AttributeValue{}
+		if request.write.PutRequest != nil {
+			keyItem = request.write.PutRequest.Item
+		} else if request.write.DeleteRequest != nil {
+			keyItem = request.write.DeleteRequest.Key
+		}
+
+		if keys[i], err = t.keyOf(keyItem); err != nil {
+			return nil, err
+		}
+
+		if seen[request.table+keys[i]] {
+			return nil, validationError("Provided list of item keys contains duplicates")
+		}
+		seen[request.table+keys[i]] = true
+	}
+
+	output := &dynamodb.BatchWriteItemOutput{UnprocessedItems: map[string][]types.WriteRequest{}}
+	for i, request := range requests {
+		if i >= len(requests)-skip {
+			output.UnprocessedItems[request.table] = append(output.UnprocessedItems[request.table], request.write)
+			continue
+		}
+
+		t := f.tables[request.table]
+		if request.write.PutRequest != nil {
+			t.items[keys[i]] = copyItem(request.write.PutRequest.Item)
+		} else {
+			delete(t.items, keys[i])
+		}
+	}
+
+	return output, nil
+}
+
+func (f *Fake) GetItem(_ context.Context, params *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin("GetItem"); err != nil {
+		return nil, err
+	}
+
+	t, err := f.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := t.keyOf(params.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &dynamodb.GetItemOutput{}
+	if current, ok := t.items[key]; ok {
+		output.Item = copyItem(current)
+	}
+
+	return output, nil
+}
+
+func (f *Fake) PutItem(_ context.Context, params *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin("PutItem"); err != nil {
+		return nil, err
+	}
+
+	t, err := f.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := t.keyOf(params.Item)
+	if err != nil {
+		return nil, err
+	}
+
+	current := t.items[key]
+	if err := checkCondition(params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues, current, params.ReturnValuesOnConditionCheckFailure); err != nil {
+		return nil, err
+	}
+
+	t.items[key] = copyItem(params.Item)
+
+	output := &dynamodb.PutItemOutput{}
+	if params.ReturnValues == types.ReturnValueAllOld && current != nil {
+		output.Attributes = copyItem(current)
+	}
+
+	return output, nil
+}
+
+func (f *Fake) DeleteItem(_ context.Context, params *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin("DeleteItem"); err != nil {
+		return nil, err
+	}
+
+	t, err := f.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := t.keyOf(params.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	current := t.items[key]
+	if err := checkCondition(params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues, current, params.ReturnValuesOnConditionCheckFailure); err != nil {
+		return nil, err
+	}
+
+	delete(t.items, key)
+
+	output := &dynamodb.DeleteItemOutput{}
+	if params.ReturnValues == types.ReturnValueAllOld && current != nil {
+		output.Attributes = copyItem(current)
+	}
+
+	return output, nil
+}
+
+func (f *Fake) UpdateItem(_ context.Context, params *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.begin("UpdateItem"); err != nil {
+		return nil, err
+	}
+
+	t, err := f.table(params.TableName)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := t.keyOf(params.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	current, exists := t.items[key]
+	if err := checkCondition(params.ConditionExpression, params.ExpressionAttributeNames, params.ExpressionAttributeValues, current, params.ReturnValuesOnConditionCheckFailure); err != nil {
+		return nil, err
+	}
+
+	// Updating a missing item creates it from the key
+	base := current
+	if !exists {
+		base = copyItem(params.Key)
+	}
+
+	updated := base
+	if expr := aws.ToString(params.UpdateExpression); expr != "" {
+		updated, err = applyUpdate(expr, placeholders{names: params.ExpressionAttributeNames, values: params.ExpressionAttributeValues}, base)
+		if err != nil {
+			return nil, validationError("Invalid UpdateExpression: " + err.Error())
+		}
+	}
+
+	t.items[key] = updated
+
+	output := &dynamodb.UpdateItemOutput{}
+	switch params.ReturnValues {
+	case types.ReturnValueAllOld, types.ReturnValueUpdatedOld:
+		if exists {
+			output.Attributes = copyItem(current)
+		}
+	case types.ReturnValueAllNew, types.ReturnValueUpdatedNew:
+		output.Attributes = copyItem(updated)
+	}
+
+	return output, nil
+}
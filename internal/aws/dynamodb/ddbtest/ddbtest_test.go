@@ -0,0 +1,110 @@
+package ddbtest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb/ddbtest"
+)
+
+func n(value string) types.AttributeValue { return &types.AttributeValueMemberN{Value: value} }
+func s(value string) types.AttributeValue { return &types.AttributeValueMemberS{Value: value} }
+
+func TestUpdateExpressions(t *testing.T) {
+	fake := ddbtest.New("Test")
+	ctx := context.Background()
+	key := map[string]types.AttributeValue{"Id": s("a")}
+
+	_, err := fake.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String("Test"),
+		Item: map[string]types.AttributeValue{
+			"Id":      s("a"),
+			"Views":   n("10"),
+			"Channel": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{"Title": s("Old")}},
+			"Logs":    &types.AttributeValueMemberL{Value: []types.AttributeValue{n("1")}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("TestUpdateExpressions: Error %v", err)
+	}
+
+	output, err := fake.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String("Test"),
+		Key:                      key,
+		ConditionExpression:      aws.String("(#views = :old) AND attribute_exists (#channel.Title) AND NOT attribute_exists(Gone)"),
+		UpdateExpression:         aws.String("SET #views = #views + :inc, #channel.#title = :title, Logs = list_append(Logs, :logs), Created = if_not_exists(Created, :now) REMOVE Missing ADD Tags :tags"),
+		ExpressionAttributeNames: map[string]string{"#views": "Views", "#channel": "Channel", "#title": "Title"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":old":   n("10"),
+			":inc":   n("5"),
+			":title": s("New"),
+			":logs":  &types.AttributeValueMemberL{Value: []types.AttributeValue{n("2")}},
+			":now":   n("100"),
+			":tags":  &types.AttributeValueMemberSS{Value: []string{"x"}},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		t.Fatalf("TestUpdateExpressions: Error %v", err)
+	}
+
+	item := output.Attributes
+	if item["Views"].(*types.AttributeValueMemberN).Value != "15" {
+		t.Errorf("TestUpdateExpressions: expected 15 views, got %v", item["Views"])
+	}
+	if item["Channel"].(*types.AttributeValueMemberM).Value["Title"].(*types.AttributeValueMemberS).Value != "New" {
+		t.Errorf("TestUpdateExpressions: expected the nested title to be updated")
+	}
+	if len(item["Logs"].(*types.AttributeValueMemberL).Value) != 2 || item["Created"] == nil || item["Tags"] == nil {
+		t.Errorf("TestUpdateExpressions: got %v", item)
+	}
+
+	// The same condition no longer holds
+	_, err = fake.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String("Test"),
+		Key:                       key,
+		ConditionExpression:       aws.String("Views BETWEEN :low AND :high OR Views IN (:a, :b)"),
+		UpdateExpression:          aws.String("SET Views = :a"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{":low": n("0"), ":high": n("9"), ":a": n("1"), ":b": n("2")},
+	})
+
+	var failed *types.ConditionalCheckFailedException
+	if !errors.As(err, &failed) {
+		t.Errorf("TestUpdateExpressions: expected a ConditionalCheckFailedException, got %v", err)
+	}
+}
+
+func TestScanPagination(t *testing.T) {
+	fake := ddbtest.New("Test")
+	ctx := context.Background()
+
+	for _, id := range []string{"c", "a", "b"} {
+		_, _ = fake.PutItem(ctx, &dynamodb.PutItemInput{TableName: aws.String("Test"), Item: map[string]types.AttributeValue{"Id": s(id)}})
+	}
+
+	var ids []string
+	var start map[string]types.AttributeValue
+	for {
+		output, err := fake.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String("Test"), Limit: aws.Int32(2), ExclusiveStartKey: start})
+		if err != nil {
+			t.Fatalf("TestScanPagination: Error %v", err)
+		}
+
+		for _, item := range output.Items {
+			ids = append(ids, item["Id"].(*types.AttributeValueMemberS).Value)
+		}
+
+		if output.LastEvaluatedKey == nil {
+			break
+		}
+		start = output.LastEvaluatedKey
+	}
+
+	if len(ids) != 3 || ids[0] != "a" || ids[1] != "b" || ids[2] != "c" {
+		t.Errorf("TestScanPagination: got %v", ids)
+	}
+}
@@ -0,0 +1,1026 @@
+package ddbtest
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Item as stored by the fake
+type item = map[string]types.AttributeValue
+
+// Placeholders of an expression, #name and :value
+type placeholders struct {
+	names  map[string]string
+	values map[string]types.AttributeValue
+}
+
+type token struct {
+	kind  string // ident, name, value, number, symbol
+	text  string
+	index int
+}
+
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+
+	for i := 0; i < len(input); {
+		c := rune(input[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '#' || c == ':':
+			start := i
+			i++
+			for i < len(input) && isIdentRune(rune(input[i])) {
+				i++
+			}
+
+			kind := "name"
+			if c == ':' {
+				kind = "value"
+			}
+			tokens = append(tokens, token{kind: kind, text: input[start:i], index: start})
+
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(input) && unicode.IsDigit(rune(input[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: "number", text: input[start:i], index: start})
+
+		case isIdentRune(c):
+			start := i
+			for i < len(input) && isIdentRune(rune(input[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: "ident", text: input[start:i], index: start})
+
+		default:
+			// Two character operators first
+			if i+1 < len(input) {
+				if two := input[i : i+2]; two == "<>" || two == "<=" || two == ">=" {
+					tokens = append(tokens, token{kind: "symbol", text: two, index: i})
+					i += 2
+					continue
+				}
+			}
+
+			if !strings.ContainsRune("()[],.=<>+-", c) {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+
+			tokens = append(tokens, token{kind: "symbol", text: string(c), index: i})
+			i++
+		}
+	}
+
+	return tokens, nil
+}
+
+func isIdentRune(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	params placeholders
+}
+
+func newParser(input string, params placeholders) (*parser, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	return &parser{tokens: tokens, params: params}, nil
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) next() (token, bool) {
+	t, ok := p.peek()
+	if ok {
+		p.pos++
+	}
+
+	return t, ok
+}
+
+// Consumes the token if it's the given symbol or keyword
+func (p *parser) accept(text string) bool {
+	t, ok := p.peek()
+	if ok && (t.kind == "symbol" || t.kind == "ident") && strings.EqualFold(t.text, text) {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		t, _ := p.peek()
+		return fmt.Errorf("expected %q near %q", text, t.text)
+	}
+
+	return nil
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+// A path into an item, e.g. Channel.Title or ViewLogs[0]
+type pathPart struct {
+	name  string
+	index int
+	isIdx bool
+}
+
+type path []pathPart
+
+func (p *parser) parsePath() (path, error) {
+	var result path
+
+	first, err := p.parsePathName()
+	if err != nil {
+		return nil, err
+	}
+	result = append(result, pathPart{name: first})
+
+	for {
+		switch {
+		case p.accept("."):
+			name, err := p.parsePathName()
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, pathPart{name: name})
+
+		case p.accept("["):
+			t, ok := p.next()
+			if !ok || t.kind != "number" {
+				return nil, fmt.Errorf("expected a list index")
+			}
+			index, _ := strconv.Atoi(t.text)
+			result = append(result, pathPart{index: index, isIdx: true})
+
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+
+		default:
+			return result, nil
+		}
+	}
+}
+
+func (p *parser) parsePathName() (string, error) {
+	t, ok := p.next()
+	if !ok {
+		return "", fmt.Errorf("expected an attribute name")
+	}
+
+	switch t.kind {
+	case "ident":
+		return t.text, nil
+	case "name":
+		name, ok := p.params.names[t.text]
+		if !ok {
+			return "", fmt.Errorf("undefined attribute name %s", t.text)
+		}
+		return name, nil
+	}
+
+	return "", fmt.Errorf("expected an attribute name, got %q", t.text)
+}
+
+// Resolves to a value of the item, false when the attribute doesn't exist
+type operand func(it item) (types.AttributeValue, bool)
+
+func (p *parser) parseOperand() (operand, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("expected an operand")
+	}
+
+	if t.kind == "value" {
+		p.pos++
+
+		value, ok := p.params.values[t.text]
+		if !ok {
+			return nil, fmt.Errorf("undefined attribute value %s", t.text)
+		}
+
+		return func(item) (types.AttributeValue, bool) { return value, true }, nil
+	}
+
+	// Functions that return a value
+	if t.kind == "ident" && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].text == "(" {
+		switch strings.ToLower(t.text) {
+		case "size":
+			p.pos += 2
+			target, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+
+			return func(it item) (types.AttributeValue, bool) {
+				value, ok := resolve(it, target)
+				if !ok {
+					return nil, false
+				}
+				return number(big.NewRat(int64(sizeOf(value)), 1)), true
+			}, nil
+
+		case "if_not_exists":
+			p.pos += 2
+			target, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			fallback, err := p.parseSetValue()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+
+			return func(it item) (types.AttributeValue, bool) {
+				if value, ok := resolve(it, target); ok {
+					return value, true
+				}
+				return fallback(it)
+			}, nil
+
+		case "list_append":
+			p.pos += 2
+			left, err := p.parseSetValue()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			right, err := p.parseSetValue()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+
+			return func(it item) (types.AttributeValue, bool) {
+				l, lok := left(it)
+				r, rok := right(it)
+				if !lok || !rok {
+					return nil, false
+				}
+
+				ll, lok := l.(*types.AttributeValueMemberL)
+				rl, rok := r.(*types.AttributeValueMemberL)
+				if !lok || !rok {
+					return nil, false
+				}
+
+				return &types.AttributeValueMemberL{Value: append(append([]types.AttributeValue{}, ll.Value...), rl.Value...)}, true
+			}, nil
+		}
+	}
+
+	target, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(it item) (types.AttributeValue, bool) { return resolve(it, target) }, nil
+}
+
+// Value of a SET action, an operand optionally plus or minus another one
+func (p *parser) parseSetValue() (operand, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range []string{"+", "-"} {
+		if !p.accept(op) {
+			continue
+		}
+
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		return func(it item) (types.AttributeValue, bool) {
+			l, lok := left(it)
+			r, rok := right(it)
+			if !lok || !rok {
+				return nil, false
+			}
+
+			a, aok := ratOf(l)
+			b, bok := ratOf(r)
+			if !aok || !bok {
+				return nil, false
+			}
+
+			if op == "+" {
+				return number(new(big.Rat).Add(a, b)), true
+			}
+			return number(new(big.Rat).Sub(a, b)), true
+		}, nil
+	}
+
+	return left, nil
+}
+
+type condition func(it item) bool
+
+// Parses a condition, filter or key condition expression
+func parseCondition(input string, params placeholders) (condition, error) {
+	p, err := newParser(input, params)
+	if err != nil {
+		return nil, err
+	}
+
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.done() {
+		t, _ := p.peek()
+		return nil, fmt.Errorf("unexpected %q in condition", t.text)
+	}
+
+	return cond, nil
+}
+
+func (p *parser) parseOr() (condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		l := left
+		left = func(it item) bool { return l(it) || right(it) }
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (condition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		l := left
+		left = func(it item) bool { return l(it) && right(it) }
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseNot() (condition, error) {
+	if p.accept("NOT") {
+		cond, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return func(it item) bool { return !cond(it) }, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (condition, error) {
+	if p.accept("(") {
+		cond, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		return cond, p.expect(")")
+	}
+
+	// Functions that are conditions themselves
+	if t, ok := p.peek(); ok && t.kind == "ident" && p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].text == "(" {
+		switch name := strings.ToLower(t.text); name {
+		case "attribute_exists", "attribute_not_exists":
+			p.pos += 2
+			target, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+
+			return func(it item) bool {
+				_, exists := resolve(it, target)
+				return exists == (name == "attribute_exists")
+			}, nil
+
+		case "attribute_type", "begins_with", "contains":
+			p.pos += 2
+			target, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			argument, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+
+			return func(it item) bool {
+				value, ok := resolve(it, target)
+				arg, argOk := argument(it)
+				if !ok || !argOk {
+					return false
+				}
+
+				switch name {
+				case "attribute_type":
+					s, ok := arg.(*types.AttributeValueMemberS)
+					return ok && typeOf(value) == s.Value
+				case "begins_with":
+					v, vok := value.(*types.AttributeValueMemberS)
+					a, aok := arg.(*types.AttributeValueMemberS)
+					return vok && aok && strings.HasPrefix(v.Value, a.Value)
+				default:
+					return containsValue(value, arg)
+				}
+			}, nil
+		}
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.accept("BETWEEN") {
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		return func(it item) bool {
+			return compareOperands(it, left, low, ">=") && compareOperands(it, left, high, "<=")
+		}, nil
+	}
+
+	if p.accept("IN") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+
+		var candidates []operand
+		for {
+			candidate, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, candidate)
+
+			if !p.accept(",") {
+				break
+			}
+		}
+
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+
+		return func(it item) bool {
+			for _, candidate := range candidates {
+				if compareOperands(it, left, candidate, "=") {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+
+	t, ok := p.next()
+	if !ok || t.kind != "symbol" {
+		return nil, fmt.Errorf("expected a comparison")
+	}
+
+	switch t.text {
+	case "=", "<>", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("unknown comparison %q", t.text)
+	}
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(it item) bool { return compareOperands(it, left, right, t.text) }, nil
+}
+
+func compareOperands(it item, left, right operand, op string) bool {
+	l, lok := left(it)
+	r, rok := right(it)
+	if !lok || !rok {
+		// Comparing with a missing attribute is only true for <>
+		return op == "<>" && lok != rok
+	}
+
+	if op == "=" {
+		return equal(l, r)
+	}
+	if op == "<>" {
+		return !equal(l, r)
+	}
+
+	cmp, ok := compare(l, r)
+	if !ok {
+		return false
+	}
+
+	switch op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+// Applies an update expression to the item
+func applyUpdate(input string, params placeholders, it item) (item, error) {
+	p, err := newParser(input, params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every value is resolved against the item as it was before the update
+	before := it
+	updated := copyItem(it)
+
+	for !p.done() {
+		t, _ := p.next()
+		clause := strings.ToUpper(t.text)
+
+		for {
+			target, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+
+			switch clause {
+			case "SET":
+				if err := p.expect("="); err != nil {
+					return nil, err
+				}
+				value, err := p.parseSetValue()
+				if err != nil {
+					return nil, err
+				}
+
+				resolved, ok := value(before)
+				if !ok {
+					return nil, fmt.Errorf("the value for %s could not be resolved", target[0].name)
+				}
+				if updated, err = setPath(updated, target, resolved); err != nil {
+					return nil, err
+				}
+
+			case "REMOVE":
+				updated = removePath(updated, target)
+
+			case "ADD", "DELETE":
+				value, err := p.parseOperand()
+				if err != nil {
+					return nil, err
+				}
+				resolved, _ := value(before)
+				current, exists := resolve(before, target)
+
+				var result types.AttributeValue
+				if clause == "ADD" {
+					result, err = add(current, exists, resolved)
+				} else {
+					result, err = remove(current, exists, resolved)
+				}
+				if err != nil {
+					return nil, err
+				}
+
+				if updated, err = setPath(updated, target, result); err != nil {
+					return nil, err
+				}
+
+			default:
+				return nil, fmt.Errorf("unknown update clause %q", t.text)
+			}
+
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+
+	return updated, nil
+}
+
+func resolve(it item, target path) (types.AttributeValue, bool) {
+	var current types.AttributeValue = &types.AttributeValueMemberM{Value: it}
+
+	for _, part := range target {
+		switch value := current.(type) {
+		case *types.AttributeValueMemberM:
+			if part.isIdx {
+				return nil, false
+			}
+			next, ok := value.Value[part.name]
+			if !ok {
+				return nil, false
+			}
+			current = next
+
+		case *types.AttributeValueMemberL:
+			if !part.isIdx || part.index >= len(value.Value) {
+				return nil, false
+			}
+			current = value.Value[part.index]
+
+		default:
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// Copies the maps and lists along the path so the stored item is never modified in place
+func setPath(it item, target path, value types.AttributeValue) (item, error) {
+	root, err := setIn(&types.AttributeValueMemberM{Value: it}, target, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return root.(*types.AttributeValueMemberM).Value, nil
+}
+
+func setIn(current types.AttributeValue, target path, value types.AttributeValue) (types.AttributeValue, error) {
+	if len(target) == 0 {
+		return value, nil
+	}
+
+	part := target[0]
+	switch container := current.(type) {
+	case *types.AttributeValueMemberM:
+		if part.isIdx {
+			return nil, fmt.Errorf("the document path is invalid for an update")
+		}
+
+		copied := copyItem(container.Value)
+		child, exists := copied[part.name]
+		if !exists && len(target) > 1 {
+			return nil, fmt.Errorf("the document path %s does not exist", part.name)
+		}
+
+		updated, err := setIn(child, target[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		copied[part.name] = updated
+
+		return &types.AttributeValueMemberM{Value: copied}, nil
+
+	case *types.AttributeValueMemberL:
+		if !part.isIdx {
+			return nil, fmt.Errorf("the document path is invalid for an update")
+		}
+
+		copied := append([]types.AttributeValue{}, container.Value...)
+		if part.index >= len(copied) {
+			// Past the end appends, like DynamoDB does
+			if len(target) > 1 {
+				return nil, fmt.Errorf("the document path is invalid for an update")
+			}
+			return &types.AttributeValueMemberL{Value: append(copied, value)}, nil
+		}
+
+		updated, err := setIn(copied[part.index], target[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		copied[part.index] = updated
+
+		return &types.AttributeValueMemberL{Value: copied}, nil
+	}
+
+	return nil, fmt.Errorf("the document path is invalid for an update")
+}
+
+func removePath(it item, target path) item {
+	if len(target) == 1 && !target[0].isIdx {
+		copied := copyItem(it)
+		delete(copied, target[0].name)
+		return copied
+	}
+
+	parent, ok := resolve(it, target[:len(target)-1])
+	if !ok {
+		return it
+	}
+
+	last := target[len(target)-1]
+	var replacement types.AttributeValue
+	switch container := parent.(type) {
+	case *types.AttributeValueMemberM:
+		copied := copyItem(container.Value)
+		delete(copied, last.name)
+		replacement = &types.AttributeValueMemberM{Value: copied}
+	case *types.AttributeValueMemberL:
+		if !last.isIdx || last.index >= len(container.Value) {
+			return it
+		}
+		copied := append(append([]types.AttributeValue{}, container.Value[:last.index]...), container.Value[last.index+1:]...)
+		replacement = &types.AttributeValueMemberL{Value: copied}
+	default:
+		return it
+	}
+
+	updated, err := setPath(it, target[:len(target)-1], replacement)
+	if err != nil {
+		return it
+	}
+
+	return updated
+}
+
+func add(current types.AttributeValue, exists bool, value types.AttributeValue) (types.AttributeValue, error) {
+	if n, ok := value.(*types.AttributeValueMemberN); ok {
+		if !exists {
+			return n, nil
+		}
+
+		a, aok := ratOf(current)
+		b, _ := ratOf(n)
+		if !aok {
+			return nil, fmt.Errorf("ADD requires a number")
+		}
+
+		return number(new(big.Rat).Add(a, b)), nil
+	}
+
+	if !exists {
+		return value, nil
+	}
+
+	switch set := value.(type) {
+	case *types.AttributeValueMemberSS:
+		if c, ok := current.(*types.AttributeValueMemberSS); ok {
+			return &types.AttributeValueMemberSS{Value: union(c.Value, set.Value)}, nil
+		}
+	case *types.AttributeValueMemberNS:
+		if c, ok := current.(*types.AttributeValueMemberNS); ok {
+			return &types.AttributeValueMemberNS{Value: union(c.Value, set.Value)}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("ADD requires a number or a set of the same type")
+}
+
+func remove(current types.AttributeValue, exists bool, value types.AttributeValue) (types.AttributeValue, error) {
+	if !exists {
+		return nil, fmt.Errorf("DELETE requires an existing set")
+	}
+
+	switch set := value.(type) {
+	case *types.AttributeValueMemberSS:
+		if c, ok := current.(*types.AttributeValueMemberSS); ok {
+			return &types.AttributeValueMemberSS{Value: difference(c.Value, set.Value)}, nil
+		}
+	case *types.AttributeValueMemberNS:
+		if c, ok := current.(*types.AttributeValueMemberNS); ok {
+			return &types.AttributeValueMemberNS{Value: difference(c.Value, set.Value)}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("DELETE requires a set of the same type")
+}
+
+func union(a, b []string) []string {
+	result := append([]string{}, a...)
+	for _, value := range b {
+		if !containsString(result, value) {
+			result = append(result, value)
+		}
+	}
+
+	return result
+}
+
+func difference(a, b []string) []string {
+	var result []string
+	for _, value := range a {
+		if !containsString(b, value) {
+			result = append(result, value)
+		}
+	}
+
+	return result
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsValue(container, value types.AttributeValue) bool {
+	switch c := container.(type) {
+	case *types.AttributeValueMemberS:
+		v, ok := value.(*types.AttributeValueMemberS)
+		return ok && strings.Contains(c.Value, v.Value)
+	case *types.AttributeValueMemberSS:
+		v, ok := value.(*types.AttributeValueMemberS)
+		return ok && containsString(c.Value, v.Value)
+	case *types.AttributeValueMemberNS:
+		v, ok := value.(*types.AttributeValueMemberN)
+		return ok && containsString(c.Value, v.Value)
+	case *types.AttributeValueMemberL:
+		for _, element := range c.Value {
+			if equal(element, value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func ratOf(value types.AttributeValue) (*big.Rat, bool) {
+	n, ok := value.(*types.AttributeValueMemberN)
+	if !ok {
+		return nil, false
+	}
+
+	return new(big.Rat).SetString(n.Value)
+}
+
+func number(value *big.Rat) types.AttributeValue {
+	if value.IsInt() {
+		return &types.AttributeValueMemberN{Value: value.Num().String()}
+	}
+
+	return &types.AttributeValueMemberN{Value: strings.TrimRight(value.FloatString(20), "0")}
+}
+
+func equal(a, b types.AttributeValue) bool {
+	if x, ok := ratOf(a); ok {
+		y, ok := ratOf(b)
+		return ok && x.Cmp(y) == 0
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func compare(a, b types.AttributeValue) (int, bool) {
+	switch x := a.(type) {
+	case *types.AttributeValueMemberN:
+		l, _ := ratOf(x)
+		r, ok := ratOf(b)
+		if !ok || l == nil {
+			return 0, false
+		}
+		return l.Cmp(r), true
+	case *types.AttributeValueMemberS:
+		y, ok := b.(*types.AttributeValueMemberS)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x.Value, y.Value), true
+	case *types.AttributeValueMemberB:
+		y, ok := b.(*types.AttributeValueMemberB)
+		if !ok {
+			return 0, false
+		}
+		return bytes.Compare(x.Value, y.Value), true
+	}
+
+	return 0, false
+}
+
+func sizeOf(value types.AttributeValue) int {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value)
+	case *types.AttributeValueMemberB:
+		return len(v.Value)
+	case *types.AttributeValueMemberL:
+		return len(v.Value)
+	case *types.AttributeValueMemberM:
+		return len(v.Value)
+	case *types.AttributeValueMemberSS:
+		return len(v.Value)
+	case *types.AttributeValueMemberNS:
+		return len(v.Value)
+	case *types.AttributeValueMemberBS:
+		return len(v.Value)
+	}
+
+	return 0
+}
+
+func typeOf(value types.AttributeValue) string {
+	switch value.(type) {
+	case *types.AttributeValueMemberS:
+		return "S"
+	case *types.AttributeValueMemberN:
+		return "N"
+	case *types.AttributeValueMemberB:
+		return "B"
+	case *types.AttributeValueMemberBOOL:
+		return "BOOL"
+	case *types.AttributeValueMemberNULL:
+		return "NULL"
+	case *types.AttributeValueMemberL:
+		return "L"
+	case *types.AttributeValueMemberM:
+		return "M"
+	case *types.AttributeValueMemberSS:
+		return "SS"
+	case *types.AttributeValueMemberNS:
+		return "NS"
+	case *types.AttributeValueMemberBS:
+		return "BS"
+	}
+
+	return ""
+}
+
+func copyItem(it item) item {
+	copied := make(item, len(it))
+	for key, value := range it {
+		copied[key] = value
+	}
+
+	return copied
+}
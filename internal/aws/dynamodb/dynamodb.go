@@ -5,32 +5,267 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"reflect"
-	"time"
+	"os"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/ricomonster/black-flag/internal/metrics"
 )
 
+// The calls we make to DynamoDB, satisfied by *dynamodb.Client and by the fake in ddbtest
+type Client interface {
+	ListTables(ctx context.Context, params *dynamodb.ListTablesInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTablesOutput, error)
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+	UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error)
+	DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error)
+	UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error)
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	BatchWriteItem(ctx context.Context, params *dynamodb.BatchWriteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+}
+
 type DynamoDB[T any] struct {
-	client *dynamodb.Client
-	table  string
+	client   Client
+	table    string
+	keys     KeySchema
+	version  *versionField
+	upgrader Upgrader
+}
+
+// Brings items written by older versions of the app up to date before they are decoded
+type Upgrader interface {
+	Upgrade(item map[string]types.AttributeValue) (map[string]types.AttributeValue, error)
+}
+
+// Returned when the condition of a write doesn't hold, e.g. the item was changed in the meantime
+var ErrConditionFailed = errors.New("the conditional request failed")
+
+// Returned by Create when an item with the same key is stored already
+var ErrAlreadyExists = errors.New("the item already exists")
+
+// Tells if the call failed because the table doesn't exist, e.g. init-table didn't create it
+func IsTableNotFound(err error) bool {
+	var notFound *types.ResourceNotFoundException
+	return errors.As(err, &notFound)
+}
+
+type Option func(*options)
+
+type options struct {
+	client          Client
+	keys            *KeySchema
+	endpoint        string
+	region          string
+	profile         string
+	accessKeyId     string
+	secretAccessKey string
+}
+
+// Uses the given client instead of connecting to AWS, e.g. the fake from ddbtest
+func WithClient(client Client) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
+// Uses the given key schema instead of the one tagged on T, e.g. for tables only read and written raw
+func WithKeySchema(keys KeySchema) Option {
+	return func(o *options) {
+		o.keys = &keys
+	}
+}
+
+// Connects to a DynamoDB compatible endpoint instead of AWS, e.g. DynamoDB Local
+func WithEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.endpoint = endpoint
+	}
+}
+
+func WithRegion(region string) Option {
+	return func(o *options) {
+		o.region = region
+	}
+}
+
+// Uses a named profile from the shared AWS config and credentials files
+func WithProfile(profile string) Option {
+	return func(o *options) {
+		o.profile = profile
+	}
+}
+
+// Uses static credentials instead of the default credential chain
+func WithCredentials(accessKeyId, secretAccessKey string) Option {
+	return func(o *options) {
+		o.accessKeyId = accessKeyId
+		o.secretAccessKey = secretAccessKey
+	}
+}
+
+// Region and credentials used against a local endpoint when none are given, DynamoDB Local accepts anything
+var (
+	LOCAL_REGION      = "us-east-1"
+	LOCAL_CREDENTIALS = "local"
+)
+
+// Client used by every table that is not given one, tests swap it for the fake
+var defaultClient Client
+
+// Replaces the client used when NewDynamoDB is not given one, nil goes back to AWS
+func SetDefaultClient(client Client) {
+	defaultClient = client
+}
+
+// Connection settings from the env, the options given to NewDynamoDB take precedence
+func optionsFromEnv() options {
+	return options{
+		client:          defaultClient,
+		endpoint:        os.Getenv("BLACK_FLAG_DYNAMODB_ENDPOINT"),
+		region:          os.Getenv("BLACK_FLAG_DYNAMODB_REGION"),
+		profile:         os.Getenv("BLACK_FLAG_DYNAMODB_PROFILE"),
+		accessKeyId:     os.Getenv("BLACK_FLAG_DYNAMODB_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("BLACK_FLAG_DYNAMODB_SECRET_ACCESS_KEY"),
+	}
+}
+
+func newClient(opts []Option) (Client, error) {
+	o := optionsFromEnv()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o.newClient()
+}
+
+func (o options) newClient() (Client, error) {
+	if o.client != nil {
+		return o.client, nil
+	}
+
+	// Local development, nothing should be read from the AWS account of the machine
+	if o.endpoint != "" && o.profile == "" {
+		if o.region == "" {
+			o.region = LOCAL_REGION
+		}
+		if o.accessKeyId == "" {
+			o.accessKeyId, o.secretAccessKey = LOCAL_CREDENTIALS, LOCAL_CREDENTIALS
+		}
+	}
+
+	var loadOptions []func(*config.LoadOptions) error
+	if o.region != "" {
+		loadOptions = append(loadOptions, config.WithRegion(o.region))
+	}
+	if o.profile != "" {
+		loadOptions = append(loadOptions, config.WithSharedConfigProfile(o.profile))
+	}
+	if o.accessKeyId != "" {
+		if o.secretAccessKey == "" {
+			return nil, errors.New("a secret access key is required with the access key id")
+		}
+		loadOptions = append(loadOptions, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(o.accessKeyId, o.secretAccessKey, ""),
+		))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(), loadOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the AWS config: %w", err)
+	}
+
+	return dynamodb.NewFromConfig(cfg, func(options *dynamodb.Options) {
+		if o.endpoint != "" {
+			options.BaseEndpoint = aws.String(o.endpoint)
+		}
+	}), nil
+}
+
+// Instantiate and setups connectivity to DynamoDB and to the target table.
+// The connection is configured through the BLACK_FLAG_DYNAMODB_* env, e.g. BLACK_FLAG_DYNAMODB_ENDPOINT
+// points every table to a local DynamoDB compatible endpoint.
+// The key of the table comes from the fields of T tagged with dynamodbkey, see KEY_TAG.
+func NewDynamoDB[T any](table string, opts ...Option) (*DynamoDB[T], error) {
+	o := optionsFromEnv()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var keys KeySchema
+	if o.keys != nil {
+		keys = *o.keys
+	} else {
+		var err error
+		if keys, err = KeySchemaOf[T](); err != nil {
+			return nil, err
+		}
+	}
+
+	version, err := versionFieldOf[T]()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := o.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return &DynamoDB[T]{client: client, table: table, keys: keys, version: version}, nil
 }
 
-// Instantiate and setups connectivity to DynamoDB and to the target table
-func NewDynamoDB[T any](table string) *DynamoDB[T] {
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+// The key of the table
+func (ddb *DynamoDB[T]) KeySchema() KeySchema {
+	return ddb.keys
+}
+
+// The key of the item, e.g. to read it again
+func (ddb *DynamoDB[T]) KeyOf(item T) (Key, error) {
+	marshalled, err := attributevalue.MarshalMap(item)
 	if err != nil {
-		log.Fatal(err)
+		return Key{}, err
+	}
+
+	key := Key{}
+	if err := attributevalue.Unmarshal(marshalled[ddb.keys.Partition.Name], &key.Partition); err != nil {
+		return Key{}, err
+	}
+	if ddb.keys.Sort != nil {
+		if err := attributevalue.Unmarshal(marshalled[ddb.keys.Sort.Name], &key.Sort); err != nil {
+			return Key{}, err
+		}
 	}
 
-	service := dynamodb.NewFromConfig(cfg)
+	return key, nil
+}
 
-	return &DynamoDB[T]{client: service, table: table}
+// Upgrades the items read by GetAll, FindByKey and so Modify, Query, BatchGet and the item returned by
+// UpdateItem. Raw reads are left as they are.
+func (ddb *DynamoDB[T]) SetUpgrader(upgrader Upgrader) {
+	ddb.upgrader = upgrader
+}
+
+func (ddb *DynamoDB[T]) decode(item map[string]types.AttributeValue, result *T) error {
+	if ddb.upgrader != nil && len(item) > 0 {
+		upgraded, err := ddb.upgrader.Upgrade(item)
+		if err != nil {
+			return err
+		}
+		item = upgraded
+	}
+
+	return attributevalue.UnmarshalMap(item, result)
 }
 
 // Returns a list of acceessible tables (this will vary per account iam role/permission)
@@ -42,6 +277,7 @@ func (ddb *DynamoDB[_]) ListTables() ([]string, error) {
 			ExclusiveStartTableName: lastEvaluatedTableName,
 		})
 		if err != nil {
+			trackError("ListTables")
 			return []string{}, err
 		}
 
@@ -61,60 +297,58 @@ func (ddb *DynamoDB[_]) ListTables() ([]string, error) {
 	return tables, nil
 }
 
-// Get all items in the selected dynamodb table
+// Get all items in the selected dynamodb table, page after page. An item that can't be decoded fails
+// the whole read so nothing is silently left out.
 func (ddb *DynamoDB[T]) GetAll() ([]T, error) {
-	response, err := ddb.client.Scan(context.TODO(), &dynamodb.ScanInput{
-		TableName: aws.String(ddb.table),
-	})
-	if err != nil {
-		return []T{}, err
-	}
-
-	var results []T
-	for _, item := range response.Items {
-		var result T
+	var (
+		results []T
+		start   map[string]types.AttributeValue
+	)
 
-		err := attributevalue.UnmarshalMap(item, &result)
+	for {
+		items, next, err := ddb.ScanRaw(start, 0)
 		if err != nil {
-			fmt.Println(err)
-			continue
+			return []T{}, err
 		}
 
-		results = append(results, result)
-	}
-
-	return results, nil
-}
+		for _, item := range items {
+			var result T
+			if err := ddb.decode(item, &result); err != nil {
+				return []T{}, fmt.Errorf("unable to decode %s: %w", ddb.keys.stringOf(item), err)
+			}
 
-// Find a record in the DynamoDB table using the primary key attribute value
-func (ddb *DynamoDB[T]) FindById(key string, value string) (T, error) {
-	var result T
+			results = append(results, result)
+		}
 
-	if key == "" {
-		return result, errors.New("Key name is required.")
+		if next == nil {
+			return results, nil
+		}
+		start = next
 	}
+}
 
-	if value == "" {
-		return result, errors.New("ID is required.")
-	}
+// Find a record in the DynamoDB table using its primary key, a missing record is returned empty
+func (ddb *DynamoDB[T]) FindByKey(key Key) (T, error) {
+	var result T
 
-	findValue, err := attributevalue.Marshal(value)
+	marshalledKey, err := ddb.keys.marshal(key)
 	if err != nil {
-		panic(err)
+		return result, err
 	}
 
 	command := &dynamodb.GetItemInput{
 		TableName: aws.String(ddb.table),
-		Key:       map[string]types.AttributeValue{key: findValue},
+		Key:       marshalledKey,
 	}
 
 	response, err := ddb.client.GetItem(context.TODO(), command)
 	if err != nil {
-		log.Printf("Couldn't get info about %v. Here's why: %v\n", value, err)
+		trackError("GetItem")
+		log.Printf("Couldn't get info about %v. Here's why: %v\n", key, err)
 		return result, err
 	}
 
-	err = attributevalue.UnmarshalMap(response.Item, &result)
+	err = ddb.decode(response.Item, &result)
 	if err != nil {
 		log.Printf("Couldn't unmarshal response. Here's why: %v\n", err)
 		return result, err
@@ -124,101 +358,199 @@ func (ddb *DynamoDB[T]) FindById(key string, value string) (T, error) {
 }
 
 // Inserts an item to a DynamoDB table.
+// Versioned items are only written when the stored one is still at the version of item, ErrConflict otherwise.
 func (ddb *DynamoDB[T]) PutItem(item T) error {
-	marshalledItem, err := attributevalue.MarshalMap(item)
+	_, err := ddb.put(item)
+
+	return err
+}
+
+// Inserts the item unless one with the same key is stored already, ErrAlreadyExists then.
+// Returns the item as it was written, i.e. at its first version.
+func (ddb *DynamoDB[T]) Create(item T) (T, error) {
+	created := item
+	if ddb.version != nil {
+		ddb.version.set(&created, 1)
+	}
+
+	marshalledItem, err := attributevalue.MarshalMap(created)
 	if err != nil {
-		return err
+		return item, err
 	}
 
-	_, err = ddb.client.PutItem(
-		context.TODO(),
-		&dynamodb.PutItemInput{TableName: aws.String(ddb.table), Item: marshalledItem},
-	)
+	condition := expression.Name(ddb.keys.Partition.Name).AttributeNotExists()
+	err = ddb.PutRaw(marshalledItem, &condition)
+	if errors.Is(err, ErrConditionFailed) {
+		key, _ := ddb.KeyOf(item)
+		return item, fmt.Errorf("%w: %v", ErrAlreadyExists, key)
+	}
 	if err != nil {
-		return err
+		return item, err
 	}
 
-	return nil
+	return created, nil
 }
 
-// Perform an update to an item
-func (ddb *DynamoDB[T]) UpdateItem(key string, findValue string, item T) error {
-	// Create a new expression builder
-	updater := expression.Set(expression.Name("Modified"), expression.Value(time.Now().Unix()))
+// Returns the item as it was written, i.e. with its new version
+func (ddb *DynamoDB[T]) put(item T) (T, error) {
+	input := &dynamodb.PutItemInput{TableName: aws.String(ddb.table)}
+	read := item
 
-	// Iterate over the fields of the struct and add them to the expression builder
-	t := reflect.TypeOf(item)
-	for i := 0; i < t.NumField(); i++ {
-		field := t.Field(i)
+	var expected *int64
+	if ddb.version != nil {
+		version := ddb.version.get(&item)
+		expected = &version
+		ddb.version.set(&item, version+1)
 
-		// Ignore unexported fields
-		if field.PkgPath != "" {
-			continue
+		expr, err := expression.NewBuilder().WithCondition(ddb.version.condition(version)).Build()
+		if err != nil {
+			return read, err
 		}
 
-		// Check if the value is empty
-		if IsEmptyValue(reflect.ValueOf(item).Field(i)) {
-			continue
+		input.ConditionExpression = expr.Condition()
+		input.ExpressionAttributeNames = expr.Names()
+		input.ExpressionAttributeValues = expr.Values()
+		input.ReturnValuesOnConditionCheckFailure = types.ReturnValuesOnConditionCheckFailureAllOld
+	}
+
+	marshalledItem, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return read, err
+	}
+	input.Item = marshalledItem
+
+	_, err = ddb.client.PutItem(context.TODO(), input)
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		key, _ := ddb.KeyOf(item)
+		return read, ddb.conditionError(err, key, expected)
+	}
+	if err != nil {
+		trackError("PutItem")
+		return read, err
+	}
+
+	return item, nil
+}
+
+// Reads a page of items as they are stored, start is the key returned by the previous page.
+// The returned key is nil once the whole table was read.
+func (ddb *DynamoDB[T]) ScanRaw(start map[string]types.AttributeValue, limit int32) ([]map[string]types.AttributeValue, map[string]types.AttributeValue, error) {
+	input := &dynamodb.ScanInput{
+		TableName:         aws.String(ddb.table),
+		ExclusiveStartKey: start,
+	}
+	if limit > 0 {
+		input.Limit = aws.Int32(limit)
+	}
+
+	response, err := ddb.client.Scan(context.TODO(), input)
+	if err != nil {
+		trackError("Scan")
+		return nil, nil, err
+	}
+
+	return response.Items, response.LastEvaluatedKey, nil
+}
+
+// Writes an item as is, only when the condition holds if one is given
+func (ddb *DynamoDB[T]) PutRaw(item map[string]types.AttributeValue, condition *expression.ConditionBuilder) error {
+	input := &dynamodb.PutItemInput{TableName: aws.String(ddb.table), Item: item}
+
+	if condition != nil {
+		expr, err := expression.NewBuilder().WithCondition(*condition).Build()
+		if err != nil {
+			return err
 		}
 
-		// Maybe i do not fully understand how reflect works so I get it again
-		value := reflect.ValueOf(item).Field(i).Interface()
+		input.ConditionExpression = expr.Condition()
+		input.ExpressionAttributeNames = expr.Names()
+		input.ExpressionAttributeValues = expr.Values()
+	}
+
+	_, err := ddb.client.PutItem(context.TODO(), input)
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return fmt.Errorf("%w: %v", ErrConditionFailed, err)
+	}
+	if err != nil {
+		trackError("PutItem")
+		return err
+	}
+
+	return nil
+}
 
-		// Add the field to the expression builder
-		updater = updater.Set(expression.Name(field.Name), expression.Value(value))
+// Deletes an item using its primary key
+func (ddb *DynamoDB[T]) DeleteItem(key Key) error {
+	marshalledKey, err := ddb.keys.marshal(key)
+	if err != nil {
+		return err
 	}
 
-	// Build the expression
-	expr, err := expression.NewBuilder().WithUpdate(updater).Build()
+	_, err = ddb.client.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(ddb.table),
+		Key:       marshalledKey,
+	})
 	if err != nil {
+		trackError("DeleteItem")
 		return err
 	}
 
-	// Marshal the find value
-	marshalledFindValue, err := attributevalue.Marshal(findValue)
+	return nil
+}
+
+// Perform an update to an item and returns it as it is after the update, see NewUpdate and UpdateMask.
+// An item that doesn't exist yet is created unless the update is conditioned.
+// The version of versioned items is incremented, see Update.IfVersion.
+func (ddb *DynamoDB[T]) UpdateItem(key Key, update *Update) (T, error) {
+	var result T
+
+	if ddb.version == nil && update.version != nil {
+		return result, fmt.Errorf("%T has no field tagged %s", result, VERSION_TAG)
+	}
+
+	expr, err := update.build(ddb.version)
 	if err != nil {
-		panic(err)
+		return result, err
 	}
 
-	_, err = ddb.client.UpdateItem(
+	marshalledKey, err := ddb.keys.marshal(key)
+	if err != nil {
+		return result, err
+	}
+
+	response, err := ddb.client.UpdateItem(
 		context.TODO(),
 		&dynamodb.UpdateItemInput{
-			TableName:                 aws.String(ddb.table),
-			Key:                       map[string]types.AttributeValue{key: marshalledFindValue},
-			UpdateExpression:          expr.Update(),
-			ExpressionAttributeNames:  expr.Names(),
-			ExpressionAttributeValues: expr.Values(),
+			TableName:                           aws.String(ddb.table),
+			Key:                                 marshalledKey,
+			UpdateExpression:                    expr.Update(),
+			ConditionExpression:                 expr.Condition(),
+			ExpressionAttributeNames:            expr.Names(),
+			ExpressionAttributeValues:           expr.Values(),
+			ReturnValues:                        types.ReturnValueAllNew,
+			ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
 		},
 	)
+
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return result, ddb.conditionError(err, key, update.version)
+	}
 	if err != nil {
-		return err
+		trackError("UpdateItem")
+		return result, err
 	}
-	return nil
+
+	err = ddb.decode(response.Attributes, &result)
+
+	return result, err
 }
 
-func IsEmptyValue(value reflect.Value) bool {
-	switch value.Kind() {
-	case reflect.String:
-		return value.String() == ""
-	case reflect.Int, reflect.Int16, reflect.Int32, reflect.Int64:
-		return value.Int() == 0
-	case reflect.Float32, reflect.Float64:
-		return value.Float() == 0
-	case reflect.Ptr:
-		return value.IsNil()
-	case reflect.Struct:
-		for i := 0; i < value.NumField(); i++ {
-			if !IsEmptyValue(value.Field(i)) {
-				return false
-			}
-		}
-		return true
-	case reflect.Slice:
-		if value.Len() > 0 {
-			return false
-		}
-		return true
-	default:
-		return true
-	}
+// Counts the failed calls so they show up in the metrics
+func trackError(operation string) {
+	metrics.DynamoDBErrors.WithLabelValues(operation).Inc()
 }
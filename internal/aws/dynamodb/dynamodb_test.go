@@ -1,46 +1,554 @@
 package dynamodb_test
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/ricomonster/black-flag/internal/aws/dynamodb"
-	"github.com/ricomonster/black-flag/internal/config"
-	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb/ddbtest"
 )
 
-func init() {
-	config.LoadEnvConfig()
+type testItem struct {
+	Id       string `dynamodbkey:"partition"`
+	Title    string
+	Views    int
+	Tags     []string
+	Modified int64
+}
+
+func newTestTable(t *testing.T) (*dynamodb.DynamoDB[testItem], *ddbtest.Fake) {
+	fake := ddbtest.New("BlackFlag_Test")
+	return mustTable(t, "BlackFlag_Test", fake), fake
+}
+
+func mustTable(t *testing.T, table string, fake *ddbtest.Fake) *dynamodb.DynamoDB[testItem] {
+	svc, err := dynamodb.NewDynamoDB[testItem](table, dynamodb.WithClient(fake))
+	if err != nil {
+		t.Fatalf("unable to create the table client: %v", err)
+	}
+
+	return svc
 }
 
 func TestListTables(t *testing.T) {
-	svc := dynamodb.NewDynamoDB[interface{}]("")
+	fake := ddbtest.New("BlackFlag_Videos", "BlackFlag_AlertRules")
+	svc := mustTable(t, "", fake)
+
 	tables, err := svc.ListTables()
 	if err != nil {
-		t.Errorf("TestListTables: Error %v", err)
+		t.Fatalf("TestListTables: Error %v", err)
 	}
 
-	t.Logf("TestListTables: Tables %v", tables)
+	if len(tables) != 2 || tables[0] != "BlackFlag_AlertRules" || tables[1] != "BlackFlag_Videos" {
+		t.Errorf("TestListTables: got %v", tables)
+	}
 }
 
-func TestFindById(t *testing.T) {
-	svc := dynamodb.NewDynamoDB[interface{}]("BlackFlag_Videos")
-	item, err := svc.FindById("Id", "_Hu4GYtye5U")
+func TestFindByKey(t *testing.T) {
+	svc, _ := newTestTable(t)
+
+	if err := svc.PutItem(testItem{Id: "abc", Title: "First", Views: 10}); err != nil {
+		t.Fatalf("TestFindByKey: Error %v", err)
+	}
+
+	item, err := svc.FindByKey(dynamodb.Key{Partition: "abc"})
 	if err != nil {
-		t.Errorf("TestFindById: Error %v", err)
+		t.Fatalf("TestFindByKey: Error %v", err)
+	}
+	if item.Title != "First" || item.Views != 10 {
+		t.Errorf("TestFindByKey: got %+v", item)
+	}
+
+	// Missing items are returned empty without an error
+	item, err = svc.FindByKey(dynamodb.Key{Partition: "missing"})
+	if err != nil || item.Id != "" {
+		t.Errorf("TestFindByKey: missing item got %+v, %v", item, err)
 	}
 
-	t.Logf("TestFindById: Tables %v", item)
+	if _, err := svc.FindByKey(dynamodb.Key{Partition: ""}); err == nil {
+		t.Errorf("TestFindByKey: expected an error without an id")
+	}
 }
 
 func TestUpdateItem(t *testing.T) {
-	svc := dynamodb.NewDynamoDB[videos.VideoDdbAttributes]("BlackFlag_Videos")
-	itemToUpdate := videos.VideoDdbAttributes{
-		TestAttribute: "Made in Japan",
-		// TestAttributeHana: 23,
+	svc, _ := newTestTable(t)
+
+	if err := svc.PutItem(testItem{Id: "abc", Title: "First", Views: 10, Tags: []string{"a"}}); err != nil {
+		t.Fatalf("TestUpdateItem: Error %v", err)
 	}
 
-	err := svc.UpdateItem("Id", "_Hu4GYtye5U", itemToUpdate)
+	update := dynamodb.NewUpdate().
+		Add("Views", 5).
+		Append("Tags", []string{"b"}).
+		Remove("Title").
+		SetIfNotExists("Modified", 1)
+
+	item, err := svc.UpdateItem(dynamodb.Key{Partition: "abc"}, update)
 	if err != nil {
-		t.Errorf("TestUpdateItem: Error %v", err)
+		t.Fatalf("TestUpdateItem: Error %v", err)
+	}
+	// Modified was stored as 0 by PutItem so it is kept
+	if item.Title != "" || item.Views != 15 || len(item.Tags) != 2 || item.Tags[1] != "b" || item.Modified != 0 {
+		t.Errorf("TestUpdateItem: got %+v", item)
+	}
+
+	// Only when the condition holds
+	update = dynamodb.NewUpdate().Set("Views", 0).If(expression.Name("Views").Equal(expression.Value(10)))
+	if _, err := svc.UpdateItem(dynamodb.Key{Partition: "abc"}, update); !errors.Is(err, dynamodb.ErrConditionFailed) {
+		t.Errorf("TestUpdateItem: expected the condition to fail, got %v", err)
+	}
+
+	update = dynamodb.NewUpdate().Set("Views", 0).If(expression.Name("Views").Equal(expression.Value(15)))
+	if item, err := svc.UpdateItem(dynamodb.Key{Partition: "abc"}, update); err != nil || item.Views != 0 {
+		t.Errorf("TestUpdateItem: expected the views to be reset, got %+v, %v", item, err)
+	}
+
+	if _, err := svc.UpdateItem(dynamodb.Key{Partition: "abc"}, dynamodb.NewUpdate()); err == nil {
+		t.Errorf("TestUpdateItem: expected an error for an update without changes")
+	}
+}
+
+type maskItem struct {
+	Id       string            `dynamodbav:"Id" dynamodbkey:"partition"`
+	Count    int               `dynamodbav:"count"`
+	Active   bool              `dynamodbav:"active"`
+	Size     uint              `dynamodbav:"size"`
+	Labels   map[string]string `dynamodbav:"labels"`
+	Title    string            `dynamodbav:"title"`
+	Tags     []string          `dynamodbav:"tags"`
+	Note     string            `dynamodbav:"note,omitempty"`
+	Owner    maskOwner         `dynamodbav:"owner"`
+	Skipped  string            `dynamodbav:"-"`
+	Untagged int
+}
+
+type maskOwner struct {
+	Name  string `dynamodbav:"name"`
+	Total int    `dynamodbav:"total"`
+}
+
+func TestUpdateMask(t *testing.T) {
+	fake := ddbtest.New("BlackFlag_Test")
+	svc, err := dynamodb.NewDynamoDB[maskItem]("BlackFlag_Test", dynamodb.WithClient(fake))
+	if err != nil {
+		t.Fatalf("TestUpdateMask: Error %v", err)
+	}
+
+	if err := svc.PutItem(maskItem{Id: "abc", Owner: maskOwner{Name: "Ann", Total: 3}}); err != nil {
+		t.Fatalf("TestUpdateMask: Error %v", err)
+	}
+
+	mask := []string{"count", "active", "size", "labels", "title", "tags", "note", "owner.name", "Untagged"}
+
+	// Bools, uints and maps are written like everything else
+	update, err := svc.UpdateMask(maskItem{
+		Count: 2, Active: true, Size: 7, Labels: map[string]string{"a": "b"}, Title: "Title", Tags: []string{"a"},
+		Note: "note", Owner: maskOwner{Name: "Bob"}, Untagged: 1,
+	}, mask...)
+	if err != nil {
+		t.Fatalf("TestUpdateMask: Error %v", err)
+	}
+
+	item, err := svc.UpdateItem(dynamodb.Key{Partition: "abc"}, update)
+	if err != nil {
+		t.Fatalf("TestUpdateMask: Error %v", err)
+	}
+	if item.Count != 2 || !item.Active || item.Size != 7 || item.Labels["a"] != "b" || item.Title != "Title" ||
+		len(item.Tags) != 1 || item.Note != "note" || item.Untagged != 1 {
+		t.Errorf("TestUpdateMask: got %+v", item)
+	}
+
+	// Only the masked nested attribute changes
+	if item.Owner.Name != "Bob" || item.Owner.Total != 3 {
+		t.Errorf("TestUpdateMask: expected only the owner name to change, got %+v", item.Owner)
+	}
+
+	// Zero values are written too and omitempty fields are removed
+	update, err = svc.UpdateMask(maskItem{Labels: map[string]string{}, Tags: []string{}}, mask...)
+	if err != nil {
+		t.Fatalf("TestUpdateMask: Error %v", err)
+	}
+
+	if item, err = svc.UpdateItem(dynamodb.Key{Partition: "abc"}, update); err != nil {
+		t.Fatalf("TestUpdateMask: Error %v", err)
+	}
+	if item.Count != 0 || item.Active || item.Size != 0 || len(item.Labels) != 0 || item.Title != "" || len(item.Tags) != 0 || item.Untagged != 0 {
+		t.Errorf("TestUpdateMask: expected zero values, got %+v", item)
+	}
+	if _, ok := fake.Items("BlackFlag_Test")[0]["note"]; ok {
+		t.Errorf("TestUpdateMask: expected the empty omitempty note to be removed")
+	}
+
+	// The mask uses the stored names and can't touch the key
+	for _, mask := range [][]string{{"Count"}, {"Id"}, {"Skipped"}, {"missing"}, {}} {
+		if _, err := svc.UpdateMask(maskItem{}, mask...); err == nil {
+			t.Errorf("TestUpdateMask: expected an error for the mask %v", mask)
+		}
+	}
+}
+
+func TestGetAllAndDeleteItem(t *testing.T) {
+	svc, fake := newTestTable(t)
+
+	for _, id := range []string{"b", "a", "c"} {
+		if err := svc.PutItem(testItem{Id: id}); err != nil {
+			t.Fatalf("TestGetAllAndDeleteItem: Error %v", err)
+		}
+	}
+
+	if err := svc.DeleteItem(dynamodb.Key{Partition: "b"}); err != nil {
+		t.Fatalf("TestGetAllAndDeleteItem: Error %v", err)
+	}
+
+	items, err := svc.GetAll()
+	if err != nil {
+		t.Fatalf("TestGetAllAndDeleteItem: Error %v", err)
+	}
+	if len(items) != 2 || items[0].Id != "a" || items[1].Id != "c" {
+		t.Errorf("TestGetAllAndDeleteItem: got %+v", items)
+	}
+
+	// Tables over 1 MB are read page after page
+	fake.SetPageSize(1)
+	scans := fake.Calls("Scan")
+	items, err = svc.GetAll()
+	if err != nil || len(items) != 2 || fake.Calls("Scan")-scans != 2 {
+		t.Errorf("TestGetAllAndDeleteItem: expected every page to be read, got %+v in %d scans, %v", items, fake.Calls("Scan")-scans, err)
+	}
+
+	// An item that can't be decoded fails the read instead of being left out
+	err = svc.PutRaw(map[string]types.AttributeValue{
+		"Id":    &types.AttributeValueMemberS{Value: "d"},
+		"Views": &types.AttributeValueMemberS{Value: "many"},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GetAll(); err == nil {
+		t.Errorf("TestGetAllAndDeleteItem: expected the undecodable item to fail the read")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	svc, fake := newTestTable(t)
+
+	injected := errors.New("throttled")
+	fake.FailNext("PutItem", injected)
+
+	if err := svc.PutItem(testItem{Id: "abc"}); !errors.Is(err, injected) {
+		t.Errorf("TestErrors: expected the injected error, got %v", err)
+	}
+	if err := svc.PutItem(testItem{Id: "abc"}); err != nil {
+		t.Errorf("TestErrors: only the next call should fail, got %v", err)
+	}
+
+	// Unknown tables fail like they do on AWS
+	missing := mustTable(t, "BlackFlag_Missing", fake)
+	var notFound *types.ResourceNotFoundException
+	if _, err := missing.GetAll(); !errors.As(err, &notFound) {
+		t.Errorf("TestErrors: expected a ResourceNotFoundException, got %v", err)
+	}
+}
+
+func TestNewDynamoDBConfig(t *testing.T) {
+	// A key id without its secret is a mistake in the config
+	t.Setenv("BLACK_FLAG_DYNAMODB_ACCESS_KEY_ID", "key")
+	t.Setenv("BLACK_FLAG_DYNAMODB_SECRET_ACCESS_KEY", "")
+	if _, err := dynamodb.NewDynamoDB[testItem]("BlackFlag_Test"); err == nil {
+		t.Errorf("TestNewDynamoDBConfig: expected an error without a secret access key")
+	}
+
+	// Local endpoints work without any AWS account set up
+	t.Setenv("BLACK_FLAG_DYNAMODB_ACCESS_KEY_ID", "")
+	t.Setenv("BLACK_FLAG_DYNAMODB_ENDPOINT", "http://localhost:8000")
+	t.Setenv("AWS_CONFIG_FILE", "/nonexistent")
+	if _, err := dynamodb.NewDynamoDB[testItem]("BlackFlag_Test"); err != nil {
+		t.Errorf("TestNewDynamoDBConfig: Error %v", err)
+	}
+}
+
+func TestEnsureTable(t *testing.T) {
+	fake := ddbtest.New()
+	schema := dynamodb.TableSchema{
+		Name:    "BlackFlag_Test",
+		HashKey: dynamodb.KeyAttribute{Name: "Id", Type: types.ScalarAttributeTypeS},
+		Indexes: []dynamodb.IndexSchema{
+			{Name: "ChannelIndex", HashKey: dynamodb.KeyAttribute{Name: "ChannelId", Type: types.ScalarAttributeTypeS}},
+		},
+		TTLAttribute: "ExpiresAt",
+	}
+
+	result, err := dynamodb.EnsureTable(schema, dynamodb.WithClient(fake))
+	if err != nil {
+		t.Fatalf("TestEnsureTable: Error %v", err)
+	}
+	if !result.Created || len(result.AddedIndexes) != 1 || !result.EnabledTTL {
+		t.Errorf("TestEnsureTable: got %+v", result)
+	}
+
+	// Indexes added to the schema later are added to the existing table
+	schema.Indexes = append(schema.Indexes, dynamodb.IndexSchema{
+		Name:    "PollIndex",
+		HashKey: dynamodb.KeyAttribute{Name: "PollBucket", Type: types.ScalarAttributeTypeS},
+	})
+
+	result, err = dynamodb.EnsureTable(schema, dynamodb.WithClient(fake))
+	if err != nil {
+		t.Fatalf("TestEnsureTable: Error %v", err)
+	}
+	if result.Created || len(result.AddedIndexes) != 1 || result.AddedIndexes[0] != "PollIndex" || result.EnabledTTL {
+		t.Errorf("TestEnsureTable: got %+v", result)
+	}
+
+	// Nothing left to do
+	result, err = dynamodb.EnsureTable(schema, dynamodb.WithClient(fake))
+	if err != nil || result.Created || len(result.AddedIndexes) != 0 || result.EnabledTTL {
+		t.Errorf("TestEnsureTable: expected no change, got %+v, %v", result, err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	svc, fake := newTestTable(t)
+
+	backoff, retries := dynamodb.BATCH_BACKOFF, dynamodb.BATCH_RETRIES
+	defer func() { dynamodb.BATCH_BACKOFF, dynamodb.BATCH_RETRIES = backoff, retries }()
+	dynamodb.BATCH_BACKOFF = 0
+
+	var items []testItem
+	var keys []dynamodb.Key
+	for i := 0; i < 60; i++ {
+		id := fmt.Sprintf("video%02d", i)
+		items = append(items, testItem{Id: id, Views: i})
+		keys = append(keys, dynamodb.Key{Partition: id})
+	}
+
+	// DynamoDB doesn't process everything at once sometimes
+	fake.UnprocessNext("BatchWriteItem", 5)
+	if err := svc.BatchPut(items); err != nil {
+		t.Fatalf("TestBatch: Error %v", err)
+	}
+	if len(fake.Items("BlackFlag_Test")) != 60 || fake.Calls("BatchWriteItem") != 4 {
+		t.Errorf("TestBatch: expected 60 items in 3 batches and a retry, got %d items in %d calls", len(fake.Items("BlackFlag_Test")), fake.Calls("BatchWriteItem"))
+	}
+
+	fake.UnprocessNext("BatchGetItem", 10)
+	found, err := svc.BatchGet(append(keys, dynamodb.Key{Partition: "missing"}, dynamodb.Key{Partition: "video00"}))
+	if err != nil {
+		t.Fatalf("TestBatch: Error %v", err)
+	}
+	if len(found) != 60 || found["video42"].Views != 42 {
+		t.Errorf("TestBatch: expected the 60 items, got %d", len(found))
+	}
+
+	if err := svc.BatchDelete(keys[:50]); err != nil {
+		t.Fatalf("TestBatch: Error %v", err)
+	}
+	if len(fake.Items("BlackFlag_Test")) != 10 {
+		t.Errorf("TestBatch: expected 10 items left, got %d", len(fake.Items("BlackFlag_Test")))
+	}
+
+	// Items that are never processed are reported on their own
+	dynamodb.BATCH_RETRIES = 1
+	fake.UnprocessNext("BatchWriteItem", 1)
+	fake.UnprocessNext("BatchWriteItem", 1)
+
+	err = svc.BatchPut([]testItem{{Id: "a"}, {Id: "b"}})
+
+	var batchErrors dynamodb.BatchErrors
+	if !errors.As(err, &batchErrors) || len(batchErrors) != 1 || !errors.Is(batchErrors["b"], dynamodb.ErrUnprocessed) {
+		t.Errorf("TestBatch: expected b to be unprocessed, got %v", err)
+	}
+}
+
+type sampleItem struct {
+	Video     string `dynamodbav:"VideoId" dynamodbkey:"partition"`
+	Timestamp int64  `dynamodbkey:"sort"`
+	Views     int
+}
+
+func TestKeySchemaOf(t *testing.T) {
+	schema, err := dynamodb.KeySchemaOf[sampleItem]()
+	if err != nil {
+		t.Fatalf("TestKeySchemaOf: Error %v", err)
+	}
+	if schema.Partition != (dynamodb.KeyAttribute{Name: "VideoId", Type: types.ScalarAttributeTypeS}) ||
+		schema.Sort == nil || *schema.Sort != (dynamodb.KeyAttribute{Name: "Timestamp", Type: types.ScalarAttributeTypeN}) {
+		t.Errorf("TestKeySchemaOf: got %+v", schema)
+	}
+
+	type binaryItem struct {
+		Hash []byte `dynamodbkey:"partition"`
+	}
+	if schema, err := dynamodb.KeySchemaOf[binaryItem](); err != nil || schema.Partition.Type != types.ScalarAttributeTypeB || schema.Sort != nil {
+		t.Errorf("TestKeySchemaOf: expected a binary partition key, got %+v, %v", schema, err)
+	}
+
+	type untagged struct{ Id string }
+	if _, err := dynamodb.KeySchemaOf[untagged](); err == nil {
+		t.Errorf("TestKeySchemaOf: expected an error without a partition key")
+	}
+	if _, err := dynamodb.NewDynamoDB[untagged]("BlackFlag_Test", dynamodb.WithClient(ddbtest.New())); err == nil {
+		t.Errorf("TestKeySchemaOf: expected NewDynamoDB to fail without a partition key")
+	}
+
+	type unsupported struct {
+		Id bool `dynamodbkey:"partition"`
+	}
+	if _, err := dynamodb.KeySchemaOf[unsupported](); err == nil {
+		t.Errorf("TestKeySchemaOf: expected an error for a bool key")
+	}
+}
+
+func TestCompositeKey(t *testing.T) {
+	fake := ddbtest.New()
+	_, err := dynamodb.EnsureTable(dynamodb.TableSchema{
+		Name:     "BlackFlag_Samples",
+		HashKey:  dynamodb.KeyAttribute{Name: "VideoId", Type: types.ScalarAttributeTypeS},
+		RangeKey: &dynamodb.KeyAttribute{Name: "Timestamp", Type: types.ScalarAttributeTypeN},
+	}, dynamodb.WithClient(fake))
+	if err != nil {
+		t.Fatalf("TestCompositeKey: Error %v", err)
+	}
+
+	svc, err := dynamodb.NewDynamoDB[sampleItem]("BlackFlag_Samples", dynamodb.WithClient(fake))
+	if err != nil {
+		t.Fatalf("TestCompositeKey: Error %v", err)
+	}
+
+	// Same video, the sort key tells them apart
+	if err := svc.BatchPut([]sampleItem{{Video: "a", Timestamp: 1, Views: 10}, {Video: "a", Timestamp: 2, Views: 20}, {Video: "b", Timestamp: 1, Views: 5}}); err != nil {
+		t.Fatalf("TestCompositeKey: Error %v", err)
+	}
+
+	item, err := svc.FindByKey(dynamodb.Key{Partition: "a", Sort: 2})
+	if err != nil || item.Views != 20 {
+		t.Errorf("TestCompositeKey: got %+v, %v", item, err)
+	}
+
+	key, err := svc.KeyOf(item)
+	if err != nil || key.String() != "a/2" {
+		t.Errorf("TestCompositeKey: expected the key a/2, got %v, %v", key, err)
+	}
+
+	found, err := svc.BatchGet([]dynamodb.Key{{Partition: "a", Sort: 1}, {Partition: "b", Sort: int64(1)}, {Partition: "b", Sort: 2}})
+	if err != nil || len(found) != 2 || found["a/1"].Views != 10 || found["b/1"].Views != 5 {
+		t.Errorf("TestCompositeKey: got %+v, %v", found, err)
+	}
+
+	// The key must match the schema
+	for _, key := range []dynamodb.Key{{Partition: "a"}, {Partition: "a", Sort: "1"}, {Partition: 1, Sort: 1}} {
+		if _, err := svc.FindByKey(key); err == nil {
+			t.Errorf("TestCompositeKey: expected an error for %+v", key)
+		}
+	}
+
+	if err := svc.DeleteItem(dynamodb.Key{Partition: "a", Sort: 1}); err != nil {
+		t.Fatalf("TestCompositeKey: Error %v", err)
+	}
+	if len(fake.Items("BlackFlag_Samples")) != 2 {
+		t.Errorf("TestCompositeKey: expected 2 items left, got %d", len(fake.Items("BlackFlag_Samples")))
+	}
+}
+
+type versionedItem struct {
+	Id      string `dynamodbkey:"partition"`
+	Views   int
+	Version int64 `dynamodbversion:"true"`
+}
+
+func TestVersioning(t *testing.T) {
+	fake := ddbtest.New("BlackFlag_Test")
+	svc, err := dynamodb.NewDynamoDB[versionedItem]("BlackFlag_Test", dynamodb.WithClient(fake))
+	if err != nil {
+		t.Fatalf("TestVersioning: Error %v", err)
+	}
+	key := dynamodb.Key{Partition: "abc"}
+
+	if err := svc.PutItem(versionedItem{Id: "abc", Views: 1}); err != nil {
+		t.Fatalf("TestVersioning: Error %v", err)
+	}
+
+	// Two readers of the same version, only the first write goes through
+	read, _ := svc.FindByKey(key)
+	if read.Version != 1 {
+		t.Fatalf("TestVersioning: expected version 1, got %+v", read)
+	}
+
+	first, second := read, read
+	first.Views, second.Views = 2, 3
+
+	update, _ := svc.UpdateMask(first, "Views")
+	if item, err := svc.UpdateItem(key, update); err != nil || item.Version != 2 || item.Views != 2 {
+		t.Fatalf("TestVersioning: got %+v, %v", item, err)
+	}
+
+	update, _ = svc.UpdateMask(second, "Views")
+	if _, err := svc.UpdateItem(key, update); !errors.Is(err, dynamodb.ErrConflict) {
+		t.Errorf("TestVersioning: expected a conflict on update, got %v", err)
+	}
+	if err := svc.PutItem(second); !errors.Is(err, dynamodb.ErrConflict) {
+		t.Errorf("TestVersioning: expected a conflict on put, got %v", err)
+	}
+	if err := svc.PutItem(versionedItem{Id: "abc"}); !errors.Is(err, dynamodb.ErrConflict) {
+		t.Errorf("TestVersioning: expected a conflict when putting over an existing item, got %v", err)
+	}
+
+	// A condition of the caller failing on the current version is not a conflict
+	update = dynamodb.NewUpdate().Set("Views", 4).IfVersion(2).If(expression.Name("Views").Equal(expression.Value(0)))
+	if _, err := svc.UpdateItem(key, update); errors.Is(err, dynamodb.ErrConflict) || !errors.Is(err, dynamodb.ErrConditionFailed) {
+		t.Errorf("TestVersioning: expected the condition to fail without a conflict, got %v", err)
+	}
+
+	// Unconditioned updates still move the version
+	if item, err := svc.UpdateItem(key, dynamodb.NewUpdate().Add("Views", 1)); err != nil || item.Version != 3 {
+		t.Errorf("TestVersioning: expected version 3, got %+v, %v", item, err)
+	}
+
+	// Someone writes in between the first read and write, the mutation is made again on the new item
+	calls := 0
+	item, err := svc.Modify(key, func(item *versionedItem) error {
+		calls++
+		if calls == 1 {
+			if _, err := svc.UpdateItem(key, dynamodb.NewUpdate().Add("Views", 10)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		item.Views *= 2
+		return nil
+	})
+	if err != nil || calls != 2 || item.Views != 26 || item.Version != 5 {
+		t.Errorf("TestVersioning: expected the mutation to be retried, got %+v after %d calls, %v", item, calls, err)
+	}
+
+	// Restoring an older copy moves the version forward, a reader of the stored item still conflicts
+	stale, _ := svc.FindByKey(key)
+	restored, err := svc.Replace(versionedItem{Id: "abc", Views: 1, Version: 1})
+	if err != nil || restored.Version != 6 || restored.Views != 1 {
+		t.Errorf("TestVersioning: expected the replaced item at version 6, got %+v, %v", restored, err)
+	}
+	update, _ = svc.UpdateMask(stale, "Views")
+	if _, err := svc.UpdateItem(key, update); !errors.Is(err, dynamodb.ErrConflict) {
+		t.Errorf("TestVersioning: expected a conflict after the replace, got %v", err)
+	}
+
+	// Only created when missing
+	if _, err := svc.Create(versionedItem{Id: "abc", Views: 100}); !errors.Is(err, dynamodb.ErrAlreadyExists) {
+		t.Errorf("TestVersioning: expected the stored item to be kept, got %v", err)
+	}
+	if created, err := svc.Create(versionedItem{Id: "def", Views: 100}); err != nil || created.Version != 1 {
+		t.Errorf("TestVersioning: expected the item to be created at version 1, got %+v, %v", created, err)
+	}
+
+	// Not for items without a version
+	plain, _ := newTestTable(t)
+	if _, err := plain.Modify(key, func(*testItem) error { return nil }); err == nil {
+		t.Errorf("TestVersioning: expected Modify to need a version")
+	}
+	if _, err := plain.UpdateItem(key, dynamodb.NewUpdate().Set("Views", 1).IfVersion(1)); err == nil {
+		t.Errorf("TestVersioning: expected IfVersion to need a version")
 	}
 }
@@ -0,0 +1,219 @@
+package dynamodb
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Struct tag marking the fields holding the primary key of the items, e.g.
+//
+//	Channel   string `dynamodbav:"Channel" dynamodbkey:"partition"`
+//	Timestamp int64  `dynamodbav:"Timestamp" dynamodbkey:"sort"`
+var KEY_TAG = "dynamodbkey"
+
+// Primary key of an item, the sort key is only given when the table has one.
+// The values are strings, numbers or []byte matching the type of the key attribute.
+type Key struct {
+	Partition interface{}
+	Sort      interface{}
+}
+
+// Value of the key as used by BatchGet and BatchErrors, the partition key followed by a / and the sort key
+// when there is one. Binary values are base64 encoded.
+func (k Key) String() string {
+	value := keyValueString(k.Partition)
+	if k.Sort != nil {
+		value += "/" + keyValueString(k.Sort)
+	}
+
+	return value
+}
+
+// Names and types of the key attributes of a table
+type KeySchema struct {
+	Partition KeyAttribute
+	Sort      *KeyAttribute
+}
+
+// Derives the key schema from the fields of T tagged with KEY_TAG, the attribute names come from the
+// dynamodbav tags like they do when the items are marshalled.
+func KeySchemaOf[T any]() (KeySchema, error) {
+	var schema KeySchema
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return schema, fmt.Errorf("%s is not a struct", t)
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		role, ok := field.Tag.Lookup(KEY_TAG)
+		if !ok {
+			continue
+		}
+
+		attribute, err := keyAttributeOf(field)
+		if err != nil {
+			return schema, fmt.Errorf("%s.%s: %w", t.Name(), field.Name, err)
+		}
+
+		switch role {
+		case "partition":
+			if schema.Partition.Name != "" {
+				return schema, fmt.Errorf("%s has more than one partition key", t.Name())
+			}
+			schema.Partition = attribute
+		case "sort":
+			if schema.Sort != nil {
+				return schema, fmt.Errorf("%s has more than one sort key", t.Name())
+			}
+			schema.Sort = &attribute
+		default:
+			return schema, fmt.Errorf("%s.%s: unknown key %q, either partition or sort", t.Name(), field.Name, role)
+		}
+	}
+
+	if schema.Partition.Name == "" {
+		return schema, fmt.Errorf("%s has no field tagged %s:\"partition\"", t.Name(), KEY_TAG)
+	}
+
+	return schema, nil
+}
+
+func keyAttributeOf(field reflect.StructField) (KeyAttribute, error) {
+	attribute := KeyAttribute{Name: field.Name}
+
+	if tag := strings.Split(field.Tag.Get("dynamodbav"), ",")[0]; tag == "-" {
+		return attribute, errors.New("a key can't be skipped by dynamodbav")
+	} else if tag != "" {
+		attribute.Name = tag
+	}
+
+	switch kind := field.Type.Kind(); {
+	case kind == reflect.String:
+		attribute.Type = types.ScalarAttributeTypeS
+	case kind >= reflect.Int && kind <= reflect.Float64:
+		attribute.Type = types.ScalarAttributeTypeN
+	case kind == reflect.Slice && field.Type.Elem().Kind() == reflect.Uint8:
+		attribute.Type = types.ScalarAttributeTypeB
+	default:
+		return attribute, fmt.Errorf("a key must be a string, a number or []byte, not %s", field.Type)
+	}
+
+	return attribute, nil
+}
+
+// The key as sent to DynamoDB, fails when it doesn't match the schema
+func (s KeySchema) marshal(key Key) (map[string]types.AttributeValue, error) {
+	partition, err := marshalKeyValue(s.Partition, key.Partition)
+	if err != nil {
+		return nil, err
+	}
+
+	marshalled := map[string]types.AttributeValue{s.Partition.Name: partition}
+
+	if s.Sort == nil {
+		if key.Sort != nil {
+			return nil, errors.New("the table has no sort key")
+		}
+		return marshalled, nil
+	}
+
+	if marshalled[s.Sort.Name], err = marshalKeyValue(*s.Sort, key.Sort); err != nil {
+		return nil, err
+	}
+
+	return marshalled, nil
+}
+
+func marshalKeyValue(attribute KeyAttribute, value interface{}) (types.AttributeValue, error) {
+	if value == nil {
+		return nil, fmt.Errorf("%s is required", attribute.Name)
+	}
+
+	marshalled, err := attributevalue.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := false
+	switch v := marshalled.(type) {
+	case *types.AttributeValueMemberS:
+		valid = attribute.Type == types.ScalarAttributeTypeS && v.Value != ""
+	case *types.AttributeValueMemberN:
+		valid = attribute.Type == types.ScalarAttributeTypeN
+	case *types.AttributeValueMemberB:
+		valid = attribute.Type == types.ScalarAttributeTypeB && len(v.Value) > 0
+	}
+
+	if !valid {
+		return nil, fmt.Errorf("%s must be a non empty %s, got %T %v", attribute.Name, attributeTypeName(attribute.Type), value, value)
+	}
+
+	return marshalled, nil
+}
+
+// Same value as Key.String of the key of a stored item
+func (s KeySchema) stringOf(item map[string]types.AttributeValue) string {
+	value := attributeString(item[s.Partition.Name])
+	if s.Sort != nil {
+		value += "/" + attributeString(item[s.Sort.Name])
+	}
+
+	return value
+}
+
+// Only the key attributes of the item
+func (s KeySchema) keyOf(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	key := map[string]types.AttributeValue{s.Partition.Name: item[s.Partition.Name]}
+	if s.Sort != nil {
+		key[s.Sort.Name] = item[s.Sort.Name]
+	}
+
+	return key
+}
+
+// Tells if the attribute is part of the key, those can't be changed by an update
+func (s KeySchema) isKey(name string) bool {
+	return name == s.Partition.Name || (s.Sort != nil && name == s.Sort.Name)
+}
+
+func keyValueString(value interface{}) string {
+	marshalled, err := attributevalue.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return attributeString(marshalled)
+}
+
+func attributeString(value types.AttributeValue) string {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value
+	case *types.AttributeValueMemberN:
+		return v.Value
+	case *types.AttributeValueMemberB:
+		return base64.StdEncoding.EncodeToString(v.Value)
+	}
+
+	return ""
+}
+
+func attributeTypeName(attributeType types.ScalarAttributeType) string {
+	switch attributeType {
+	case types.ScalarAttributeTypeN:
+		return "number"
+	case types.ScalarAttributeTypeB:
+		return "binary"
+	}
+
+	return "string"
+}
@@ -0,0 +1,126 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// Returned when querying an index the table doesn't have, e.g. init-table was not run since it was added
+var ErrIndexNotFound = errors.New("the table does not have the index")
+
+type QueryOptions struct {
+	// Queries the table itself when empty
+	Index  string
+	Key    expression.KeyConditionBuilder
+	Filter *expression.ConditionBuilder
+	// Items read per page, the filter is applied after the limit
+	Limit int32
+	// Key returned by the previous page
+	StartKey map[string]types.AttributeValue
+	// Highest range key first
+	Descending bool
+	// Only reads these attributes when set
+	Projection []string
+}
+
+type Page[T any] struct {
+	Items []T
+	// Key to get the next page with, nil on the last page
+	Next map[string]types.AttributeValue
+}
+
+// Reads a single page of the items matching the key condition
+func (ddb *DynamoDB[T]) Query(options QueryOptions) (Page[T], error) {
+	var page Page[T]
+
+	builder := expression.NewBuilder().WithKeyCondition(options.Key)
+	if options.Filter != nil {
+		builder = builder.WithFilter(*options.Filter)
+	}
+	if len(options.Projection) > 0 {
+		names := make([]expression.NameBuilder, len(options.Projection))
+		for i, name := range options.Projection {
+			names[i] = expression.Name(name)
+		}
+		builder = builder.WithProjection(expression.NamesList(names[0], names[1:]...))
+	}
+
+	expr, err := builder.Build()
+	if err != nil {
+		return page, err
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(ddb.table),
+		KeyConditionExpression:    expr.KeyCondition(),
+		FilterExpression:          expr.Filter(),
+		ProjectionExpression:      expr.Projection(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ExclusiveStartKey:         options.StartKey,
+		ScanIndexForward:          aws.Bool(!options.Descending),
+	}
+	if options.Index != "" {
+		input.IndexName = aws.String(options.Index)
+	}
+	if options.Limit > 0 {
+		input.Limit = aws.Int32(options.Limit)
+	}
+
+	response, err := ddb.client.Query(context.TODO(), input)
+	if isIndexNotFound(err) {
+		return page, fmt.Errorf("%w: %s on %s", ErrIndexNotFound, options.Index, ddb.table)
+	}
+	if err != nil {
+		trackError("Query")
+		return page, err
+	}
+
+	for _, item := range response.Items {
+		var result T
+		if err := ddb.decode(item, &result); err != nil {
+			return page, err
+		}
+
+		page.Items = append(page.Items, result)
+	}
+	page.Next = response.LastEvaluatedKey
+
+	return page, nil
+}
+
+// Reads every page of the items matching the key condition
+func (ddb *DynamoDB[T]) QueryAll(options QueryOptions) ([]T, error) {
+	var results []T
+
+	for {
+		page, err := ddb.Query(options)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, page.Items...)
+
+		if page.Next == nil {
+			return results, nil
+		}
+		options.StartKey = page.Next
+	}
+}
+
+func isIndexNotFound(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	return apiErr.ErrorCode() == "ValidationException" && strings.Contains(apiErr.ErrorMessage(), "specified index")
+}
@@ -0,0 +1,255 @@
+package dynamodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// How long we wait for a table or index to become active and how often we check
+var (
+	TABLE_WAIT_TIMEOUT  = 10 * time.Minute
+	TABLE_POLL_INTERVAL = 2 * time.Second
+)
+
+type KeyAttribute struct {
+	Name string
+	Type types.ScalarAttributeType
+}
+
+type IndexSchema struct {
+	Name     string
+	HashKey  KeyAttribute
+	RangeKey *KeyAttribute
+}
+
+// What a table should look like, tables are billed on demand
+type TableSchema struct {
+	Name     string
+	HashKey  KeyAttribute
+	RangeKey *KeyAttribute
+	Indexes  []IndexSchema
+	// Attribute holding the unix timestamp when an item expires, no TTL when empty
+	TTLAttribute string
+}
+
+type EnsureTableResult struct {
+	Created      bool
+	AddedIndexes []string
+	EnabledTTL   bool
+}
+
+// Creates the table when it doesn't exist yet and adds whatever it is missing, the indexes and the TTL.
+// Running it against a table that is already up to date changes nothing.
+func EnsureTable(schema TableSchema, opts ...Option) (EnsureTableResult, error) {
+	var result EnsureTableResult
+
+	client, err := newClient(opts)
+	if err != nil {
+		return result, err
+	}
+
+	ctx := context.TODO()
+
+	table, err := describeTable(ctx, client, schema.Name)
+	if err != nil {
+		return result, err
+	}
+
+	if table == nil {
+		_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+			TableName:              aws.String(schema.Name),
+			BillingMode:            types.BillingModePayPerRequest,
+			KeySchema:              keySchema(schema.HashKey, schema.RangeKey),
+			AttributeDefinitions:   schema.attributeDefinitions(),
+			GlobalSecondaryIndexes: schema.globalSecondaryIndexes(),
+		})
+		if err != nil {
+			trackError("CreateTable")
+			return result, err
+		}
+
+		result.Created = true
+		for _, index := range schema.Indexes {
+			result.AddedIndexes = append(result.AddedIndexes, index.Name)
+		}
+
+		if table, err = waitForTable(ctx, client, schema.Name); err != nil {
+			return result, err
+		}
+	}
+
+	// Only a single index can be added at a time
+	for _, index := range schema.Indexes {
+		if hasIndex(table, index.Name) {
+			continue
+		}
+
+		_, err := client.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+			TableName:            aws.String(schema.Name),
+			AttributeDefinitions: schema.attributeDefinitions(),
+			GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{{
+				Create: &types.CreateGlobalSecondaryIndexAction{
+					IndexName:  aws.String(index.Name),
+					KeySchema:  keySchema(index.HashKey, index.RangeKey),
+					Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+				},
+			}},
+		})
+		if err != nil {
+			trackError("UpdateTable")
+			return result, fmt.Errorf("unable to add the index %s: %w", index.Name, err)
+		}
+		result.AddedIndexes = append(result.AddedIndexes, index.Name)
+
+		if table, err = waitForTable(ctx, client, schema.Name); err != nil {
+			return result, err
+		}
+	}
+
+	if schema.TTLAttribute == "" {
+		return result, nil
+	}
+
+	ttl, err := client.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{TableName: aws.String(schema.Name)})
+	if err != nil {
+		trackError("DescribeTimeToLive")
+		return result, err
+	}
+
+	if description := ttl.TimeToLiveDescription; description != nil && aws.ToString(description.AttributeName) == schema.TTLAttribute &&
+		(description.TimeToLiveStatus == types.TimeToLiveStatusEnabled || description.TimeToLiveStatus == types.TimeToLiveStatusEnabling) {
+		return result, nil
+	}
+
+	_, err = client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(schema.Name),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(schema.TTLAttribute),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		trackError("UpdateTimeToLive")
+		return result, err
+	}
+	result.EnabledTTL = true
+
+	return result, nil
+}
+
+// Returns nil when the table doesn't exist
+func describeTable(ctx context.Context, client Client, name string) (*types.TableDescription, error) {
+	response, err := client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(name)})
+
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil, nil
+	}
+	if err != nil {
+		trackError("DescribeTable")
+		return nil, err
+	}
+
+	return response.Table, nil
+}
+
+// Waits until the table and every index of it are active
+func waitForTable(ctx context.Context, client Client, name string) (*types.TableDescription, error) {
+	deadline := time.Now().Add(TABLE_WAIT_TIMEOUT)
+
+	for {
+		table, err := describeTable(ctx, client, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if table != nil && isActive(table) {
+			return table, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("table %s is still not active after %s", name, TABLE_WAIT_TIMEOUT)
+		}
+
+		time.Sleep(TABLE_POLL_INTERVAL)
+	}
+}
+
+func isActive(table *types.TableDescription) bool {
+	if table.TableStatus != types.TableStatusActive {
+		return false
+	}
+
+	for _, index := range table.GlobalSecondaryIndexes {
+		if index.IndexStatus != types.IndexStatusActive {
+			return false
+		}
+	}
+
+	return true
+}
+
+func hasIndex(table *types.TableDescription, name string) bool {
+	for _, index := range table.GlobalSecondaryIndexes {
+		if aws.ToString(index.IndexName) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func keySchema(hashKey KeyAttribute, rangeKey *KeyAttribute) []types.KeySchemaElement {
+	elements := []types.KeySchemaElement{{AttributeName: aws.String(hashKey.Name), KeyType: types.KeyTypeHash}}
+	if rangeKey != nil {
+		elements = append(elements, types.KeySchemaElement{AttributeName: aws.String(rangeKey.Name), KeyType: types.KeyTypeRange})
+	}
+
+	return elements
+}
+
+// Every attribute used in a key of the table or of its indexes
+func (s TableSchema) attributeDefinitions() []types.AttributeDefinition {
+	var definitions []types.AttributeDefinition
+	seen := map[string]bool{}
+
+	add := func(attribute *KeyAttribute) {
+		if attribute == nil || seen[attribute.Name] {
+			return
+		}
+		seen[attribute.Name] = true
+
+		definitions = append(definitions, types.AttributeDefinition{
+			AttributeName: aws.String(attribute.Name),
+			AttributeType: attribute.Type,
+		})
+	}
+
+	add(&s.HashKey)
+	add(s.RangeKey)
+	for i := range s.Indexes {
+		add(&s.Indexes[i].HashKey)
+		add(s.Indexes[i].RangeKey)
+	}
+
+	return definitions
+}
+
+func (s TableSchema) globalSecondaryIndexes() []types.GlobalSecondaryIndex {
+	var indexes []types.GlobalSecondaryIndex
+	for _, index := range s.Indexes {
+		indexes = append(indexes, types.GlobalSecondaryIndex{
+			IndexName:  aws.String(index.Name),
+			KeySchema:  keySchema(index.HashKey, index.RangeKey),
+			Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+		})
+	}
+
+	return indexes
+}
@@ -0,0 +1,221 @@
+package dynamodb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Changes UpdateItem makes to an item. Paths are the attribute names as stored, i.e. the dynamodbav
+// tags, and can point inside maps and lists, e.g. "Channel.Title" or "ViewLogs[0]".
+// Zero values are written like any other value, use Remove to drop an attribute.
+type Update struct {
+	// Applied to a new builder every time the update is sent so it can be sent again
+	operations []func(expression.UpdateBuilder) expression.UpdateBuilder
+	condition  *expression.ConditionBuilder
+	version    *int64
+}
+
+func NewUpdate() *Update {
+	return &Update{}
+}
+
+func (u *Update) add(operation func(expression.UpdateBuilder) expression.UpdateBuilder) *Update {
+	u.operations = append(u.operations, operation)
+	return u
+}
+
+// Sets the attribute to the value
+func (u *Update) Set(path string, value interface{}) *Update {
+	return u.add(func(builder expression.UpdateBuilder) expression.UpdateBuilder {
+		return builder.Set(expression.Name(path), expression.Value(value))
+	})
+}
+
+// Sets the attribute to the value only when it doesn't exist yet
+func (u *Update) SetIfNotExists(path string, value interface{}) *Update {
+	return u.add(func(builder expression.UpdateBuilder) expression.UpdateBuilder {
+		return builder.Set(expression.Name(path), expression.Name(path).IfNotExists(expression.Value(value)))
+	})
+}
+
+// Drops the attribute from the item
+func (u *Update) Remove(path string) *Update {
+	return u.add(func(builder expression.UpdateBuilder) expression.UpdateBuilder {
+		return builder.Remove(expression.Name(path))
+	})
+}
+
+// Adds the number to the attribute, or the values to a set, starting from zero or an empty set
+func (u *Update) Add(path string, value interface{}) *Update {
+	return u.add(func(builder expression.UpdateBuilder) expression.UpdateBuilder {
+		return builder.Add(expression.Name(path), expression.Value(value))
+	})
+}
+
+// Appends the values, a slice, at the end of the list, starting from an empty list
+func (u *Update) Append(path string, values interface{}) *Update {
+	return u.add(func(builder expression.UpdateBuilder) expression.UpdateBuilder {
+		list := expression.Name(path).IfNotExists(expression.Value([]interface{}{}))
+		return builder.Set(expression.Name(path), expression.ListAppend(list, expression.Value(values)))
+	})
+}
+
+// Removes the values from a set
+func (u *Update) Delete(path string, values interface{}) *Update {
+	return u.add(func(builder expression.UpdateBuilder) expression.UpdateBuilder {
+		return builder.Delete(expression.Name(path), expression.Value(values))
+	})
+}
+
+// Only updates the item when the condition holds, UpdateItem returns ErrConditionFailed otherwise.
+// Several conditions must all hold.
+func (u *Update) If(condition expression.ConditionBuilder) *Update {
+	if u.condition != nil {
+		condition = u.condition.And(condition)
+	}
+	u.condition = &condition
+	return u
+}
+
+// Only updates the item when it is still at the version it was read at, UpdateItem returns ErrConflict
+// otherwise. Only for versioned items, UpdateMask sets it from the item.
+func (u *Update) IfVersion(version int64) *Update {
+	u.version = &version
+	return u
+}
+
+// The version of versioned items is incremented and checked
+func (u *Update) build(version *versionField) (expression.Expression, error) {
+	if len(u.operations) == 0 {
+		return expression.Expression{}, errors.New("the update has no changes")
+	}
+
+	var update expression.UpdateBuilder
+	for _, operation := range u.operations {
+		update = operation(update)
+	}
+
+	condition := u.condition
+	if version != nil {
+		update = update.Add(expression.Name(version.name), expression.Value(1))
+
+		if u.version != nil {
+			versionCondition := version.condition(*u.version)
+			if condition != nil {
+				versionCondition = condition.And(versionCondition)
+			}
+			condition = &versionCondition
+		}
+	}
+
+	builder := expression.NewBuilder().WithUpdate(update)
+	if condition != nil {
+		builder = builder.WithCondition(*condition)
+	}
+
+	return builder.Build()
+}
+
+// Update writing the fields of item named in the mask, zero values included. Fields that are left out
+// when item is marshalled, e.g. empty ones tagged omitempty, are removed. The mask uses the attribute
+// names as stored and can go into nested maps, e.g. "Channel.Title". The key can't be part of it.
+// Versioned items are only updated when they are still at the version of item.
+func (ddb *DynamoDB[T]) UpdateMask(item T, mask ...string) (*Update, error) {
+	if len(mask) == 0 {
+		return nil, errors.New("the mask is empty")
+	}
+
+	marshalled, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return nil, err
+	}
+
+	known := attributeNames(reflect.TypeOf((*T)(nil)).Elem())
+
+	update := NewUpdate()
+	for _, path := range mask {
+		segments := strings.Split(path, ".")
+
+		if !known[segments[0]] {
+			return nil, fmt.Errorf("%s is not an attribute of the item", segments[0])
+		}
+		if ddb.keys.isKey(segments[0]) {
+			return nil, fmt.Errorf("%s is part of the key and can't be updated", segments[0])
+		}
+		if ddb.version != nil && segments[0] == ddb.version.name {
+			return nil, fmt.Errorf("%s is the version, it is incremented by every update", segments[0])
+		}
+
+		if value, ok := lookupPath(marshalled, segments); ok {
+			update.Set(path, value)
+		} else {
+			update.Remove(path)
+		}
+	}
+
+	// Nobody else should have written the item since it was read
+	if ddb.version != nil {
+		update.IfVersion(ddb.version.get(&item))
+	}
+
+	return update, nil
+}
+
+// Names of the attributes the struct is marshalled to, embedded structs are flattened like attributevalue does
+func attributeNames(t reflect.Type) map[string]bool {
+	names := map[string]bool{}
+	if t.Kind() != reflect.Struct {
+		return names
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name := strings.Split(field.Tag.Get("dynamodbav"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for embedded := range attributeNames(field.Type) {
+				names[embedded] = true
+			}
+			continue
+		}
+
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		names[name] = true
+	}
+
+	return names
+}
+
+func lookupPath(item map[string]types.AttributeValue, segments []string) (types.AttributeValue, bool) {
+	value, ok := item[segments[0]]
+	if !ok {
+		return nil, false
+	}
+
+	if len(segments) == 1 {
+		return value, true
+	}
+
+	nested, ok := value.(*types.AttributeValueMemberM)
+	if !ok {
+		return nil, false
+	}
+
+	return lookupPath(nested.Value, segments[1:])
+}
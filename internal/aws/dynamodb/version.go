@@ -0,0 +1,184 @@
+package dynamodb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Struct tag marking the integer field holding the version of the items, e.g.
+//
+//	Version int64 `dynamodbav:"Version" dynamodbversion:"true"`
+//
+// Every write of a versioned item increments it, and PutItem and UpdateItem only write when the stored item
+// is still at the version it was read at.
+var VERSION_TAG = "dynamodbversion"
+
+// Returned when the item was written by someone else since it was read, read it again and retry, see Modify
+var ErrConflict = errors.New("the item was changed since it was read")
+
+// How many times Modify reads the item again after a conflict before giving up
+var CONFLICT_RETRIES = 3
+
+type versionField struct {
+	// Attribute name as stored
+	name  string
+	index []int
+}
+
+// The field of T tagged with VERSION_TAG, nil when T is not versioned
+func versionFieldOf[T any]() (*versionField, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+
+	var version *versionField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if tag, ok := field.Tag.Lookup(VERSION_TAG); !ok || tag != "true" {
+			continue
+		}
+
+		if version != nil {
+			return nil, fmt.Errorf("%s has more than one version field", t.Name())
+		}
+
+		if kind := field.Type.Kind(); kind < reflect.Int || kind > reflect.Int64 {
+			return nil, fmt.Errorf("%s.%s: the version must be an integer, not %s", t.Name(), field.Name, field.Type)
+		}
+
+		name := strings.Split(field.Tag.Get("dynamodbav"), ",")[0]
+		if name == "-" {
+			return nil, fmt.Errorf("%s.%s: the version can't be skipped by dynamodbav", t.Name(), field.Name)
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		version = &versionField{name: name, index: field.Index}
+	}
+
+	return version, nil
+}
+
+// Name of the attribute holding the version of the items, empty when they are not versioned
+func (ddb *DynamoDB[T]) VersionAttribute() string {
+	if ddb.version == nil {
+		return ""
+	}
+
+	return ddb.version.name
+}
+
+func (v *versionField) get(item interface{}) int64 {
+	return reflect.ValueOf(item).Elem().FieldByIndex(v.index).Int()
+}
+
+func (v *versionField) set(item interface{}, version int64) {
+	reflect.ValueOf(item).Elem().FieldByIndex(v.index).SetInt(version)
+}
+
+// The stored item is still at the version, items written before they were versioned have none
+func (v *versionField) condition(version int64) expression.ConditionBuilder {
+	condition := expression.Name(v.name).Equal(expression.Value(version))
+	if version == 0 {
+		condition = expression.Name(v.name).AttributeNotExists().Or(condition)
+	}
+
+	return condition
+}
+
+// Tells a conflict apart from a condition of the caller that doesn't hold from the item returned with the
+// failed condition. expected is nil when the write wasn't conditioned on the version.
+func (ddb *DynamoDB[T]) conditionError(err error, key Key, expected *int64) error {
+	var conditionFailed *types.ConditionalCheckFailedException
+	if !errors.As(err, &conditionFailed) {
+		return err
+	}
+
+	if ddb.version != nil && expected != nil {
+		stored, exists := storedVersion(conditionFailed.Item, ddb.version.name)
+
+		if conditionFailed.Item == nil && *expected != 0 {
+			return fmt.Errorf("%w: %v was deleted", ErrConflict, key)
+		}
+		if exists && stored != *expected {
+			return fmt.Errorf("%w: %v is at version %d, it was read at %d", ErrConflict, key, stored, *expected)
+		}
+	}
+
+	return fmt.Errorf("%w: %v", ErrConditionFailed, err)
+}
+
+func storedVersion(item map[string]types.AttributeValue, name string) (int64, bool) {
+	if item == nil {
+		return 0, false
+	}
+
+	number, ok := item[name].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, true
+	}
+
+	version, err := strconv.ParseInt(number.Value, 10, 64)
+	if err != nil {
+		return 0, true
+	}
+
+	return version, true
+}
+
+// Reads the item, lets mutate change it and writes it back. When someone else wrote it in the meantime
+// it is read again and given to mutate again, up to CONFLICT_RETRIES times. The item is empty when it
+// doesn't exist yet, mutate has to fill in its key then. Only for versioned items.
+func (ddb *DynamoDB[T]) Modify(key Key, mutate func(item *T) error) (T, error) {
+	if ddb.version == nil {
+		var empty T
+		return empty, fmt.Errorf("%T has no field tagged %s", empty, VERSION_TAG)
+	}
+
+	for attempt := 0; ; attempt++ {
+		item, err := ddb.FindByKey(key)
+		if err != nil {
+			return item, err
+		}
+
+		if err := mutate(&item); err != nil {
+			return item, err
+		}
+
+		saved, err := ddb.put(item)
+		if errors.Is(err, ErrConflict) && attempt < CONFLICT_RETRIES {
+			continue
+		}
+
+		return saved, err
+	}
+}
+
+// Writes the item over the stored one whatever version it was read at, e.g. when restoring a backup.
+// The item gets a version above the stored one so whoever read the stored item has to read it again.
+func (ddb *DynamoDB[T]) Replace(item T) (T, error) {
+	if ddb.version == nil {
+		return item, ddb.PutItem(item)
+	}
+
+	key, err := ddb.KeyOf(item)
+	if err != nil {
+		return item, err
+	}
+
+	return ddb.Modify(key, func(stored *T) error {
+		version := ddb.version.get(stored)
+		*stored = item
+		ddb.version.set(stored, version)
+		return nil
+	})
+}
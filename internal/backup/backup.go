@@ -0,0 +1,299 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/alerts"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+// Bumped whenever the layout of the archive changes, older archives can always be restored
+var VERSION = 1
+
+var (
+	ErrUnsupportedVersion = errors.New("backup was made by a newer version")
+	ErrChecksumMismatch   = errors.New("backup is corrupted, checksum mismatch")
+)
+
+const (
+	manifestFile   = "manifest.json"
+	videosFile     = "videos.jsonl"
+	alertRulesFile = "alert_rules.jsonl"
+	alertStateFile = "alert_state.jsonl"
+)
+
+// The DynamoDB tables an archive covers. The legacy storage JSON files are not in it, bring them
+// into the videos table first with import --format=legacy.
+var TABLES = []string{videos.TABLE, alerts.RULES_TABLE, alerts.STATE_TABLE}
+
+// Everything worth keeping, YouTube never gives back past view counts
+type Dataset struct {
+	Videos     []videos.VideoDdbAttributes
+	AlertRules []alerts.Rule
+	AlertState []alerts.AlertState
+}
+
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Encrypted bool      `json:"encrypted"`
+	// What the archive was read from, see TABLES. Empty for archives made before it was recorded.
+	Tables []string       `json:"tables"`
+	Files  []ManifestFile `json:"files"`
+}
+
+type ManifestFile struct {
+	Name   string `json:"name"`
+	Items  int    `json:"items"`
+	Sha256 string `json:"sha256"`
+}
+
+// Writes the dataset as a gzipped tar with a manifest holding the checksum of every file.
+// The whole archive is encrypted when a passphrase is given.
+func Write(w io.Writer, dataset Dataset, passphrase string) (Manifest, error) {
+	manifest := Manifest{Version: VERSION, CreatedAt: time.Now().UTC(), Encrypted: passphrase != "", Tables: TABLES}
+
+	files := map[string][]byte{}
+	for _, table := range []struct {
+		name   string
+		encode func() ([]byte, int, error)
+	}{
+		{videosFile, func() ([]byte, int, error) { return encodeLines(dataset.Videos) }},
+		{alertRulesFile, func() ([]byte, int, error) { return encodeLines(dataset.AlertRules) }},
+		{alertStateFile, func() ([]byte, int, error) { return encodeLines(dataset.AlertState) }},
+	} {
+		content, items, err := table.encode()
+		if err != nil {
+			return manifest, err
+		}
+
+		files[table.name] = content
+		manifest.Files = append(manifest.Files, ManifestFile{Name: table.name, Items: items, Sha256: checksum(content)})
+	}
+
+	manifestContent, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+
+	// The manifest goes first so it can be inspected without reading everything
+	entries := []struct {
+		name    string
+		content []byte
+	}{{manifestFile, manifestContent}}
+	for _, file := range manifest.Files {
+		entries = append(entries, struct {
+			name    string
+			content []byte
+		}{file.Name, files[file.Name]})
+	}
+
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content)), ModTime: manifest.CreatedAt}
+		if err := tw.WriteHeader(header); err != nil {
+			return manifest, err
+		}
+
+		if _, err := tw.Write(entry.content); err != nil {
+			return manifest, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return manifest, err
+	}
+
+	if err := gz.Close(); err != nil {
+		return manifest, err
+	}
+
+	content := archive.Bytes()
+	if passphrase != "" {
+		if content, err = encrypt(content, passphrase); err != nil {
+			return manifest, err
+		}
+	}
+
+	_, err = w.Write(content)
+
+	return manifest, err
+}
+
+// Reads and verifies an archive written by Write
+func Read(r io.Reader, passphrase string) (Dataset, Manifest, error) {
+	var dataset Dataset
+	var manifest Manifest
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return dataset, manifest, err
+	}
+
+	if isEncrypted(content) {
+		if content, err = decrypt(content, passphrase); err != nil {
+			return dataset, manifest, err
+		}
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return dataset, manifest, fmt.Errorf("not a backup archive, %w", err)
+	}
+
+	files := map[string][]byte{}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return dataset, manifest, err
+		}
+
+		if files[header.Name], err = io.ReadAll(tr); err != nil {
+			return dataset, manifest, err
+		}
+	}
+
+	if err := json.Unmarshal(files[manifestFile], &manifest); err != nil {
+		return dataset, manifest, fmt.Errorf("unable to read the manifest, %w", err)
+	}
+
+	if manifest.Version > VERSION {
+		return dataset, manifest, fmt.Errorf("%w (version %d, we support up to %d)", ErrUnsupportedVersion, manifest.Version, VERSION)
+	}
+
+	for _, file := range manifest.Files {
+		content, ok := files[file.Name]
+		if !ok || checksum(content) != file.Sha256 {
+			return dataset, manifest, fmt.Errorf("%w in %s", ErrChecksumMismatch, file.Name)
+		}
+
+		var items int
+		switch file.Name {
+		case videosFile:
+			dataset.Videos, err = decodeLines[videos.VideoDdbAttributes](content)
+			items = len(dataset.Videos)
+		case alertRulesFile:
+			dataset.AlertRules, err = decodeLines[alerts.Rule](content)
+			items = len(dataset.AlertRules)
+		case alertStateFile:
+			dataset.AlertState, err = decodeLines[alerts.AlertState](content)
+			items = len(dataset.AlertState)
+		default:
+			// Made by a newer version that kept the layout compatible
+			continue
+		}
+		if err != nil {
+			return dataset, manifest, fmt.Errorf("unable to read %s, %w", file.Name, err)
+		}
+
+		if items != file.Items {
+			return dataset, manifest, fmt.Errorf("%w in %s, expected %d items but found %d", ErrChecksumMismatch, file.Name, file.Items, items)
+		}
+	}
+
+	return dataset, manifest, nil
+}
+
+// The dataset as it was at the given time, later samples are dropped along with the videos added after it
+func (d Dataset) AsOf(at time.Time) Dataset {
+	cutoff := at.Unix()
+
+	result := Dataset{AlertRules: d.AlertRules}
+
+	for _, video := range d.Videos {
+		var logs []videos.VideoViewAttributes
+		for _, log := range video.ViewLogs {
+			if log.Timestamp <= cutoff {
+				logs = append(logs, log)
+			}
+		}
+
+		if len(logs) == 0 && video.Created > cutoff {
+			continue
+		}
+
+		video.ViewLogs = logs
+		if len(logs) > 0 && video.LastActivityAt > logs[len(logs)-1].Timestamp {
+			video.LastActivityAt = logs[len(logs)-1].Timestamp
+		}
+		if video.UnavailableAt > cutoff {
+			video.UnavailableAt = 0
+		}
+
+		// Let the schedule work out when it's due again
+		video.NextPollAt = 0
+
+		result.Videos = append(result.Videos, video)
+	}
+
+	for _, state := range d.AlertState {
+		if state.FiredAt <= cutoff {
+			result.AlertState = append(result.AlertState, state)
+		}
+	}
+
+	return result
+}
+
+// Number of view samples of every video
+func (d Dataset) Samples() int {
+	count := 0
+	for _, video := range d.Videos {
+		count += len(video.ViewLogs)
+	}
+
+	return count
+}
+
+func encodeLines[T any](items []T) ([]byte, int, error) {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+
+	for _, item := range items {
+		if err := encoder.Encode(item); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return b.Bytes(), len(items), nil
+}
+
+func decodeLines[T any](content []byte) ([]T, error) {
+	var items []T
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	// Videos with a long history make for long lines
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var item T
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, scanner.Err()
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,83 @@
+package backup_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/alerts"
+	"github.com/ricomonster/black-flag/internal/backup"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+var dataset = backup.Dataset{
+	Videos: []videos.VideoDdbAttributes{
+		{
+			Id:             "old",
+			Title:          "Old video",
+			Created:        100,
+			LastActivityAt: 300,
+			ViewLogs: []videos.VideoViewAttributes{
+				{Views: 10, Timestamp: 100},
+				{Views: 20, Timestamp: 200},
+				{Views: 30, Timestamp: 300},
+			},
+		},
+		{
+			Id:       "new",
+			Created:  250,
+			ViewLogs: []videos.VideoViewAttributes{{Views: 1, Timestamp: 250}},
+		},
+	},
+	AlertRules: []alerts.Rule{{Id: "million", Type: alerts.RULE_MILESTONE, Threshold: 1e6}},
+	AlertState: []alerts.AlertState{{Id: "million#old", FiredAt: 280}},
+}
+
+func TestRoundTrip(t *testing.T) {
+	// Keep the key derivation cheap in tests
+	backup.SCRYPT_N = 1 << 10
+
+	for _, passphrase := range []string{"", "secret"} {
+		var b bytes.Buffer
+		if _, err := backup.Write(&b, dataset, passphrase); err != nil {
+			t.Fatalf("TestRoundTrip: unable to write, %v", err)
+		}
+
+		restored, manifest, err := backup.Read(bytes.NewReader(b.Bytes()), passphrase)
+		if err != nil {
+			t.Fatalf("TestRoundTrip: unable to read, %v", err)
+		}
+
+		if manifest.Encrypted != (passphrase != "") || len(manifest.Tables) != len(backup.TABLES) || restored.Samples() != 4 || len(restored.AlertRules) != 1 || len(restored.AlertState) != 1 {
+			t.Errorf("TestRoundTrip: unexpected backup %+v %+v", manifest, restored)
+		}
+
+		if passphrase != "" {
+			if _, _, err := backup.Read(bytes.NewReader(b.Bytes()), ""); !errors.Is(err, backup.ErrPassphraseRequired) {
+				t.Errorf("TestRoundTrip: expected a passphrase to be required, got %v", err)
+			}
+
+			if _, _, err := backup.Read(bytes.NewReader(b.Bytes()), "wrong"); !errors.Is(err, backup.ErrWrongPassphrase) {
+				t.Errorf("TestRoundTrip: expected the wrong passphrase to fail, got %v", err)
+			}
+		}
+	}
+}
+
+func TestAsOf(t *testing.T) {
+	restored := dataset.AsOf(time.Unix(220, 0))
+
+	if len(restored.Videos) != 1 || restored.Videos[0].Id != "old" {
+		t.Fatalf("TestAsOf: expected only the old video, got %+v", restored.Videos)
+	}
+
+	video := restored.Videos[0]
+	if len(video.ViewLogs) != 2 || video.LastActivityAt != 200 {
+		t.Errorf("TestAsOf: expected 2 samples up to 200, got %+v", video)
+	}
+
+	if len(restored.AlertState) != 0 {
+		t.Errorf("TestAsOf: expected the alert fired later to be dropped, got %+v", restored.AlertState)
+	}
+}
@@ -0,0 +1,97 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	ErrPassphraseRequired = errors.New("backup is encrypted, a passphrase is required")
+	ErrWrongPassphrase    = errors.New("unable to decrypt the backup, wrong passphrase")
+)
+
+// Encrypted archives start with this so we know to ask for the passphrase
+var encryptedMagic = []byte("BLACKFLAG-ENC1")
+
+// Cost of deriving the key, recommended interactive parameters for scrypt
+var (
+	SCRYPT_N = 1 << 15
+	SCRYPT_R = 8
+	SCRYPT_P = 1
+)
+
+const saltSize = 16
+
+func isEncrypted(content []byte) bool {
+	return bytes.HasPrefix(content, encryptedMagic)
+}
+
+// Layout: magic, salt, nonce, then the AES-256-GCM sealed archive
+func encrypt(plain []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := append(append(append([]byte{}, encryptedMagic...), salt...), nonce...)
+
+	return gcm.Seal(out, nonce, plain, encryptedMagic), nil
+}
+
+func decrypt(content []byte, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+
+	content = content[len(encryptedMagic):]
+	if len(content) < saltSize {
+		return nil, ErrWrongPassphrase
+	}
+	salt, content := content[:saltSize], content[saltSize:]
+
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) < gcm.NonceSize() {
+		return nil, ErrWrongPassphrase
+	}
+	nonce, sealed := content[:gcm.NonceSize()], content[gcm.NonceSize():]
+
+	plain, err := gcm.Open(nil, nonce, sealed, encryptedMagic)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	return plain, nil
+}
+
+func newGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, SCRYPT_N, SCRYPT_R, SCRYPT_P, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,146 @@
+package chart
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/series"
+)
+
+var (
+	DEFAULT_WIDTH  = 60
+	DEFAULT_HEIGHT = 15
+)
+
+type Line struct {
+	Name   string
+	Marker rune
+	Points series.Series
+}
+
+type Options struct {
+	Width  int
+	Height int
+	Title  string
+	// Formats the x axis, dates by default
+	Label func(timestamp int64) string
+}
+
+// Draws the lines in the terminal, lines drawn later are drawn on top
+func Render(w io.Writer, lines []Line, options Options) error {
+	if options.Width <= 1 {
+		options.Width = DEFAULT_WIDTH
+	}
+
+	if options.Height <= 1 {
+		options.Height = DEFAULT_HEIGHT
+	}
+
+	minTs, maxTs, minValue, maxValue, ok := bounds(lines)
+	if !ok {
+		_, err := fmt.Fprintln(w, "Nothing to chart yet.")
+		return err
+	}
+
+	grid := make([][]rune, options.Height)
+	for i := range grid {
+		grid[i] = []rune(strings.Repeat(" ", options.Width))
+	}
+
+	for _, line := range lines {
+		for col := 0; col < options.Width; col++ {
+			timestamp := minTs + (maxTs-minTs)*int64(col)/int64(options.Width-1)
+
+			value, ok := line.Points.At(timestamp)
+			if !ok {
+				continue
+			}
+
+			row := int(math.Round((value - minValue) / (maxValue - minValue) * float64(options.Height-1)))
+			grid[options.Height-1-row][col] = line.Marker
+		}
+	}
+
+	// Labels on the top, middle and bottom rows
+	labels := make([]string, options.Height)
+	labels[0] = formatValue(maxValue)
+	labels[options.Height/2] = formatValue((maxValue + minValue) / 2)
+	labels[options.Height-1] = formatValue(minValue)
+
+	labelWidth := 0
+	for _, label := range labels {
+		labelWidth = max(labelWidth, len(label))
+	}
+
+	var b strings.Builder
+	if options.Title != "" {
+		fmt.Fprintf(&b, "%s\n", options.Title)
+	}
+
+	for i, row := range grid {
+		fmt.Fprintf(&b, "%*s ┤%s\n", labelWidth, labels[i], string(row))
+	}
+
+	fmt.Fprintf(&b, "%*s └%s\n", labelWidth, "", strings.Repeat("─", options.Width))
+
+	label := options.Label
+	if label == nil {
+		label = formatDate
+	}
+
+	start, end := label(minTs), label(maxTs)
+	fmt.Fprintf(&b, "%*s  %s%*s\n", labelWidth, "", start, options.Width-len(start), end)
+
+	var legend []string
+	for _, line := range lines {
+		legend = append(legend, fmt.Sprintf("%c %s", line.Marker, line.Name))
+	}
+	fmt.Fprintf(&b, "%*s  %s\n", labelWidth, "", strings.Join(legend, "   "))
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+func bounds(lines []Line) (int64, int64, float64, float64, bool) {
+	var minTs, maxTs int64 = math.MaxInt64, math.MinInt64
+	minValue, maxValue := math.Inf(1), math.Inf(-1)
+
+	for _, line := range lines {
+		for _, point := range line.Points {
+			minTs, maxTs = min(minTs, point.Timestamp), max(maxTs, point.Timestamp)
+			minValue, maxValue = math.Min(minValue, point.Value), math.Max(maxValue, point.Value)
+		}
+	}
+
+	if minTs >= maxTs {
+		return 0, 0, 0, 0, false
+	}
+
+	// A flat line still needs some room
+	if minValue == maxValue {
+		minValue, maxValue = minValue-1, maxValue+1
+	}
+
+	return minTs, maxTs, minValue, maxValue, true
+}
+
+func formatDate(timestamp int64) string {
+	return time.Unix(timestamp, 0).Local().Format(time.DateOnly)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.Abs(value) >= 1e9:
+		return fmt.Sprintf("%.2fB", value/1e9)
+	case math.Abs(value) >= 1e6:
+		return fmt.Sprintf("%.2fM", value/1e6)
+	case math.Abs(value) >= 1e3:
+		return fmt.Sprintf("%.1fK", value/1e3)
+	default:
+		return fmt.Sprintf("%.0f", value)
+	}
+}
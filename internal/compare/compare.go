@@ -0,0 +1,138 @@
+package compare
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/series"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+type Alignment string
+
+var (
+	// Every video starts the moment it was published
+	ALIGN_PUBLISH Alignment = "publish"
+	// Every video starts at the same moment, when the latest of them was published
+	ALIGN_WALLCLOCK Alignment = "wallclock"
+)
+
+var ALIGNMENTS = []Alignment{ALIGN_PUBLISH, ALIGN_WALLCLOCK}
+
+var DEFAULT_CHECKPOINTS = []time.Duration{
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+	30 * 24 * time.Hour,
+}
+
+type Checkpoint struct {
+	After time.Duration
+	Views float64
+	// Views gained since the previous checkpoint, only known when both are
+	Gain    float64
+	HasGain bool
+	// False when we have no samples around the checkpoint
+	Known bool
+}
+
+type Entry struct {
+	Video videos.VideoDdbAttributes
+	// When the video's clock starts
+	Start int64
+	// Views keyed by the seconds since the start
+	Views       series.Series
+	Checkpoints []Checkpoint
+}
+
+// Aligns the view logs of the videos and reads them at the same checkpoints
+func Compare(items []videos.VideoDdbAttributes, align Alignment, checkpoints []time.Duration) []Entry {
+	// Wall clock comparisons start when every video exists
+	var common int64
+	for _, item := range items {
+		common = max(common, startOf(item))
+	}
+
+	entries := make([]Entry, 0, len(items))
+	for _, item := range items {
+		start := startOf(item)
+		if align == ALIGN_WALLCLOCK {
+			start = common
+		}
+
+		views := series.Views(item.ViewLogs)
+		aligned := make(series.Series, 0, len(views))
+		for _, point := range views {
+			aligned = append(aligned, series.Point{Timestamp: point.Timestamp - start, Value: point.Value})
+		}
+
+		entries = append(entries, Entry{
+			Video:       item,
+			Start:       start,
+			Views:       aligned,
+			Checkpoints: readCheckpoints(aligned, checkpoints),
+		})
+	}
+
+	return entries
+}
+
+func readCheckpoints(views series.Series, checkpoints []time.Duration) []Checkpoint {
+	result := make([]Checkpoint, 0, len(checkpoints))
+
+	for i, after := range checkpoints {
+		checkpoint := Checkpoint{After: after}
+		checkpoint.Views, checkpoint.Known = views.At(int64(after.Seconds()))
+
+		if i > 0 && checkpoint.Known && result[i-1].Known {
+			checkpoint.Gain = checkpoint.Views - result[i-1].Views
+			checkpoint.HasGain = true
+		}
+
+		result = append(result, checkpoint)
+	}
+
+	return result
+}
+
+// When the video was published, the first sample when we don't know
+func startOf(video videos.VideoDdbAttributes) int64 {
+	if video.PublishedAt > 0 {
+		return video.PublishedAt
+	}
+
+	if len(video.ViewLogs) > 0 {
+		return series.Views(video.ViewLogs)[0].Timestamp
+	}
+
+	return video.Created
+}
+
+// Same as time.ParseDuration but also accepts days, e.g. 7d
+func ParseDuration(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		count, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+
+		return time.Duration(count * float64(24*time.Hour)), nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+// Short label of a checkpoint, e.g. 6h or 7d
+func FormatDuration(duration time.Duration) string {
+	switch {
+	case duration >= 48*time.Hour && duration%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", duration/(24*time.Hour))
+	case duration%time.Hour == 0:
+		return fmt.Sprintf("%dh", duration/time.Hour)
+	default:
+		return duration.String()
+	}
+}
@@ -0,0 +1,80 @@
+package compare_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/compare"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+func TestCompare(t *testing.T) {
+	hour := int64(3600)
+
+	a := videos.VideoDdbAttributes{
+		Id:          "a",
+		PublishedAt: 1000 * hour,
+		ViewLogs: []videos.VideoViewAttributes{
+			{Views: 100, Timestamp: 1001 * hour},
+			{Views: 1100, Timestamp: 1011 * hour},
+		},
+	}
+	b := videos.VideoDdbAttributes{
+		Id:          "b",
+		PublishedAt: 2000 * hour,
+		ViewLogs: []videos.VideoViewAttributes{
+			{Views: 50, Timestamp: 2001 * hour},
+			{Views: 550, Timestamp: 2006 * hour},
+		},
+	}
+
+	checkpoints := []time.Duration{time.Hour, 6 * time.Hour, 10 * time.Hour}
+
+	entries := compare.Compare([]videos.VideoDdbAttributes{a, b}, compare.ALIGN_PUBLISH, checkpoints)
+
+	// a is interpolated between its two samples, b is only known up to 6h
+	want := [][]float64{{100, 600, 1000}, {50, 550, -1}}
+	for i, entry := range entries {
+		for j, checkpoint := range entry.Checkpoints {
+			if want[i][j] < 0 {
+				if checkpoint.Known {
+					t.Errorf("TestCompare: expected %s at %s to be unknown", entry.Video.Id, checkpoint.After)
+				}
+				continue
+			}
+
+			if !checkpoint.Known || checkpoint.Views != want[i][j] {
+				t.Errorf("TestCompare: expected %s at %s to have %.0f views, got %.0f", entry.Video.Id, checkpoint.After, want[i][j], checkpoint.Views)
+			}
+		}
+	}
+
+	if gain := entries[0].Checkpoints[1]; !gain.HasGain || gain.Gain != 500 {
+		t.Errorf("TestCompare: expected a gain of 500 between 1h and 6h, got %.0f", gain.Gain)
+	}
+
+	// By date both start when b was published, a has no samples by then
+	entries = compare.Compare([]videos.VideoDdbAttributes{a, b}, compare.ALIGN_WALLCLOCK, checkpoints)
+	if entries[0].Checkpoints[0].Known {
+		t.Errorf("TestCompare: expected a to be unknown when aligned by date")
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"1h":  time.Hour,
+		"90m": 90 * time.Minute,
+		"7d":  7 * 24 * time.Hour,
+	}
+
+	for value, want := range tests {
+		got, err := compare.ParseDuration(value)
+		if err != nil || got != want {
+			t.Errorf("TestParseDuration: expected %s to be %s, got %s (%v)", value, want, got, err)
+		}
+
+		if label := compare.FormatDuration(got); label != value && value != "90m" {
+			t.Errorf("TestParseDuration: expected %s to be formatted back, got %s", value, label)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+)
+
+// Settings that doesn't fit in the env, e.g. alert rules and notifiers.
+// This is a separate instance since the storage lib uses the global viper for its own files.
+var file = viper.New()
+
+// Loads the config file, when no file is given we look for $HOME/.black-flag.yaml.
+// Not having a config file at all is fine.
+func LoadConfigFile(path string) error {
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+
+		path = filepath.Join(home, ".black-flag.yaml")
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+	}
+
+	file.SetConfigFile(path)
+
+	return file.ReadInConfig()
+}
+
+// Decodes a section of the config file into the target
+func UnmarshalKey(key string, target any) error {
+	return file.UnmarshalKey(key, target)
+}
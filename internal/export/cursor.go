@@ -0,0 +1,108 @@
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+// Remembers the last exported sample of every video so the next export only emits newer ones
+type Cursor struct {
+	Videos map[string]int64 `json:"videos"`
+	// How many samples every video had up to its last exported one, more of them means some were added
+	// later on with an older timestamp, e.g. by an import or a restore
+	Samples   map[string]int `json:"samples,omitempty"`
+	UpdatedAt time.Time      `json:"updated_at"`
+
+	path string
+}
+
+// Loads the cursor from the file, a missing file is an empty cursor.
+// An empty path gives a cursor that lets everything through and is never saved.
+func LoadCursor(path string) (*Cursor, error) {
+	cursor := &Cursor{Videos: map[string]int64{}, Samples: map[string]int{}, path: path}
+	if path == "" {
+		return cursor, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cursor, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, cursor); err != nil {
+		return nil, err
+	}
+
+	if cursor.Videos == nil {
+		cursor.Videos = map[string]int64{}
+	}
+	if cursor.Samples == nil {
+		cursor.Samples = map[string]int{}
+	}
+
+	return cursor, nil
+}
+
+func (c *Cursor) IsNew(video string, timestamp int64) bool {
+	return timestamp > c.Videos[video]
+}
+
+func (c *Cursor) Advance(video string, timestamp int64) {
+	if timestamp > c.Videos[video] {
+		c.Videos[video] = timestamp
+	}
+}
+
+// Tells if samples older than the last exported one were added since the last export.
+// Cursors saved before the samples were counted never see a backfill.
+func (c *Cursor) Backfilled(video string, logs []videos.VideoViewAttributes) bool {
+	counted, ok := c.Samples[video]
+	return ok && samplesUntil(logs, c.Videos[video]) > counted
+}
+
+// Counts the samples up to the last exported one so a later backfill can be told apart
+func (c *Cursor) Count(video string, logs []videos.VideoViewAttributes) {
+	if _, ok := c.Videos[video]; ok {
+		c.Samples[video] = samplesUntil(logs, c.Videos[video])
+	}
+}
+
+func samplesUntil(logs []videos.VideoViewAttributes, timestamp int64) int {
+	count := 0
+	for _, log := range logs {
+		if log.Timestamp <= timestamp {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Writes the cursor next to the file first so a crash never leaves half a cursor behind
+func (c *Cursor) Save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	c.UpdatedAt = time.Now().UTC()
+
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, c.path)
+}
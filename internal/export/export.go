@@ -0,0 +1,243 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+type Format string
+
+var (
+	FORMAT_CSV     Format = "csv"
+	FORMAT_JSONL   Format = "jsonl"
+	FORMAT_PARQUET Format = "parquet"
+)
+
+var FORMATS = []Format{FORMAT_CSV, FORMAT_JSONL, FORMAT_PARQUET}
+
+// Rows are written to parquet in groups of this size
+var PARQUET_BATCH = 1000
+
+// A single sample of a video
+type Row struct {
+	VideoId   string    `json:"video_id" parquet:"video_id"`
+	Title     string    `json:"title" parquet:"title"`
+	ChannelId string    `json:"channel_id" parquet:"channel_id"`
+	Channel   string    `json:"channel" parquet:"channel"`
+	Timestamp int64     `json:"timestamp" parquet:"timestamp"`
+	SampledAt time.Time `json:"sampled_at" parquet:"sampled_at,timestamp(millisecond)"`
+	Views     int64     `json:"views" parquet:"views"`
+	Likes     int64     `json:"likes" parquet:"likes"`
+	Comments  int64     `json:"comments" parquet:"comments"`
+}
+
+var csvHeader = []string{"video_id", "title", "channel_id", "channel", "timestamp", "sampled_at", "views", "likes", "comments"}
+
+type Filter struct {
+	Videos   []string
+	Channels []string
+	// Zero means unbounded
+	Since time.Time
+	Until time.Time
+}
+
+type Writer interface {
+	Write(row Row) error
+	// Flushes whatever is buffered, the rows are only complete after this
+	Close() error
+}
+
+func ValidateFormat(format Format) error {
+	for _, known := range FORMATS {
+		if format == known {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown format %q, expected one of %v", format, FORMATS)
+}
+
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	switch format {
+	case FORMAT_CSV:
+		return newCSVWriter(w), nil
+	case FORMAT_JSONL:
+		return &jsonlWriter{encoder: json.NewEncoder(w)}, nil
+	case FORMAT_PARQUET:
+		return &parquetWriter{writer: parquet.NewGenericWriter[Row](w)}, nil
+	}
+
+	return nil, ValidateFormat(format)
+}
+
+// Writes a row for every sample that passes the filter and that the cursor hasn't seen yet.
+// The cursor moves forward as rows are written, it's up to the caller to save it.
+// Videos that got samples older than the cursor, e.g. from an import, are written again from the start
+// so the readers have to expect the same sample twice.
+func Export(items []videos.VideoDdbAttributes, filter Filter, cursor *Cursor, writer Writer) (int, error) {
+	count := 0
+
+	for _, item := range items {
+		if !filter.matches(item) {
+			continue
+		}
+
+		backfilled := cursor.Backfilled(item.Id, item.ViewLogs)
+		for _, log := range item.ViewLogs {
+			if !filter.inRange(log.Timestamp) || !backfilled && !cursor.IsNew(item.Id, log.Timestamp) {
+				continue
+			}
+
+			err := writer.Write(Row{
+				VideoId:   item.Id,
+				Title:     item.Title,
+				ChannelId: item.Channel.Id,
+				Channel:   item.Channel.Title,
+				Timestamp: log.Timestamp,
+				SampledAt: time.Unix(log.Timestamp, 0).UTC(),
+				Views:     int64(log.Views),
+				Likes:     int64(log.Likes),
+				Comments:  int64(log.Comments),
+			})
+			if err != nil {
+				return count, err
+			}
+
+			cursor.Advance(item.Id, log.Timestamp)
+			count++
+		}
+
+		cursor.Count(item.Id, item.ViewLogs)
+	}
+
+	return count, nil
+}
+
+func (f Filter) matches(video videos.VideoDdbAttributes) bool {
+	if len(f.Videos) > 0 && !contains(f.Videos, video.Id) {
+		return false
+	}
+
+	if len(f.Channels) > 0 && !contains(f.Channels, video.Channel.Id) && !contains(f.Channels, video.Channel.Title) {
+		return false
+	}
+
+	return true
+}
+
+func (f Filter) inRange(timestamp int64) bool {
+	if !f.Since.IsZero() && timestamp < f.Since.Unix() {
+		return false
+	}
+
+	if !f.Until.IsZero() && timestamp > f.Until.Unix() {
+		return false
+	}
+
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+type csvWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{writer: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(row Row) error {
+	// The header is written even if there are no rows, see Close
+	if !c.headerWritten {
+		if err := c.writer.Write(csvHeader); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+
+	return c.writer.Write([]string{
+		row.VideoId,
+		row.Title,
+		row.ChannelId,
+		row.Channel,
+		strconv.FormatInt(row.Timestamp, 10),
+		row.SampledAt.Format(time.RFC3339),
+		strconv.FormatInt(row.Views, 10),
+		strconv.FormatInt(row.Likes, 10),
+		strconv.FormatInt(row.Comments, 10),
+	})
+}
+
+func (c *csvWriter) Close() error {
+	if !c.headerWritten {
+		if err := c.writer.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+
+	c.writer.Flush()
+
+	return c.writer.Error()
+}
+
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func (j *jsonlWriter) Write(row Row) error {
+	return j.encoder.Encode(row)
+}
+
+func (j *jsonlWriter) Close() error {
+	return nil
+}
+
+type parquetWriter struct {
+	writer *parquet.GenericWriter[Row]
+	batch  []Row
+}
+
+func (p *parquetWriter) Write(row Row) error {
+	p.batch = append(p.batch, row)
+	if len(p.batch) < PARQUET_BATCH {
+		return nil
+	}
+
+	return p.flush()
+}
+
+func (p *parquetWriter) flush() error {
+	if len(p.batch) == 0 {
+		return nil
+	}
+
+	_, err := p.writer.Write(p.batch)
+	p.batch = p.batch[:0]
+
+	return err
+}
+
+func (p *parquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+
+	return p.writer.Close()
+}
@@ -0,0 +1,108 @@
+package export_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/ricomonster/black-flag/internal/export"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+var items = []videos.VideoDdbAttributes{
+	{
+		Id:      "a",
+		Title:   "Video A",
+		Channel: videos.VideoChannelAttributes{Id: "UC_a", Title: "Channel A"},
+		ViewLogs: []videos.VideoViewAttributes{
+			{Views: 10, Likes: 1, Timestamp: 1000},
+			{Views: 20, Likes: 2, Timestamp: 2000},
+		},
+	},
+	{
+		Id:      "b",
+		Title:   "Video B",
+		Channel: videos.VideoChannelAttributes{Id: "UC_b", Title: "Channel B"},
+		ViewLogs: []videos.VideoViewAttributes{
+			{Views: 5, Timestamp: 1500},
+		},
+	},
+}
+
+func TestExportIncremental(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cursor.json")
+
+	run := func(items []videos.VideoDdbAttributes) string {
+		cursor, err := export.LoadCursor(path)
+		if err != nil {
+			t.Fatalf("TestExportIncremental: unable to load the cursor, %v", err)
+		}
+
+		var b bytes.Buffer
+		writer, _ := export.NewWriter(export.FORMAT_CSV, &b)
+		if _, err := export.Export(items, export.Filter{}, cursor, writer); err != nil {
+			t.Fatalf("TestExportIncremental: unexpected error %v", err)
+		}
+		writer.Close()
+
+		if err := cursor.Save(); err != nil {
+			t.Fatalf("TestExportIncremental: unable to save the cursor, %v", err)
+		}
+
+		return b.String()
+	}
+
+	first := run(items)
+	if lines := strings.Count(first, "\n"); lines != 4 {
+		t.Errorf("TestExportIncremental: expected a header and 3 rows, got %d lines\n%s", lines, first)
+	}
+
+	// A new sample for a, only that one should come out
+	updated := append([]videos.VideoDdbAttributes{}, items...)
+	updated[0].ViewLogs = append(append([]videos.VideoViewAttributes{}, items[0].ViewLogs...), videos.VideoViewAttributes{Views: 30, Timestamp: 3000})
+
+	second := run(updated)
+	if lines := strings.Split(strings.TrimSpace(second), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[1], "a,Video A,UC_a,Channel A,3000,") {
+		t.Errorf("TestExportIncremental: expected only the new sample, got\n%s", second)
+	}
+
+	// An import brought an older sample for b, b is written again with it
+	updated[1].ViewLogs = []videos.VideoViewAttributes{{Views: 1, Timestamp: 1200}, {Views: 5, Timestamp: 1500}}
+
+	third := run(updated)
+	if lines := strings.Split(strings.TrimSpace(third), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[1], "b,Video B,UC_b,Channel B,1200,") {
+		t.Errorf("TestExportIncremental: expected b to be written again, got\n%s", third)
+	}
+
+	if fourth := run(updated); strings.Count(fourth, "\n") != 1 {
+		t.Errorf("TestExportIncremental: expected nothing new, got\n%s", fourth)
+	}
+}
+
+func TestExportFilterAndParquet(t *testing.T) {
+	filter := export.Filter{Channels: []string{"Channel A"}, Since: time.Unix(1500, 0)}
+
+	cursor, _ := export.LoadCursor("")
+
+	var b bytes.Buffer
+	writer, _ := export.NewWriter(export.FORMAT_PARQUET, &b)
+	count, err := export.Export(items, filter, cursor, writer)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil || count != 1 {
+		t.Fatalf("TestExportFilterAndParquet: expected a single row, got %d (%v)", count, err)
+	}
+
+	rows, err := parquet.Read[export.Row](bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatalf("TestExportFilterAndParquet: unable to read the parquet file, %v", err)
+	}
+
+	if len(rows) != 1 || rows[0].VideoId != "a" || rows[0].Views != 20 || rows[0].Timestamp != 2000 {
+		t.Errorf("TestExportFilterAndParquet: unexpected rows %+v", rows)
+	}
+}
@@ -0,0 +1,182 @@
+package forecast
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/series"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+var (
+	// Samples needed to fit and backtest the models
+	MIN_SAMPLES = 6
+	// Share of the samples held out to backtest the models
+	HOLDOUT_RATIO = 0.25
+	// How far ahead we look for a target before giving up
+	MAX_HORIZON = 5 * 365 * 24 * time.Hour
+	// Resolution of the projected dates
+	SEARCH_STEP = time.Hour
+	// Width of the confidence interval in backtest errors, about 95%
+	CONFIDENCE_Z = 1.96
+)
+
+var ErrNotEnoughSamples = errors.New("not enough samples to forecast the views")
+
+var models = []fitFunc{fitLinear, fitLogDecay, fitSmoothing}
+
+type Forecast struct {
+	Model Model
+	// Root mean squared error of every model on the held out samples
+	Backtests map[string]float64
+	// Error of the chosen model and how far ahead it had to predict in the backtest
+	Error           float64
+	backtestHorizon int64
+	last            series.Point
+}
+
+// When the target is expected to be reached, Earliest and Latest are the bounds of the
+// confidence interval and are zero when they fall beyond the horizon.
+type Projection struct {
+	At       time.Time
+	Earliest time.Time
+	Latest   time.Time
+}
+
+// Fits every model to the view logs of the video and picks the one that predicted the held out samples best
+func Fit(video videos.VideoDdbAttributes) (Forecast, error) {
+	views := series.Views(video.ViewLogs)
+	if len(views) < MIN_SAMPLES {
+		return Forecast{}, ErrNotEnoughSamples
+	}
+
+	origin := originOf(video, views)
+
+	holdout := int(math.Ceil(float64(len(views)) * HOLDOUT_RATIO))
+	if holdout < 2 {
+		holdout = 2
+	}
+	train, test := views[:len(views)-holdout], views[len(views)-holdout:]
+
+	forecast := Forecast{Backtests: map[string]float64{}, Error: math.Inf(1)}
+
+	var best fitFunc
+	for _, fit := range models {
+		model, err := fit(train, origin)
+		if err != nil {
+			continue
+		}
+
+		rmse := backtest(model, test)
+		forecast.Backtests[model.Name()] = rmse
+
+		if rmse < forecast.Error {
+			best, forecast.Error = fit, rmse
+		}
+	}
+
+	if best == nil {
+		return Forecast{}, ErrNotEnoughSamples
+	}
+
+	// Refit the winner with everything we have
+	model, err := best(views, origin)
+	if err != nil {
+		return Forecast{}, err
+	}
+
+	forecast.Model = model
+	forecast.last, _ = views.Last()
+	forecast.backtestHorizon = test[len(test)-1].Timestamp - train[len(train)-1].Timestamp
+
+	return forecast, nil
+}
+
+// Projected views at the given time with the bounds of the confidence interval.
+// Views never go down so nothing is projected below the latest sample.
+func (f Forecast) ViewsAt(at time.Time) (float64, float64, float64) {
+	timestamp := at.Unix()
+	predicted := math.Max(f.Model.Predict(timestamp), f.last.Value)
+
+	band := f.band(timestamp)
+
+	return predicted, math.Max(predicted-band, f.last.Value), predicted + band
+}
+
+// Searches for when the views reach the target, false when it is beyond the horizon
+func (f Forecast) ReachAt(target float64) (Projection, bool) {
+	var projection Projection
+
+	step := int64(SEARCH_STEP.Seconds())
+	end := f.last.Timestamp + int64(MAX_HORIZON.Seconds())
+	for timestamp := f.last.Timestamp; timestamp <= end; timestamp += step {
+		predicted, low, high := f.ViewsAt(time.Unix(timestamp, 0))
+
+		if projection.Earliest.IsZero() && high >= target {
+			projection.Earliest = time.Unix(timestamp, 0)
+		}
+
+		if projection.At.IsZero() && predicted >= target {
+			projection.At = time.Unix(timestamp, 0)
+		}
+
+		if low >= target {
+			projection.Latest = time.Unix(timestamp, 0)
+			break
+		}
+	}
+
+	return projection, !projection.At.IsZero()
+}
+
+// The model's curve sampled at a fixed step, used to draw it next to the recorded views
+func (f Forecast) Curve(from, to time.Time, points int) series.Series {
+	if points < 2 || !to.After(from) {
+		return series.Series{}
+	}
+
+	step := to.Sub(from) / time.Duration(points-1)
+
+	curve := make(series.Series, 0, points)
+	for i := 0; i < points; i++ {
+		timestamp := from.Add(step * time.Duration(i)).Unix()
+		curve = append(curve, series.Point{Timestamp: timestamp, Value: f.Model.Predict(timestamp)})
+	}
+
+	return curve
+}
+
+// The error grows the further ahead we predict compared to the backtest
+func (f Forecast) band(timestamp int64) float64 {
+	ahead := timestamp - f.last.Timestamp
+	if ahead <= 0 {
+		return 0
+	}
+
+	scale := 1.0
+	if f.backtestHorizon > 0 && ahead > f.backtestHorizon {
+		scale = float64(ahead) / float64(f.backtestHorizon)
+	}
+
+	return CONFIDENCE_Z * f.Error * scale
+}
+
+func backtest(model Model, test series.Series) float64 {
+	var sse float64
+	for _, point := range test {
+		diff := model.Predict(point.Timestamp) - point.Value
+		sse += diff * diff
+	}
+
+	return math.Sqrt(sse / float64(len(test)))
+}
+
+// When the video was published, an hour before the first sample if we don't know
+func originOf(video videos.VideoDdbAttributes, views series.Series) int64 {
+	if video.PublishedAt > 0 && video.PublishedAt < views[0].Timestamp {
+		return video.PublishedAt
+	}
+
+	return views[0].Timestamp - 3600
+}
@@ -0,0 +1,66 @@
+package forecast_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/forecast"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+func TestFitLinear(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// 100 views every hour
+	var logs []videos.VideoViewAttributes
+	for i := 0; i < 24; i++ {
+		logs = append(logs, videos.VideoViewAttributes{Views: 1000 + i*100, Timestamp: start.Add(time.Duration(i) * time.Hour).Unix()})
+	}
+
+	fitted, err := forecast.Fit(videos.VideoDdbAttributes{Id: "video", ViewLogs: logs})
+	if err != nil {
+		t.Fatalf("TestFitLinear: unexpected error %v", err)
+	}
+
+	// 3300 views at the last sample, 5000 is 17 hours later
+	projection, ok := fitted.ReachAt(5000)
+	want := start.Add(40 * time.Hour)
+	if !ok || projection.At.Sub(want).Abs() > time.Hour {
+		t.Errorf("TestFitLinear: expected to reach 5000 views around %s, got %s", want, projection.At)
+	}
+
+	views, low, high := fitted.ViewsAt(start.Add(40 * time.Hour))
+	if math.Abs(views-5000) > 100 || low > views || high < views {
+		t.Errorf("TestFitLinear: expected about 5000 views, got %.0f (%.0f - %.0f)", views, low, high)
+	}
+}
+
+func TestFitLogDecay(t *testing.T) {
+	published := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Slows down as the video gets older
+	var logs []videos.VideoViewAttributes
+	for hours := 1; hours <= 48; hours += 2 {
+		logs = append(logs, videos.VideoViewAttributes{
+			Views:     int(10000 * math.Log(float64(hours))),
+			Timestamp: published.Add(time.Duration(hours) * time.Hour).Unix(),
+		})
+	}
+
+	fitted, err := forecast.Fit(videos.VideoDdbAttributes{Id: "video", PublishedAt: published.Unix(), ViewLogs: logs})
+	if err != nil {
+		t.Fatalf("TestFitLogDecay: unexpected error %v", err)
+	}
+
+	if fitted.Model.Name() != "log-decay" {
+		t.Errorf("TestFitLogDecay: expected the log-decay model, got %s with backtests %v", fitted.Model.Name(), fitted.Backtests)
+	}
+}
+
+func TestFitNotEnoughSamples(t *testing.T) {
+	_, err := forecast.Fit(videos.VideoDdbAttributes{Id: "video", ViewLogs: []videos.VideoViewAttributes{{Views: 1, Timestamp: 1}}})
+	if err != forecast.ErrNotEnoughSamples {
+		t.Errorf("TestFitNotEnoughSamples: expected ErrNotEnoughSamples, got %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package forecast
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/series"
+)
+
+var (
+	// Only the recent trajectory matters for the linear model
+	LINEAR_WINDOW = 72 * time.Hour
+	// Smoothing factors tried when fitting the exponential smoothing model
+	SMOOTHING_FACTORS = []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}
+)
+
+var errNotEnoughSamples = errors.New("not enough samples to fit the model")
+
+type Model interface {
+	Name() string
+	// Projected views at the given time
+	Predict(timestamp int64) float64
+}
+
+// Fits a model to the samples, the origin is when the video was published
+type fitFunc func(s series.Series, origin int64) (Model, error)
+
+// Straight line through the recent samples
+type linear struct {
+	intercept float64
+	slope     float64
+}
+
+func fitLinear(s series.Series, _ int64) (Model, error) {
+	last, ok := s.Last()
+	if !ok {
+		return nil, errNotEnoughSamples
+	}
+
+	recent := s.Since(last.Timestamp - int64(LINEAR_WINDOW.Seconds()))
+	if len(recent) < 2 {
+		recent = s
+	}
+
+	xs := make([]float64, len(recent))
+	ys := make([]float64, len(recent))
+	for i, point := range recent {
+		xs[i] = float64(point.Timestamp)
+		ys[i] = point.Value
+	}
+
+	intercept, slope, err := leastSquares(xs, ys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &linear{intercept: intercept, slope: slope}, nil
+}
+
+func (m *linear) Name() string {
+	return "linear"
+}
+
+func (m *linear) Predict(timestamp int64) float64 {
+	return m.intercept + m.slope*float64(timestamp)
+}
+
+// Views grow with the log of the video's age, most videos slow down like this after release
+type logDecay struct {
+	origin    int64
+	intercept float64
+	slope     float64
+}
+
+func fitLogDecay(s series.Series, origin int64) (Model, error) {
+	var xs, ys []float64
+	for _, point := range s {
+		if point.Timestamp <= origin {
+			continue
+		}
+
+		xs = append(xs, math.Log(hoursSince(origin, point.Timestamp)))
+		ys = append(ys, point.Value)
+	}
+
+	intercept, slope, err := leastSquares(xs, ys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logDecay{origin: origin, intercept: intercept, slope: slope}, nil
+}
+
+func (m *logDecay) Name() string {
+	return "log-decay"
+}
+
+func (m *logDecay) Predict(timestamp int64) float64 {
+	if timestamp <= m.origin {
+		return 0
+	}
+
+	return m.intercept + m.slope*math.Log(hoursSince(m.origin, timestamp))
+}
+
+// Holt's linear exponential smoothing on evenly spaced samples
+type smoothing struct {
+	step   int64
+	level  float64
+	trend  float64
+	last   int64
+	fitted series.Series
+}
+
+func fitSmoothing(s series.Series, _ int64) (Model, error) {
+	if len(s) < 3 {
+		return nil, errNotEnoughSamples
+	}
+
+	step := medianGap(s)
+	resampled := s.Resample(time.Duration(step) * time.Second)
+	if len(resampled) < 3 {
+		return nil, errNotEnoughSamples
+	}
+
+	// Pick the factors with the smallest one step ahead error
+	var best *smoothing
+	bestError := math.Inf(1)
+	for _, alpha := range SMOOTHING_FACTORS {
+		for _, beta := range SMOOTHING_FACTORS {
+			model, sse := holt(resampled, step, alpha, beta)
+			if sse < bestError {
+				best, bestError = model, sse
+			}
+		}
+	}
+
+	return best, nil
+}
+
+func holt(s series.Series, step int64, alpha, beta float64) (*smoothing, float64) {
+	level := s[0].Value
+	trend := s[1].Value - s[0].Value
+	fitted := series.Series{s[0]}
+
+	var sse float64
+	for _, point := range s[1:] {
+		expected := level + trend
+		sse += (point.Value - expected) * (point.Value - expected)
+		fitted = append(fitted, series.Point{Timestamp: point.Timestamp, Value: expected})
+
+		previous := level
+		level = alpha*point.Value + (1-alpha)*(level+trend)
+		trend = beta*(level-previous) + (1-beta)*trend
+	}
+
+	return &smoothing{step: step, level: level, trend: trend, last: s[len(s)-1].Timestamp, fitted: fitted}, sse
+}
+
+func (m *smoothing) Name() string {
+	return "exponential-smoothing"
+}
+
+func (m *smoothing) Predict(timestamp int64) float64 {
+	if value, ok := m.fitted.At(timestamp); ok && timestamp < m.last {
+		return value
+	}
+
+	return m.level + m.trend*float64(timestamp-m.last)/float64(m.step)
+}
+
+func leastSquares(xs, ys []float64) (float64, float64, error) {
+	if len(xs) < 2 {
+		return 0, 0, errNotEnoughSamples
+	}
+
+	n := float64(len(xs))
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var covariance, variance float64
+	for i := range xs {
+		covariance += (xs[i] - meanX) * (ys[i] - meanY)
+		variance += (xs[i] - meanX) * (xs[i] - meanX)
+	}
+
+	if variance == 0 {
+		return 0, 0, errNotEnoughSamples
+	}
+
+	slope := covariance / variance
+
+	return meanY - slope*meanX, slope, nil
+}
+
+func hoursSince(origin, timestamp int64) float64 {
+	return float64(timestamp-origin) / 3600
+}
+
+func medianGap(s series.Series) int64 {
+	gaps := make([]int64, 0, len(s)-1)
+	for i := 1; i < len(s); i++ {
+		gaps = append(gaps, s[i].Timestamp-s[i-1].Timestamp)
+	}
+
+	sort.Slice(gaps, func(i, j int) bool {
+		return gaps[i] < gaps[j]
+	})
+
+	gap := gaps[len(gaps)/2]
+	if gap < 60 {
+		return 60
+	}
+
+	return gap
+}
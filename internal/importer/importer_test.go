@@ -0,0 +1,103 @@
+package importer_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ricomonster/black-flag/internal/importer"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+func TestReadCSV(t *testing.T) {
+	mapping, err := importer.ParseMapping(map[string]string{"video": "Video ID", "views": "Total Views"})
+	if err != nil {
+		t.Fatalf("TestReadCSV: unexpected error %v", err)
+	}
+
+	csv := "Video ID,Date,Total Views\nabc,2023-01-01T10:00:00Z,\"1,000\"\nabc,1672570800000,1200\n"
+
+	samples, err := importer.ReadCSV(strings.NewReader(csv), "history.csv", mapping)
+	if err != nil {
+		t.Fatalf("TestReadCSV: unexpected error %v", err)
+	}
+
+	if len(samples) != 2 || samples[0].Views != 1000 || samples[0].Timestamp != 1672567200 || samples[1].Timestamp != 1672570800 {
+		t.Errorf("TestReadCSV: unexpected samples %+v", samples)
+	}
+
+	if samples[1].Source != "history.csv:3" {
+		t.Errorf("TestReadCSV: expected the source to be history.csv:3, got %s", samples[1].Source)
+	}
+}
+
+func TestReadLegacy(t *testing.T) {
+	legacy := `{"id":"abc","title":"Video","channel":{"id":"UC","title":"Channel"},"last_activity_at":2,"views":[{"views":10,"timestamp":1},{"Views":20,"Timestamp":2}]}`
+
+	samples, err := importer.ReadLegacy(strings.NewReader(legacy), "abc.json")
+	if err != nil {
+		t.Fatalf("TestReadLegacy: unexpected error %v", err)
+	}
+
+	if len(samples) != 2 || samples[1].Views != 20 || samples[1].Title != "Video" || samples[1].ChannelId != "UC" {
+		t.Errorf("TestReadLegacy: unexpected samples %+v", samples)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	stored := videos.VideoDdbAttributes{
+		Id:      "abc",
+		Created: 1,
+		ViewLogs: []videos.VideoViewAttributes{
+			{Views: 100, Timestamp: 100},
+			{Views: 300, Timestamp: 300},
+		},
+	}
+
+	find := func(ids []string) (map[string]videos.VideoDdbAttributes, error) {
+		found := map[string]videos.VideoDdbAttributes{}
+		for _, id := range ids {
+			if id == stored.Id {
+				found[id] = stored
+			}
+		}
+		return found, nil
+	}
+
+	merges, err := importer.Plan([]importer.Sample{
+		{VideoId: "abc", Timestamp: 200, Views: 200},
+		{VideoId: "abc", Timestamp: 100, Views: 100},
+		{VideoId: "abc", Timestamp: 200, Views: 200},
+		{VideoId: "abc", Timestamp: 50, Views: 150},
+		{VideoId: "new", Timestamp: 10, Views: 1, Title: "New"},
+	}, find)
+	if err != nil {
+		t.Fatalf("TestPlan: unexpected error %v", err)
+	}
+
+	merge := merges[0]
+	if len(merge.Added) != 2 || merge.Duplicates != 2 || merge.HasErrors() {
+		t.Errorf("TestPlan: expected 2 added and 2 duplicates, got %d and %d with %+v", len(merge.Added), merge.Duplicates, merge.Issues)
+	}
+
+	var timestamps []int64
+	for _, log := range merge.Logs {
+		timestamps = append(timestamps, log.Timestamp)
+	}
+	if len(timestamps) != 4 || timestamps[0] != 50 || timestamps[2] != 200 {
+		t.Errorf("TestPlan: expected the logs in timestamp order, got %v", timestamps)
+	}
+
+	// 150 at 50 then 100 at 100
+	if len(merge.Issues) != 1 || merge.Issues[0].Level != importer.ISSUE_WARNING {
+		t.Errorf("TestPlan: expected a warning about the views going down, got %+v", merge.Issues)
+	}
+
+	if !merges[1].IsNew() || merges[1].Title != "New" {
+		t.Errorf("TestPlan: expected the second video to be new, got %+v", merges[1])
+	}
+
+	conflict, _ := importer.Plan([]importer.Sample{{VideoId: "abc", Timestamp: 100, Views: 999}}, find)
+	if !conflict[0].HasErrors() {
+		t.Errorf("TestPlan: expected a conflict with the stored sample")
+	}
+}
@@ -0,0 +1,166 @@
+package importer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+type IssueLevel string
+
+var (
+	// Imported anyway, e.g. views going down which Youtube does when it removes spam views
+	ISSUE_WARNING IssueLevel = "warning"
+	// Blocks the import, e.g. two different view counts for the same time
+	ISSUE_ERROR IssueLevel = "error"
+)
+
+type Issue struct {
+	Level     IssueLevel
+	Timestamp int64
+	Source    string
+	Message   string
+}
+
+// What importing the samples of a single video changes
+type Merge struct {
+	VideoId string
+	// What we have stored, Created is zero when we don't track the video yet
+	Existing videos.VideoDdbAttributes
+	// Metadata found in the samples for videos we don't track yet
+	Title   string
+	Channel videos.VideoChannelAttributes
+	// Samples that are not stored yet and the full history once they are merged in
+	Added      []videos.VideoViewAttributes
+	Logs       []videos.VideoViewAttributes
+	Duplicates int
+	Issues     []Issue
+}
+
+func (m Merge) IsNew() bool {
+	return m.Existing.Created == 0
+}
+
+func (m Merge) HasErrors() bool {
+	for _, issue := range m.Issues {
+		if issue.Level == ISSUE_ERROR {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Works out how the samples merge into the stored history of each video, nothing is saved.
+// find reads the stored videos at once and leaves out the ones we don't track.
+func Plan(samples []Sample, find func(ids []string) (map[string]videos.VideoDdbAttributes, error)) ([]Merge, error) {
+	// Keep the videos in the order they first appear
+	var ids []string
+	byVideo := map[string][]Sample{}
+	for _, sample := range samples {
+		if _, ok := byVideo[sample.VideoId]; !ok {
+			ids = append(ids, sample.VideoId)
+		}
+		byVideo[sample.VideoId] = append(byVideo[sample.VideoId], sample)
+	}
+
+	stored, err := find(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	merges := make([]Merge, 0, len(ids))
+	for _, id := range ids {
+		merges = append(merges, plan(id, stored[id], byVideo[id]))
+	}
+
+	return merges, nil
+}
+
+func plan(id string, existing videos.VideoDdbAttributes, samples []Sample) Merge {
+	merge := Merge{VideoId: id, Existing: existing}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Timestamp < samples[j].Timestamp
+	})
+
+	stored := map[int64]int{}
+	for _, log := range existing.ViewLogs {
+		stored[log.Timestamp] = log.Views
+	}
+
+	imported := map[int64]Sample{}
+	for _, sample := range samples {
+		if merge.Title == "" && sample.Title != "" {
+			merge.Title = sample.Title
+		}
+		if merge.Channel.Id == "" && sample.ChannelId != "" {
+			merge.Channel = videos.VideoChannelAttributes{Id: sample.ChannelId, Title: sample.Channel}
+		}
+
+		if views, ok := stored[sample.Timestamp]; ok {
+			if views == sample.Views {
+				merge.Duplicates++
+			} else {
+				merge.Issues = append(merge.Issues, Issue{
+					Level:     ISSUE_ERROR,
+					Timestamp: sample.Timestamp,
+					Source:    sample.Source,
+					Message:   fmt.Sprintf("%d views but %d are already stored for the same time", sample.Views, views),
+				})
+			}
+			continue
+		}
+
+		if previous, ok := imported[sample.Timestamp]; ok {
+			if previous.Views == sample.Views {
+				merge.Duplicates++
+			} else {
+				merge.Issues = append(merge.Issues, Issue{
+					Level:     ISSUE_ERROR,
+					Timestamp: sample.Timestamp,
+					Source:    sample.Source,
+					Message:   fmt.Sprintf("%d views but %s has %d for the same time", sample.Views, previous.Source, previous.Views),
+				})
+			}
+			continue
+		}
+
+		imported[sample.Timestamp] = sample
+		merge.Added = append(merge.Added, videos.VideoViewAttributes{
+			Views:     sample.Views,
+			Likes:     sample.Likes,
+			Comments:  sample.Comments,
+			Timestamp: sample.Timestamp,
+		})
+	}
+
+	// The stored and imported samples in timestamp order
+	merge.Logs = append(append([]videos.VideoViewAttributes{}, existing.ViewLogs...), merge.Added...)
+	sort.SliceStable(merge.Logs, func(i, j int) bool {
+		return merge.Logs[i].Timestamp < merge.Logs[j].Timestamp
+	})
+
+	for i := 1; i < len(merge.Logs); i++ {
+		before, after := merge.Logs[i-1], merge.Logs[i]
+		if after.Views >= before.Views {
+			continue
+		}
+
+		// Only complain about what we are bringing in
+		sample, isNew := imported[after.Timestamp]
+		if _, beforeIsNew := imported[before.Timestamp]; !isNew && !beforeIsNew {
+			continue
+		}
+
+		merge.Issues = append(merge.Issues, Issue{
+			Level:     ISSUE_WARNING,
+			Timestamp: after.Timestamp,
+			Source:    sample.Source,
+			Message:   fmt.Sprintf("views went down from %d to %d", before.Views, after.Views),
+		})
+	}
+
+	return merge
+}
@@ -0,0 +1,361 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/storage"
+)
+
+type Format string
+
+var (
+	FORMAT_AUTO Format = "auto"
+	FORMAT_CSV  Format = "csv"
+	// Either an array of objects or JSON Lines
+	FORMAT_JSON Format = "json"
+	// Files written by storage.SaveVideoStats
+	FORMAT_LEGACY Format = "legacy"
+)
+
+var FORMATS = []Format{FORMAT_AUTO, FORMAT_CSV, FORMAT_JSON, FORMAT_LEGACY}
+
+// A single historical sample of a video
+type Sample struct {
+	VideoId   string
+	Timestamp int64
+	Views     int
+	Likes     int
+	Comments  int
+	// Only known for some sources, used when the video is not tracked yet
+	Title     string
+	ChannelId string
+	Channel   string
+	// Where the sample came from, e.g. history.csv:12
+	Source string
+}
+
+// Names of the columns or keys holding each field, the first one found wins
+type Mapping struct {
+	Video     []string
+	Timestamp []string
+	Views     []string
+	Likes     []string
+	Comments  []string
+	Title     []string
+	ChannelId []string
+	Channel   []string
+}
+
+var DEFAULT_MAPPING = Mapping{
+	Video:     []string{"video_id", "video", "id"},
+	Timestamp: []string{"timestamp", "sampled_at", "date", "time"},
+	Views:     []string{"views", "view_count"},
+	Likes:     []string{"likes", "like_count"},
+	Comments:  []string{"comments", "comment_count"},
+	Title:     []string{"title"},
+	ChannelId: []string{"channel_id"},
+	Channel:   []string{"channel", "channel_title"},
+}
+
+// Layouts accepted for timestamps besides unix seconds
+var TIME_LAYOUTS = []string{time.RFC3339, time.DateTime, "2006-01-02 15:04", time.DateOnly, "01/02/2006 15:04", "01/02/2006"}
+
+// Overrides the default columns, e.g. video=Video ID,views=Total Views
+func ParseMapping(values map[string]string) (Mapping, error) {
+	mapping := DEFAULT_MAPPING
+
+	for field, column := range values {
+		target := map[string]*[]string{
+			"video":      &mapping.Video,
+			"timestamp":  &mapping.Timestamp,
+			"views":      &mapping.Views,
+			"likes":      &mapping.Likes,
+			"comments":   &mapping.Comments,
+			"title":      &mapping.Title,
+			"channel_id": &mapping.ChannelId,
+			"channel":    &mapping.Channel,
+		}[field]
+		if target == nil {
+			return mapping, fmt.Errorf("unknown field %q, expected video, timestamp, views, likes, comments, title, channel_id or channel", field)
+		}
+
+		*target = []string{column}
+	}
+
+	return mapping, nil
+}
+
+// Reads the samples of a file, or of every legacy JSON file when given a directory
+func ReadPath(path string, format Format, mapping Mapping) ([]Sample, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		files, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+
+		var samples []Sample
+		for _, file := range files {
+			read, err := ReadPath(file, FORMAT_LEGACY, mapping)
+			if err != nil {
+				return nil, err
+			}
+			samples = append(samples, read...)
+		}
+
+		return samples, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == FORMAT_AUTO {
+		format = detect(path, content)
+	}
+
+	name := filepath.Base(path)
+	switch format {
+	case FORMAT_CSV:
+		return ReadCSV(bytes.NewReader(content), name, mapping)
+	case FORMAT_JSON:
+		return ReadJSON(bytes.NewReader(content), name, mapping)
+	case FORMAT_LEGACY:
+		return ReadLegacy(bytes.NewReader(content), name)
+	}
+
+	return nil, fmt.Errorf("unknown format %q, expected one of %v", format, FORMATS)
+}
+
+func detect(path string, content []byte) Format {
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return FORMAT_CSV
+	}
+
+	// Legacy files are a single object with the views inside
+	var legacy map[string]json.RawMessage
+	if json.Unmarshal(content, &legacy) == nil {
+		if views, ok := legacy["views"]; ok && bytes.HasPrefix(bytes.TrimSpace(views), []byte("[")) {
+			return FORMAT_LEGACY
+		}
+	}
+
+	return FORMAT_JSON
+}
+
+func ReadCSV(r io.Reader, name string, mapping Mapping) ([]Sample, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: unable to read the header, %w", name, err)
+	}
+
+	columns := map[string]int{}
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+
+	var samples []Sample
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+
+		sample, err := newSample(func(keys []string) (string, bool) {
+			for _, key := range keys {
+				if i, ok := columns[strings.ToLower(key)]; ok && i < len(record) {
+					return record[i], true
+				}
+			}
+			return "", false
+		}, mapping)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+
+		sample.Source = fmt.Sprintf("%s:%d", name, line)
+		samples = append(samples, sample)
+	}
+
+	return samples, nil
+}
+
+func ReadJSON(r io.Reader, name string, mapping Mapping) ([]Sample, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// An array of objects, otherwise one object per line
+	var objects []map[string]any
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte("[")) {
+		if err := json.Unmarshal(content, &objects); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+
+			var object map[string]any
+			if err := json.Unmarshal(scanner.Bytes(), &object); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+			}
+			objects = append(objects, object)
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	var samples []Sample
+	for i, object := range objects {
+		sample, err := newSample(func(keys []string) (string, bool) {
+			for _, key := range keys {
+				if value, ok := object[key]; ok && value != nil {
+					// Numbers are decoded as floats, keep them whole
+					if number, ok := value.(float64); ok {
+						return strconv.FormatFloat(number, 'f', -1, 64), true
+					}
+					return fmt.Sprint(value), true
+				}
+			}
+			return "", false
+		}, mapping)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, i+1, err)
+		}
+
+		sample.Source = fmt.Sprintf("%s:%d", name, i+1)
+		samples = append(samples, sample)
+	}
+
+	return samples, nil
+}
+
+func ReadLegacy(r io.Reader, name string) ([]Sample, error) {
+	var details storage.VideoStatDetails
+	if err := json.NewDecoder(r).Decode(&details); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if details.Id == "" {
+		return nil, fmt.Errorf("%s: missing the video id", name)
+	}
+
+	samples := make([]Sample, 0, len(details.Views))
+	for i, views := range details.Views {
+		samples = append(samples, Sample{
+			VideoId:   details.Id,
+			Timestamp: views.Timestamp,
+			Views:     views.Views,
+			Title:     details.Title,
+			ChannelId: details.Channel.Id,
+			Channel:   details.Channel.Title,
+			Source:    fmt.Sprintf("%s:%d", name, i+1),
+		})
+	}
+
+	return samples, nil
+}
+
+func newSample(lookup func(keys []string) (string, bool), mapping Mapping) (Sample, error) {
+	var sample Sample
+
+	video, ok := lookup(mapping.Video)
+	if !ok || strings.TrimSpace(video) == "" {
+		return sample, errors.New("missing the video id")
+	}
+	sample.VideoId = strings.TrimSpace(video)
+
+	timestamp, ok := lookup(mapping.Timestamp)
+	if !ok {
+		return sample, errors.New("missing the timestamp")
+	}
+
+	parsed, err := parseTimestamp(timestamp)
+	if err != nil {
+		return sample, err
+	}
+	sample.Timestamp = parsed
+
+	views, ok := lookup(mapping.Views)
+	if !ok {
+		return sample, errors.New("missing the views")
+	}
+
+	if sample.Views, err = parseCount(views); err != nil {
+		return sample, fmt.Errorf("invalid views %q", views)
+	}
+
+	for _, optional := range []struct {
+		keys   []string
+		target *int
+	}{
+		{mapping.Likes, &sample.Likes},
+		{mapping.Comments, &sample.Comments},
+	} {
+		if value, ok := lookup(optional.keys); ok && value != "" {
+			if *optional.target, err = parseCount(value); err != nil {
+				return sample, fmt.Errorf("invalid count %q", value)
+			}
+		}
+	}
+
+	sample.Title, _ = lookup(mapping.Title)
+	sample.ChannelId, _ = lookup(mapping.ChannelId)
+	sample.Channel, _ = lookup(mapping.Channel)
+
+	return sample, nil
+}
+
+func parseTimestamp(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		// Milliseconds are common in spreadsheets exported from other tools
+		if unix > 1e12 {
+			unix /= 1000
+		}
+		return unix, nil
+	}
+
+	for _, layout := range TIME_LAYOUTS {
+		if parsed, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return parsed.Unix(), nil
+		}
+	}
+
+	return 0, fmt.Errorf("invalid timestamp %q", value)
+}
+
+// Spreadsheets like to format counts as 1,234
+func parseCount(value string) (int, error) {
+	return strconv.Atoi(strings.ReplaceAll(strings.TrimSpace(value), ",", ""))
+}
@@ -0,0 +1,122 @@
+package leaderboard
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/compare"
+	"github.com/ricomonster/black-flag/internal/series"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+type By string
+
+var (
+	BY_VIDEOS   By = "videos"
+	BY_CHANNELS By = "channels"
+)
+
+// Names accepted for the common windows
+var WINDOWS = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+	"week": 7 * 24 * time.Hour,
+}
+
+type Entry struct {
+	// Set when ranking videos
+	Video   videos.VideoDdbAttributes
+	Channel videos.VideoChannelAttributes
+	// Videos in the entry, always 1 for videos
+	Videos int
+	Views  int
+	Gain   float64
+	// The history doesn't cover the whole window so the gain is only for part of it
+	Partial bool
+}
+
+// Accepts hour, day, week or a duration like 6h or 30d
+func ParseWindow(value string) (time.Duration, error) {
+	if window, ok := WINDOWS[strings.ToLower(value)]; ok {
+		return window, nil
+	}
+
+	window, err := compare.ParseDuration(value)
+	if err != nil || window <= 0 {
+		return 0, fmt.Errorf("invalid window %q, expected hour, day, week or a duration like 6h", value)
+	}
+
+	return window, nil
+}
+
+// Views gained by the video in the window ending now. Samples rarely line up with the window
+// so the views at its start are interpolated, before the first sample we only count what we saw.
+func Gain(video videos.VideoDdbAttributes, window time.Duration, now time.Time) (float64, bool) {
+	views := series.Views(video.ViewLogs)
+	if len(views) == 0 {
+		return 0, true
+	}
+
+	start := now.Add(-window).Unix()
+
+	return views.Clamped(now.Unix()) - views.Clamped(start), start < views[0].Timestamp
+}
+
+// Ranks the videos by the views gained in the window
+func Videos(items []videos.VideoDdbAttributes, window time.Duration, now time.Time) []Entry {
+	entries := make([]Entry, 0, len(items))
+	for _, item := range items {
+		gain, partial := Gain(item, window, now)
+
+		entries = append(entries, Entry{
+			Video:   item,
+			Channel: item.Channel,
+			Videos:  1,
+			Views:   videos.LatestViews(item),
+			Gain:    gain,
+			Partial: partial,
+		})
+	}
+
+	rank(entries)
+
+	return entries
+}
+
+// Ranks the channels by the views their videos gained in the window
+func Channels(items []videos.VideoDdbAttributes, window time.Duration, now time.Time) []Entry {
+	byChannel := map[string]*Entry{}
+	for _, entry := range Videos(items, window, now) {
+		channel, ok := byChannel[entry.Channel.Id]
+		if !ok {
+			channel = &Entry{Channel: entry.Channel}
+			byChannel[entry.Channel.Id] = channel
+		}
+
+		channel.Videos++
+		channel.Views += entry.Views
+		channel.Gain += entry.Gain
+		channel.Partial = channel.Partial || entry.Partial
+	}
+
+	entries := make([]Entry, 0, len(byChannel))
+	for _, entry := range byChannel {
+		entries = append(entries, *entry)
+	}
+
+	rank(entries)
+
+	return entries
+}
+
+func rank(entries []Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Gain == entries[j].Gain {
+			return entries[i].Views > entries[j].Views
+		}
+
+		return entries[i].Gain > entries[j].Gain
+	})
+}
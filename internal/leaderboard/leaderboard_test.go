@@ -0,0 +1,69 @@
+package leaderboard_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/leaderboard"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+func TestVideos(t *testing.T) {
+	now := time.Date(2023, 1, 10, 12, 0, 0, 0, time.UTC)
+	at := func(hoursAgo float64) int64 {
+		return now.Add(-time.Duration(hoursAgo * float64(time.Hour))).Unix()
+	}
+
+	items := []videos.VideoDdbAttributes{
+		{
+			Id:      "slow",
+			Channel: videos.VideoChannelAttributes{Id: "a"},
+			ViewLogs: []videos.VideoViewAttributes{
+				{Views: 1000, Timestamp: at(48)},
+				{Views: 1200, Timestamp: at(0)},
+			},
+		},
+		{
+			// The window starts between the samples, half of the 2000 views were before it
+			Id:      "fast",
+			Channel: videos.VideoChannelAttributes{Id: "b"},
+			ViewLogs: []videos.VideoViewAttributes{
+				{Views: 0, Timestamp: at(48)},
+				{Views: 2000, Timestamp: at(0)},
+			},
+		},
+		{
+			// Added an hour ago so only part of the window is known
+			Id:      "new",
+			Channel: videos.VideoChannelAttributes{Id: "a"},
+			ViewLogs: []videos.VideoViewAttributes{
+				{Views: 500, Timestamp: at(1)},
+				{Views: 800, Timestamp: at(0)},
+			},
+		},
+	}
+
+	entries := leaderboard.Videos(items, 24*time.Hour, now)
+
+	want := []struct {
+		id      string
+		gain    float64
+		partial bool
+	}{
+		{"fast", 1000, false},
+		{"new", 300, true},
+		{"slow", 100, false},
+	}
+
+	for i, w := range want {
+		if entries[i].Video.Id != w.id || entries[i].Gain != w.gain || entries[i].Partial != w.partial {
+			t.Errorf("TestVideos: expected %s with %.0f (partial %v) at %d, got %s with %.0f (partial %v)",
+				w.id, w.gain, w.partial, i+1, entries[i].Video.Id, entries[i].Gain, entries[i].Partial)
+		}
+	}
+
+	channels := leaderboard.Channels(items, 24*time.Hour, now)
+	if channels[0].Channel.Id != "b" || channels[1].Gain != 400 || channels[1].Videos != 2 {
+		t.Errorf("TestVideos: unexpected channel ranking %+v", channels)
+	}
+}
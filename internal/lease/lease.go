@@ -0,0 +1,336 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// What an instance does when someone else holds the lease it wants
+type Mode string
+
+var (
+	// Waits until the lease is released or expires
+	MODE_BLOCK Mode = "block"
+	// Gives up right away
+	MODE_SKIP Mode = "skip"
+	// Waits like block but checks often so the lease is taken as soon as it is released or expires, a holder
+	// that is still heartbeating is never preempted
+	MODE_TAKEOVER Mode = "takeover"
+)
+
+var (
+	// How long a lease lasts without a heartbeat, a crashed holder blocks the others at most this long
+	DEFAULT_TTL = 2 * time.Minute
+	// How often a blocked instance checks the lease again
+	DEFAULT_RETRY_INTERVAL = 15 * time.Second
+	// How often an instance taking the lease over checks it again
+	TAKEOVER_RETRY_INTERVAL = time.Second
+)
+
+// Returned when someone else holds the lease and we are not waiting for it
+var ErrHeld = errors.New("the lease is held by someone else")
+
+// Returned by a heartbeat once someone else took the lease, i.e. it expired before it could be renewed
+var ErrLost = errors.New("the lease was taken over")
+
+// A named lease as stored, only one holder at a time until it expires
+type Lease struct {
+	Name string `dynamodbav:"Id" dynamodbkey:"partition" json:"name"`
+	// Who holds it, host and process id by default
+	Holder     string `dynamodbav:"Holder" json:"holder"`
+	AcquiredAt int64  `dynamodbav:"AcquiredAt" json:"acquired_at"`
+	RenewedAt  int64  `dynamodbav:"RenewedAt" json:"renewed_at"`
+	// Unix timestamp, also the TTL of the DynamoDB item so abandoned leases are cleaned up
+	ExpiresAt int64 `dynamodbav:"ExpiresAt" json:"expires_at"`
+	// Every write is conditioned on it so two instances can't both acquire the lease
+	Version int64 `dynamodbav:"Version" dynamodbversion:"true" json:"version"`
+}
+
+// Tells if nobody holds the lease anymore, released leases are expired too
+func (l Lease) Expired(now time.Time) bool {
+	return l.Holder == "" || l.ExpiresAt <= now.Unix()
+}
+
+func (l Lease) String() string {
+	return fmt.Sprintf("%s held by %s since %s until %s", l.Name, l.Holder,
+		time.Unix(l.AcquiredAt, 0).Format(time.RFC3339), time.Unix(l.ExpiresAt, 0).Format(time.RFC3339))
+}
+
+// Where the leases are kept
+type Store interface {
+	// Reads the lease, lets mutate change it and writes it back. When someone else wrote it in the meantime
+	// mutate is given the new one. The lease is empty, apart from its name, when it was never acquired.
+	Modify(name string, mutate func(lease *Lease) error) (Lease, error)
+	// Every lease whose name starts with the prefix, expired ones included
+	List(prefix string) ([]Lease, error)
+}
+
+type Options struct {
+	// Defaults to the host name and process id
+	Holder string
+	TTL    time.Duration
+	Mode   Mode
+	// How often a blocked instance checks the lease again
+	RetryInterval time.Duration
+	Logger        *slog.Logger
+}
+
+type Locker struct {
+	store         Store
+	holder        string
+	ttl           time.Duration
+	mode          Mode
+	retryInterval time.Duration
+	logger        *slog.Logger
+}
+
+func NewLocker(store Store, options Options) *Locker {
+	if options.Holder == "" {
+		options.Holder = DefaultHolder()
+	}
+
+	if options.TTL <= 0 {
+		options.TTL = DEFAULT_TTL
+	}
+
+	if options.Mode == "" {
+		options.Mode = MODE_BLOCK
+	}
+
+	if options.RetryInterval <= 0 {
+		options.RetryInterval = DEFAULT_RETRY_INTERVAL
+		if options.Mode == MODE_TAKEOVER {
+			options.RetryInterval = TAKEOVER_RETRY_INTERVAL
+		}
+	}
+
+	if options.Logger == nil {
+		options.Logger = slog.Default()
+	}
+
+	return &Locker{
+		store:         store,
+		holder:        options.Holder,
+		ttl:           options.TTL,
+		mode:          options.Mode,
+		retryInterval: options.RetryInterval,
+		logger:        options.Logger,
+	}
+}
+
+// Host name and process id, unique enough for the instances running at the same time
+func DefaultHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// Acquires the lease and keeps it alive until it is released. When someone else holds it we either wait
+// or give up with ErrHeld depending on the mode. Waiting stops when the context is cancelled.
+func (l *Locker) Acquire(ctx context.Context, name string) (*Handle, error) {
+	for {
+		lease, err := l.tryAcquire(name)
+		if err == nil {
+			return l.hold(ctx, lease), nil
+		}
+
+		if !errors.Is(err, ErrHeld) || l.mode == MODE_SKIP {
+			return nil, err
+		}
+
+		l.logger.Info("waiting for the lease", "lease", name, "holder", lease.Holder,
+			"acquired_at", time.Unix(lease.AcquiredAt, 0).Format(time.RFC3339), "expires_at", time.Unix(lease.ExpiresAt, 0).Format(time.RFC3339))
+
+		// No point in checking again before it expires unless it gets released
+		wait := l.retryInterval
+		if untilExpiry := time.Until(time.Unix(lease.ExpiresAt, 0)); untilExpiry > 0 && untilExpiry < wait {
+			wait = untilExpiry
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Returns the lease as stored along with ErrHeld when someone else holds it
+func (l *Locker) tryAcquire(name string) (Lease, error) {
+	var previous Lease
+
+	lease, err := l.store.Modify(name, func(lease *Lease) error {
+		now := time.Now()
+		previous = *lease
+
+		if lease.Holder != l.holder && !lease.Expired(now) {
+			return ErrHeld
+		}
+
+		// Holding it already, e.g. an earlier run of ours that didn't release it
+		if lease.Holder != l.holder || lease.Expired(now) {
+			lease.AcquiredAt = now.Unix()
+		}
+
+		lease.Holder = l.holder
+		lease.RenewedAt = now.Unix()
+		lease.ExpiresAt = now.Add(l.ttl).Unix()
+		return nil
+	})
+	if errors.Is(err, ErrHeld) {
+		return previous, fmt.Errorf("%w: %v", ErrHeld, previous)
+	}
+	if err != nil {
+		return lease, err
+	}
+
+	attrs := []any{"lease", name, "holder", l.holder, "expires_at", time.Unix(lease.ExpiresAt, 0).Format(time.RFC3339)}
+	if previous.Holder == "" || previous.Holder == l.holder {
+		l.logger.Info("lease acquired", attrs...)
+	} else {
+		l.logger.Warn("lease expired, taking it over", append(attrs, "previous_holder", previous.Holder,
+			"expired_at", time.Unix(previous.ExpiresAt, 0).Format(time.RFC3339))...)
+	}
+
+	return lease, nil
+}
+
+// Keeps the lease alive in the background
+func (l *Locker) hold(ctx context.Context, lease Lease) *Handle {
+	ctx, cancel := context.WithCancel(ctx)
+
+	handle := &Handle{
+		locker: l,
+		lease:  lease,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go handle.heartbeat()
+
+	return handle
+}
+
+// A lease we hold, its context is cancelled once the lease is lost
+type Handle struct {
+	locker *Locker
+	lease  Lease
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// Cancelled when the lease is lost or released, the work done under the lease should stop then
+func (h *Handle) Context() context.Context {
+	return h.ctx
+}
+
+// Why the lease was lost, nil while we hold it or after it was released
+func (h *Handle) Err() error {
+	select {
+	case <-h.done:
+		return h.err
+	default:
+		return nil
+	}
+}
+
+// Renews the lease a few times per TTL so a single failed call doesn't lose it
+func (h *Handle) heartbeat() {
+	defer close(h.done)
+
+	ticker := time.NewTicker(h.locker.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		lease, err := h.locker.renew(h.lease)
+		if err == nil {
+			h.lease = lease
+			continue
+		}
+
+		// Transient failures are fine as long as the lease didn't expire in the meantime
+		if !errors.Is(err, ErrLost) && !h.lease.Expired(time.Now()) {
+			h.locker.logger.Warn("lease heartbeat failed", "lease", h.lease.Name, "error", err)
+			continue
+		}
+
+		h.err = err
+		if !errors.Is(err, ErrLost) {
+			h.err = fmt.Errorf("%w: it expired, the last heartbeat failed with %v", ErrLost, err)
+		}
+
+		h.locker.logger.Error("lease lost", "lease", h.lease.Name, "error", h.err)
+		h.cancel()
+		return
+	}
+}
+
+func (l *Locker) renew(held Lease) (Lease, error) {
+	var current Lease
+
+	lease, err := l.store.Modify(held.Name, func(lease *Lease) error {
+		current = *lease
+		if lease.Holder != held.Holder || lease.AcquiredAt != held.AcquiredAt {
+			return ErrLost
+		}
+
+		now := time.Now()
+		lease.RenewedAt = now.Unix()
+		lease.ExpiresAt = now.Add(l.ttl).Unix()
+		return nil
+	})
+	if errors.Is(err, ErrLost) {
+		return lease, fmt.Errorf("%w: %v", ErrLost, current)
+	}
+
+	return lease, err
+}
+
+// Stops the heartbeat and lets the others acquire the lease right away. Releasing a lease that was lost
+// leaves it to its new holder.
+func (h *Handle) Release() error {
+	h.cancel()
+	<-h.done
+
+	if h.err != nil {
+		return nil
+	}
+
+	_, err := h.locker.store.Modify(h.lease.Name, func(lease *Lease) error {
+		if lease.Holder != h.lease.Holder || lease.AcquiredAt != h.lease.AcquiredAt {
+			return ErrLost
+		}
+
+		lease.Holder = ""
+		lease.ExpiresAt = time.Now().Unix()
+		return nil
+	})
+	if errors.Is(err, ErrLost) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	h.locker.logger.Info("lease released", "lease", h.lease.Name, "holder", h.lease.Holder)
+
+	return nil
+}
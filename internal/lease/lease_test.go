@@ -0,0 +1,186 @@
+package lease_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb"
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb/ddbtest"
+	"github.com/ricomonster/black-flag/internal/lease"
+)
+
+func stores(t *testing.T) map[string]lease.Store {
+	fake := ddbtest.New(lease.TABLE)
+	dynamodb.SetDefaultClient(fake)
+	t.Cleanup(func() { dynamodb.SetDefaultClient(nil) })
+
+	ddbStore, err := lease.NewStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fileStore, err := lease.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]lease.Store{"dynamodb": ddbStore, "file": fileStore}
+}
+
+func TestAcquire(t *testing.T) {
+	for name, store := range stores(t) {
+		first := lease.NewLocker(store, lease.Options{Holder: "first", TTL: time.Minute, Mode: lease.MODE_SKIP})
+		second := lease.NewLocker(store, lease.Options{Holder: "second", TTL: time.Minute, Mode: lease.MODE_SKIP})
+
+		handle, err := first.Acquire(context.Background(), "refresh")
+		if err != nil {
+			t.Fatalf("TestAcquire: %s: unexpected error %v", name, err)
+		}
+
+		if _, err := second.Acquire(context.Background(), "refresh"); !errors.Is(err, lease.ErrHeld) {
+			t.Errorf("TestAcquire: %s: expected the lease to be held, got %v", name, err)
+		}
+
+		// Other leases are independent
+		other, err := second.Acquire(context.Background(), "refresh/1")
+		if err != nil {
+			t.Errorf("TestAcquire: %s: unexpected error for another lease %v", name, err)
+		} else {
+			other.Release()
+		}
+
+		if err := handle.Release(); err != nil {
+			t.Errorf("TestAcquire: %s: unexpected release error %v", name, err)
+		}
+		if handle.Context().Err() == nil {
+			t.Errorf("TestAcquire: %s: expected the context to be cancelled once released", name)
+		}
+
+		handle, err = second.Acquire(context.Background(), "refresh")
+		if err != nil {
+			t.Errorf("TestAcquire: %s: expected the released lease to be acquired, got %v", name, err)
+		} else {
+			handle.Release()
+		}
+	}
+}
+
+func TestAcquireExpired(t *testing.T) {
+	for name, store := range stores(t) {
+		// Left behind by a holder that crashed
+		_, err := store.Modify("refresh", func(l *lease.Lease) error {
+			l.Holder = "crashed"
+			l.AcquiredAt = time.Now().Add(-time.Hour).Unix()
+			l.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		locker := lease.NewLocker(store, lease.Options{Holder: "next", TTL: time.Minute, Mode: lease.MODE_SKIP})
+		handle, err := locker.Acquire(context.Background(), "refresh")
+		if err != nil {
+			t.Errorf("TestAcquireExpired: %s: unexpected error %v", name, err)
+			continue
+		}
+		handle.Release()
+	}
+}
+
+func TestAcquireBlock(t *testing.T) {
+	for name, store := range stores(t) {
+		first := lease.NewLocker(store, lease.Options{Holder: "first", TTL: time.Minute})
+		second := lease.NewLocker(store, lease.Options{Holder: "second", TTL: time.Minute, Mode: lease.MODE_BLOCK, RetryInterval: 10 * time.Millisecond})
+
+		handle, err := first.Acquire(context.Background(), "refresh")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		acquired := make(chan error)
+		go func() {
+			waiting, err := second.Acquire(context.Background(), "refresh")
+			if err == nil {
+				waiting.Release()
+			}
+			acquired <- err
+		}()
+
+		select {
+		case err := <-acquired:
+			t.Fatalf("TestAcquireBlock: %s: expected to wait for the lease, got %v", name, err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		handle.Release()
+
+		select {
+		case err := <-acquired:
+			if err != nil {
+				t.Errorf("TestAcquireBlock: %s: unexpected error %v", name, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("TestAcquireBlock: %s: the lease was not acquired once released", name)
+		}
+
+		// Waiting stops with the context
+		handle, _ = first.Acquire(context.Background(), "refresh")
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		if _, err := second.Acquire(ctx, "refresh"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("TestAcquireBlock: %s: expected to stop waiting, got %v", name, err)
+		}
+		cancel()
+		handle.Release()
+	}
+}
+
+func TestTakeover(t *testing.T) {
+	for name, store := range stores(t) {
+		first := lease.NewLocker(store, lease.Options{Holder: "first", TTL: 3 * time.Second})
+		second := lease.NewLocker(store, lease.Options{Holder: "second", TTL: time.Minute, Mode: lease.MODE_TAKEOVER})
+
+		handle, err := first.Acquire(context.Background(), "refresh")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A live holder keeps the lease
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		if _, err := second.Acquire(ctx, "refresh"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("TestTakeover: %s: expected to wait for the live holder, got %v", name, err)
+		}
+		cancel()
+		if handle.Context().Err() != nil {
+			t.Errorf("TestTakeover: %s: the live holder lost the lease %v", name, handle.Err())
+		}
+		handle.Release()
+
+		// Left behind by a holder that crashed, taken over as soon as it expires
+		_, err = store.Modify("refresh", func(l *lease.Lease) error {
+			l.Holder = "crashed"
+			l.AcquiredAt = time.Now().Unix()
+			l.ExpiresAt = time.Now().Add(time.Second).Unix()
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
+		taken, err := second.Acquire(ctx, "refresh")
+		cancel()
+		if err != nil {
+			t.Fatalf("TestTakeover: %s: expected to take the expired lease over, got %v", name, err)
+		}
+
+		third := lease.NewLocker(store, lease.Options{Holder: "third", Mode: lease.MODE_SKIP})
+		if _, err := third.Acquire(context.Background(), "refresh"); !errors.Is(err, lease.ErrHeld) {
+			t.Errorf("TestTakeover: %s: expected the lease to be held by the new holder, got %v", name, err)
+		}
+
+		taken.Release()
+	}
+}
@@ -0,0 +1,180 @@
+package lease
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb"
+)
+
+var (
+	TABLE = "BlackFlag_Leases"
+
+	// Leases expire by themselves, the TTL only cleans up the ones nobody asks for anymore
+	SCHEMA = dynamodb.TableSchema{
+		Name:         TABLE,
+		HashKey:      dynamodb.KeyAttribute{Name: "Id", Type: types.ScalarAttributeTypeS},
+		TTLAttribute: "ExpiresAt",
+	}
+)
+
+type ddbStore struct {
+	dynamodb *dynamodb.DynamoDB[Lease]
+}
+
+// Keeps the leases in DynamoDB so instances on different machines see each other
+func NewStore() (Store, error) {
+	ddb, err := dynamodb.NewDynamoDB[Lease](TABLE)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ddbStore{dynamodb: ddb}, nil
+}
+
+func (s *ddbStore) Modify(name string, mutate func(lease *Lease) error) (Lease, error) {
+	return s.dynamodb.Modify(dynamodb.Key{Partition: name}, func(lease *Lease) error {
+		lease.Name = name
+		return mutate(lease)
+	})
+}
+
+// The table only holds a handful of leases so it is scanned
+func (s *ddbStore) List(prefix string) ([]Lease, error) {
+	all, err := s.dynamodb.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var leases []Lease
+	for _, lease := range all {
+		if strings.HasPrefix(lease.Name, prefix) {
+			leases = append(leases, lease)
+		}
+	}
+
+	return leases, nil
+}
+
+// How long the file store waits for another process on the same machine to finish writing a lease
+var FILE_LOCK_TIMEOUT = 10 * time.Second
+
+type fileStore struct {
+	dir string
+}
+
+// Keeps the leases as JSON files in the directory, for instances running on the same machine
+func NewFileStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &fileStore{dir: dir}, nil
+}
+
+func (s *fileStore) path(name string) string {
+	// Lease names can contain slashes, e.g. per shard
+	return filepath.Join(s.dir, strings.ReplaceAll(name, "/", "_")+".json")
+}
+
+func (s *fileStore) Modify(name string, mutate func(lease *Lease) error) (Lease, error) {
+	path := s.path(name)
+
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return Lease{}, err
+	}
+	defer unlock()
+
+	lease := Lease{Name: name}
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return lease, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(content, &lease); err != nil {
+			return lease, fmt.Errorf("unable to read the lease %s: %w", path, err)
+		}
+	}
+
+	if err := mutate(&lease); err != nil {
+		return lease, err
+	}
+	lease.Version++
+
+	content, err = json.Marshal(lease)
+	if err != nil {
+		return lease, err
+	}
+
+	// Readers never see a half written lease
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return lease, err
+	}
+
+	return lease, os.Rename(tmp, path)
+}
+
+func (s *fileStore) List(prefix string) ([]Lease, error) {
+	paths, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var leases []Lease
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var lease Lease
+		if err := json.Unmarshal(content, &lease); err != nil {
+			return nil, fmt.Errorf("unable to read the lease %s: %w", path, err)
+		}
+
+		if strings.HasPrefix(lease.Name, prefix) {
+			leases = append(leases, lease)
+		}
+	}
+
+	return leases, nil
+}
+
+// Only one process reads and writes the lease at a time, lock files left by a crashed process are
+// removed once they are older than FILE_LOCK_TIMEOUT
+func lockFile(path string) (func(), error) {
+	deadline := time.Now().Add(FILE_LOCK_TIMEOUT)
+
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			file.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > FILE_LOCK_TIMEOUT {
+			os.Remove(path)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for %s", path)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
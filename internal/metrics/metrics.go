@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Operational metrics of the tool itself, these are updated by the packages doing the work
+var (
+	YoutubeRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "black_flag_youtube_requests_total",
+		Help: "Number of calls made to the Youtube Data API.",
+	}, []string{"result"})
+
+	YoutubeQuotaUnits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "black_flag_youtube_quota_units_total",
+		Help: "Youtube Data API quota units spent.",
+	})
+
+	DynamoDBErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "black_flag_dynamodb_errors_total",
+		Help: "Number of failed DynamoDB calls.",
+	}, []string{"operation"})
+
+	Refreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "black_flag_refreshes_total",
+		Help: "Number of processed videos by their status.",
+	}, []string{"status"})
+
+	RefreshDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "black_flag_refresh_duration_seconds",
+		Help:    "Time it took to fetch and save the stats of a video.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"status"})
+
+	ThrottledSkips = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "black_flag_throttled_skips_total",
+		Help: "Number of videos that were skipped because they were refreshed recently.",
+	})
+
+	ShardIndex = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "black_flag_shard_index",
+		Help: "Shard of the videos refreshed by this worker, starting at 1.",
+	})
+
+	ShardCount = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "black_flag_shard_count",
+		Help: "Number of workers the videos are split across, 1 when not sharded.",
+	})
+)
+
+// How long the stats read from the store are reused between scrapes
+var VIDEO_STATS_TTL = 30 * time.Second
+
+// Latest recorded stats of a tracked video
+type VideoStat struct {
+	Id       string
+	Title    string
+	Channel  string
+	Views    int
+	Likes    int
+	Comments int
+}
+
+var (
+	videoViewsDesc = prometheus.NewDesc(
+		"black_flag_video_views",
+		"Latest recorded views of a tracked video.",
+		[]string{"video_id", "title", "channel"}, nil,
+	)
+	videoLikesDesc = prometheus.NewDesc(
+		"black_flag_video_likes",
+		"Latest recorded likes of a tracked video.",
+		[]string{"video_id", "title", "channel"}, nil,
+	)
+	videoCommentsDesc = prometheus.NewDesc(
+		"black_flag_video_comments",
+		"Latest recorded comments of a tracked video.",
+		[]string{"video_id", "title", "channel"}, nil,
+	)
+	videoStatsUpDesc = prometheus.NewDesc(
+		"black_flag_video_stats_up",
+		"Whether the tracked video stats were read from the store on the last scrape.",
+		nil, nil,
+	)
+)
+
+// Publishes the latest stats of every tracked video read from the store
+type videoCollector struct {
+	source func() ([]VideoStat, error)
+
+	mu        sync.Mutex
+	cached    []VideoStat
+	cachedAt  time.Time
+	lastError error
+}
+
+func (c *videoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- videoViewsDesc
+	ch <- videoLikesDesc
+	ch <- videoCommentsDesc
+	ch <- videoStatsUpDesc
+}
+
+func (c *videoCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.stats()
+
+	up := 1.0
+	if err != nil {
+		up = 0
+	}
+	ch <- prometheus.MustNewConstMetric(videoStatsUpDesc, prometheus.GaugeValue, up)
+
+	for _, stat := range stats {
+		ch <- prometheus.MustNewConstMetric(videoViewsDesc, prometheus.GaugeValue, float64(stat.Views), stat.Id, stat.Title, stat.Channel)
+		ch <- prometheus.MustNewConstMetric(videoLikesDesc, prometheus.GaugeValue, float64(stat.Likes), stat.Id, stat.Title, stat.Channel)
+		ch <- prometheus.MustNewConstMetric(videoCommentsDesc, prometheus.GaugeValue, float64(stat.Comments), stat.Id, stat.Title, stat.Channel)
+	}
+}
+
+// Avoids scanning the store on every scrape
+func (c *videoCollector) stats() ([]VideoStat, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.cachedAt) < VIDEO_STATS_TTL {
+		return c.cached, c.lastError
+	}
+
+	stats, err := c.source()
+	if err != nil {
+		c.lastError = err
+		c.cachedAt = time.Now()
+		return c.cached, err
+	}
+
+	c.cached, c.lastError, c.cachedAt = stats, nil, time.Now()
+
+	return stats, nil
+}
+
+var registerOnce sync.Once
+
+// Returns the /metrics handler, the video stats are read through the given source.
+// Only the first source is registered since the collectors are global.
+func Handler(source func() ([]VideoStat, error)) http.Handler {
+	registerOnce.Do(func() {
+		prometheus.MustRegister(&videoCollector{source: source})
+	})
+
+	return promhttp.Handler()
+}
@@ -0,0 +1,98 @@
+package migrate
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Attribute holding the version of the shape of an item, items without one are at version 0
+var VERSION_ATTRIBUTE = "SchemaVersion"
+
+// An item decoded for a migration. Numbers are attributevalue.Number so they are written back exactly.
+type Item = map[string]interface{}
+
+type Migration struct {
+	Version     int
+	Description string
+	// Changes the item in place, the version attribute is taken care of
+	Up func(item Item) error
+}
+
+// Ordered migrations of a table
+type Registry struct {
+	migrations []Migration
+}
+
+// Panics when the versions are not 1, 2, 3... in order since that's a mistake in the code
+func NewRegistry(migrations ...Migration) *Registry {
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			panic(fmt.Sprintf("migration %q has version %d, expected %d", migration.Description, migration.Version, i+1))
+		}
+		if migration.Up == nil {
+			panic(fmt.Sprintf("migration %d has no Up", migration.Version))
+		}
+	}
+
+	return &Registry{migrations: migrations}
+}
+
+// Version every item is at once migrated
+func (r *Registry) Latest() int {
+	return len(r.migrations)
+}
+
+func (r *Registry) Migrations() []Migration {
+	return r.migrations
+}
+
+// Migrations that are still to be applied to an item at the version
+func (r *Registry) Pending(version int) []Migration {
+	if version >= len(r.migrations) || version < 0 {
+		return nil
+	}
+
+	return r.migrations[version:]
+}
+
+// Applies the pending migrations, items that are up to date are returned as is.
+// This is what lets us read items that were not migrated yet.
+func (r *Registry) Upgrade(raw map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	version := VersionOf(raw)
+
+	pending := r.Pending(version)
+	if len(pending) == 0 {
+		return raw, nil
+	}
+
+	item := Item{}
+	err := attributevalue.UnmarshalMapWithOptions(raw, &item, func(o *attributevalue.DecoderOptions) {
+		o.UseNumber = true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, migration := range pending {
+		if err := migration.Up(item); err != nil {
+			return nil, fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Description, err)
+		}
+	}
+	item[VERSION_ATTRIBUTE] = r.Latest()
+
+	return attributevalue.MarshalMap(item)
+}
+
+// Version of a stored item, 0 when it has none
+func VersionOf(raw map[string]types.AttributeValue) int {
+	value, ok := raw[VERSION_ATTRIBUTE].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0
+	}
+
+	version, _ := strconv.Atoi(value.Value)
+	return version
+}
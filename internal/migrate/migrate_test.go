@@ -0,0 +1,248 @@
+package migrate_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	awsdynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb"
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb/ddbtest"
+	"github.com/ricomonster/black-flag/internal/migrate"
+)
+
+var registry = migrate.NewRegistry(
+	migrate.Migration{
+		Version:     1,
+		Description: "Remove Junk",
+		Up: func(item migrate.Item) error {
+			delete(item, "Junk")
+			return nil
+		},
+	},
+	migrate.Migration{
+		Version:     2,
+		Description: "Copy the channel id to the top",
+		Up: func(item migrate.Item) error {
+			if channel, ok := item["Channel"].(map[string]interface{}); ok {
+				item["ChannelId"] = channel["Id"]
+			}
+			return nil
+		},
+	},
+)
+
+// The items are only read and written raw
+var keys = dynamodb.KeySchema{Partition: dynamodb.KeyAttribute{Name: "Id", Type: types.ScalarAttributeTypeS}}
+
+func seed(t *testing.T, fake *ddbtest.Fake, items ...map[string]interface{}) {
+	for _, item := range items {
+		raw, err := attributevalue.MarshalMap(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := fake.PutItem(context.Background(), &awsdynamodb.PutItemInput{TableName: aws.String("Test"), Item: raw}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	raw, _ := attributevalue.MarshalMap(map[string]interface{}{
+		"Id":      "a",
+		"Junk":    "x",
+		"Views":   int64(9007199254740993),
+		"Channel": map[string]interface{}{"Id": "UC1"},
+	})
+
+	upgraded, err := registry.Upgrade(raw)
+	if err != nil {
+		t.Fatalf("TestUpgrade: Error %v", err)
+	}
+
+	if migrate.VersionOf(upgraded) != 2 {
+		t.Errorf("TestUpgrade: expected version 2, got %d", migrate.VersionOf(upgraded))
+	}
+	if _, ok := upgraded["Junk"]; ok {
+		t.Errorf("TestUpgrade: expected Junk to be removed")
+	}
+	if channelId, ok := upgraded["ChannelId"].(*types.AttributeValueMemberS); !ok || channelId.Value != "UC1" {
+		t.Errorf("TestUpgrade: expected the channel id, got %v", upgraded["ChannelId"])
+	}
+	// Numbers are kept exactly
+	if views := upgraded["Views"].(*types.AttributeValueMemberN).Value; views != "9007199254740993" {
+		t.Errorf("TestUpgrade: expected the views to be kept exactly, got %s", views)
+	}
+
+	// Up to date items are left alone
+	again, _ := registry.Upgrade(upgraded)
+	if fmt.Sprint(again) != fmt.Sprint(upgraded) {
+		t.Errorf("TestUpgrade: expected an up to date item to be returned as is")
+	}
+}
+
+func TestRun(t *testing.T) {
+	fake := ddbtest.New("Test")
+	store, _ := dynamodb.NewDynamoDB[struct{}]("Test", dynamodb.WithClient(fake), dynamodb.WithKeySchema(keys))
+
+	seed(t, fake,
+		map[string]interface{}{"Id": "a", "Junk": "x"},
+		map[string]interface{}{"Id": "b", "SchemaVersion": 1, "Channel": map[string]interface{}{"Id": "UC1"}},
+		map[string]interface{}{"Id": "c", "SchemaVersion": 2},
+		map[string]interface{}{"Id": "d"},
+		map[string]interface{}{"Id": "e"},
+	)
+
+	// The first batch goes through and the second scan fails
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	checkpoint, _ := migrate.LoadCheckpoint(path)
+	fake.FailNext("Scan", nil)
+	fake.FailNext("Scan", fmt.Errorf("interrupted"))
+
+	_, err := migrate.Run(store, registry, migrate.Options{BatchSize: 2, Checkpoint: checkpoint})
+	if err == nil {
+		t.Fatalf("TestRun: expected the run to be interrupted")
+	}
+
+	status, _ := migrate.Status(store, 0)
+	if status[2] != 3 || status[0] != 2 {
+		t.Errorf("TestRun: expected the first batch to be migrated, got %v", status)
+	}
+
+	// Continues from the checkpoint
+	checkpoint, _ = migrate.LoadCheckpoint(path)
+	if checkpoint.Start() == nil {
+		t.Fatalf("TestRun: expected a checkpoint")
+	}
+
+	result, err := migrate.Run(store, registry, migrate.Options{BatchSize: 2, Checkpoint: checkpoint})
+	if err != nil {
+		t.Fatalf("TestRun: Error %v", err)
+	}
+	if result.Scanned != 5 || result.Migrated != 4 || result.UpToDate != 1 {
+		t.Errorf("TestRun: got %+v", result)
+	}
+
+	status, _ = migrate.Status(store, 0)
+	if len(status) != 1 || status[2] != 5 {
+		t.Errorf("TestRun: expected every item at version 2, got %v", status)
+	}
+
+	// The checkpoint is gone once done
+	checkpoint, _ = migrate.LoadCheckpoint(path)
+	if checkpoint.Start() != nil {
+		t.Errorf("TestRun: expected the checkpoint to be cleared")
+	}
+}
+
+func TestRunExclusive(t *testing.T) {
+	fake := ddbtest.New("Test")
+	store, _ := dynamodb.NewDynamoDB[struct{}]("Test", dynamodb.WithClient(fake), dynamodb.WithKeySchema(keys))
+
+	seed(t, fake,
+		map[string]interface{}{"Id": "a", "Junk": "x"},
+		map[string]interface{}{"Id": "b", "SchemaVersion": 2},
+		map[string]interface{}{"Id": "c"},
+	)
+
+	result, err := migrate.Run(store, registry, migrate.Options{Exclusive: true})
+	if err != nil {
+		t.Fatalf("TestRunExclusive: Error %v", err)
+	}
+	if result.Migrated != 2 || result.UpToDate != 1 {
+		t.Errorf("TestRunExclusive: got %+v", result)
+	}
+
+	// Written in a single batch
+	if fake.Calls("BatchWriteItem") != 1 || fake.Calls("PutItem") != 3 {
+		t.Errorf("TestRunExclusive: expected one batch write, got %d and %d puts", fake.Calls("BatchWriteItem"), fake.Calls("PutItem"))
+	}
+
+	status, _ := migrate.Status(store, 0)
+	if len(status) != 1 || status[2] != 3 {
+		t.Errorf("TestRunExclusive: expected every item at version 2, got %v", status)
+	}
+}
+
+type versionedItem struct {
+	Id      string `dynamodbav:"Id" dynamodbkey:"partition"`
+	Version int64  `dynamodbav:"Version" dynamodbversion:"true"`
+}
+
+// Runs race right before the first upgraded item is written, like a refresh landing between the scan and the put
+type racingStore struct {
+	*dynamodb.DynamoDB[versionedItem]
+	race func()
+}
+
+func (s *racingStore) PutRaw(item map[string]types.AttributeValue, condition *expression.ConditionBuilder) error {
+	if s.race != nil {
+		s.race()
+		s.race = nil
+	}
+
+	return s.DynamoDB.PutRaw(item, condition)
+}
+
+func TestRunConcurrentWrite(t *testing.T) {
+	fake := ddbtest.New("Test")
+	ddb, _ := dynamodb.NewDynamoDB[versionedItem]("Test", dynamodb.WithClient(fake))
+
+	seed(t, fake,
+		map[string]interface{}{"Id": "a", "Junk": "x", "Version": 3},
+		map[string]interface{}{"Id": "b", "Junk": "x"},
+	)
+
+	// A sample is appended to a after it was scanned, only the version changes
+	store := &racingStore{DynamoDB: ddb, race: func() {
+		_, err := ddb.UpdateItem(dynamodb.Key{Partition: "a"}, dynamodb.NewUpdate().Append("Samples", []int{1}))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}}
+
+	result, err := migrate.Run(store, registry, migrate.Options{BatchSize: 1})
+	if err != nil {
+		t.Fatalf("TestRunConcurrentWrite: Error %v", err)
+	}
+	if result.Conflicts != 1 || result.Migrated != 1 {
+		t.Errorf("TestRunConcurrentWrite: expected a conflict, got %+v", result)
+	}
+
+	items := map[string]map[string]types.AttributeValue{}
+	for _, item := range fake.Items("Test") {
+		items[item["Id"].(*types.AttributeValueMemberS).Value] = item
+	}
+
+	if _, ok := items["a"]["Samples"]; !ok {
+		t.Errorf("TestRunConcurrentWrite: the appended sample was overwritten %v", items["a"])
+	}
+	if version := items["b"]["Version"].(*types.AttributeValueMemberN).Value; version != "1" {
+		t.Errorf("TestRunConcurrentWrite: expected the migrated item to be at version 1, got %s", version)
+	}
+
+	// The next run migrates it with the sample
+	result, err = migrate.Run(store, registry, migrate.Options{})
+	if err != nil || result.Migrated != 1 || result.Conflicts != 0 {
+		t.Fatalf("TestRunConcurrentWrite: unexpected second run %+v %v", result, err)
+	}
+
+	for _, item := range fake.Items("Test") {
+		if item["Id"].(*types.AttributeValueMemberS).Value != "a" {
+			continue
+		}
+
+		if _, ok := item["Samples"]; !ok || migrate.VersionOf(item) != 2 {
+			t.Errorf("TestRunConcurrentWrite: unexpected migrated item %v", item)
+		}
+		if version := item["Version"].(*types.AttributeValueMemberN).Value; version != "5" {
+			t.Errorf("TestRunConcurrentWrite: expected the version to be incremented, got %s", version)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package migrate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb"
+)
+
+var DEFAULT_BATCH_SIZE int32 = 100
+
+// The table being migrated, satisfied by *dynamodb.DynamoDB
+type Store interface {
+	ScanRaw(start map[string]types.AttributeValue, limit int32) ([]map[string]types.AttributeValue, map[string]types.AttributeValue, error)
+	PutRaw(item map[string]types.AttributeValue, condition *expression.ConditionBuilder) error
+	BatchPutRaw(items []map[string]types.AttributeValue) error
+	// Attribute every write of an item increments, empty when the items are not versioned
+	VersionAttribute() string
+}
+
+type Options struct {
+	BatchSize int32
+	DryRun    bool
+	// Nobody else writes the table while we migrate, so every batch is written at once without checking
+	// the version of the items
+	Exclusive bool
+	// Where the run continues from and is saved to after every batch, nil to always start over
+	Checkpoint *Checkpoint
+	// Called after every batch
+	Progress func(Result)
+}
+
+type Result struct {
+	Scanned  int
+	Migrated int
+	UpToDate int
+	// Items that were changed while we migrated them, they are upgraded again on the next run
+	Conflicts int
+}
+
+// Upgrades every item of the table that is behind, one batch at a time
+func Run(store Store, registry *Registry, options Options) (Result, error) {
+	var result Result
+
+	if options.BatchSize <= 0 {
+		options.BatchSize = DEFAULT_BATCH_SIZE
+	}
+
+	lock := store.VersionAttribute()
+
+	var start map[string]types.AttributeValue
+	if options.Checkpoint != nil {
+		start = options.Checkpoint.Start()
+		result = options.Checkpoint.Result
+	}
+
+	for {
+		items, next, err := store.ScanRaw(start, options.BatchSize)
+		if err != nil {
+			return result, err
+		}
+
+		var upgradedItems []map[string]types.AttributeValue
+		for _, item := range items {
+			result.Scanned++
+
+			version := VersionOf(item)
+			if len(registry.Pending(version)) == 0 {
+				result.UpToDate++
+				continue
+			}
+
+			upgraded, err := registry.Upgrade(item)
+			if err != nil {
+				return result, err
+			}
+
+			// Anyone who read the item before the migration has to read it again before writing it
+			written, hasVersion := itemVersion(item, lock)
+			if lock != "" {
+				upgraded[lock] = &types.AttributeValueMemberN{Value: strconv.FormatInt(written+1, 10)}
+			}
+
+			if options.DryRun {
+				result.Migrated++
+				continue
+			}
+
+			if options.Exclusive {
+				upgradedItems = append(upgradedItems, upgraded)
+				continue
+			}
+
+			// Only replace the item if nobody wrote it since we read it
+			err = store.PutRaw(upgraded, writeCondition(version, lock, written, hasVersion))
+			if errors.Is(err, dynamodb.ErrConditionFailed) {
+				result.Conflicts++
+				continue
+			}
+			if err != nil {
+				return result, err
+			}
+
+			result.Migrated++
+		}
+
+		// A failed item stops the run before the checkpoint so the batch is migrated again
+		if len(upgradedItems) > 0 {
+			if err := store.BatchPutRaw(upgradedItems); err != nil {
+				return result, err
+			}
+
+			result.Migrated += len(upgradedItems)
+		}
+
+		if options.Checkpoint != nil && !options.DryRun {
+			if err := options.Checkpoint.Save(next, result); err != nil {
+				return result, err
+			}
+		}
+
+		if options.Progress != nil {
+			options.Progress(result)
+		}
+
+		if next == nil {
+			break
+		}
+		start = next
+	}
+
+	// Done, the next run starts from the beginning
+	if options.Checkpoint != nil && !options.DryRun {
+		return result, options.Checkpoint.Clear()
+	}
+
+	return result, nil
+}
+
+// The schema version alone doesn't change when samples are appended, the version of versioned items
+// changes on every write
+func writeCondition(version int, lock string, written int64, hasVersion bool) *expression.ConditionBuilder {
+	condition := expression.Name(VERSION_ATTRIBUTE).Equal(expression.Value(version))
+	if version == 0 {
+		condition = expression.Name(VERSION_ATTRIBUTE).AttributeNotExists().Or(condition)
+	}
+
+	if lock == "" {
+		return &condition
+	}
+
+	unchanged := expression.Name(lock).AttributeNotExists()
+	if hasVersion {
+		unchanged = expression.Name(lock).Equal(expression.Value(written))
+	}
+	condition = condition.And(unchanged)
+
+	return &condition
+}
+
+// Version of the item as written by the wrapper, see dynamodb.VERSION_TAG
+func itemVersion(item map[string]types.AttributeValue, attribute string) (int64, bool) {
+	value, ok := item[attribute].(*types.AttributeValueMemberN)
+	if attribute == "" || !ok {
+		return 0, false
+	}
+
+	version, err := strconv.ParseInt(value.Value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return version, true
+}
+
+// Number of items at every version
+func Status(store Store, batchSize int32) (map[int]int, error) {
+	if batchSize <= 0 {
+		batchSize = DEFAULT_BATCH_SIZE
+	}
+
+	versions := map[int]int{}
+
+	var start map[string]types.AttributeValue
+	for {
+		items, next, err := store.ScanRaw(start, batchSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			versions[VersionOf(item)]++
+		}
+
+		if next == nil {
+			return versions, nil
+		}
+		start = next
+	}
+}
+
+// Remembers how far a migration got so an interrupted run continues where it stopped
+type Checkpoint struct {
+	LastKey   map[string]keyValue `json:"last_key"`
+	Result    Result              `json:"result"`
+	UpdatedAt time.Time           `json:"updated_at"`
+
+	path string
+}
+
+// Keys are strings or numbers, this keeps the type through JSON
+type keyValue struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Loads the checkpoint from the file, a missing file starts from the beginning
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{path: path}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, checkpoint); err != nil {
+		return nil, err
+	}
+
+	return checkpoint, nil
+}
+
+// Key to continue the scan from, nil to start from the beginning
+func (c *Checkpoint) Start() map[string]types.AttributeValue {
+	if len(c.LastKey) == 0 {
+		return nil
+	}
+
+	key := map[string]types.AttributeValue{}
+	for name, value := range c.LastKey {
+		if value.Type == "N" {
+			key[name] = &types.AttributeValueMemberN{Value: value.Value}
+		} else {
+			key[name] = &types.AttributeValueMemberS{Value: value.Value}
+		}
+	}
+
+	return key
+}
+
+// Writes the checkpoint next to the file first so a crash never leaves half a checkpoint behind
+func (c *Checkpoint) Save(lastKey map[string]types.AttributeValue, result Result) error {
+	c.LastKey = map[string]keyValue{}
+	for name, value := range lastKey {
+		switch v := value.(type) {
+		case *types.AttributeValueMemberS:
+			c.LastKey[name] = keyValue{Type: "S", Value: v.Value}
+		case *types.AttributeValueMemberN:
+			c.LastKey[name] = keyValue{Type: "N", Value: v.Value}
+		default:
+			return fmt.Errorf("unsupported key attribute %s", name)
+		}
+	}
+	c.Result = result
+	c.UpdatedAt = time.Now()
+
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, c.path)
+}
+
+func (c *Checkpoint) Clear() error {
+	c.LastKey = nil
+	c.Result = Result{}
+
+	err := os.Remove(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,27 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Prints the message, useful to try out the rules before wiring a real notifier
+type Log struct {
+	name string
+	out  io.Writer
+}
+
+func NewLog(config Config) *Log {
+	return &Log{name: config.Name, out: os.Stdout}
+}
+
+func (l *Log) Name() string {
+	return l.name
+}
+
+func (l *Log) Notify(_ context.Context, message Message) error {
+	_, err := fmt.Fprintf(l.out, "[%s] %s\n%s\n", l.name, message.Title, message.Text)
+	return err
+}
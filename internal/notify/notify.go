@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+)
+
+type Message struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+	// Structured payload for the notifiers that can make use of it, e.g. the generic webhook
+	Data any `json:"data,omitempty"`
+}
+
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, message Message) error
+}
+
+// How a notifier is declared in the config file:
+//
+//	notifiers:
+//	  - name: team
+//	    type: slack
+//	    url: https://hooks.slack.com/services/...
+type Config struct {
+	Name string `mapstructure:"name"`
+	// webhook, slack, smtp or log
+	Type string `mapstructure:"type"`
+
+	// webhook and slack
+	Url     string            `mapstructure:"url"`
+	Headers map[string]string `mapstructure:"headers"`
+
+	// smtp
+	Host     string   `mapstructure:"host"`
+	Port     int      `mapstructure:"port"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+}
+
+// Builds the notifiers keyed by their name
+func NewNotifiers(configs []Config) (map[string]Notifier, error) {
+	notifiers := map[string]Notifier{}
+
+	for _, config := range configs {
+		if config.Name == "" {
+			config.Name = config.Type
+		}
+
+		if _, ok := notifiers[config.Name]; ok {
+			return nil, fmt.Errorf("notifier %q is declared more than once", config.Name)
+		}
+
+		notifier, err := NewNotifier(config)
+		if err != nil {
+			return nil, err
+		}
+
+		notifiers[config.Name] = notifier
+	}
+
+	return notifiers, nil
+}
+
+func NewNotifier(config Config) (Notifier, error) {
+	switch config.Type {
+	case "webhook":
+		return NewWebhook(config)
+	case "slack":
+		return NewSlack(config)
+	case "smtp", "email":
+		return NewSMTP(config)
+	case "log", "stdout":
+		return NewLog(config), nil
+	default:
+		return nil, fmt.Errorf("notifier %q has an unknown type %q", config.Name, config.Type)
+	}
+}
@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sends the message as a plain text email
+type SMTP struct {
+	name     string
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func NewSMTP(config Config) (*SMTP, error) {
+	if config.Host == "" || config.From == "" || len(config.To) == 0 {
+		return nil, fmt.Errorf("notifier %q requires a host, from and to", config.Name)
+	}
+
+	port := config.Port
+	if port == 0 {
+		port = 587
+	}
+
+	return &SMTP{
+		name:     config.Name,
+		addr:     net.JoinHostPort(config.Host, strconv.Itoa(port)),
+		host:     config.Host,
+		username: config.Username,
+		password: config.Password,
+		from:     config.From,
+		to:       config.To,
+	}, nil
+}
+
+func (s *SMTP) Name() string {
+	return s.name
+}
+
+func (s *SMTP) Notify(ctx context.Context, message Message) error {
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+
+	// net/smtp doesn't take a context so we at least respect the cancellation before sending
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return smtp.SendMail(s.addr, auth, s.from, s.to, s.build(message))
+}
+
+func (s *SMTP) build(message Message) []byte {
+	var b strings.Builder
+
+	b.WriteString("From: " + s.from + "\r\n")
+	b.WriteString("To: " + strings.Join(s.to, ", ") + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", message.Title) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(message.Text, "\n", "\r\n"))
+	b.WriteString("\r\n")
+
+	return []byte(b.String())
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Posts the message as JSON to any URL
+type Webhook struct {
+	name    string
+	url     string
+	headers map[string]string
+}
+
+func NewWebhook(config Config) (*Webhook, error) {
+	if config.Url == "" {
+		return nil, fmt.Errorf("notifier %q requires a url", config.Name)
+	}
+
+	return &Webhook{name: config.Name, url: config.Url, headers: config.Headers}, nil
+}
+
+func (w *Webhook) Name() string {
+	return w.name
+}
+
+func (w *Webhook) Notify(ctx context.Context, message Message) error {
+	return postJSON(ctx, w.url, w.headers, message)
+}
+
+// Posts to a Slack compatible incoming webhook (Slack, Mattermost, Rocket.Chat...)
+type Slack struct {
+	name string
+	url  string
+}
+
+func NewSlack(config Config) (*Slack, error) {
+	if config.Url == "" {
+		return nil, fmt.Errorf("notifier %q requires a url", config.Name)
+	}
+
+	return &Slack{name: config.Name, url: config.Url}, nil
+}
+
+func (s *Slack) Name() string {
+	return s.name
+}
+
+func (s *Slack) Notify(ctx context.Context, message Message) error {
+	return postJSON(ctx, s.url, nil, map[string]string{
+		"text": fmt.Sprintf("*%s*\n%s", message.Title, message.Text),
+	})
+}
+
+func postJSON(ctx context.Context, url string, headers map[string]string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		response, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("webhook responded with %s: %s", res.Status, bytes.TrimSpace(response))
+	}
+
+	return nil
+}
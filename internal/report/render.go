@@ -0,0 +1,191 @@
+package report
+
+import (
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/series"
+)
+
+type Format string
+
+var (
+	FORMAT_MARKDOWN Format = "markdown"
+	FORMAT_HTML     Format = "html"
+	FORMAT_TEXT     Format = "text"
+)
+
+var FORMATS = []Format{FORMAT_MARKDOWN, FORMAT_HTML, FORMAT_TEXT}
+
+//go:embed templates
+var templates embed.FS
+
+var templateFiles = map[Format]string{
+	FORMAT_MARKDOWN: "templates/report.md.tmpl",
+	FORMAT_HTML:     "templates/report.html.tmpl",
+	FORMAT_TEXT:     "templates/report.txt.tmpl",
+}
+
+// Executes either the built in template of the format or a custom one
+type executor interface {
+	Execute(w io.Writer, data any) error
+}
+
+var funcs = map[string]any{
+	"number":  formatNumber,
+	"gain":    formatGain,
+	"date":    formatDate,
+	"inc":     func(i int) int { return i + 1 },
+	"score":   func(score float64) string { return fmt.Sprintf("%.1f", score) },
+	"partial": func(partial bool) string { return map[bool]string{true: "*", false: ""}[partial] },
+}
+
+// Functions that return markup, only available to the HTML templates
+var htmlFuncs = map[string]any{
+	"sparkline":   sparkline,
+	"channelBars": channelBars,
+}
+
+func ValidateFormat(format Format) error {
+	for _, known := range FORMATS {
+		if format == known {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown format %q, expected one of %v", format, FORMATS)
+}
+
+// Renders the report with the template of the format, or with the template at the given path
+func Render(w io.Writer, report Report, format Format, templatePath string) error {
+	if err := ValidateFormat(format); err != nil {
+		return err
+	}
+
+	name, content := templateFiles[format], []byte(nil)
+	if templatePath != "" {
+		custom, err := os.ReadFile(templatePath)
+		if err != nil {
+			return err
+		}
+		name, content = templatePath, custom
+	} else {
+		builtIn, err := templates.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		content = builtIn
+	}
+
+	tmpl, err := parse(filepath.Base(name), string(content), format)
+	if err != nil {
+		return err
+	}
+
+	return tmpl.Execute(w, report)
+}
+
+func parse(name, content string, format Format) (executor, error) {
+	if format == FORMAT_HTML {
+		return htmltemplate.New(name).Funcs(funcs).Funcs(htmlFuncs).Parse(content)
+	}
+
+	return texttemplate.New(name).Funcs(funcs).Parse(content)
+}
+
+func formatNumber(value int) string {
+	digits := fmt.Sprintf("%d", value)
+	if value < 0 {
+		return "-" + formatNumber(-value)
+	}
+
+	var b strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteRune(',')
+		}
+		b.WriteRune(digit)
+	}
+
+	return b.String()
+}
+
+func formatGain(value int) string {
+	if value < 0 {
+		return formatNumber(value)
+	}
+
+	return "+" + formatNumber(value)
+}
+
+func formatDate(t time.Time) string {
+	return t.Local().Format("Jan 2, 2006 15:04")
+}
+
+// Small inline chart of the views of a video during the period
+func sparkline(history series.Series) htmltemplate.HTML {
+	const width, height = 120, 24
+
+	if len(history) < 2 {
+		return ""
+	}
+
+	first, last := history[0], history[len(history)-1]
+	low, high := first.Value, last.Value
+	for _, point := range history {
+		low, high = min(low, point.Value), max(high, point.Value)
+	}
+	if high == low {
+		high = low + 1
+	}
+
+	var points []string
+	for _, point := range history {
+		x := float64(point.Timestamp-first.Timestamp) / float64(max(last.Timestamp-first.Timestamp, 1)) * width
+		y := height - (point.Value-low)/(high-low)*height
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+
+	return htmltemplate.HTML(fmt.Sprintf(
+		`<svg width="%d" height="%d" viewBox="0 0 %d %d"><polyline fill="none" stroke="#e4572e" stroke-width="1.5" points="%s"/></svg>`,
+		width, height, width, height, strings.Join(points, " "),
+	))
+}
+
+// Horizontal bars of the views each channel gained during the period
+func channelBars(channels []ChannelRow) htmltemplate.HTML {
+	const width, barHeight, labelWidth = 560, 18, 180
+
+	if len(channels) == 0 {
+		return ""
+	}
+
+	highest := 1
+	for _, channel := range channels {
+		highest = max(highest, channel.Gain)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`,
+		width, len(channels)*(barHeight+4), width, len(channels)*(barHeight+4))
+
+	for i, channel := range channels {
+		y := i * (barHeight + 4)
+		bar := float64(max(channel.Gain, 0)) / float64(highest) * (width - labelWidth - 80)
+
+		fmt.Fprintf(&b, `<text x="0" y="%d">%s</text>`, y+13, htmltemplate.HTMLEscapeString(channel.Title))
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%.1f" height="%d" fill="#2e86ab"/>`, labelWidth, y, bar, barHeight)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d">%s</text>`, float64(labelWidth)+bar+4, y+13, formatGain(channel.Gain))
+	}
+
+	b.WriteString(`</svg>`)
+
+	return htmltemplate.HTML(b.String())
+}
@@ -0,0 +1,217 @@
+package report
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/anomaly"
+	"github.com/ricomonster/black-flag/internal/leaderboard"
+	"github.com/ricomonster/black-flag/internal/series"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+var PERIODS = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+}
+
+// View counts worth celebrating
+var MILESTONES = []float64{1e3, 1e4, 1e5, 5e5, 1e6, 5e6, 1e7, 5e7, 1e8, 5e8, 1e9}
+
+var DEFAULT_TOP = 10
+
+type VideoRow struct {
+	Id      string `json:"id"`
+	Title   string `json:"title"`
+	Channel string `json:"channel"`
+	Url     string `json:"url"`
+	Views   int    `json:"views"`
+	Gain    int    `json:"gain"`
+	// The history doesn't cover the whole period
+	Partial bool `json:"partial"`
+	// Views during the period, used for the charts
+	History series.Series `json:"-"`
+}
+
+type MilestoneRow struct {
+	Video     VideoRow  `json:"video"`
+	Milestone int       `json:"milestone"`
+	At        time.Time `json:"at"`
+}
+
+type AnomalyRow struct {
+	Video    VideoRow  `json:"video"`
+	At       time.Time `json:"at"`
+	Kind     string    `json:"kind"`
+	Rate     int       `json:"rate"`
+	Baseline int       `json:"baseline"`
+	Score    float64   `json:"score"`
+}
+
+type ChannelRow struct {
+	Id         string `json:"id"`
+	Title      string `json:"title"`
+	Videos     int    `json:"videos"`
+	TotalViews int    `json:"total_views"`
+	Gain       int    `json:"gain"`
+}
+
+type Report struct {
+	Title       string         `json:"title"`
+	Period      string         `json:"period"`
+	From        time.Time      `json:"from"`
+	To          time.Time      `json:"to"`
+	TopGainers  []VideoRow     `json:"top_gainers"`
+	Milestones  []MilestoneRow `json:"milestones"`
+	Anomalies   []AnomalyRow   `json:"anomalies"`
+	NewVideos   []VideoRow     `json:"new_videos"`
+	Unavailable []VideoRow     `json:"unavailable"`
+	Channels    []ChannelRow   `json:"channels"`
+	TotalViews  int            `json:"total_views"`
+	TotalGain   int            `json:"total_gain"`
+}
+
+type Options struct {
+	// Number of top gainers
+	Top int
+}
+
+func ParsePeriod(value string) (time.Duration, error) {
+	if period, ok := PERIODS[strings.ToLower(value)]; ok {
+		return period, nil
+	}
+
+	return 0, fmt.Errorf("unknown period %q, expected day, week or month", value)
+}
+
+// Builds the digest of what happened to the videos in the period ending now
+func Build(items []videos.VideoDdbAttributes, name string, period time.Duration, now time.Time, options Options) Report {
+	if options.Top <= 0 {
+		options.Top = DEFAULT_TOP
+	}
+
+	from := now.Add(-period)
+
+	report := Report{
+		Title:  fmt.Sprintf("Black Flag %s report", periodTitle(name)),
+		Period: name,
+		From:   from,
+		To:     now,
+	}
+
+	rows := map[string]VideoRow{}
+	for _, entry := range leaderboard.Videos(items, period, now) {
+		row := newVideoRow(entry.Video, from)
+		row.Gain = int(entry.Gain)
+		row.Partial = entry.Partial
+		rows[row.Id] = row
+
+		report.TotalViews += row.Views
+		report.TotalGain += row.Gain
+
+		if len(report.TopGainers) < options.Top && row.Gain > 0 {
+			report.TopGainers = append(report.TopGainers, row)
+		}
+	}
+
+	for _, item := range items {
+		row := rows[item.Id]
+
+		report.Milestones = append(report.Milestones, milestones(item, row, from, now)...)
+
+		for _, a := range anomaly.Detect(item, anomaly.Options{}) {
+			if a.Timestamp < from.Unix() {
+				continue
+			}
+
+			report.Anomalies = append(report.Anomalies, AnomalyRow{
+				Video:    row,
+				At:       time.Unix(a.Timestamp, 0),
+				Kind:     string(a.Kind),
+				Rate:     int(a.Rate),
+				Baseline: int(a.Baseline),
+				Score:    a.Score,
+			})
+		}
+
+		if item.Created >= from.Unix() {
+			report.NewVideos = append(report.NewVideos, row)
+		}
+
+		if item.Unavailable() {
+			report.Unavailable = append(report.Unavailable, row)
+		}
+	}
+
+	sort.Slice(report.Milestones, func(i, j int) bool {
+		return report.Milestones[i].At.After(report.Milestones[j].At)
+	})
+
+	sort.Slice(report.Anomalies, func(i, j int) bool {
+		return report.Anomalies[i].At.After(report.Anomalies[j].At)
+	})
+
+	for _, entry := range leaderboard.Channels(items, period, now) {
+		report.Channels = append(report.Channels, ChannelRow{
+			Id:         entry.Channel.Id,
+			Title:      entry.Channel.Title,
+			Videos:     entry.Videos,
+			TotalViews: entry.Views,
+			Gain:       int(entry.Gain),
+		})
+	}
+
+	return report
+}
+
+func newVideoRow(video videos.VideoDdbAttributes, from time.Time) VideoRow {
+	return VideoRow{
+		Id:      video.Id,
+		Title:   video.Title,
+		Channel: video.Channel.Title,
+		Url:     "https://www.youtube.com/watch?v=" + video.Id,
+		Views:   videos.LatestViews(video),
+		History: series.Views(video.ViewLogs).Since(from.Unix()),
+	}
+}
+
+// Milestones the video crossed in the period, only the ones we saw it cross
+func milestones(video videos.VideoDdbAttributes, row VideoRow, from, to time.Time) []MilestoneRow {
+	views := series.Views(video.ViewLogs)
+	if len(views) < 2 {
+		return nil
+	}
+
+	var rows []MilestoneRow
+	for _, milestone := range MILESTONES {
+		for i := 1; i < len(views); i++ {
+			if views[i-1].Value >= milestone || views[i].Value < milestone {
+				continue
+			}
+
+			at := time.Unix(views[i].Timestamp, 0)
+			if !at.Before(from) && !at.After(to) {
+				rows = append(rows, MilestoneRow{Video: row, Milestone: int(milestone), At: at})
+			}
+			break
+		}
+	}
+
+	return rows
+}
+
+func periodTitle(name string) string {
+	switch name {
+	case "day":
+		return "daily"
+	case "week":
+		return "weekly"
+	case "month":
+		return "monthly"
+	default:
+		return name
+	}
+}
@@ -0,0 +1,74 @@
+package report_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/report"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+func TestBuildAndRender(t *testing.T) {
+	now := time.Date(2023, 1, 10, 12, 0, 0, 0, time.UTC)
+	at := func(hoursAgo int) int64 {
+		return now.Add(-time.Duration(hoursAgo) * time.Hour).Unix()
+	}
+
+	items := []videos.VideoDdbAttributes{
+		{
+			Id:             "million",
+			Title:          "Crossed a million",
+			Channel:        videos.VideoChannelAttributes{Id: "a", Title: "Channel A"},
+			Created:        at(24 * 30),
+			LastActivityAt: at(0),
+			ViewLogs: []videos.VideoViewAttributes{
+				{Views: 900000, Timestamp: at(24 * 10)},
+				{Views: 990000, Timestamp: at(24 * 3)},
+				{Views: 1020000, Timestamp: at(0)},
+			},
+		},
+		{
+			Id:             "gone",
+			Title:          "Made private",
+			Channel:        videos.VideoChannelAttributes{Id: "b", Title: "Channel B"},
+			Created:        at(24),
+			LastActivityAt: at(24),
+			UnavailableAt:  at(1),
+			ViewLogs: []videos.VideoViewAttributes{
+				{Views: 10, Timestamp: at(24)},
+			},
+		},
+	}
+
+	digest := report.Build(items, "week", 7*24*time.Hour, now, report.Options{})
+
+	if len(digest.TopGainers) != 1 || digest.TopGainers[0].Id != "million" {
+		t.Errorf("TestBuildAndRender: expected million to be the only gainer, got %+v", digest.TopGainers)
+	}
+
+	if len(digest.Milestones) != 1 || digest.Milestones[0].Milestone != 1000000 {
+		t.Errorf("TestBuildAndRender: expected the 1M milestone, got %+v", digest.Milestones)
+	}
+
+	if len(digest.NewVideos) != 1 || digest.NewVideos[0].Id != "gone" {
+		t.Errorf("TestBuildAndRender: expected gone to be new, got %+v", digest.NewVideos)
+	}
+
+	if len(digest.Unavailable) != 1 || digest.Unavailable[0].Id != "gone" {
+		t.Errorf("TestBuildAndRender: expected gone to be unavailable, got %+v", digest.Unavailable)
+	}
+
+	for _, format := range report.FORMATS {
+		var b bytes.Buffer
+		if err := report.Render(&b, digest, format, ""); err != nil {
+			t.Errorf("TestBuildAndRender: unable to render %s, %v", format, err)
+			continue
+		}
+
+		if !strings.Contains(b.String(), "1,000,000") {
+			t.Errorf("TestBuildAndRender: expected the %s report to mention the milestone", format)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/metrics"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+// The parts of the video lib that the scheduler needs
+type VideoLib interface {
+	GetDueVideos(until time.Time) ([]videos.VideoDdbAttributes, error)
+	ProcessVideoStat(video string, options videos.ProcessVideoStatOptions) (videos.ProcessVideoStatResult, error)
+	Schedule() videos.Schedule
+}
+
+// Splits the videos between the workers, see the shard package
+type Shard interface {
+	Owns(video string) bool
+	// Index of the worker starting at 1 and the number of workers
+	Position() (int, int)
+}
+
+type Options struct {
+	// Longest time the scheduler sleeps before checking the store again.
+	// This is also how fast newly added videos gets picked up.
+	Tick time.Duration
+	// How many videos are refreshed at the same time
+	Workers int
+	// Only the videos of the shard are refreshed, all of them when nil
+	Shard  Shard
+	Logger *slog.Logger
+}
+
+type Scheduler struct {
+	videoLib VideoLib
+	tick     time.Duration
+	workers  int
+	shard    Shard
+	logger   *slog.Logger
+
+	// Videos that failed to refresh are not retried until their next interval
+	retryAt map[string]time.Time
+}
+
+func NewScheduler(videoLib VideoLib, options Options) *Scheduler {
+	if options.Tick <= 0 {
+		options.Tick = time.Minute
+	}
+
+	if options.Workers <= 0 {
+		options.Workers = 1
+	}
+
+	if options.Logger == nil {
+		options.Logger = slog.Default()
+	}
+
+	return &Scheduler{
+		videoLib: videoLib,
+		tick:     options.Tick,
+		workers:  options.Workers,
+		shard:    options.Shard,
+		logger:   options.Logger,
+		retryAt:  map[string]time.Time{},
+	}
+}
+
+// Keeps on refreshing the videos that are due until the context is cancelled.
+// Refreshes that are already running when that happens are allowed to finish so we don't lose a sample.
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.logger.Info("scheduler started", "tick", s.tick, "workers", s.workers, "shard", s.describeShard())
+
+	for {
+		next := s.RunOnce(ctx)
+
+		// Sleep until the next video is due but make sure we still check the store every tick
+		wait := time.Until(next)
+		if wait > s.tick {
+			wait = s.tick
+		}
+		if wait < time.Second {
+			wait = time.Second
+		}
+
+		s.logger.Debug("scheduler sleeping", "wait", wait.Round(time.Second))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.logger.Info("scheduler stopped")
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// Refreshes all the videos that are currently due and returns when the next one will be due
+func (s *Scheduler) RunOnce(ctx context.Context) time.Time {
+	now := time.Now()
+	next := now.Add(s.tick)
+
+	// Only the videos that are due before the next tick, the rest doesn't change when we wake up
+	allVideos, err := s.videoLib.GetDueVideos(next)
+	if err != nil {
+		s.logger.Error("failed to fetch videos", "error", err)
+		return next
+	}
+
+	schedule := s.videoLib.Schedule()
+	shard := s.describeShard()
+
+	var due []videos.VideoDdbAttributes
+	for _, item := range allVideos {
+		// Another worker takes care of it
+		if s.shard != nil && !s.shard.Owns(item.Id) {
+			continue
+		}
+
+		if retryAt, ok := s.retryAt[item.Id]; ok && now.Before(retryAt) {
+			if retryAt.Before(next) {
+				next = retryAt
+			}
+			continue
+		}
+
+		if schedule.IsDue(item, now) {
+			due = append(due, item)
+			continue
+		}
+
+		if nextPollAt := time.Unix(schedule.NextPollAt(item), 0); nextPollAt.Before(next) {
+			next = nextPollAt
+		}
+	}
+
+	if len(due) == 0 {
+		return next
+	}
+
+	s.logger.Info("refresh cycle started", "due", len(due), "shard", shard)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		refreshed int
+		throttled int
+		failed    int
+	)
+
+	// Limit the number of concurrent calls to the Youtube API
+	sem := make(chan struct{}, s.workers)
+
+	for _, item := range due {
+		// Do not start new refreshes once we are asked to stop
+		if ctx.Err() != nil {
+			break
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(item videos.VideoDdbAttributes) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			started := time.Now()
+			processed, err := s.videoLib.ProcessVideoStat(item.Id, videos.ProcessVideoStatOptions{Stored: item})
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				failed++
+				s.retryAt[item.Id] = time.Now().Add(schedule.IntervalFor(item))
+				s.logger.Error("refresh failed", "video", item.Id, "title", item.Title, "error", err, "retry_at", s.retryAt[item.Id].Format(time.RFC3339))
+				return
+			}
+
+			delete(s.retryAt, item.Id)
+
+			// Someone else (e.g. an update run) already refreshed it
+			result := processed.Video
+			if processed.Status == videos.STATUS_THROTTLED {
+				throttled++
+				if eligibleAt := time.Unix(processed.EligibleAt, 0); eligibleAt.Before(next) {
+					next = eligibleAt
+				}
+				s.logger.Info("video throttled", "video", result.Id, "title", result.Title, "eligible_at", time.Unix(processed.EligibleAt, 0).Format(time.RFC3339))
+				return
+			}
+
+			refreshed++
+
+			nextPollAt := time.Unix(schedule.NextPollAt(result), 0)
+			if nextPollAt.Before(next) {
+				next = nextPollAt
+			}
+
+			attrs := []any{
+				"video", result.Id,
+				"title", result.Title,
+				"duration", time.Since(started).Round(time.Millisecond),
+				"next_poll_at", nextPollAt.Format(time.RFC3339),
+			}
+			if len(result.ViewLogs) > 0 {
+				attrs = append(attrs, "views", result.ViewLogs[len(result.ViewLogs)-1].Views)
+			}
+
+			s.logger.Info("video refreshed", attrs...)
+		}(item)
+	}
+
+	wg.Wait()
+
+	s.logger.Info("refresh cycle finished", "shard", shard, "refreshed", refreshed, "throttled", throttled, "failed", failed, "next_due", next.Format(time.RFC3339))
+
+	return next
+}
+
+// The shard as i/n, also published in the metrics since it changes when the workers are rebalanced
+func (s *Scheduler) describeShard() string {
+	index, count := 1, 1
+	if s.shard != nil {
+		index, count = s.shard.Position()
+	}
+
+	metrics.ShardIndex.Set(float64(index))
+	metrics.ShardCount.Set(float64(count))
+
+	return fmt.Sprintf("%d/%d", index, count)
+}
@@ -0,0 +1,127 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/scheduler"
+	"github.com/ricomonster/black-flag/internal/shard"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+type fakeVideoLib struct {
+	mu        sync.Mutex
+	items     []videos.VideoDdbAttributes
+	processed []string
+	fail      map[string]bool
+}
+
+func (f *fakeVideoLib) GetDueVideos(until time.Time) ([]videos.VideoDdbAttributes, error) {
+	var due []videos.VideoDdbAttributes
+	for _, item := range f.items {
+		if item.NextPollAt <= until.Unix() {
+			due = append(due, item)
+		}
+	}
+
+	return due, nil
+}
+
+func (f *fakeVideoLib) ProcessVideoStat(id string, _ videos.ProcessVideoStatOptions) (videos.ProcessVideoStatResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.processed = append(f.processed, id)
+	if f.fail[id] {
+		err := errors.New("boom")
+		return videos.ProcessVideoStatResult{Status: videos.STATUS_FAILED, Error: err}, err
+	}
+
+	return videos.ProcessVideoStatResult{
+		Video:  videos.VideoDdbAttributes{Id: id, NextPollAt: time.Now().Add(time.Hour).Unix()},
+		Status: videos.STATUS_REFRESHED,
+	}, nil
+}
+
+func (f *fakeVideoLib) Schedule() videos.Schedule {
+	return videos.Schedule{Interval: time.Hour}
+}
+
+func TestRunOnce(t *testing.T) {
+	now := time.Now()
+	lib := &fakeVideoLib{
+		items: []videos.VideoDdbAttributes{
+			{Id: "due", NextPollAt: now.Add(-time.Minute).Unix()},
+			{Id: "later", NextPollAt: now.Add(10 * time.Minute).Unix()},
+			{Id: "legacy", LastActivityAt: now.Add(-2 * time.Hour).Unix()},
+			{Id: "broken", NextPollAt: now.Add(-time.Minute).Unix()},
+		},
+		fail: map[string]bool{"broken": true},
+	}
+
+	svc := scheduler.NewScheduler(lib, scheduler.Options{
+		Tick:    time.Hour,
+		Workers: 2,
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+
+	next := svc.RunOnce(context.Background())
+	if len(lib.processed) != 3 {
+		t.Fatalf("TestRunOnce: expected 3 videos to be processed, got %v", lib.processed)
+	}
+
+	if next.After(now.Add(11 * time.Minute)) {
+		t.Errorf("TestRunOnce: expected to wake up for the next due video, got %v", next)
+	}
+
+	// Failed videos should wait for their next interval instead of being retried right away
+	lib.processed = nil
+	svc.RunOnce(context.Background())
+	for _, id := range lib.processed {
+		if id == "broken" {
+			t.Errorf("TestRunOnce: failed video was retried right away")
+		}
+	}
+}
+
+func TestRunOnceShard(t *testing.T) {
+	now := time.Now()
+	lib := &fakeVideoLib{}
+	for i := 0; i < 100; i++ {
+		lib.items = append(lib.items, videos.VideoDdbAttributes{Id: fmt.Sprintf("video%d", i), NextPollAt: now.Add(-time.Minute).Unix()})
+	}
+
+	owned := map[string]bool{}
+	for i := 1; i <= 2; i++ {
+		static, err := shard.NewStatic(i, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lib.processed = nil
+		svc := scheduler.NewScheduler(lib, scheduler.Options{
+			Tick:   time.Hour,
+			Shard:  static,
+			Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		})
+		svc.RunOnce(context.Background())
+
+		for _, id := range lib.processed {
+			if !static.Owns(id) || owned[id] {
+				t.Errorf("TestRunOnceShard: %s was refreshed by shard %v", id, static)
+			}
+			owned[id] = true
+		}
+	}
+
+	// Between them the shards refreshed every video
+	if len(owned) != len(lib.items) {
+		t.Errorf("TestRunOnceShard: expected %d videos to be refreshed, got %d", len(lib.items), len(owned))
+	}
+}
@@ -0,0 +1,138 @@
+package series
+
+import (
+	"sort"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+type Point struct {
+	Timestamp int64
+	Value     float64
+}
+
+// Samples sorted by their timestamp
+type Series []Point
+
+// Builds the cumulative views series from the view logs
+func Views(logs []videos.VideoViewAttributes) Series {
+	s := make(Series, 0, len(logs))
+	for _, log := range logs {
+		s = append(s, Point{Timestamp: log.Timestamp, Value: float64(log.Views)})
+	}
+
+	sort.SliceStable(s, func(i, j int) bool {
+		return s[i].Timestamp < s[j].Timestamp
+	})
+
+	return s
+}
+
+func (s Series) Last() (Point, bool) {
+	if len(s) == 0 {
+		return Point{}, false
+	}
+
+	return s[len(s)-1], true
+}
+
+// Returns the value at the given time, interpolating linearly between the samples around it.
+// Times outside of the recorded range are unknown.
+func (s Series) At(timestamp int64) (float64, bool) {
+	if len(s) == 0 || timestamp < s[0].Timestamp || timestamp > s[len(s)-1].Timestamp {
+		return 0, false
+	}
+
+	// First sample at or after the timestamp
+	i := sort.Search(len(s), func(i int) bool {
+		return s[i].Timestamp >= timestamp
+	})
+
+	if s[i].Timestamp == timestamp || i == 0 {
+		return s[i].Value, true
+	}
+
+	before, after := s[i-1], s[i]
+	ratio := float64(timestamp-before.Timestamp) / float64(after.Timestamp-before.Timestamp)
+
+	return before.Value + ratio*(after.Value-before.Value), true
+}
+
+// Returns how much was gained in the window ending at the given time along with the value at the start of the window
+func (s Series) GainOver(window time.Duration, end int64) (float64, float64, bool) {
+	endValue, ok := s.At(end)
+	if !ok {
+		return 0, 0, false
+	}
+
+	startValue, ok := s.At(end - int64(window.Seconds()))
+	if !ok {
+		return 0, 0, false
+	}
+
+	return endValue - startValue, startValue, true
+}
+
+// Returns the gain per hour between every two consecutive samples, timestamped at the end of each interval
+func (s Series) Rates() Series {
+	if len(s) < 2 {
+		return Series{}
+	}
+
+	rates := make(Series, 0, len(s)-1)
+	for i := 1; i < len(s); i++ {
+		hours := float64(s[i].Timestamp-s[i-1].Timestamp) / 3600
+		if hours <= 0 {
+			continue
+		}
+
+		rates = append(rates, Point{Timestamp: s[i].Timestamp, Value: (s[i].Value - s[i-1].Value) / hours})
+	}
+
+	return rates
+}
+
+// Samples the series at a fixed step, interpolating between the recorded samples
+func (s Series) Resample(step time.Duration) Series {
+	seconds := int64(step.Seconds())
+	if len(s) == 0 || seconds <= 0 {
+		return Series{}
+	}
+
+	var resampled Series
+	for ts := s[0].Timestamp; ts <= s[len(s)-1].Timestamp; ts += seconds {
+		value, _ := s.At(ts)
+		resampled = append(resampled, Point{Timestamp: ts, Value: value})
+	}
+
+	return resampled
+}
+
+// Returns the samples at or after the given time
+func (s Series) Since(timestamp int64) Series {
+	i := sort.Search(len(s), func(i int) bool {
+		return s[i].Timestamp >= timestamp
+	})
+
+	return s[i:]
+}
+
+// Same as At but times outside of the recorded range take the first or last sample
+func (s Series) Clamped(timestamp int64) float64 {
+	if len(s) == 0 {
+		return 0
+	}
+
+	if timestamp <= s[0].Timestamp {
+		return s[0].Value
+	}
+
+	if timestamp >= s[len(s)-1].Timestamp {
+		return s[len(s)-1].Value
+	}
+
+	value, _ := s.At(timestamp)
+
+	return value
+}
@@ -0,0 +1,331 @@
+"use strict";
+
+(function () {
+  const state = {
+    apiKey: localStorage.getItem("black-flag-api-key") || "",
+    videos: [],
+    channels: [],
+    selected: null,
+    sort: {
+      videos: { key: "views", dir: "desc" },
+      channels: { key: "total_views", dir: "desc" },
+    },
+    events: null,
+  };
+
+  const number = new Intl.NumberFormat();
+  const svgNS = "http://www.w3.org/2000/svg";
+
+  function api(path) {
+    return fetch(path, { headers: { "X-API-Key": state.apiKey } }).then((res) => {
+      if (!res.ok) {
+        throw new Error(res.status + " " + res.statusText);
+      }
+      return res.json();
+    });
+  }
+
+  // The list endpoint is paginated, keep on fetching until we have everything
+  async function loadVideos() {
+    let page = 1;
+    let items = [];
+    for (;;) {
+      const data = await api("/api/videos?per_page=100&page=" + page);
+      items = items.concat(data.items);
+      if (items.length >= data.total || data.items.length === 0) {
+        break;
+      }
+      page++;
+    }
+    state.videos = items;
+    renderVideos();
+  }
+
+  async function loadChannels() {
+    state.channels = await api("/api/channels");
+    renderChannels();
+  }
+
+  async function selectVideo(id) {
+    state.selected = await api("/api/videos/" + encodeURIComponent(id));
+    renderVideos();
+    renderDetail();
+  }
+
+  function formatDate(value) {
+    return value ? new Date(value).toLocaleString() : "";
+  }
+
+  function sortBy(items, sort, value) {
+    const dir = sort.dir === "asc" ? 1 : -1;
+    return items.slice().sort((a, b) => {
+      const x = value(a, sort.key);
+      const y = value(b, sort.key);
+      if (x < y) return -dir;
+      if (x > y) return dir;
+      return 0;
+    });
+  }
+
+  function videoValue(video, key) {
+    switch (key) {
+      case "channel":
+        return video.channel.title.toLowerCase();
+      case "title":
+        return video.title.toLowerCase();
+      default:
+        return video[key] || "";
+    }
+  }
+
+  function channelValue(channel, key) {
+    if (key === "top") {
+      return channel.top_videos.length ? channel.top_videos[0].title.toLowerCase() : "";
+    }
+    if (key === "title") {
+      return channel.title.toLowerCase();
+    }
+    return channel[key];
+  }
+
+  function cell(row, text, className) {
+    const td = document.createElement("td");
+    td.textContent = text;
+    if (className) {
+      td.className = className;
+    }
+    row.appendChild(td);
+  }
+
+  function renderVideos(flashId) {
+    const tbody = document.querySelector("#videos tbody");
+    tbody.replaceChildren();
+
+    for (const video of sortBy(state.videos, state.sort.videos, videoValue)) {
+      const row = document.createElement("tr");
+      row.dataset.id = video.id;
+      if (state.selected && state.selected.id === video.id) {
+        row.classList.add("selected");
+      }
+      if (flashId === video.id) {
+        row.classList.add("flash");
+      }
+
+      cell(row, video.title);
+      cell(row, video.channel.title);
+      cell(row, number.format(video.views), "number");
+      cell(row, number.format(video.gain), "number");
+      cell(row, formatDate(video.last_activity_at));
+      cell(row, formatDate(video.next_poll_at));
+
+      row.addEventListener("click", () => selectVideo(video.id));
+      tbody.appendChild(row);
+    }
+
+    markSorted("videos");
+  }
+
+  function renderChannels() {
+    const tbody = document.querySelector("#channels tbody");
+    tbody.replaceChildren();
+
+    for (const channel of sortBy(state.channels, state.sort.channels, channelValue)) {
+      const row = document.createElement("tr");
+      cell(row, channel.title);
+      cell(row, number.format(channel.videos), "number");
+      cell(row, number.format(channel.total_views), "number");
+      cell(row, channel.top_videos.length ? channel.top_videos[0].title : "");
+      tbody.appendChild(row);
+    }
+
+    markSorted("channels");
+  }
+
+  function markSorted(table) {
+    const sort = state.sort[table];
+    document.querySelectorAll("#" + table + " th").forEach((th) => {
+      th.classList.remove("asc", "desc");
+      if (th.dataset.key === sort.key) {
+        th.classList.add(sort.dir);
+      }
+    });
+  }
+
+  function renderDetail() {
+    const video = state.selected;
+    if (!video) {
+      return;
+    }
+
+    document.getElementById("detail").hidden = false;
+    document.getElementById("detail-title").textContent = video.title;
+    document.getElementById("detail-meta").textContent =
+      video.channel.title + " · " + number.format(video.views) + " views · " + video.history.length + " samples";
+
+    const points = video.history.map((log) => ({ x: new Date(log.timestamp).getTime(), y: log.views }));
+
+    // Views gained per hour between each sample
+    const gains = [];
+    for (let i = 1; i < points.length; i++) {
+      const hours = (points[i].x - points[i - 1].x) / 3600000;
+      if (hours > 0) {
+        gains.push({ x: points[i].x, y: (points[i].y - points[i - 1].y) / hours });
+      }
+    }
+
+    drawChart(document.getElementById("views-chart"), points, "line");
+    drawChart(document.getElementById("gains-chart"), gains, "bar");
+  }
+
+  function el(name, attrs, text) {
+    const node = document.createElementNS(svgNS, name);
+    for (const key in attrs) {
+      node.setAttribute(key, attrs[key]);
+    }
+    if (text !== undefined) {
+      node.textContent = text;
+    }
+    return node;
+  }
+
+  function drawChart(container, points, kind) {
+    container.replaceChildren();
+
+    const width = 1000;
+    const height = 240;
+    const pad = { top: 10, right: 10, bottom: 24, left: 70 };
+    const svg = el("svg", { viewBox: "0 0 " + width + " " + height, preserveAspectRatio: "none" });
+    container.appendChild(svg);
+
+    if (points.length === 0) {
+      svg.appendChild(el("text", { x: width / 2, y: height / 2, "text-anchor": "middle", class: "label" }, "Not enough samples yet"));
+      return;
+    }
+
+    const xs = points.map((p) => p.x);
+    const ys = points.map((p) => p.y);
+    let minX = Math.min(...xs);
+    let maxX = Math.max(...xs);
+    let minY = kind === "bar" ? Math.min(0, ...ys) : Math.min(...ys);
+    let maxY = Math.max(...ys);
+    if (minX === maxX) {
+      minX -= 3600000;
+      maxX += 3600000;
+    }
+    if (minY === maxY) {
+      maxY += 1;
+    }
+
+    const sx = (x) => pad.left + ((x - minX) / (maxX - minX)) * (width - pad.left - pad.right);
+    const sy = (y) => height - pad.bottom - ((y - minY) / (maxY - minY)) * (height - pad.top - pad.bottom);
+
+    svg.appendChild(el("line", { x1: pad.left, y1: sy(minY), x2: width - pad.right, y2: sy(minY), class: "axis" }));
+    svg.appendChild(el("line", { x1: pad.left, y1: pad.top, x2: pad.left, y2: height - pad.bottom, class: "axis" }));
+
+    for (const value of [minY, (minY + maxY) / 2, maxY]) {
+      svg.appendChild(el("text", { x: pad.left - 6, y: sy(value) + 4, "text-anchor": "end", class: "label" }, number.format(Math.round(value))));
+    }
+    svg.appendChild(el("text", { x: pad.left, y: height - 6, class: "label" }, new Date(minX).toLocaleString()));
+    svg.appendChild(el("text", { x: width - pad.right, y: height - 6, "text-anchor": "end", class: "label" }, new Date(maxX).toLocaleString()));
+
+    if (kind === "line") {
+      const d = points.map((p, i) => (i === 0 ? "M" : "L") + sx(p.x).toFixed(1) + " " + sy(p.y).toFixed(1)).join(" ");
+      svg.appendChild(el("path", { d: d, class: "line" }));
+      return;
+    }
+
+    const barWidth = Math.max(2, (width - pad.left - pad.right) / points.length - 2);
+    for (const p of points) {
+      const y = sy(Math.max(p.y, 0));
+      const bar = el("rect", {
+        x: sx(p.x) - barWidth / 2,
+        y: y,
+        width: barWidth,
+        height: Math.abs(sy(p.y) - sy(0)),
+        class: p.y < 0 ? "bar negative" : "bar",
+      });
+      bar.appendChild(el("title", {}, new Date(p.x).toLocaleString() + ": " + number.format(Math.round(p.y)) + "/h"));
+      svg.appendChild(bar);
+    }
+  }
+
+  function connectEvents() {
+    if (state.events) {
+      state.events.close();
+    }
+
+    const status = document.getElementById("status");
+    const events = new EventSource("/api/events?api_key=" + encodeURIComponent(state.apiKey));
+    state.events = events;
+
+    events.onopen = () => {
+      status.textContent = "live";
+      status.classList.add("live");
+    };
+
+    events.onerror = () => {
+      status.textContent = "reconnecting…";
+      status.classList.remove("live");
+    };
+
+    events.addEventListener("sample", (e) => {
+      const video = JSON.parse(e.data);
+      const index = state.videos.findIndex((v) => v.id === video.id);
+      const row = Object.assign({}, video);
+      delete row.history;
+      if (index === -1) {
+        state.videos.push(row);
+      } else {
+        state.videos[index] = row;
+      }
+
+      if (state.selected && state.selected.id === video.id) {
+        state.selected = video;
+        renderDetail();
+      }
+
+      renderVideos(video.id);
+      loadChannels().catch(() => {});
+    });
+  }
+
+  function connect() {
+    const status = document.getElementById("status");
+    status.textContent = "loading…";
+
+    Promise.all([loadVideos(), loadChannels()])
+      .then(connectEvents)
+      .catch((err) => {
+        status.textContent = err.message;
+        status.classList.remove("live");
+      });
+  }
+
+  function setupSorting(table, render) {
+    document.querySelectorAll("#" + table + " th").forEach((th) => {
+      th.addEventListener("click", () => {
+        const sort = state.sort[table];
+        if (sort.key === th.dataset.key) {
+          sort.dir = sort.dir === "asc" ? "desc" : "asc";
+        } else {
+          sort.key = th.dataset.key;
+          sort.dir = "asc";
+        }
+        render();
+      });
+    });
+  }
+
+  document.getElementById("api-key").value = state.apiKey;
+  document.getElementById("auth").addEventListener("submit", (e) => {
+    e.preventDefault();
+    state.apiKey = document.getElementById("api-key").value;
+    localStorage.setItem("black-flag-api-key", state.apiKey);
+    connect();
+  });
+
+  setupSorting("videos", () => renderVideos());
+  setupSorting("channels", renderChannels);
+
+  connect();
+})();
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+// How often a comment is sent to keep idle connections (and proxies) from timing out
+var SSE_KEEPALIVE = 30 * time.Second
+
+type event struct {
+	Name string
+	Data []byte
+}
+
+// Fans out the events to every connected dashboard
+type broker struct {
+	mu          sync.Mutex
+	subscribers map[chan event]struct{}
+}
+
+func newBroker() *broker {
+	return &broker{subscribers: map[chan event]struct{}{}}
+}
+
+func (b *broker) subscribe() (chan event, func()) {
+	ch := make(chan event, 16)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}
+}
+
+func (b *broker) publish(e event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers {
+		// Slow clients miss the event instead of blocking the scheduler
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Sends the recorded sample to the connected dashboards, this is meant to be registered through OnSample
+func (s *Server) NotifySample(video videos.VideoDdbAttributes) {
+	data, err := json.Marshal(NewVideoResponse(video, true))
+	if err != nil {
+		s.logger.Error("failed to encode sample event", "video", video.Id, "error", err)
+		return
+	}
+
+	s.events.publish(event{Name: "sample", Data: data})
+}
+
+// GET /api/events
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch, unsubscribe := s.events.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	// Let the client know that it is connected
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepalive := time.NewTicker(SSE_KEEPALIVE)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case e := <-ch:
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Name, e.Data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+type VideoChannelResponse struct {
+	Id    string `json:"id"`
+	Title string `json:"title"`
+}
+
+type ChannelResponse struct {
+	Id         string          `json:"id"`
+	Title      string          `json:"title"`
+	Videos     int             `json:"videos"`
+	TotalViews int             `json:"total_views"`
+	TopVideos  []VideoResponse `json:"top_videos"`
+}
+
+type ViewLogResponse struct {
+	Views     int       `json:"views"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type VideoResponse struct {
+	Id             string               `json:"id"`
+	Title          string               `json:"title"`
+	Channel        VideoChannelResponse `json:"channel"`
+	Views          int                  `json:"views"`
+	Gain           int                  `json:"gain"`
+	PublishedAt    *time.Time           `json:"published_at,omitempty"`
+	LastActivityAt time.Time            `json:"last_activity_at"`
+	NextPollAt     *time.Time           `json:"next_poll_at,omitempty"`
+	Created        time.Time            `json:"created"`
+	Modified       time.Time            `json:"modified"`
+	History        []ViewLogResponse    `json:"history,omitempty"`
+}
+
+type VideoListResponse struct {
+	Items   []VideoResponse `json:"items"`
+	Page    int             `json:"page"`
+	PerPage int             `json:"per_page"`
+	Total   int             `json:"total"`
+}
+
+type RefreshResponse struct {
+	Status     string        `json:"status"`
+	EligibleAt *time.Time    `json:"eligible_at,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Video      VideoResponse `json:"video"`
+}
+
+// Maps the stored video to the API representation, the history is only included when asked
+func NewVideoResponse(video videos.VideoDdbAttributes, withHistory bool) VideoResponse {
+	response := VideoResponse{
+		Id:             video.Id,
+		Title:          video.Title,
+		Channel:        VideoChannelResponse{Id: video.Channel.Id, Title: video.Channel.Title},
+		LastActivityAt: unix(video.LastActivityAt),
+		Created:        unix(video.Created),
+		Modified:       unix(video.Modified),
+	}
+
+	if len(video.ViewLogs) > 0 {
+		response.Views = video.ViewLogs[len(video.ViewLogs)-1].Views
+	}
+
+	if len(video.ViewLogs) > 1 {
+		response.Gain = response.Views - video.ViewLogs[len(video.ViewLogs)-2].Views
+	}
+
+	if video.PublishedAt != 0 {
+		publishedAt := unix(video.PublishedAt)
+		response.PublishedAt = &publishedAt
+	}
+
+	if video.NextPollAt != 0 {
+		nextPollAt := unix(video.NextPollAt)
+		response.NextPollAt = &nextPollAt
+	}
+
+	if withHistory {
+		response.History = []ViewLogResponse{}
+		for _, log := range video.ViewLogs {
+			response.History = append(response.History, ViewLogResponse{Views: log.Views, Timestamp: unix(log.Timestamp)})
+		}
+	}
+
+	return response
+}
+
+// Channel roll-up, only the top 5 videos are included
+func NewChannelResponse(summary videos.ChannelSummary) ChannelResponse {
+	response := ChannelResponse{
+		Id:         summary.Channel.Id,
+		Title:      summary.Channel.Title,
+		Videos:     summary.Videos,
+		TotalViews: summary.TotalViews,
+		TopVideos:  []VideoResponse{},
+	}
+
+	for i, video := range summary.TopVideos {
+		if i == 5 {
+			break
+		}
+
+		response.TopVideos = append(response.TopVideos, NewVideoResponse(video, false))
+	}
+
+	return response
+}
+
+func NewRefreshResponse(result videos.ProcessVideoStatResult) RefreshResponse {
+	response := RefreshResponse{
+		Status: string(result.Status),
+		Video:  NewVideoResponse(result.Video, true),
+	}
+
+	if result.Status == videos.STATUS_THROTTLED {
+		eligibleAt := unix(result.EligibleAt)
+		response.EligibleAt = &eligibleAt
+	}
+
+	if result.Error != nil {
+		response.Error = result.Error.Error()
+	}
+
+	return response
+}
+
+func unix(timestamp int64) time.Time {
+	return time.Unix(timestamp, 0).UTC()
+}
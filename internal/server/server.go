@@ -0,0 +1,407 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+//go:embed openapi.yaml
+var openapi []byte
+
+//go:embed dashboard
+var dashboard embed.FS
+
+// Number of videos per page when the request does not say so
+var DEFAULT_PER_PAGE = 20
+
+var MAX_PER_PAGE = 100
+
+// The parts of the video lib exposed through the API
+type VideoLib interface {
+	GetVideos() ([]videos.VideoDdbAttributes, error)
+	FindVideo(id string) (videos.VideoDdbAttributes, error)
+	AddVideo(video string) (videos.VideoDdbAttributes, bool, error)
+	DeleteVideo(id string) error
+	ProcessVideoStat(video string, options videos.ProcessVideoStatOptions) (videos.ProcessVideoStatResult, error)
+}
+
+type Options struct {
+	// Requests should send this through the X-API-Key header or as a bearer token.
+	// Leaving it empty disables the authentication.
+	ApiKey string
+	Logger *slog.Logger
+}
+
+type Server struct {
+	videoLib VideoLib
+	apiKey   string
+	logger   *slog.Logger
+	mux      *http.ServeMux
+	events   *broker
+}
+
+func NewServer(videoLib VideoLib, options Options) *Server {
+	if options.Logger == nil {
+		options.Logger = slog.Default()
+	}
+
+	s := &Server{
+		videoLib: videoLib,
+		apiKey:   options.ApiKey,
+		logger:   options.Logger,
+		mux:      http.NewServeMux(),
+		events:   newBroker(),
+	}
+
+	// The dashboard itself is public, it asks for the API key before calling the API
+	static, _ := fs.Sub(dashboard, "dashboard")
+	s.mux.Handle("/", http.FileServer(http.FS(static)))
+
+	s.mux.HandleFunc("/openapi.yaml", s.handleOpenAPI)
+	s.mux.Handle("/api/videos", s.authenticate(http.HandlerFunc(s.handleVideos)))
+	s.mux.Handle("/api/videos/", s.authenticate(http.HandlerFunc(s.handleVideo)))
+	s.mux.Handle("/api/channels", s.authenticate(http.HandlerFunc(s.handleChannels)))
+	s.mux.Handle("/api/events", s.authenticate(http.HandlerFunc(s.handleEvents)))
+
+	return s
+}
+
+// Allows other packages to mount more routes next to the API
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+	s.mux.ServeHTTP(recorder, r)
+
+	s.logger.Info("request", "method", r.Method, "path", r.URL.Path, "status", recorder.status, "duration", time.Since(started).Round(time.Millisecond))
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Server-sent events needs to flush each event as it is written
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.apiKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := r.Header.Get("X-API-Key")
+		if bearer, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+			key = bearer
+		}
+
+		// EventSource in browsers can't send headers so the key is allowed in the query string
+		if key == "" {
+			key = r.URL.Query().Get("api_key")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(key), []byte(s.apiKey)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("invalid or missing API key"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(openapi)
+}
+
+// GET /api/videos and POST /api/videos
+func (s *Server) handleVideos(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listVideos(w, r)
+	case http.MethodPost:
+		s.addVideo(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// GET|DELETE /api/videos/{id} and POST /api/videos/{id}/refresh
+func (s *Server) handleVideo(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/videos/"), "/")
+	id, action, _ := strings.Cut(path, "/")
+
+	if id == "" {
+		s.handleVideos(w, r)
+		return
+	}
+
+	switch action {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			s.getVideo(w, r, id)
+		case http.MethodDelete:
+			s.deleteVideo(w, id)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		}
+	case "refresh":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		s.refreshVideo(w, r, id)
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+func (s *Server) listVideos(w http.ResponseWriter, r *http.Request) {
+	page, err := queryInt(r, "page", 1)
+	if err != nil || page < 1 {
+		writeError(w, http.StatusBadRequest, errors.New("page should be a positive number"))
+		return
+	}
+
+	perPage, err := queryInt(r, "per_page", DEFAULT_PER_PAGE)
+	if err != nil || perPage < 1 || perPage > MAX_PER_PAGE {
+		writeError(w, http.StatusBadRequest, errors.New("per_page should be between 1 and 100"))
+		return
+	}
+
+	allVideos, err := s.videoLib.GetVideos()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// Keep the order stable so the pages do not shift between requests
+	sort.Slice(allVideos, func(i, j int) bool {
+		return allVideos[i].Id < allVideos[j].Id
+	})
+
+	start := (page - 1) * perPage
+	if start > len(allVideos) {
+		start = len(allVideos)
+	}
+
+	end := start + perPage
+	if end > len(allVideos) {
+		end = len(allVideos)
+	}
+
+	items := []VideoResponse{}
+	for _, item := range allVideos[start:end] {
+		items = append(items, NewVideoResponse(item, false))
+	}
+
+	writeCached(w, r, http.StatusOK, VideoListResponse{
+		Items:   items,
+		Page:    page,
+		PerPage: perPage,
+		Total:   len(allVideos),
+	})
+}
+
+func (s *Server) getVideo(w http.ResponseWriter, r *http.Request, id string) {
+	item, err := s.videoLib.FindVideo(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if item.Id == "" {
+		writeError(w, http.StatusNotFound, errors.New("video not found"))
+		return
+	}
+
+	writeCached(w, r, http.StatusOK, NewVideoResponse(item, true))
+}
+
+type addVideoRequest struct {
+	// Video id or URL
+	Video string `json:"video"`
+}
+
+func (s *Server) addVideo(w http.ResponseWriter, r *http.Request) {
+	var body addVideoRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Video == "" {
+		writeError(w, http.StatusBadRequest, errors.New(`expected a JSON body with a "video" id or URL`))
+		return
+	}
+
+	item, added, err := s.videoLib.AddVideo(body.Video)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	status := http.StatusOK
+	if added {
+		status = http.StatusCreated
+	}
+
+	writeJSON(w, status, NewVideoResponse(item, true))
+}
+
+func (s *Server) refreshVideo(w http.ResponseWriter, r *http.Request, id string) {
+	item, err := s.videoLib.FindVideo(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if item.Id == "" {
+		writeError(w, http.StatusNotFound, errors.New("video not found"))
+		return
+	}
+
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+
+	result, err := s.videoLib.ProcessVideoStat(id, videos.ProcessVideoStatOptions{Force: force})
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, NewRefreshResponse(result))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, NewRefreshResponse(result))
+}
+
+// GET /api/channels
+func (s *Server) handleChannels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	allVideos, err := s.videoLib.GetVideos()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	items := []ChannelResponse{}
+	for _, summary := range videos.SummarizeChannels(allVideos) {
+		items = append(items, NewChannelResponse(summary))
+	}
+
+	writeCached(w, r, http.StatusOK, items)
+}
+
+func (s *Server) deleteVideo(w http.ResponseWriter, id string) {
+	item, err := s.videoLib.FindVideo(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if item.Id == "" {
+		writeError(w, http.StatusNotFound, errors.New("video not found"))
+		return
+	}
+
+	if err := s.videoLib.DeleteVideo(id); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	return strconv.Atoi(value)
+}
+
+func methodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+// Same as writeJSON but tags the response with an ETag so clients can skip unchanged responses with If-None-Match
+func writeCached(w http.ResponseWriter, r *http.Request, status int, data any) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hash := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(hash[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if matchesETag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+func matchesETag(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+
+	return false
+}
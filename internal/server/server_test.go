@@ -0,0 +1,146 @@
+package server_test
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ricomonster/black-flag/internal/server"
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+type fakeVideoLib struct {
+	items map[string]videos.VideoDdbAttributes
+}
+
+func (f *fakeVideoLib) GetVideos() ([]videos.VideoDdbAttributes, error) {
+	var items []videos.VideoDdbAttributes
+	for _, item := range f.items {
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func (f *fakeVideoLib) FindVideo(id string) (videos.VideoDdbAttributes, error) {
+	return f.items[id], nil
+}
+
+func (f *fakeVideoLib) AddVideo(video string) (videos.VideoDdbAttributes, bool, error) {
+	if item, ok := f.items[video]; ok {
+		return item, false, nil
+	}
+
+	f.items[video] = videos.VideoDdbAttributes{Id: video, Title: "New"}
+	return f.items[video], true, nil
+}
+
+func (f *fakeVideoLib) DeleteVideo(id string) error {
+	delete(f.items, id)
+	return nil
+}
+
+func (f *fakeVideoLib) ProcessVideoStat(id string, _ videos.ProcessVideoStatOptions) (videos.ProcessVideoStatResult, error) {
+	return videos.ProcessVideoStatResult{Video: f.items[id], Status: videos.STATUS_REFRESHED}, nil
+}
+
+func newTestServer() *server.Server {
+	lib := &fakeVideoLib{items: map[string]videos.VideoDdbAttributes{
+		"a": {Id: "a", Title: "A", ViewLogs: []videos.VideoViewAttributes{{Views: 10, Timestamp: 1}}},
+		"b": {Id: "b", Title: "B"},
+		"c": {Id: "c", Title: "C"},
+	}}
+
+	return server.NewServer(lib, server.Options{
+		ApiKey: "secret",
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+}
+
+func request(handler http.Handler, method string, path string, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+func TestAuthentication(t *testing.T) {
+	handler := newTestServer()
+
+	if res := request(handler, http.MethodGet, "/api/videos", "", nil); res.Code != http.StatusUnauthorized {
+		t.Errorf("TestAuthentication: expected 401 without a key, got %d", res.Code)
+	}
+
+	if res := request(handler, http.MethodGet, "/api/videos", "", map[string]string{"Authorization": "Bearer secret"}); res.Code != http.StatusOK {
+		t.Errorf("TestAuthentication: expected 200 with a bearer token, got %d", res.Code)
+	}
+
+	if res := request(handler, http.MethodGet, "/openapi.yaml", "", nil); res.Code != http.StatusOK {
+		t.Errorf("TestAuthentication: expected the OpenAPI document to be public, got %d", res.Code)
+	}
+
+	if res := request(handler, http.MethodGet, "/", "", nil); res.Code != http.StatusOK || !strings.Contains(res.Body.String(), "app.js") {
+		t.Errorf("TestAuthentication: expected the dashboard to be public, got %d", res.Code)
+	}
+}
+
+func TestListVideos(t *testing.T) {
+	handler := newTestServer()
+	auth := map[string]string{"X-API-Key": "secret"}
+
+	res := request(handler, http.MethodGet, "/api/videos?page=2&per_page=2", "", auth)
+	if res.Code != http.StatusOK {
+		t.Fatalf("TestListVideos: expected 200, got %d", res.Code)
+	}
+
+	var list server.VideoListResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &list); err != nil {
+		t.Fatalf("TestListVideos: %v", err)
+	}
+
+	if list.Total != 3 || len(list.Items) != 1 || list.Items[0].Id != "c" {
+		t.Errorf("TestListVideos: unexpected page %+v", list)
+	}
+
+	// Same content should give back a 304
+	etag := res.Header().Get("ETag")
+	res = request(handler, http.MethodGet, "/api/videos?page=2&per_page=2", "", map[string]string{"X-API-Key": "secret", "If-None-Match": etag})
+	if res.Code != http.StatusNotModified {
+		t.Errorf("TestListVideos: expected 304, got %d", res.Code)
+	}
+}
+
+func TestVideoLifecycle(t *testing.T) {
+	handler := newTestServer()
+	auth := map[string]string{"X-API-Key": "secret"}
+
+	if res := request(handler, http.MethodPost, "/api/videos", `{"video":"https://www.youtube.com/watch?v=d"}`, auth); res.Code != http.StatusCreated {
+		t.Errorf("TestVideoLifecycle: expected 201, got %d", res.Code)
+	}
+
+	res := request(handler, http.MethodGet, "/api/videos/a", "", auth)
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `"history"`) {
+		t.Errorf("TestVideoLifecycle: expected the video with its history, got %d %s", res.Code, res.Body.String())
+	}
+
+	if res := request(handler, http.MethodPost, "/api/videos/a/refresh", "", auth); res.Code != http.StatusOK {
+		t.Errorf("TestVideoLifecycle: expected 200 on refresh, got %d", res.Code)
+	}
+
+	if res := request(handler, http.MethodDelete, "/api/videos/a", "", auth); res.Code != http.StatusNoContent {
+		t.Errorf("TestVideoLifecycle: expected 204, got %d", res.Code)
+	}
+
+	if res := request(handler, http.MethodGet, "/api/videos/a", "", auth); res.Code != http.StatusNotFound {
+		t.Errorf("TestVideoLifecycle: expected 404 after delete, got %d", res.Code)
+	}
+}
@@ -0,0 +1,163 @@
+package shard
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/lease"
+)
+
+// Workers register a lease named after them, the live ones split the videos
+var WORKER_LEASE_PREFIX = "worker/"
+
+type DynamicOptions struct {
+	// Defaults to the host name and process id
+	Worker string
+	// Where the worker leases are kept, defaults to WORKER_LEASE_PREFIX
+	Prefix string
+	// How long a worker that stopped heartbeating keeps its videos
+	TTL    time.Duration
+	Logger *slog.Logger
+}
+
+// Splits the videos across the workers that are currently alive, the videos of a worker that dies are
+// picked up by the others once its lease expires
+type Dynamic struct {
+	store  lease.Store
+	worker string
+	prefix string
+	handle *lease.Handle
+	logger *slog.Logger
+
+	mu   sync.RWMutex
+	ring *Ring
+}
+
+// Registers the worker and keeps track of the others until the context is cancelled or the lease of
+// the worker is lost, see Context
+func Join(ctx context.Context, store lease.Store, options DynamicOptions) (*Dynamic, error) {
+	if options.Worker == "" {
+		options.Worker = lease.DefaultHolder()
+	}
+
+	if options.Prefix == "" {
+		options.Prefix = WORKER_LEASE_PREFIX
+	}
+
+	if options.TTL <= 0 {
+		options.TTL = lease.DEFAULT_TTL
+	}
+
+	if options.Logger == nil {
+		options.Logger = slog.Default()
+	}
+
+	// The lease is named after the worker so nobody else wants it
+	locker := lease.NewLocker(store, lease.Options{Holder: options.Worker, TTL: options.TTL, Mode: lease.MODE_SKIP, Logger: options.Logger})
+	handle, err := locker.Acquire(ctx, options.Prefix+options.Worker)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Dynamic{
+		store:  store,
+		worker: options.Worker,
+		prefix: options.Prefix,
+		handle: handle,
+		logger: options.Logger,
+		ring:   NewRing([]string{options.Worker}),
+	}
+
+	if err := d.Refresh(); err != nil {
+		handle.Release()
+		return nil, err
+	}
+
+	go d.watch(options.TTL / 3)
+
+	return d, nil
+}
+
+// Looks for workers that joined or died as often as the leases are renewed
+func (d *Dynamic) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.handle.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		// The workers we knew about keep their videos until we can read the leases again
+		if err := d.Refresh(); err != nil {
+			d.logger.Warn("unable to read the workers", "error", err)
+		}
+	}
+}
+
+// Reads the live workers and rebalances the videos when they changed
+func (d *Dynamic) Refresh() error {
+	leases, err := d.store.List(d.prefix)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	members := []string{d.worker}
+	for _, l := range leases {
+		if !l.Expired(now) && l.Holder != d.worker {
+			members = append(members, l.Holder)
+		}
+	}
+
+	ring := NewRing(members)
+
+	d.mu.Lock()
+	previous := d.ring
+	d.ring = ring
+	d.mu.Unlock()
+
+	if !slices.Equal(previous.Members(), ring.Members()) {
+		index, count := d.Position()
+		d.logger.Info("shards rebalanced", "worker", d.worker, "shard", index, "shards", count, "workers", ring.Members())
+	}
+
+	return nil
+}
+
+// Tells if the video belongs to this worker
+func (d *Dynamic) Owns(video string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.ring.Owner(video) == d.worker
+}
+
+// Where the worker stands among the live ones, starting at 1
+func (d *Dynamic) Position() (int, int) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	members := d.ring.Members()
+	return slices.Index(members, d.worker) + 1, len(members)
+}
+
+// Cancelled once the worker lost its lease, e.g. it couldn't renew it in time and the others took over its videos
+func (d *Dynamic) Context() context.Context {
+	return d.handle.Context()
+}
+
+// Why the worker lost its lease, nil while it is registered
+func (d *Dynamic) Err() error {
+	return d.handle.Err()
+}
+
+// Unregisters the worker so the others pick up its videos right away
+func (d *Dynamic) Leave() error {
+	return d.handle.Release()
+}
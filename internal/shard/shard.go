@@ -0,0 +1,127 @@
+package shard
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Points each member gets on the ring, more points spread the videos more evenly
+var VIRTUAL_NODES = 128
+
+// Consistent hash ring, adding or removing a member only moves the videos of that member
+type Ring struct {
+	points  []uint32
+	owners  map[uint32]string
+	members []string
+}
+
+func NewRing(members []string) *Ring {
+	r := &Ring{owners: map[uint32]string{}}
+
+	seen := map[string]bool{}
+	for _, member := range members {
+		if seen[member] {
+			continue
+		}
+		seen[member] = true
+		r.members = append(r.members, member)
+
+		for i := 0; i < VIRTUAL_NODES; i++ {
+			point := hash(member + "#" + strconv.Itoa(i))
+			// Collisions are rare, the first member keeps the point so every ring agrees
+			if _, ok := r.owners[point]; ok {
+				continue
+			}
+			r.owners[point] = member
+			r.points = append(r.points, point)
+		}
+	}
+
+	sort.Strings(r.members)
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+
+	return r
+}
+
+// The member the key belongs to, empty when the ring has no members
+func (r *Ring) Owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+
+	point := hash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= point })
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.owners[r.points[i]]
+}
+
+// Sorted members of the ring
+func (r *Ring) Members() []string {
+	return r.members
+}
+
+func hash(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// A fixed split of the videos, the index starts at 1, e.g. 2/4 is the second of four workers
+type Static struct {
+	Index int
+	Count int
+	ring  *Ring
+}
+
+// Parses a shard given as i/n
+func Parse(value string) (*Static, error) {
+	index, count, ok := strings.Cut(value, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid shard %q, expected i/n e.g. 1/4", value)
+	}
+
+	i, err := strconv.Atoi(index)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shard %q, expected i/n e.g. 1/4", value)
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return nil, fmt.Errorf("invalid shard %q, expected i/n e.g. 1/4", value)
+	}
+
+	return NewStatic(i, n)
+}
+
+func NewStatic(index, count int) (*Static, error) {
+	if count < 1 || index < 1 || index > count {
+		return nil, fmt.Errorf("invalid shard %d/%d, the index goes from 1 to the number of shards", index, count)
+	}
+
+	members := make([]string, count)
+	for i := range members {
+		members[i] = strconv.Itoa(i + 1)
+	}
+
+	return &Static{Index: index, Count: count, ring: NewRing(members)}, nil
+}
+
+// Tells if the video belongs to this shard
+func (s *Static) Owns(video string) bool {
+	return s.ring.Owner(video) == strconv.Itoa(s.Index)
+}
+
+func (s *Static) String() string {
+	return fmt.Sprintf("%d/%d", s.Index, s.Count)
+}
+
+// Where the shard stands, starting at 1
+func (s *Static) Position() (int, int) {
+	return s.Index, s.Count
+}
@@ -0,0 +1,155 @@
+package shard_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/lease"
+	"github.com/ricomonster/black-flag/internal/shard"
+)
+
+func videoIds(count int) []string {
+	ids := make([]string, count)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("video%d", i)
+	}
+
+	return ids
+}
+
+func TestRing(t *testing.T) {
+	ids := videoIds(10000)
+
+	ring := shard.NewRing([]string{"a", "b", "c", "d"})
+	owners := map[string]string{}
+	counts := map[string]int{}
+	for _, id := range ids {
+		owners[id] = ring.Owner(id)
+		counts[owners[id]]++
+	}
+
+	// Roughly a quarter each
+	for member, count := range counts {
+		if count < 1500 || count > 3500 {
+			t.Errorf("TestRing: unbalanced ring, %s owns %d of %d videos", member, count, len(ids))
+		}
+	}
+
+	// Only the videos of the removed member move
+	smaller := shard.NewRing([]string{"a", "b", "d"})
+	for _, id := range ids {
+		if owner := smaller.Owner(id); owners[id] != "c" && owner != owners[id] {
+			t.Fatalf("TestRing: %s moved from %s to %s", id, owners[id], owner)
+		}
+	}
+
+	if owner := shard.NewRing(nil).Owner("video"); owner != "" {
+		t.Errorf("TestRing: expected no owner on an empty ring, got %s", owner)
+	}
+}
+
+func TestParse(t *testing.T) {
+	static, err := shard.Parse("2/4")
+	if err != nil || static.Index != 2 || static.Count != 4 || static.String() != "2/4" {
+		t.Errorf("TestParse: unexpected shard %v %v", static, err)
+	}
+
+	for _, value := range []string{"", "2", "0/4", "5/4", "a/4", "1/0"} {
+		if _, err := shard.Parse(value); err == nil {
+			t.Errorf("TestParse: expected %q to be invalid", value)
+		}
+	}
+}
+
+func TestStatic(t *testing.T) {
+	ids := videoIds(1000)
+
+	var shards []*shard.Static
+	for i := 1; i <= 3; i++ {
+		static, err := shard.NewStatic(i, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shards = append(shards, static)
+	}
+
+	// Every video belongs to exactly one shard
+	for _, id := range ids {
+		owners := 0
+		for _, static := range shards {
+			if static.Owns(id) {
+				owners++
+			}
+		}
+
+		if owners != 1 {
+			t.Fatalf("TestStatic: %s belongs to %d shards", id, owners)
+		}
+	}
+}
+
+func TestDynamic(t *testing.T) {
+	store, err := lease.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	first, err := shard.Join(context.Background(), store, shard.DynamicOptions{Worker: "first", TTL: time.Minute, Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := shard.Join(context.Background(), store, shard.DynamicOptions{Worker: "second", TTL: time.Minute, Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Leave()
+
+	// The first worker finds out about the second one on its next refresh
+	if err := first.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	if index, count := first.Position(); index != 1 || count != 2 {
+		t.Errorf("TestDynamic: unexpected position of the first worker %d/%d", index, count)
+	}
+	if index, count := second.Position(); index != 2 || count != 2 {
+		t.Errorf("TestDynamic: unexpected position of the second worker %d/%d", index, count)
+	}
+
+	ids := videoIds(1000)
+	owned := 0
+	for _, id := range ids {
+		if first.Owns(id) == second.Owns(id) {
+			t.Fatalf("TestDynamic: %s should belong to exactly one worker", id)
+		}
+		if second.Owns(id) {
+			owned++
+		}
+	}
+	if owned == 0 || owned == len(ids) {
+		t.Errorf("TestDynamic: expected the videos to be split, the second worker owns %d", owned)
+	}
+
+	// The second worker takes over every video once the first one is gone
+	if err := first.Leave(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range ids {
+		if !second.Owns(id) {
+			t.Fatalf("TestDynamic: expected %s to move to the second worker", id)
+		}
+	}
+	if index, count := second.Position(); index != 1 || count != 1 {
+		t.Errorf("TestDynamic: unexpected position after the rebalance %d/%d", index, count)
+	}
+}
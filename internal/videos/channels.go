@@ -0,0 +1,58 @@
+package videos
+
+import "sort"
+
+type ChannelSummary struct {
+	Channel VideoChannelAttributes
+	// Number of videos we track from the channel
+	Videos int
+	// Sum of the latest recorded views of each video
+	TotalViews int
+	// Tracked videos of the channel sorted by their latest views
+	TopVideos []VideoDdbAttributes
+}
+
+// Returns the latest recorded views of the video
+func LatestViews(video VideoDdbAttributes) int {
+	if len(video.ViewLogs) == 0 {
+		return 0
+	}
+
+	return video.ViewLogs[len(video.ViewLogs)-1].Views
+}
+
+// Groups the videos by their channel, channels with the most views first
+func SummarizeChannels(items []VideoDdbAttributes) []ChannelSummary {
+	byChannel := map[string]*ChannelSummary{}
+
+	for _, item := range items {
+		summary, ok := byChannel[item.Channel.Id]
+		if !ok {
+			summary = &ChannelSummary{Channel: item.Channel}
+			byChannel[item.Channel.Id] = summary
+		}
+
+		summary.Videos++
+		summary.TotalViews += LatestViews(item)
+		summary.TopVideos = append(summary.TopVideos, item)
+	}
+
+	var summaries []ChannelSummary
+	for _, summary := range byChannel {
+		sort.Slice(summary.TopVideos, func(i, j int) bool {
+			return LatestViews(summary.TopVideos[i]) > LatestViews(summary.TopVideos[j])
+		})
+
+		summaries = append(summaries, *summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].TotalViews == summaries[j].TotalViews {
+			return summaries[i].Channel.Title < summaries[j].Channel.Title
+		}
+
+		return summaries[i].TotalViews > summaries[j].TotalViews
+	})
+
+	return summaries
+}
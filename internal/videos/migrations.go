@@ -0,0 +1,36 @@
+package videos
+
+import "github.com/ricomonster/black-flag/internal/migrate"
+
+// Every change to the shape of the stored videos, new videos are saved at the latest version.
+// Append new migrations at the end, never change one that was already released.
+var MIGRATIONS = migrate.NewRegistry(
+	migrate.Migration{
+		Version:     1,
+		Description: "Remove the TestAttribute and TestAttributeHana test attributes",
+		Up: func(item migrate.Item) error {
+			delete(item, "TestAttribute")
+			delete(item, "TestAttributeHana")
+			return nil
+		},
+	},
+	migrate.Migration{
+		Version:     2,
+		Description: "Copy the channel id and add the poll bucket for the indexes",
+		Up: func(item migrate.Item) error {
+			if channel, ok := item["Channel"].(map[string]interface{}); ok {
+				if id, ok := channel["Id"].(string); ok && id != "" {
+					item["ChannelId"] = id
+				}
+			}
+
+			// Videos without a next poll are due right away, the schedule still has the last say
+			if _, ok := item["NextPollAt"]; !ok {
+				item["NextPollAt"] = 0
+			}
+			item["PollBucket"] = POLL_BUCKET
+
+			return nil
+		},
+	},
+)
@@ -0,0 +1,240 @@
+package videos
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default time between each refresh of a video, this is also the throttle we apply to the Youtube API
+var DEFAULT_POLL_INTERVAL = time.Hour
+
+// Bounds of the interval computed by the adaptive polling
+var (
+	DEFAULT_MIN_POLL_INTERVAL = 5 * time.Minute
+	DEFAULT_MAX_POLL_INTERVAL = 24 * time.Hour
+)
+
+type Schedule struct {
+	// Interval used when there's no override for the video or its channel and
+	// when adaptive polling is disabled or there's not enough data about the video
+	Interval time.Duration
+	// Computes the interval from the age and the recent growth of the video
+	Adaptive    bool
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	// Overrides keyed by the channel id
+	Channels map[string]time.Duration
+	// Overrides keyed by the video id, this wins over the channel override
+	Videos map[string]time.Duration
+}
+
+// Builds the schedule from the env config:
+//
+//	BLACK_FLAG_POLL_INTERVAL=1h
+//	BLACK_FLAG_ADAPTIVE_POLLING=true
+//	BLACK_FLAG_POLL_MIN_INTERVAL=5m
+//	BLACK_FLAG_POLL_MAX_INTERVAL=24h
+//	BLACK_FLAG_CHANNEL_INTERVALS=UCxxxx=30m,UCyyyy=6h
+//	BLACK_FLAG_VIDEO_INTERVALS=_Hu4GYtye5U=10m
+func NewScheduleFromEnv() (Schedule, error) {
+	schedule := Schedule{
+		Interval:    DEFAULT_POLL_INTERVAL,
+		Adaptive:    true,
+		MinInterval: DEFAULT_MIN_POLL_INTERVAL,
+		MaxInterval: DEFAULT_MAX_POLL_INTERVAL,
+		Channels:    map[string]time.Duration{},
+		Videos:      map[string]time.Duration{},
+	}
+
+	durations := map[string]*time.Duration{
+		"BLACK_FLAG_POLL_INTERVAL":     &schedule.Interval,
+		"BLACK_FLAG_POLL_MIN_INTERVAL": &schedule.MinInterval,
+		"BLACK_FLAG_POLL_MAX_INTERVAL": &schedule.MaxInterval,
+	}
+	for name, target := range durations {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return Schedule{}, fmt.Errorf("invalid %s: %w", name, err)
+		}
+
+		*target = interval
+	}
+
+	if value := os.Getenv("BLACK_FLAG_ADAPTIVE_POLLING"); value != "" {
+		adaptive, err := strconv.ParseBool(value)
+		if err != nil {
+			return Schedule{}, fmt.Errorf("invalid BLACK_FLAG_ADAPTIVE_POLLING: %w", err)
+		}
+
+		schedule.Adaptive = adaptive
+	}
+
+	if schedule.MinInterval > schedule.MaxInterval {
+		return Schedule{}, fmt.Errorf("BLACK_FLAG_POLL_MIN_INTERVAL is greater than BLACK_FLAG_POLL_MAX_INTERVAL")
+	}
+
+	channels, err := ParseIntervals(os.Getenv("BLACK_FLAG_CHANNEL_INTERVALS"))
+	if err != nil {
+		return Schedule{}, fmt.Errorf("invalid BLACK_FLAG_CHANNEL_INTERVALS: %w", err)
+	}
+	schedule.Channels = channels
+
+	videos, err := ParseIntervals(os.Getenv("BLACK_FLAG_VIDEO_INTERVALS"))
+	if err != nil {
+		return Schedule{}, fmt.Errorf("invalid BLACK_FLAG_VIDEO_INTERVALS: %w", err)
+	}
+	schedule.Videos = videos
+
+	return schedule, nil
+}
+
+// Parses a comma separated list of id=duration pairs
+func ParseIntervals(value string) (map[string]time.Duration, error) {
+	intervals := map[string]time.Duration{}
+
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		id, duration, found := strings.Cut(pair, "=")
+		if !found || id == "" {
+			return nil, fmt.Errorf("expected id=duration, got %q", pair)
+		}
+
+		interval, err := time.ParseDuration(duration)
+		if err != nil {
+			return nil, err
+		}
+
+		intervals[id] = interval
+	}
+
+	return intervals, nil
+}
+
+// Returns how long we should wait between each refresh of the video
+func (s Schedule) IntervalFor(video VideoDdbAttributes) time.Duration {
+	if interval, ok := s.Videos[video.Id]; ok && interval > 0 {
+		return interval
+	}
+
+	if interval, ok := s.Channels[video.Channel.Id]; ok && interval > 0 {
+		return interval
+	}
+
+	if s.Adaptive {
+		if interval, ok := s.adaptiveInterval(video, time.Now()); ok {
+			return interval
+		}
+	}
+
+	if s.Interval > 0 {
+		return s.Interval
+	}
+
+	return DEFAULT_POLL_INTERVAL
+}
+
+// Fresh uploads are sampled often while old videos that barely move are left alone.
+// We start from a 24th of the video age (a day old video is polled hourly) and shorten it
+// to the time the video needs to gain 1% of its views based on its growth in the last day.
+func (s Schedule) adaptiveInterval(video VideoDdbAttributes, now time.Time) (time.Duration, bool) {
+	// Records that were saved before we stored the publish date falls back to when we started tracking it
+	publishedAt := video.PublishedAt
+	if publishedAt == 0 {
+		publishedAt = video.Created
+	}
+	if publishedAt == 0 && len(video.ViewLogs) > 0 {
+		publishedAt = video.ViewLogs[0].Timestamp
+	}
+	if publishedAt == 0 {
+		return 0, false
+	}
+
+	age := now.Sub(time.Unix(publishedAt, 0))
+	if age <= 0 {
+		age = time.Minute
+	}
+
+	interval := age / 24
+
+	if rate, ok := recentGrowthRate(video.ViewLogs); ok && rate > 0 {
+		views := float64(video.ViewLogs[len(video.ViewLogs)-1].Views)
+		if views < 100 {
+			views = 100
+		}
+
+		if hours := 0.01 * views / rate; hours < interval.Hours() {
+			interval = time.Duration(hours * float64(time.Hour))
+		}
+	}
+
+	return s.clamp(interval), true
+}
+
+func (s Schedule) clamp(interval time.Duration) time.Duration {
+	minInterval, maxInterval := s.MinInterval, s.MaxInterval
+	if minInterval <= 0 {
+		minInterval = DEFAULT_MIN_POLL_INTERVAL
+	}
+	if maxInterval <= 0 {
+		maxInterval = DEFAULT_MAX_POLL_INTERVAL
+	}
+
+	if interval < minInterval {
+		return minInterval
+	}
+	if interval > maxInterval {
+		return maxInterval
+	}
+
+	return interval
+}
+
+// Returns the views gained per hour between the last sample and the oldest sample within a day of it
+func recentGrowthRate(logs []VideoViewAttributes) (float64, bool) {
+	if len(logs) < 2 {
+		return 0, false
+	}
+
+	last := logs[len(logs)-1]
+	reference := logs[len(logs)-2]
+	for i := len(logs) - 2; i >= 0; i-- {
+		if last.Timestamp-logs[i].Timestamp > int64((24 * time.Hour).Seconds()) {
+			break
+		}
+		reference = logs[i]
+	}
+
+	hours := float64(last.Timestamp-reference.Timestamp) / 3600
+	if hours <= 0 {
+		return 0, false
+	}
+
+	return float64(last.Views-reference.Views) / hours, true
+}
+
+// Returns the unix timestamp when the video can be refreshed again.
+// Records saved before we persisted the next poll time falls back to the last activity.
+func (s Schedule) NextPollAt(video VideoDdbAttributes) int64 {
+	if video.NextPollAt != 0 {
+		return video.NextPollAt
+	}
+
+	return video.LastActivityAt + int64(s.IntervalFor(video).Seconds())
+}
+
+// Checks if the video is due for a refresh
+func (s Schedule) IsDue(video VideoDdbAttributes, now time.Time) bool {
+	return now.Unix() >= s.NextPollAt(video)
+}
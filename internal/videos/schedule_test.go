@@ -0,0 +1,78 @@
+package videos_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ricomonster/black-flag/internal/videos"
+)
+
+func TestIntervalFor(t *testing.T) {
+	now := time.Now()
+	schedule := videos.Schedule{
+		Interval:    time.Hour,
+		Adaptive:    true,
+		MinInterval: 5 * time.Minute,
+		MaxInterval: 24 * time.Hour,
+		Channels:    map[string]time.Duration{"UC_override": 30 * time.Minute},
+		Videos:      map[string]time.Duration{"video_override": 10 * time.Minute},
+	}
+
+	tests := []struct {
+		name  string
+		video videos.VideoDdbAttributes
+		want  time.Duration
+	}{
+		{
+			name:  "video override",
+			video: videos.VideoDdbAttributes{Id: "video_override", Channel: videos.VideoChannelAttributes{Id: "UC_override"}},
+			want:  10 * time.Minute,
+		},
+		{
+			name:  "channel override",
+			video: videos.VideoDdbAttributes{Id: "video", Channel: videos.VideoChannelAttributes{Id: "UC_override"}},
+			want:  30 * time.Minute,
+		},
+		{
+			name:  "no data",
+			video: videos.VideoDdbAttributes{Id: "video"},
+			want:  time.Hour,
+		},
+		{
+			name:  "fresh upload",
+			video: videos.VideoDdbAttributes{Id: "video", PublishedAt: now.Add(-time.Hour).Unix()},
+			want:  5 * time.Minute,
+		},
+		{
+			name: "old and stale",
+			video: videos.VideoDdbAttributes{
+				Id:          "video",
+				PublishedAt: now.AddDate(-5, 0, 0).Unix(),
+				ViewLogs: []videos.VideoViewAttributes{
+					{Views: 1000000, Timestamp: now.Add(-2 * time.Hour).Unix()},
+					{Views: 1000002, Timestamp: now.Add(-time.Hour).Unix()},
+				},
+			},
+			want: 24 * time.Hour,
+		},
+		{
+			name: "old but trending",
+			video: videos.VideoDdbAttributes{
+				Id:          "video",
+				PublishedAt: now.AddDate(-5, 0, 0).Unix(),
+				ViewLogs: []videos.VideoViewAttributes{
+					{Views: 995000, Timestamp: now.Add(-2 * time.Hour).Unix()},
+					{Views: 1000000, Timestamp: now.Add(-time.Hour).Unix()},
+				},
+			},
+			want: 2 * time.Hour,
+		},
+	}
+
+	for _, test := range tests {
+		got := schedule.IntervalFor(test.video)
+		if got.Round(time.Minute) != test.want {
+			t.Errorf("TestIntervalFor: %s expected %v, got %v", test.name, test.want, got)
+		}
+	}
+}
@@ -1,27 +1,53 @@
 package videos
 
 import (
+	"errors"
+	"log"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/ricomonster/black-flag/internal/aws/dynamodb"
+	"github.com/ricomonster/black-flag/internal/metrics"
+	"github.com/ricomonster/black-flag/internal/migrate"
 	"github.com/ricomonster/black-flag/internal/youtube"
+	youtube_api "google.golang.org/api/youtube/v3"
 )
 
+// ChannelId and PollBucket are copies kept at the top for the indexes, keys of an index can't be empty strings.
+// Version is incremented on every write so two refreshes of the same video can't both record a sample.
 type VideoDdbAttributes struct {
-	Id                string                 `dynamodbav:"Id"`
-	Title             string                 `dynamodbav:"Title"`
-	Channel           VideoChannelAttributes `dynamodbav:"Channel"`
-	LastActivityAt    int64                  `dynamodbav:"LastActivityAt"`
-	ViewLogs          []VideoViewAttributes  `dynamodbav:"ViewLogs"`
-	Created           int64                  `dynamodbav:"Created"`
-	Modified          int64                  `dynamodbav:"Modified"`
-	TestAttribute     string                 `dynamodbav:"TestAttribute"`
-	TestAttributeHana int                    `dynamodbav:"TestAttributeHana"`
+	Id             string                 `dynamodbav:"Id" dynamodbkey:"partition"`
+	Title          string                 `dynamodbav:"Title"`
+	Channel        VideoChannelAttributes `dynamodbav:"Channel"`
+	LastActivityAt int64                  `dynamodbav:"LastActivityAt"`
+	NextPollAt     int64                  `dynamodbav:"NextPollAt"`
+	PublishedAt    int64                  `dynamodbav:"PublishedAt"`
+	UnavailableAt  int64                  `dynamodbav:"UnavailableAt"`
+	ViewLogs       []VideoViewAttributes  `dynamodbav:"ViewLogs"`
+	Created        int64                  `dynamodbav:"Created"`
+	Modified       int64                  `dynamodbav:"Modified"`
+	SchemaVersion  int                    `dynamodbav:"SchemaVersion"`
+	ChannelId      string                 `dynamodbav:"ChannelId,omitempty"`
+	PollBucket     string                 `dynamodbav:"PollBucket,omitempty"`
+	Version        int64                  `dynamodbav:"Version" dynamodbversion:"true"`
+}
+
+// The video was deleted or made private since we last refreshed it, UnavailableAt is the
+// last time Youtube told us it is gone
+func (v VideoDdbAttributes) Unavailable() bool {
+	return v.UnavailableAt > v.LastActivityAt
 }
 
 type VideoViewAttributes struct {
 	Views     int   `dynamodbav:"Views"`
+	Likes     int   `dynamodbav:"Likes"`
+	Comments  int   `dynamodbav:"Comments"`
 	Timestamp int64 `dynamodbav:"Timestamp"`
 }
 
@@ -31,22 +57,103 @@ type VideoChannelAttributes struct {
 }
 
 type SaveVideoOptions struct {
-	Id      string
-	Title   string
-	Channel VideoChannelAttributes
-	Views   int
+	Id          string
+	Title       string
+	Channel     VideoChannelAttributes
+	Views       int
+	Likes       int
+	Comments    int
+	PublishedAt int64
+}
+
+type ProcessVideoStatOptions struct {
+	// Fetches the stats from Youtube even if the video is not yet due
+	Force bool
+	// The video as it is stored when the caller already read it, it is read again when empty
+	Stored VideoDdbAttributes
+}
+
+type ProcessVideoStatStatus string
+
+var (
+	STATUS_REFRESHED ProcessVideoStatStatus = "refreshed"
+	STATUS_THROTTLED ProcessVideoStatStatus = "throttled"
+	STATUS_FAILED    ProcessVideoStatStatus = "failed"
+)
+
+type ProcessVideoStatResult struct {
+	Video  VideoDdbAttributes
+	Status ProcessVideoStatStatus
+	// Unix timestamp when a throttled video can be refreshed again
+	EligibleAt int64
+	Error      error
+}
+
+// Returns how long until a throttled video can be refreshed again
+func (r ProcessVideoStatResult) EligibleIn(now time.Time) time.Duration {
+	if r.Status != STATUS_THROTTLED {
+		return 0
+	}
+
+	eligibleIn := time.Unix(r.EligibleAt, 0).Sub(now)
+	if eligibleIn < 0 {
+		return 0
+	}
+
+	return eligibleIn
 }
 
 type videos struct {
 	dynamodb *dynamodb.DynamoDB[VideoDdbAttributes]
 	youtube  *youtube.Youtube
+	schedule Schedule
+
+	// Called every time a new sample was recorded
+	sampleListeners []func(VideoDdbAttributes)
+
+	// Set once every stored video was seen at the latest schema version. Videos written before the indexes
+	// don't have their keys, those are only found by scanning until db migrate upgrades them.
+	indexed       atomic.Bool
+	warnUnindexed sync.Once
 }
 
-var TABLE = "BlackFlag_Videos"
+var (
+	TABLE = "BlackFlag_Videos"
+
+	CHANNEL_INDEX = "ChannelIndex"
+	POLL_INDEX    = "PollIndex"
+	// Every video is in the same bucket of the poll index
+	POLL_BUCKET = "videos"
+)
+
+// Table created by init-table. The indexes list the videos of a channel and the videos due for a refresh,
+// PollBucket is the same for every video so NextPollAt can be queried as a range.
+var SCHEMA = dynamodb.TableSchema{
+	Name:    TABLE,
+	HashKey: dynamodb.KeyAttribute{Name: "Id", Type: types.ScalarAttributeTypeS},
+	Indexes: []dynamodb.IndexSchema{
+		{
+			Name:     CHANNEL_INDEX,
+			HashKey:  dynamodb.KeyAttribute{Name: "ChannelId", Type: types.ScalarAttributeTypeS},
+			RangeKey: &dynamodb.KeyAttribute{Name: "LastActivityAt", Type: types.ScalarAttributeTypeN},
+		},
+		{
+			Name:     POLL_INDEX,
+			HashKey:  dynamodb.KeyAttribute{Name: "PollBucket", Type: types.ScalarAttributeTypeS},
+			RangeKey: &dynamodb.KeyAttribute{Name: "NextPollAt", Type: types.ScalarAttributeTypeN},
+		},
+	},
+}
 
 func NewVideos() (*videos, error) {
 	// Instantiate DynamoDB service
-	ddbSvc := dynamodb.NewDynamoDB[VideoDdbAttributes](TABLE)
+	ddbSvc, err := dynamodb.NewDynamoDB[VideoDdbAttributes](TABLE)
+	if err != nil {
+		return &videos{}, err
+	}
+
+	// Videos that were not migrated yet are upgraded as they are read
+	ddbSvc.SetUpgrader(MIGRATIONS)
 
 	// Instantiate youtube lib
 	youtubeLib, err := youtube.NewYoutube()
@@ -54,7 +161,34 @@ func NewVideos() (*videos, error) {
 		return &videos{}, err
 	}
 
-	return &videos{dynamodb: ddbSvc, youtube: youtubeLib}, nil
+	schedule, err := NewScheduleFromEnv()
+	if err != nil {
+		return &videos{}, err
+	}
+
+	return &videos{dynamodb: ddbSvc, youtube: youtubeLib, schedule: schedule}, nil
+}
+
+// Returns the refresh schedule used to throttle the Youtube API calls
+func (v *videos) Schedule() Schedule {
+	return v.schedule
+}
+
+// Replaces the refresh schedule, e.g. when the intervals are overridden through flags
+func (v *videos) SetSchedule(schedule Schedule) {
+	v.schedule = schedule
+}
+
+// Registers a function that is called every time a new sample was recorded for a video.
+// Listeners should be registered before the lib is used concurrently.
+func (v *videos) OnSample(listener func(VideoDdbAttributes)) {
+	v.sampleListeners = append(v.sampleListeners, listener)
+}
+
+func (v *videos) notifySample(video VideoDdbAttributes) {
+	for _, listener := range v.sampleListeners {
+		listener(video)
+	}
 }
 
 // Fetches all the stored videos records saved.
@@ -67,10 +201,126 @@ func (v *videos) GetVideos() ([]VideoDdbAttributes, error) {
 	return videos, nil
 }
 
+// Videos of the channel, most recently refreshed first
+func (v *videos) GetChannelVideos(channelId string) ([]VideoDdbAttributes, error) {
+	matches := func(video VideoDdbAttributes) bool { return video.Channel.Id == channelId }
+	if !v.indexed.Load() {
+		return v.scanVideos(matches)
+	}
+
+	items, err := v.dynamodb.QueryAll(dynamodb.QueryOptions{
+		Index:      CHANNEL_INDEX,
+		Key:        expression.Key("ChannelId").Equal(expression.Value(channelId)),
+		Descending: true,
+	})
+	if errors.Is(err, dynamodb.ErrIndexNotFound) {
+		return v.scanVideos(matches)
+	}
+
+	return items, err
+}
+
+// Videos with a next poll at or before until, the ones due first come first.
+// Callers still check the schedule, this only narrows down what is read.
+func (v *videos) GetDueVideos(until time.Time) ([]VideoDdbAttributes, error) {
+	matches := func(video VideoDdbAttributes) bool { return video.NextPollAt <= until.Unix() }
+	if !v.indexed.Load() {
+		return v.scanVideos(matches)
+	}
+
+	items, err := v.dynamodb.QueryAll(dynamodb.QueryOptions{
+		Index: POLL_INDEX,
+		Key: expression.Key("PollBucket").Equal(expression.Value(POLL_BUCKET)).
+			And(expression.Key("NextPollAt").LessThanEqual(expression.Value(until.Unix()))),
+	})
+	if errors.Is(err, dynamodb.ErrIndexNotFound) {
+		return v.scanVideos(matches)
+	}
+
+	return items, err
+}
+
+// What is read of the videos that are only listed, the view logs are left out
+var HEADER_ATTRIBUTES = []string{"Id", "Title", "Channel", "LastActivityAt", "NextPollAt", "PublishedAt", "UnavailableAt", "Created", "Modified", "SchemaVersion", "ChannelId", "PollBucket", "Version"}
+
+// Videos that are not due until after the time, without their view logs when the index is there.
+// Used to list them next to the due ones.
+func (v *videos) GetWaitingVideos(after time.Time) ([]VideoDdbAttributes, error) {
+	matches := func(video VideoDdbAttributes) bool { return video.NextPollAt > after.Unix() }
+	if !v.indexed.Load() {
+		return v.scanVideos(matches)
+	}
+
+	items, err := v.dynamodb.QueryAll(dynamodb.QueryOptions{
+		Index: POLL_INDEX,
+		Key: expression.Key("PollBucket").Equal(expression.Value(POLL_BUCKET)).
+			And(expression.Key("NextPollAt").GreaterThan(expression.Value(after.Unix()))),
+		Projection: HEADER_ATTRIBUTES,
+	})
+	if errors.Is(err, dynamodb.ErrIndexNotFound) {
+		return v.scanVideos(matches)
+	}
+
+	return items, err
+}
+
+// Tables created before the indexes existed are scanned until init-table adds them, and until every
+// video was migrated since the indexes would miss the ones written before
+func (v *videos) scanVideos(matches func(VideoDdbAttributes) bool) ([]VideoDdbAttributes, error) {
+	var (
+		results []VideoDdbAttributes
+		behind  int
+		start   map[string]types.AttributeValue
+	)
+
+	for {
+		items, next, err := v.dynamodb.ScanRaw(start, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			if migrate.VersionOf(item) < MIGRATIONS.Latest() {
+				behind++
+			}
+
+			upgraded, err := MIGRATIONS.Upgrade(item)
+			if err != nil {
+				return nil, err
+			}
+
+			var video VideoDdbAttributes
+			if err := attributevalue.UnmarshalMap(upgraded, &video); err != nil {
+				return nil, err
+			}
+
+			if matches(video) {
+				results = append(results, video)
+			}
+		}
+
+		if next == nil {
+			break
+		}
+		start = next
+	}
+
+	if behind == 0 {
+		v.indexed.Store(true)
+		return results, nil
+	}
+
+	v.warnUnindexed.Do(func() {
+		log.Printf("%d videos were saved before the indexes and are scanned on every read, run `black-flag db migrate` to upgrade them\n", behind)
+	})
+
+	return results, nil
+}
+
 // Find a video record in the DynamoDB table
 func (v *videos) FindVideo(id string) (VideoDdbAttributes, error) {
 	// Check if the video already exists in DynamoDB
-	item, err := v.dynamodb.FindById("Id", id)
+	item, err := v.dynamodb.FindByKey(dynamodb.Key{Partition: id})
 	if err != nil {
 		return VideoDdbAttributes{}, err
 	}
@@ -78,6 +328,237 @@ func (v *videos) FindVideo(id string) (VideoDdbAttributes, error) {
 	return item, nil
 }
 
+// Reads the videos in batches, videos we don't track are not in the result.
+// A dynamodb.BatchErrors tells which ones couldn't be read, the rest are still returned.
+func (v *videos) FindVideos(ids []string) (map[string]VideoDdbAttributes, error) {
+	keys := make([]dynamodb.Key, 0, len(ids))
+	for _, id := range ids {
+		if id != "" {
+			keys = append(keys, dynamodb.Key{Partition: id})
+		}
+	}
+
+	return v.dynamodb.BatchGet(keys)
+}
+
+type AddVideoResult struct {
+	Id    string
+	Video VideoDdbAttributes
+	// False when the video was already included
+	Added bool
+	Error error
+}
+
+// Adds the videos to our list, the stored ones are read at once and are returned as is.
+// Failures are reported per video, the error is only for when nothing could be done.
+func (v *videos) AddVideos(list []string) ([]AddVideoResult, error) {
+	var ids []string
+	seen := map[string]bool{}
+	for _, video := range list {
+		id := ParseVideoId(video)
+		if id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	existing, err := v.FindVideos(ids)
+
+	var failedReads dynamodb.BatchErrors
+	if err != nil && !errors.As(err, &failedReads) {
+		return nil, err
+	}
+
+	results := make([]AddVideoResult, len(ids))
+	for i, id := range ids {
+		results[i] = AddVideoResult{Id: id}
+
+		if err, ok := failedReads[id]; ok {
+			results[i].Error = err
+			continue
+		}
+
+		// Will only perform addition if the video is not yet included in our list
+		if item, ok := existing[id]; ok {
+			results[i].Video = item
+			continue
+		}
+
+		// Get video details from youtube
+		videoDetails, err := v.youtube.GetVideoDetails(id)
+		if err != nil {
+			results[i].Error = err
+			continue
+		}
+
+		// Someone else may add it in the meantime, it is only written when it is still missing
+		video, err := v.dynamodb.Create(v.newVideo(NewSaveVideoOptions(videoDetails)))
+		if errors.Is(err, dynamodb.ErrAlreadyExists) {
+			results[i].Video, results[i].Error = v.FindVideo(id)
+			continue
+		}
+		if err != nil {
+			results[i].Error = err
+			continue
+		}
+
+		results[i].Video = video
+		results[i].Added = true
+		v.notifySample(video)
+	}
+
+	return results, nil
+}
+
+// Adds the video to our list, videos that are already included are returned as is.
+// The second return value tells if the video was newly added.
+func (v *videos) AddVideo(video string) (VideoDdbAttributes, bool, error) {
+	id := ParseVideoId(video)
+
+	item, err := v.FindVideo(id)
+	if err != nil {
+		return VideoDdbAttributes{}, false, err
+	}
+
+	// Will only perform addition if the video is not yet included in our list
+	if item.Id != "" {
+		return item, false, nil
+	}
+
+	// Get video details from youtube
+	videoDetails, err := v.youtube.GetVideoDetails(id)
+	if err != nil {
+		return VideoDdbAttributes{}, false, err
+	}
+
+	// Save the video data
+	item, err = v.saveVideo(item, NewSaveVideoOptions(videoDetails))
+	if errors.Is(err, dynamodb.ErrAlreadyExists) {
+		item, err = v.FindVideo(id)
+		return item, false, err
+	}
+	if err != nil {
+		return VideoDdbAttributes{}, false, err
+	}
+
+	v.notifySample(item)
+
+	return item, true, nil
+}
+
+type ViewLogsImport struct {
+	// As planned, the title and channel are used when we don't track the video yet
+	Video VideoDdbAttributes
+	// Samples to bring in, the ones stored in the meantime for the same time are kept
+	Samples []VideoViewAttributes
+}
+
+// Merges imported samples into the view logs of the videos, videos we don't track yet are created.
+// Each video is read and written back at its version so samples recorded since the import was planned
+// are kept. That is one Modify per video rather than a batch, BatchWriteItem can't carry the version
+// condition. A dynamodb.BatchErrors tells which ones failed.
+func (v *videos) ImportViewLogs(imports []ViewLogsImport) error {
+	failed := dynamodb.BatchErrors{}
+	for _, imported := range imports {
+		_, err := v.dynamodb.Modify(dynamodb.Key{Partition: imported.Video.Id}, func(video *VideoDdbAttributes) error {
+			now := time.Now().Unix()
+
+			if video.Created == 0 {
+				*video = VideoDdbAttributes{
+					Id:            imported.Video.Id,
+					Title:         imported.Video.Title,
+					Channel:       imported.Video.Channel,
+					PublishedAt:   imported.Video.PublishedAt,
+					Created:       now,
+					SchemaVersion: MIGRATIONS.Latest(),
+				}
+			}
+
+			stored := map[int64]bool{}
+			for _, log := range video.ViewLogs {
+				stored[log.Timestamp] = true
+			}
+
+			for _, sample := range imported.Samples {
+				if !stored[sample.Timestamp] {
+					video.ViewLogs = append(video.ViewLogs, sample)
+				}
+			}
+
+			sort.SliceStable(video.ViewLogs, func(i, j int) bool {
+				return video.ViewLogs[i].Timestamp < video.ViewLogs[j].Timestamp
+			})
+
+			// Treat the latest imported sample as the last refresh so the schedule picks it up from there
+			if video.LastActivityAt == 0 && len(video.ViewLogs) > 0 {
+				video.LastActivityAt = video.ViewLogs[len(video.ViewLogs)-1].Timestamp
+			}
+
+			video.Modified = now
+			video.ChannelId = video.Channel.Id
+			video.PollBucket = POLL_BUCKET
+			return nil
+		})
+		if err != nil {
+			failed[imported.Video.Id] = err
+		}
+	}
+
+	if len(failed) > 0 {
+		return failed
+	}
+
+	return nil
+}
+
+// Saves the videos as they are, replacing whatever is stored. Used when restoring a backup.
+// Each one is written above the stored version so a refresh that read the video before fails its write.
+// That takes a read and a conditional write per video, BatchWriteItem can't carry a condition.
+// A dynamodb.BatchErrors tells which ones failed.
+func (v *videos) PutVideos(items []VideoDdbAttributes) error {
+	failed := dynamodb.BatchErrors{}
+	for _, item := range items {
+		item.ChannelId = item.Channel.Id
+		item.PollBucket = POLL_BUCKET
+
+		if _, err := v.dynamodb.Replace(item); err != nil {
+			failed[item.Id] = err
+		}
+	}
+
+	if len(failed) > 0 {
+		return failed
+	}
+
+	return nil
+}
+
+// Removes the video and all of its recorded stats
+func (v *videos) DeleteVideo(id string) error {
+	return v.dynamodb.DeleteItem(dynamodb.Key{Partition: id})
+}
+
+// Maps the video details from the Youtube API to the data we save
+func NewSaveVideoOptions(video youtube_api.Video) SaveVideoOptions {
+	options := SaveVideoOptions{
+		Id:       video.Id,
+		Title:    video.Snippet.Title,
+		Views:    int(video.Statistics.ViewCount),
+		Likes:    int(video.Statistics.LikeCount),
+		Comments: int(video.Statistics.CommentCount),
+		Channel: VideoChannelAttributes{
+			Id:    video.Snippet.ChannelId,
+			Title: video.Snippet.ChannelTitle,
+		},
+	}
+
+	if publishedAt, err := time.Parse(time.RFC3339, video.Snippet.PublishedAt); err == nil {
+		options.PublishedAt = publishedAt.Unix()
+	}
+
+	return options
+}
+
 // Handles saving and updating video data to DynamoDB
 func (v *videos) SaveVideo(options SaveVideoOptions) error {
 	// Check if the video already exists so we'll just update it
@@ -86,89 +567,206 @@ func (v *videos) SaveVideo(options SaveVideoOptions) error {
 		return err
 	}
 
-	viewLog := VideoViewAttributes{Views: options.Views, Timestamp: time.Now().Unix()}
+	_, err = v.saveVideo(item, options)
 
+	return err
+}
+
+// Records a new sample for the stored video, item is empty when we don't track the video yet.
+// Returns the video as it is stored with the new sample.
+func (v *videos) saveVideo(item VideoDdbAttributes, options SaveVideoOptions) (VideoDdbAttributes, error) {
 	if item.Id == "" {
-		// Insert
-		err := v.dynamodb.PutItem(VideoDdbAttributes{
-			Id:             options.Id,
-			Title:          options.Title,
-			Channel:        options.Channel,
-			LastActivityAt: time.Now().Unix(),
-			ViewLogs:       []VideoViewAttributes{viewLog},
-			Created:        time.Now().Unix(),
-			Modified:       time.Now().Unix(),
-		})
-		if err != nil {
-			return err
-		}
+		// Insert, unless someone else added it since it was read
+		return v.dynamodb.Create(v.newVideo(options))
 	}
 
-	// Update
-	// Append to the ViewLog
+	viewLog := newViewLog(options)
 	updatedViewLog := append(item.ViewLogs, viewLog)
-	err = v.dynamodb.UpdateItem("Id", options.Id, VideoDdbAttributes{
-		ViewLogs:       updatedViewLog,
-		LastActivityAt: time.Now().Unix(),
+
+	// Compute when we should refresh this video again, this is based on the view logs including the new one
+	interval := v.schedule.IntervalFor(VideoDdbAttributes{
+		Id:          options.Id,
+		Channel:     options.Channel,
+		PublishedAt: options.PublishedAt,
+		Created:     item.Created,
+		ViewLogs:    updatedViewLog,
 	})
+
+	now := time.Now()
+	changes := item
+	changes.LastActivityAt = now.Unix()
+	changes.NextPollAt = now.Add(interval).Unix()
+	changes.PublishedAt = options.PublishedAt
+	changes.Modified = now.Unix()
+	changes.ChannelId = options.Channel.Id
+	changes.PollBucket = POLL_BUCKET
+
+	// Keep the publish date we have when Youtube didn't give us one
+	mask := []string{"LastActivityAt", "NextPollAt", "Modified", "ChannelId", "PollBucket"}
+	if options.PublishedAt != 0 {
+		mask = append(mask, "PublishedAt")
+	}
+
+	update, err := v.dynamodb.UpdateMask(changes, mask...)
 	if err != nil {
-		return err
+		return item, err
 	}
 
-	return nil
+	// Update
+	// Append to the ViewLog, only if nobody else did since we read the video (dynamodb.ErrConflict otherwise).
+	// The video could have been deleted since we read it, it is not created again.
+	update.Append("ViewLogs", []VideoViewAttributes{viewLog}).If(expression.AttributeExists(expression.Name("Id")))
+
+	return v.dynamodb.UpdateItem(dynamodb.Key{Partition: options.Id}, update)
 }
 
-// This will handle fetching of video stats from Youtube API and saving it to DynamoDB
-func (v *videos) ProcessVideoStat(video string) (VideoDdbAttributes, error) {
-	id := video
-	if strings.Contains(id, "?") {
+// A video we start tracking with its first sample
+func (v *videos) newVideo(options SaveVideoOptions) VideoDdbAttributes {
+	now := time.Now()
+
+	video := VideoDdbAttributes{
+		Id:             options.Id,
+		Title:          options.Title,
+		Channel:        options.Channel,
+		LastActivityAt: now.Unix(),
+		PublishedAt:    options.PublishedAt,
+		ViewLogs:       []VideoViewAttributes{newViewLog(options)},
+		Created:        now.Unix(),
+		Modified:       now.Unix(),
+		SchemaVersion:  MIGRATIONS.Latest(),
+		ChannelId:      options.Channel.Id,
+		PollBucket:     POLL_BUCKET,
+	}
+	video.NextPollAt = now.Add(v.schedule.IntervalFor(video)).Unix()
+
+	return video
+}
+
+func newViewLog(options SaveVideoOptions) VideoViewAttributes {
+	return VideoViewAttributes{
+		Views:     options.Views,
+		Likes:     options.Likes,
+		Comments:  options.Comments,
+		Timestamp: time.Now().Unix(),
+	}
+}
+
+// Throttled returns the result for a video that is not yet due for a refresh
+func (v *videos) Throttled(video VideoDdbAttributes) ProcessVideoStatResult {
+	metrics.ThrottledSkips.Inc()
+
+	return ProcessVideoStatResult{
+		Video:      video,
+		Status:     STATUS_THROTTLED,
+		EligibleAt: v.schedule.NextPollAt(video),
+	}
+}
+
+// Returns the video id from either a Youtube URL or the id itself
+func ParseVideoId(video string) string {
+	if strings.Contains(video, "?") {
 		// Split
 		splitString := strings.Split(video, "v=")
-		id = splitString[1]
+		if len(splitString) > 1 {
+			video, _, _ = strings.Cut(splitString[1], "&")
+		}
+	}
+
+	return video
+}
+
+// This will handle fetching of video stats from Youtube API and saving it to DynamoDB
+func (v *videos) ProcessVideoStat(video string, options ProcessVideoStatOptions) (ProcessVideoStatResult, error) {
+	started := time.Now()
+
+	result, err := v.processVideoStat(ParseVideoId(video), options)
+
+	metrics.Refreshes.WithLabelValues(string(result.Status)).Inc()
+	if result.Status != STATUS_THROTTLED {
+		metrics.RefreshDuration.WithLabelValues(string(result.Status)).Observe(time.Since(started).Seconds())
 	}
 
+	return result, err
+}
+
+func (v *videos) processVideoStat(id string, options ProcessVideoStatOptions) (ProcessVideoStatResult, error) {
 	// Get the video from dynamodb
-	videoItem, err := v.FindVideo(id)
-	if err != nil {
-		return VideoDdbAttributes{}, err
+	videoItem := options.Stored
+	if videoItem.Id != id {
+		var err error
+		if videoItem, err = v.FindVideo(id); err != nil {
+			return failed(VideoDdbAttributes{Id: id}, err)
+		}
 	}
 
 	// Check if video exists
-	if videoItem.Id != "" {
+	stored := videoItem
+	if videoItem.Id == "" {
+		videoItem.Id = id
+	} else if !options.Force {
 		// Video already exists but before we proceed, let's make sure that we do not abuse the endpoint
-		// so we need to check if the last activity for this record was more than 60 minutes
-		currentTimestamp := time.Now().Unix()
-		diff := currentTimestamp - videoItem.LastActivityAt
-		if diff <= 3600 {
-			return videoItem, nil
+		// so we need to check if the video is already due based on its schedule (hourly by default)
+		if !v.schedule.IsDue(videoItem, time.Now()) {
+			return v.Throttled(videoItem), nil
 		}
 	}
 
 	// Get data from Youtube
 	youtubeVideoData, err := v.youtube.GetVideoDetails(id)
+	if errors.Is(err, youtube.ErrVideoNotFound) && videoItem.Created != 0 {
+		return v.markUnavailable(videoItem, err)
+	}
 	if err != nil {
-		return VideoDdbAttributes{}, err
+		return failed(videoItem, err)
 	}
 
 	// Save data to dynamodb
-	err = v.SaveVideo(SaveVideoOptions{
-		Id:    youtubeVideoData.Id,
-		Title: youtubeVideoData.Snippet.Title,
-		Views: int(youtubeVideoData.Statistics.ViewCount),
-		Channel: VideoChannelAttributes{
-			Id:    youtubeVideoData.Snippet.ChannelId,
-			Title: youtubeVideoData.Snippet.ChannelTitle,
-		},
-	})
+	saved, err := v.saveVideo(stored, NewSaveVideoOptions(youtubeVideoData))
+	if errors.Is(err, dynamodb.ErrConflict) {
+		return v.refreshedElsewhere(videoItem, err)
+	}
 	if err != nil {
-		return VideoDdbAttributes{}, err
+		return failed(videoItem, err)
+	}
+	videoItem = saved
+
+	v.notifySample(videoItem)
+
+	return ProcessVideoStatResult{Video: videoItem, Status: STATUS_REFRESHED}, nil
+}
+
+// Someone else, e.g. another watch, recorded a sample since we read the video. Theirs is as good as ours
+// so the video counts as throttled.
+func (v *videos) refreshedElsewhere(video VideoDdbAttributes, conflict error) (ProcessVideoStatResult, error) {
+	latest, err := v.FindVideo(video.Id)
+	if err != nil || latest.Id == "" {
+		return failed(video, conflict)
+	}
+
+	return v.Throttled(latest), nil
+}
+
+// Keeps the video and its history but remembers that it is gone, we still check on it on its usual schedule
+func (v *videos) markUnavailable(video VideoDdbAttributes, reason error) (ProcessVideoStatResult, error) {
+	now := time.Now()
+
+	video.UnavailableAt = now.Unix()
+	video.NextPollAt = now.Add(v.schedule.IntervalFor(video)).Unix()
+	video.Modified = now.Unix()
+
+	update, err := v.dynamodb.UpdateMask(video, "UnavailableAt", "NextPollAt", "Modified")
+	if err != nil {
+		return failed(video, err)
 	}
 
-	// Get again the data from dynamodb
-	videoItem, err = v.FindVideo(id)
+	_, err = v.dynamodb.UpdateItem(dynamodb.Key{Partition: video.Id}, update.If(expression.AttributeExists(expression.Name("Id"))))
 	if err != nil {
-		return VideoDdbAttributes{}, err
+		return failed(video, err)
 	}
 
-	return videoItem, nil
+	return failed(video, reason)
+}
+
+func failed(video VideoDdbAttributes, err error) (ProcessVideoStatResult, error) {
+	return ProcessVideoStatResult{Video: video, Status: STATUS_FAILED, Error: err}, err
 }
@@ -0,0 +1,376 @@
+package videos_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	awsdynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb"
+	"github.com/ricomonster/black-flag/internal/aws/dynamodb/ddbtest"
+	"github.com/ricomonster/black-flag/internal/migrate"
+	"github.com/ricomonster/black-flag/internal/videos"
+	"github.com/ricomonster/black-flag/internal/youtube"
+	"github.com/ricomonster/black-flag/internal/youtube/youtubetest"
+)
+
+func newTestVideos(t *testing.T) (*youtubetest.Server, *ddbtest.Fake) {
+	server := youtubetest.NewServer()
+	t.Cleanup(server.Close)
+	t.Setenv("BLACK_FLAG_YOUTUBE_ENDPOINT", server.Endpoint())
+
+	fake := ddbtest.New(videos.TABLE)
+	dynamodb.SetDefaultClient(fake)
+	t.Cleanup(func() { dynamodb.SetDefaultClient(nil) })
+
+	return server, fake
+}
+
+func TestAddVideo(t *testing.T) {
+	server, _ := newTestVideos(t)
+	server.AddVideo("video1", "First video", "UC1", "Channel", "2023-10-01T00:00:00Z", 1000)
+
+	videoLib, err := videos.NewVideos()
+	if err != nil {
+		t.Fatalf("TestAddVideo: Error %v", err)
+	}
+
+	video, added, err := videoLib.AddVideo("https://www.youtube.com/watch?v=video1&t=10")
+	if err != nil {
+		t.Fatalf("TestAddVideo: Error %v", err)
+	}
+	if !added || video.Title != "First video" || video.Channel.Title != "Channel" || video.PublishedAt == 0 {
+		t.Errorf("TestAddVideo: got %+v, added %v", video, added)
+	}
+	if len(video.ViewLogs) != 1 || video.ViewLogs[0].Views != 1000 {
+		t.Errorf("TestAddVideo: expected a single sample of 1000 views, got %+v", video.ViewLogs)
+	}
+
+	// Adding it again doesn't call Youtube
+	requests := server.Requests()
+	if _, added, err := videoLib.AddVideo("video1"); err != nil || added {
+		t.Errorf("TestAddVideo: expected the video to be already added, got %v, %v", added, err)
+	}
+	if server.Requests() != requests {
+		t.Errorf("TestAddVideo: expected no request to Youtube for a video already added")
+	}
+}
+
+func TestProcessVideoStat(t *testing.T) {
+	server, fake := newTestVideos(t)
+	server.AddVideo("video1", "First video", "UC1", "Channel", "2023-10-01T00:00:00Z", 1000)
+
+	videoLib, err := videos.NewVideos()
+	if err != nil {
+		t.Fatalf("TestProcessVideoStat: Error %v", err)
+	}
+	if _, _, err := videoLib.AddVideo("video1"); err != nil {
+		t.Fatalf("TestProcessVideoStat: Error %v", err)
+	}
+
+	// Not due yet
+	result, err := videoLib.ProcessVideoStat("video1", videos.ProcessVideoStatOptions{})
+	if err != nil || result.Status != videos.STATUS_THROTTLED {
+		t.Errorf("TestProcessVideoStat: expected throttled, got %s, %v", result.Status, err)
+	}
+
+	server.SetViews("video1", 1500)
+	result, err = videoLib.ProcessVideoStat("video1", videos.ProcessVideoStatOptions{Force: true})
+	if err != nil || result.Status != videos.STATUS_REFRESHED {
+		t.Fatalf("TestProcessVideoStat: expected refreshed, got %s, %v", result.Status, err)
+	}
+	if logs := result.Video.ViewLogs; len(logs) != 2 || logs[1].Views != 1500 {
+		t.Errorf("TestProcessVideoStat: expected a new sample of 1500 views, got %+v", logs)
+	}
+
+	// Another instance refreshed it after we read it, only one sample is recorded
+	stale := result.Video
+	if _, err := videoLib.ProcessVideoStat("video1", videos.ProcessVideoStatOptions{Force: true}); err != nil {
+		t.Fatalf("TestProcessVideoStat: Error %v", err)
+	}
+	result, err = videoLib.ProcessVideoStat("video1", videos.ProcessVideoStatOptions{Force: true, Stored: stale})
+	if err != nil || result.Status != videos.STATUS_THROTTLED || len(result.Video.ViewLogs) != 3 {
+		t.Errorf("TestProcessVideoStat: expected the stale refresh to be throttled, got %s with %d samples, %v", result.Status, len(result.Video.ViewLogs), err)
+	}
+
+	// Quota errors fail the refresh without touching the stored video
+	server.FailNextWithQuotaExceeded()
+	writes := fake.Calls("UpdateItem")
+	result, err = videoLib.ProcessVideoStat("video1", videos.ProcessVideoStatOptions{Force: true})
+	if err == nil || result.Status != videos.STATUS_FAILED {
+		t.Errorf("TestProcessVideoStat: expected the quota error, got %s, %v", result.Status, err)
+	}
+	if fake.Calls("UpdateItem") != writes {
+		t.Errorf("TestProcessVideoStat: expected no write after a quota error")
+	}
+
+	// Deleted videos are kept and marked
+	server.RemoveVideo("video1")
+	result, err = videoLib.ProcessVideoStat("video1", videos.ProcessVideoStatOptions{Force: true})
+	if !errors.Is(err, youtube.ErrVideoNotFound) {
+		t.Errorf("TestProcessVideoStat: expected ErrVideoNotFound, got %v", err)
+	}
+
+	video, _ := videoLib.FindVideo("video1")
+	if video.UnavailableAt == 0 || len(video.ViewLogs) != 3 {
+		t.Errorf("TestProcessVideoStat: expected the video to be marked unavailable, got %+v", video)
+	}
+}
+
+func TestFindVideoUpgradesOldItems(t *testing.T) {
+	_, fake := newTestVideos(t)
+
+	// Saved before the schema was versioned
+	raw, _ := attributevalue.MarshalMap(map[string]interface{}{
+		"Id":            "video1",
+		"Title":         "Old video",
+		"TestAttribute": "Made in Japan",
+	})
+	if _, err := fake.PutItem(context.Background(), &awsdynamodb.PutItemInput{TableName: aws.String(videos.TABLE), Item: raw}); err != nil {
+		t.Fatal(err)
+	}
+
+	videoLib, err := videos.NewVideos()
+	if err != nil {
+		t.Fatalf("TestFindVideoUpgradesOldItems: Error %v", err)
+	}
+
+	video, err := videoLib.FindVideo("video1")
+	if err != nil {
+		t.Fatalf("TestFindVideoUpgradesOldItems: Error %v", err)
+	}
+	if video.Title != "Old video" || video.SchemaVersion != videos.MIGRATIONS.Latest() {
+		t.Errorf("TestFindVideoUpgradesOldItems: got %+v", video)
+	}
+
+	// Reading doesn't write anything, db migrate does
+	if _, ok := fake.Items(videos.TABLE)[0]["TestAttribute"]; !ok {
+		t.Errorf("TestFindVideoUpgradesOldItems: expected the stored item to be left alone")
+	}
+}
+
+func TestIndexQueries(t *testing.T) {
+	server, fake := newTestVideos(t)
+	server.AddVideo("video1", "First video", "UC1", "Channel", "2023-10-01T00:00:00Z", 1000)
+	server.AddVideo("video2", "Second video", "UC2", "Other channel", "2023-10-01T00:00:00Z", 1000)
+
+	videoLib, err := videos.NewVideos()
+	if err != nil {
+		t.Fatalf("TestIndexQueries: Error %v", err)
+	}
+	for _, id := range []string{"video1", "video2"} {
+		if _, _, err := videoLib.AddVideo(id); err != nil {
+			t.Fatalf("TestIndexQueries: Error %v", err)
+		}
+	}
+
+	// The fake table has no indexes yet so the videos are scanned
+	channelVideos, err := videoLib.GetChannelVideos("UC1")
+	if err != nil || len(channelVideos) != 1 || channelVideos[0].Id != "video1" {
+		t.Errorf("TestIndexQueries: expected video1 without the index, got %+v, %v", channelVideos, err)
+	}
+
+	if _, err := dynamodb.EnsureTable(videos.SCHEMA, dynamodb.WithClient(fake)); err != nil {
+		t.Fatalf("TestIndexQueries: Error %v", err)
+	}
+	scans := fake.Calls("Scan")
+
+	channelVideos, err = videoLib.GetChannelVideos("UC2")
+	if err != nil || len(channelVideos) != 1 || channelVideos[0].Id != "video2" {
+		t.Errorf("TestIndexQueries: expected video2, got %+v, %v", channelVideos, err)
+	}
+
+	// Just added so nothing is due for now
+	due, err := videoLib.GetDueVideos(time.Now())
+	if err != nil || len(due) != 0 {
+		t.Errorf("TestIndexQueries: expected no video due, got %+v, %v", due, err)
+	}
+
+	due, err = videoLib.GetDueVideos(time.Now().Add(48 * time.Hour))
+	if err != nil || len(due) != 2 {
+		t.Errorf("TestIndexQueries: expected both videos to be due in two days, got %+v, %v", due, err)
+	}
+
+	// The ones that are not due are listed from their headers
+	waiting, err := videoLib.GetWaitingVideos(time.Now())
+	if err != nil || len(waiting) != 2 || waiting[0].Title == "" || waiting[0].NextPollAt == 0 {
+		t.Errorf("TestIndexQueries: expected both videos to be waiting, got %+v, %v", waiting, err)
+	}
+	if waiting, err := videoLib.GetWaitingVideos(time.Now().Add(48 * time.Hour)); err != nil || len(waiting) != 0 {
+		t.Errorf("TestIndexQueries: expected nothing to wait in two days, got %+v, %v", waiting, err)
+	}
+
+	if fake.Calls("Scan") != scans {
+		t.Errorf("TestIndexQueries: expected the indexes to be queried instead of scanning")
+	}
+}
+
+func TestAddVideos(t *testing.T) {
+	server, fake := newTestVideos(t)
+	server.AddVideo("video1", "First video", "UC1", "Channel", "2023-10-01T00:00:00Z", 1000)
+	server.AddVideo("video2", "Second video", "UC1", "Channel", "2023-10-02T00:00:00Z", 2000)
+
+	videoLib, err := videos.NewVideos()
+	if err != nil {
+		t.Fatalf("TestAddVideos: Error %v", err)
+	}
+	if _, _, err := videoLib.AddVideo("video1"); err != nil {
+		t.Fatalf("TestAddVideos: Error %v", err)
+	}
+
+	results, err := videoLib.AddVideos([]string{"video1", "https://www.youtube.com/watch?v=video2", "video2", "missing"})
+	if err != nil {
+		t.Fatalf("TestAddVideos: Error %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("TestAddVideos: expected the duplicates to be dropped, got %+v", results)
+	}
+	if results[0].Added || results[0].Video.Title != "First video" {
+		t.Errorf("TestAddVideos: expected video1 to be already added, got %+v", results[0])
+	}
+	if !results[1].Added || results[1].Video.Title != "Second video" {
+		t.Errorf("TestAddVideos: expected video2 to be added, got %+v", results[1])
+	}
+	if results[2].Added || !errors.Is(results[2].Error, youtube.ErrVideoNotFound) {
+		t.Errorf("TestAddVideos: expected missing to fail, got %+v", results[2])
+	}
+	// video1 was written by AddVideo
+	if fake.Calls("BatchGetItem") != 1 || fake.Calls("PutItem") != 2 {
+		t.Errorf("TestAddVideos: expected a single batch read and a write for video2, got %d and %d", fake.Calls("BatchGetItem"), fake.Calls("PutItem"))
+	}
+
+	// The rest are still imported when one of them fails
+	fake.FailNext("PutItem", errors.New("throttled"))
+
+	err = videoLib.ImportViewLogs([]videos.ViewLogsImport{
+		{Video: videos.VideoDdbAttributes{Id: "video3", Title: "Imported"}, Samples: []videos.VideoViewAttributes{{Views: 5, Timestamp: 3}}},
+		{Video: results[1].Video, Samples: []videos.VideoViewAttributes{{Views: 10, Timestamp: 1}, {Views: 20, Timestamp: 2}}},
+	})
+
+	var failed dynamodb.BatchErrors
+	if !errors.As(err, &failed) || len(failed) != 1 || failed["video3"] == nil {
+		t.Fatalf("TestAddVideos: expected video3 to fail, got %v", err)
+	}
+
+	// The sample recorded when video2 was added is kept along with the imported ones
+	found, err := videoLib.FindVideos([]string{"video2", "video3"})
+	if err != nil {
+		t.Fatalf("TestAddVideos: Error %v", err)
+	}
+	if logs := found["video2"].ViewLogs; len(found) != 1 || len(logs) != 3 || logs[0].Views != 10 || logs[2].Views != 2000 {
+		t.Errorf("TestAddVideos: expected only video2 to be imported, got %+v", found)
+	}
+
+	// Planned before someone else recorded a sample, it is merged in rather than overwriting it
+	err = videoLib.ImportViewLogs([]videos.ViewLogsImport{
+		{Video: results[1].Video, Samples: []videos.VideoViewAttributes{{Views: 30, Timestamp: 4}}},
+	})
+	if err != nil {
+		t.Fatalf("TestAddVideos: Error %v", err)
+	}
+
+	stored, err := videoLib.FindVideos([]string{"video2"})
+	if err != nil || len(stored["video2"].ViewLogs) != 4 || stored["video2"].Version <= found["video2"].Version {
+		t.Errorf("TestAddVideos: expected the stored samples to be kept, got %+v, %v", stored, err)
+	}
+}
+
+// Adds the video behind the back of the lib once it was read
+type addingClient struct {
+	*ddbtest.Fake
+	add func()
+}
+
+func (c addingClient) BatchGetItem(ctx context.Context, params *awsdynamodb.BatchGetItemInput, optFns ...func(*awsdynamodb.Options)) (*awsdynamodb.BatchGetItemOutput, error) {
+	output, err := c.Fake.BatchGetItem(ctx, params, optFns...)
+	c.add()
+	return output, err
+}
+
+func TestAddVideosAddedMeanwhile(t *testing.T) {
+	server, fake := newTestVideos(t)
+	server.AddVideo("video1", "First video", "UC1", "Channel", "2023-10-01T00:00:00Z", 1000)
+
+	other, err := videos.NewVideos()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dynamodb.SetDefaultClient(addingClient{Fake: fake, add: func() {
+		if _, _, err := other.AddVideo("video1"); err != nil {
+			t.Fatal(err)
+		}
+		server.SetViews("video1", 1500)
+	}})
+
+	videoLib, err := videos.NewVideos()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := videoLib.AddVideos([]string{"video1"})
+	if err != nil {
+		t.Fatalf("TestAddVideosAddedMeanwhile: Error %v", err)
+	}
+
+	// The video added by the other one is kept and reported as already added
+	if len(results) != 1 || results[0].Added || results[0].Error != nil || len(results[0].Video.ViewLogs) != 1 || results[0].Video.ViewLogs[0].Views != 1000 {
+		t.Errorf("TestAddVideosAddedMeanwhile: expected video1 to be already added, got %+v", results)
+	}
+}
+
+func TestUnmigratedVideosAreScanned(t *testing.T) {
+	_, fake := newTestVideos(t)
+	if _, err := dynamodb.EnsureTable(videos.SCHEMA, dynamodb.WithClient(fake)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Saved before the indexes, it has no PollBucket so the poll index doesn't know about it
+	raw, _ := attributevalue.MarshalMap(map[string]interface{}{
+		"Id":         "video1",
+		"Title":      "Old video",
+		"Channel":    map[string]interface{}{"Id": "UC1", "Title": "Channel"},
+		"NextPollAt": time.Now().Add(-time.Hour).Unix(),
+	})
+	if _, err := fake.PutItem(context.Background(), &awsdynamodb.PutItemInput{TableName: aws.String(videos.TABLE), Item: raw}); err != nil {
+		t.Fatal(err)
+	}
+
+	videoLib, err := videos.NewVideos()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		due, err := videoLib.GetDueVideos(time.Now())
+		if err != nil || len(due) != 1 || due[0].Id != "video1" {
+			t.Errorf("TestUnmigratedVideosAreScanned: expected the old video to be due, got %+v, %v", due, err)
+		}
+
+		channelVideos, err := videoLib.GetChannelVideos("UC1")
+		if err != nil || len(channelVideos) != 1 {
+			t.Errorf("TestUnmigratedVideosAreScanned: expected the old video in its channel, got %+v, %v", channelVideos, err)
+		}
+	}
+
+	// Once migrated the indexes are used
+	store, _ := dynamodb.NewDynamoDB[videos.VideoDdbAttributes](videos.TABLE)
+	if _, err := migrate.Run(store, videos.MIGRATIONS, migrate.Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	videoLib.GetDueVideos(time.Now())
+	scans := fake.Calls("Scan")
+
+	due, err := videoLib.GetDueVideos(time.Now())
+	if err != nil || len(due) != 1 {
+		t.Errorf("TestUnmigratedVideosAreScanned: expected the migrated video to be due, got %+v, %v", due, err)
+	}
+	if fake.Calls("Scan") != scans {
+		t.Errorf("TestUnmigratedVideosAreScanned: expected the index to be queried once every video is migrated")
+	}
+}
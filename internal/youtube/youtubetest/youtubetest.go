@@ -0,0 +1,143 @@
+// Package youtubetest serves a fake Youtube Data API so tests never call Youtube.
+package youtubetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	youtube_api "google.golang.org/api/youtube/v3"
+)
+
+// Server answers videos.list with the scripted videos, unknown ids get an empty list like deleted videos do
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	videos   map[string]*youtube_api.Video
+	failures []int
+	requests int
+}
+
+func NewServer() *Server {
+	s := &Server{videos: map[string]*youtube_api.Video{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+// Endpoint to give youtube.WithEndpoint or BLACK_FLAG_YOUTUBE_ENDPOINT
+func (s *Server) Endpoint() string {
+	return s.URL + "/"
+}
+
+// Adds or replaces a video with the given stats
+func (s *Server) AddVideo(id, title, channelId, channelTitle, publishedAt string, views uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.videos[id] = &youtube_api.Video{
+		Id: id,
+		Snippet: &youtube_api.VideoSnippet{
+			Title:        title,
+			ChannelId:    channelId,
+			ChannelTitle: channelTitle,
+			PublishedAt:  publishedAt,
+		},
+		Statistics: &youtube_api.VideoStatistics{ViewCount: views},
+	}
+}
+
+// Changes the views of a video that was added before
+func (s *Server) SetViews(id string, views uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if video, ok := s.videos[id]; ok {
+		video.Statistics.ViewCount = views
+	}
+}
+
+// Removes the video as if it was deleted or made private
+func (s *Server) RemoveVideo(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.videos, id)
+}
+
+// Makes the next request fail with the quota error Youtube sends once the daily quota is used up
+func (s *Server) FailNextWithQuotaExceeded() {
+	s.FailNext(http.StatusForbidden)
+}
+
+// Makes the next request fail with the status
+func (s *Server) FailNext(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, status)
+}
+
+// Number of requests received so far
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+
+	if len(s.failures) > 0 {
+		status := s.failures[0]
+		s.failures = s.failures[1:]
+
+		writeError(w, status)
+		return
+	}
+
+	if r.URL.Path != "/youtube/v3/videos" {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+
+	response := youtube_api.VideoListResponse{Kind: "youtube#videoListResponse", Items: []*youtube_api.Video{}}
+	for _, id := range strings.Split(r.URL.Query().Get("id"), ",") {
+		if video, ok := s.videos[id]; ok {
+			response.Items = append(response.Items, video)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func writeError(w http.ResponseWriter, status int) {
+	reason, message := "notFound", "Not Found"
+	switch status {
+	case http.StatusForbidden:
+		reason = "quotaExceeded"
+		message = "The request cannot be completed because you have exceeded your quota."
+	case http.StatusInternalServerError:
+		reason, message = "backendError", "Backend Error"
+	}
+
+	body := map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    status,
+			"message": message,
+			"errors":  []map[string]string{{"message": message, "domain": "youtube.quota", "reason": reason}},
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}